@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/felo/eml-viewer/internal/config"
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/export"
+	"github.com/felo/eml-viewer/internal/imapimport"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/felo/eml-viewer/internal/integrity"
+	"github.com/felo/eml-viewer/internal/network"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/pii"
+)
+
+// command is a CLI subcommand run instead of the web server
+type command struct {
+	name  string
+	usage string
+	run   func(cfg *config.Config, args []string) error
+}
+
+// commands lists the available CLI subcommands
+var commands = []command{
+	{"export", "export search results as mbox, zip, csv or redacted renderings", runExport},
+	{"produce", "create a Bates-numbered production with DAT/OPT load files", runProduce},
+	{"verify", "re-hash files and report missing, altered or new emails", runVerify},
+	{"manifest", "write or check a signed manifest of intake hashes", runManifest},
+	{"network", "export the correspondence graph as GraphML, GEXF or JSON", runNetwork},
+	{"pii", "scan emails for sensitive data and print a report", runPII},
+	{"migrate", "show, apply or roll back database schema migrations", runMigrate},
+	{"import", "download folders from an IMAP account and index them", runImport},
+}
+
+// findCommand returns the subcommand with the given name, or nil
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printUsage lists the available subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [-collection name] [command] [flags]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(w, "Without a command the web interface is started.")
+	fmt.Fprintln(w, "Commands use the first collection unless -collection names another.")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+// openDatabase opens the configured database for CLI commands
+func openDatabase(cfg *config.Config) (*db.DB, error) {
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	database.SetEmailsPath(cfg.EmailsPath)
+	return database, nil
+}
+
+// addFilterFlags registers the standard search filter flags on a flag set
+func addFilterFlags(fs *flag.FlagSet, f *db.SearchFilters) {
+	fs.StringVar(&f.Query, "q", "", "full-text search query")
+	fs.StringVar(&f.Sender, "sender", "", "sender address contains")
+	fs.StringVar(&f.Recipient, "recipient", "", "recipient address contains")
+	fs.BoolVar(&f.HasAttachments, "has-attachments", false, "only emails with attachments")
+	fs.StringVar(&f.DateFrom, "from", "", "earliest date (YYYY-MM-DD)")
+	fs.StringVar(&f.DateTo, "to", "", "latest date (YYYY-MM-DD)")
+	fs.BoolVar(&f.CollapseDuplicates, "collapse-duplicates", false, "only the first copy of duplicate messages")
+	fs.StringVar(&f.Sensitive, "sensitive", "", "only emails with sensitive data of a type, or \"any\"")
+	fs.StringVar(&f.Link, "link", "", "only emails with a link whose URL contains this")
+	fs.StringVar(&f.Domain, "domain", "", "only emails linking to this domain or its subdomains")
+	fs.StringVar(&f.Auth, "auth", "", "only emails whose authentication verdict is pass, fail or none")
+	fs.BoolVar(&f.DateUncertain, "date-uncertain", false, "only emails whose Date header was missing or invalid")
+}
+
+// runExport implements the "export" command
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "mbox", "output format: mbox, zip, csv, redacted-txt or redacted-html")
+	output := fs.String("o", "", "output file (default stdout)")
+	var filters db.SearchFilters
+	addFilterFlags(fs, &filters)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	result, err := export.NewExporter(database).Export(w, format, filters)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d emails (%d skipped)\n", result.Exported, result.Skipped)
+	return nil
+}
+
+// runNetwork implements the "network" command
+func runNetwork(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("network", flag.ContinueOnError)
+	formatName := fs.String("format", "graphml", "output format: graphml, gexf or json")
+	output := fs.String("o", "", "output file (default stdout)")
+	maxNodes := fs.Int("max-nodes", 0, "keep only the busiest addresses (0 for all)")
+	minWeight := fs.Int("min-weight", 1, "minimum emails per link")
+	var filters db.SearchFilters
+	addFilterFlags(fs, &filters)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := network.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	rows, err := database.GetCorrespondence(filters)
+	if err != nil {
+		return err
+	}
+	g := network.Build(rows).Prune(*maxNodes, *minWeight)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := network.Write(w, g, format); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d addresses and %d links\n", len(g.Nodes), len(g.Edges))
+	return nil
+}
+
+// runPII implements the "pii" command
+func runPII(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("pii", flag.ContinueOnError)
+	rescan := fs.Bool("rescan", false, "discard previous findings and scan every email again")
+	var filters db.SearchFilters
+	addFilterFlags(fs, &filters)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := filters.Validate(); err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	result, err := indexer.NewIndexer(database, cfg.EmailsPath, false).ScanSensitiveData(*rescan, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Scanned %d emails (%d failed)\n", result.Scanned, result.Failed)
+
+	report, err := database.GetPIIReport(filters)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d of %d emails contain sensitive data\n", report.Flagged, report.Total)
+	for _, c := range report.ByType {
+		fmt.Printf("  %-14s %6d emails %8d findings\n", pii.Type(c.Type).Label(), c.Emails, c.Findings)
+	}
+	return nil
+}
+
+// runProduce implements the "produce" command
+func runProduce(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+	var opts export.ProductionOptions
+	fs.StringVar(&opts.Name, "name", "", "production name (required)")
+	fs.StringVar(&opts.Prefix, "prefix", "", "Bates prefix (required)")
+	fs.StringVar(&opts.Custodian, "custodian", "", "custodian name")
+	fs.StringVar(&opts.Volume, "volume", "VOL001", "volume label for the OPT file")
+	fs.Int64Var(&opts.StartNumber, "start", 0, "first Bates number (default next unused)")
+	output := fs.String("o", "", "output zip file (required)")
+	var filters db.SearchFilters
+	addFilterFlags(fs, &filters)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		return fmt.Errorf("-o is required")
+	}
+	if err := filters.Validate(); err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	result, err := export.NewProducer(database).Produce(f, opts, filters)
+	if err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+
+	p := result.Production
+	fmt.Fprintf(os.Stderr, "Produced %s through %s: %d emails, %d attachments (%d skipped)\n",
+		export.FormatBates(p.Prefix, p.StartNumber), export.FormatBates(p.Prefix, p.EndNumber),
+		result.Emails, result.Attachments, len(result.SkippedFiles))
+	return nil
+}
+
+// runVerify implements the "verify" command; it fails if the collection changed
+func runVerify(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	report, err := integrity.NewVerifier(database, cfg.EmailsPath).Verify()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range report.Altered {
+		fmt.Printf("ALTERED  %s (intake %s, now %s)\n", f.Path, f.ExpectedHash, f.ActualHash)
+	}
+	for _, f := range report.Missing {
+		fmt.Printf("MISSING  %s\n", f)
+	}
+	for _, f := range report.Unreadable {
+		fmt.Printf("UNREADABLE %s (%s)\n", f.Path, f.Error)
+	}
+	for _, f := range report.New {
+		fmt.Printf("NEW      %s\n", f)
+	}
+	for _, f := range report.Unhashed {
+		fmt.Printf("UNHASHED %s\n", f)
+	}
+	fmt.Printf("%d indexed, %d verified, %d altered, %d missing, %d unreadable, %d new, %d not hashed\n",
+		report.Indexed, report.Verified, len(report.Altered), len(report.Missing), len(report.Unreadable), len(report.New), len(report.Unhashed))
+
+	if !report.OK() {
+		return fmt.Errorf("collection has changed since intake")
+	}
+	return nil
+}
+
+// runManifest implements the "manifest" command
+func runManifest(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	output := fs.String("o", "", "output file (default stdout)")
+	check := fs.String("check", "", "verify the signature of an existing manifest file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *check != "" {
+		data, err := os.ReadFile(*check)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+		m, pub, err := integrity.CheckSignature(data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signature valid (key fingerprint %s): %d emails generated %s\n",
+			integrity.Fingerprint(pub), m.EmailCount, m.GeneratedAt.Format("2006-01-02 15:04:05 MST"))
+		return nil
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	m, fingerprint, err := integrity.WriteSignedManifest(database, w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Signed manifest of %d emails (key fingerprint %s)\n", m.EmailCount, fingerprint)
+	return nil
+}
+
+// runMigrate implements the "migrate" command: "status" (the default), "up"
+// or "down", with -to choosing the target version
+func runMigrate(cfg *config.Config, args []string) error {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	to := fs.Int("to", -1, "target version (default latest for up, one before current for down)")
+	noBackup := fs.Bool("no-backup", false, "skip the backup taken before changing the schema")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database, err := db.OpenUnmigrated(cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	current, err := database.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "status":
+		migrations, err := database.Migrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			if !m.Reversible {
+				state += " (cannot be rolled back)"
+			}
+			fmt.Printf("%4d  %-28s %s\n", m.Version, m.Name, state)
+		}
+		fmt.Printf("Schema version %d of %d\n", current, db.LatestSchemaVersion())
+		return nil
+
+	case "up", "down":
+		target := *to
+		if target < 0 {
+			target = db.LatestSchemaVersion()
+			if action == "down" {
+				target = current - 1
+			}
+		}
+		if (action == "up" && target <= current) || (action == "down" && target >= current) {
+			fmt.Fprintf(os.Stderr, "Nothing to do: schema version is %d\n", current)
+			return nil
+		}
+
+		if !*noBackup {
+			backup, err := database.BackupBeforeMigrating()
+			if err != nil {
+				return err
+			}
+			if backup != "" {
+				fmt.Fprintf(os.Stderr, "Backed up database to %s\n", backup)
+			}
+		}
+
+		var count int
+		if action == "up" {
+			count, err = database.Migrate(target)
+			fmt.Fprintf(os.Stderr, "Applied %d migrations\n", count)
+		} else {
+			count, err = database.Rollback(target)
+			fmt.Fprintf(os.Stderr, "Rolled back %d migrations\n", count)
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown action %q: use status, up or down", action)
+	}
+}
+
+// runImport implements the "import" command: "import imap" downloads
+// folders from an IMAP account into the emails folder and indexes them
+func runImport(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "imap" {
+		return fmt.Errorf("usage: import imap -server host:port -user name [flags]")
+	}
+	fs := flag.NewFlagSet("import imap", flag.ContinueOnError)
+	server := fs.String("server", "", "IMAP server as host:port, such as imap.example.com:993")
+	user := fs.String("user", "", "account user name")
+	passwordEnv := fs.String("password-env", "IMAP_PASSWORD", "environment variable holding the password")
+	folders := fs.String("folders", "", "comma-separated folders to import (default all)")
+	useTLS := fs.Bool("tls", true, "connect over TLS")
+	insecure := fs.Bool("insecure", false, "accept any TLS certificate")
+	noIndex := fs.Bool("no-index", false, "download only, leaving indexing to the next scan")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *server == "" || *user == "" {
+		return fmt.Errorf("-server and -user are required")
+	}
+	password := os.Getenv(*passwordEnv)
+	if password == "" {
+		return fmt.Errorf("set the password in the %s environment variable", *passwordEnv)
+	}
+
+	opts := imapimport.Options{
+		Addr:               *server,
+		TLS:                *useTLS,
+		InsecureSkipVerify: *insecure,
+		User:               *user,
+		Password:           password,
+	}
+	for _, f := range strings.Split(*folders, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			opts.Folders = append(opts.Folders, f)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %w", err)
+	}
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Ctrl-C stops between messages; running again resumes
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	result, importErr := imapimport.New(database, cfg.EmailsPath, opts).Run(ctx)
+	stop()
+	if result != nil {
+		fmt.Fprintf(os.Stderr, "Imported %d folders: %d emails downloaded, %d already in the archive\n",
+			result.Folders, result.Downloaded, result.Skipped)
+	}
+	// Emails downloaded before a failure or Ctrl-C are indexed too, as the
+	// next run resumes after them
+	if result == nil || *noIndex || len(result.Files) == 0 {
+		return importErr
+	}
+
+	// A second Ctrl-C stops the indexing; the next scan picks up the rest
+	ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	keys, err := parser.LoadDKIMKeys(cfg.DKIMKeysPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load DKIM keys: %v\n", err)
+	}
+	indexed, err := indexer.NewIndexer(database, cfg.EmailsPath, false).
+		WithPIIScan(cfg.ScanPII).
+		WithDKIMKeys(keys).
+		IndexFilesContext(ctx, result.Files, nil)
+	if err != nil {
+		if importErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to index the downloaded emails: %v\n", err)
+			return importErr
+		}
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Indexed %d new emails (%d failed)\n", indexed.NewIndexed, indexed.Failed)
+	return importErr
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultCollection names the single collection used when no collections
+// file exists
+const DefaultCollection = "default"
+
+// Collection is a named archive with its own emails folder and database
+type Collection struct {
+	Name       string `json:"name"`
+	EmailsPath string `json:"emails"`
+	DBPath     string `json:"db"`
+}
+
+// collectionName restricts names to what fits in a cookie and a URL unescaped
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// LoadCollections reads the collections file, a JSON array such as
+//
+//	[{"name": "acme", "emails": "./acme/emails", "db": "./acme/db/emails.db"}]
+//
+// Relative paths are resolved against the file's folder. A missing file
+// gives one collection, DefaultCollection, using EmailsPath and DBPath.
+func (c *Config) LoadCollections() ([]Collection, error) {
+	defaults := []Collection{{Name: DefaultCollection, EmailsPath: c.EmailsPath, DBPath: c.DBPath}}
+	if c.CollectionsPath == "" {
+		return defaults, nil
+	}
+	data, err := os.ReadFile(c.CollectionsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaults, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collections file: %w", err)
+	}
+
+	var collections []Collection
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, fmt.Errorf("failed to parse collections file: %w", err)
+	}
+	if len(collections) == 0 {
+		return nil, errors.New("collections file lists no collections")
+	}
+
+	dir := filepath.Dir(c.CollectionsPath)
+	seen := make(map[string]bool)
+	dbs := make(map[string]string)
+	for i := range collections {
+		col := &collections[i]
+		if !collectionName.MatchString(col.Name) {
+			return nil, fmt.Errorf("invalid collection name %q: use letters, digits, - and _", col.Name)
+		}
+		if seen[col.Name] {
+			return nil, fmt.Errorf("duplicate collection %q", col.Name)
+		}
+		seen[col.Name] = true
+		if col.EmailsPath == "" || col.DBPath == "" {
+			return nil, fmt.Errorf("collection %q needs both an emails folder and a db path", col.Name)
+		}
+		if !filepath.IsAbs(col.EmailsPath) {
+			col.EmailsPath = filepath.Join(dir, col.EmailsPath)
+		}
+		if !filepath.IsAbs(col.DBPath) {
+			col.DBPath = filepath.Join(dir, col.DBPath)
+		}
+		if other, ok := dbs[filepath.Clean(col.DBPath)]; ok {
+			return nil, fmt.Errorf("collections %q and %q share a database", other, col.Name)
+		}
+		dbs[filepath.Clean(col.DBPath)] = col.Name
+	}
+	return collections, nil
+}
+
+// FindCollection returns the collection with the given name, or nil
+func FindCollection(collections []Collection, name string) *Collection {
+	for i := range collections {
+		if collections[i].Name == name {
+			return &collections[i]
+		}
+	}
+	return nil
+}
+
+// ForCollection returns a copy of the configuration using a collection's
+// emails folder and database
+func (c *Config) ForCollection(col Collection) *Config {
+	copied := *c
+	copied.EmailsPath = col.EmailsPath
+	copied.DBPath = col.DBPath
+	return &copied
+}
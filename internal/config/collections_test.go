@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadCollections tests reading and validating the collections file
+func TestLoadCollections(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Default()
+	cfg.CollectionsPath = filepath.Join(dir, "collections.json")
+
+	// Without the file the configured folder and database are the only collection
+	collections, err := cfg.LoadCollections()
+	require.NoError(t, err)
+	require.Len(t, collections, 1)
+	assert.Equal(t, DefaultCollection, collections[0].Name)
+	assert.Equal(t, cfg.EmailsPath, collections[0].EmailsPath)
+
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(cfg.CollectionsPath, []byte(content), 0644))
+	}
+
+	write(`[{"name": "acme", "emails": "acme/emails", "db": "/data/acme.db"},
+	        {"name": "globex", "emails": "globex/emails", "db": "globex/emails.db"}]`)
+	collections, err = cfg.LoadCollections()
+	require.NoError(t, err)
+	require.Len(t, collections, 2)
+	assert.Equal(t, filepath.Join(dir, "acme", "emails"), collections[0].EmailsPath, "Relative to the file")
+	assert.Equal(t, "/data/acme.db", collections[0].DBPath)
+	require.NotNil(t, FindCollection(collections, "globex"))
+	assert.Nil(t, FindCollection(collections, "initech"))
+
+	scoped := cfg.ForCollection(collections[1])
+	assert.Equal(t, collections[1].DBPath, scoped.DBPath)
+	assert.Equal(t, "./db/emails.db", cfg.DBPath, "Original left alone")
+
+	for content, want := range map[string]string{
+		`[]`: "no collections",
+		`[{"name": "a b", "emails": "e", "db": "d"}]`:                                          "invalid collection name",
+		`[{"name": "a", "emails": "e", "db": "d"}, {"name": "a", "emails": "f", "db": "g"}]`:   "duplicate collection",
+		`[{"name": "a", "emails": "e"}]`:                                                       "needs both",
+		`[{"name": "a", "emails": "e", "db": "d"}, {"name": "b", "emails": "f", "db": "./d"}]`: "share a database",
+		`{`: "failed to parse",
+	} {
+		write(content)
+		_, err := cfg.LoadCollections()
+		assert.ErrorContains(t, err, want, content)
+	}
+}
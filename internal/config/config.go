@@ -1,6 +1,9 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Config holds application configuration
 type Config struct {
@@ -8,26 +11,68 @@ type Config struct {
 	Host string
 	Port string
 
+	// Port of the read-only IMAP server on Host; empty disables it
+	IMAPPort string
+
 	// Database settings
 	DBPath string
 
 	// Email folder settings
 	EmailsPath string
 
+	// Optional file of named collections, each with its own emails folder
+	// and database; without it EmailsPath and DBPath are the only collection
+	CollectionsPath string
+
 	// Authentication settings
 	RequireAuth bool
 	AuthToken   string
+
+	// Near-duplicate detection settings
+	SimilarityThreshold float64 // Minimum body similarity (0-1) for emails to count as near-duplicates
+
+	// Sensitive data settings
+	ScanPII bool // Scan new emails for credit cards, IBANs, IDs, phone numbers, keys and passwords while indexing; off by default as it slows indexing
+
+	// Email authentication settings
+	DKIMKeysPath string // Optional file of DKIM public key records for offline signature verification
+
+	// Background maintenance intervals; zero disables a task
+	ScanInterval       time.Duration // Incremental scan for new .eml files
+	AnalyzeInterval    time.Duration // ANALYZE to refresh query planner statistics
+	OptimizeInterval   time.Duration // FTS5 optimize to merge search index segments
+	IntegrityInterval  time.Duration // SQLite integrity check
+	CheckpointInterval time.Duration // WAL checkpoint to keep the log file small
+
+	// Pause between emails when re-parsing those indexed by an older version,
+	// so the UI stays responsive
+	ReparseWait time.Duration
 }
 
 // Default returns default configuration
 func Default() *Config {
 	return &Config{
-		Host:        "localhost",
-		Port:        "8787",
-		DBPath:      "./db/emails.db", // Database in ./db folder
-		EmailsPath:  "./emails",       // Emails in ./emails folder
-		RequireAuth: false,            // Authentication disabled by default
-		AuthToken:   "",               // No token by default
+		Host:            "localhost",
+		Port:            "8787",
+		IMAPPort:        "",                   // IMAP server disabled by default
+		DBPath:          "./db/emails.db",     // Database in ./db folder
+		EmailsPath:      "./emails",           // Emails in ./emails folder
+		CollectionsPath: "./collections.json", // Used only if the file exists
+		RequireAuth:     false,                // Authentication disabled by default
+		AuthToken:       "",                   // No token by default
+
+		SimilarityThreshold: 0.8,   // Bodies sharing 80% of their shingles are near-duplicates
+		ScanPII:             false, // Enabled with EML_VIEWER_SCAN_PII=true
+
+		DKIMKeysPath: "./dkim_keys.txt", // Used only if the file exists
+
+		ScanInterval:       15 * time.Minute,
+		AnalyzeInterval:    24 * time.Hour,
+		OptimizeInterval:   24 * time.Hour,
+		IntegrityInterval:  7 * 24 * time.Hour,
+		CheckpointInterval: time.Hour,
+
+		ReparseWait: 20 * time.Millisecond,
 	}
 }
 
@@ -36,6 +81,11 @@ func (c *Config) Address() string {
 	return c.Host + ":" + c.Port
 }
 
+// IMAPAddress returns the IMAP server's address
+func (c *Config) IMAPAddress() string {
+	return c.Host + ":" + c.IMAPPort
+}
+
 // URL returns the full server URL
 func (c *Config) URL() string {
 	return "http://" + c.Address()
@@ -53,5 +103,15 @@ func (c *Config) Validate() error {
 		return errors.New("auth token must be set when authentication is required")
 	}
 
+	if c.SimilarityThreshold <= 0 || c.SimilarityThreshold > 1 {
+		return errors.New("similarity threshold must be greater than 0 and at most 1")
+	}
+
+	for _, interval := range []time.Duration{c.ScanInterval, c.AnalyzeInterval, c.OptimizeInterval, c.IntegrityInterval, c.CheckpointInterval} {
+		if interval != 0 && interval < time.Minute {
+			return errors.New("maintenance intervals must be zero (disabled) or at least a minute")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables that override the defaults at startup
+const (
+	EnvScanPII  = "EML_VIEWER_SCAN_PII"  // "true" scans new emails for sensitive data while indexing
+	EnvIMAPPort = "EML_VIEWER_IMAP_PORT" // Port for the read-only IMAP server, which is off without it
+)
+
+// LoadEnv applies settings given as environment variables
+func (c *Config) LoadEnv() error {
+	if v := os.Getenv(EnvScanPII); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: use true or false", EnvScanPII, v)
+		}
+		c.ScanPII = enabled
+	}
+	if v := os.Getenv(EnvIMAPPort); v != "" {
+		if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid %s %q: use a port number from 1 to 65535", EnvIMAPPort, v)
+		}
+		c.IMAPPort = v
+	}
+	return nil
+}
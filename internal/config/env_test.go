@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadEnv tests overriding defaults with environment variables
+func TestLoadEnv(t *testing.T) {
+	cfg := Default()
+	require.NoError(t, cfg.LoadEnv())
+	assert.False(t, cfg.ScanPII, "The PII scan is off unless enabled")
+
+	t.Setenv(EnvScanPII, "true")
+	require.NoError(t, cfg.LoadEnv())
+	assert.True(t, cfg.ScanPII)
+
+	t.Setenv(EnvScanPII, "sometimes")
+	assert.ErrorContains(t, cfg.LoadEnv(), EnvScanPII)
+	t.Setenv(EnvScanPII, "")
+
+	// The IMAP server is off until a port is given
+	assert.Empty(t, cfg.IMAPPort)
+	t.Setenv(EnvIMAPPort, "1143")
+	require.NoError(t, cfg.LoadEnv())
+	assert.Equal(t, "1143", cfg.IMAPPort)
+	assert.Equal(t, "localhost:1143", cfg.IMAPAddress())
+
+	for _, port := range []string{"imap", "0", "70000"} {
+		t.Setenv(EnvIMAPPort, port)
+		assert.ErrorContains(t, cfg.LoadEnv(), EnvIMAPPort, port)
+	}
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Volume granularities
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// maxFilledBuckets is the longest timeline whose empty periods are filled in;
+// longer ones (usually caused by a few bogus dates) only list non-empty periods
+const maxFilledBuckets = 3660
+
+// periodExpr returns the SQL expression for the first day (YYYY-MM-DD) of the
+// period containing e.date. Dates are bucketed as written in the Date header,
+// matching how the date filters compare them.
+func periodExpr(granularity string) (string, error) {
+	switch granularity {
+	case GranularityDay:
+		return "substr(e.date, 1, 10)", nil
+	case GranularityWeek:
+		// The Monday on or before the date
+		return "date(substr(e.date, 1, 10), '-6 days', 'weekday 1')", nil
+	case GranularityMonth:
+		return "substr(e.date, 1, 7) || '-01'", nil
+	}
+	return "", fmt.Errorf("unknown granularity %q", granularity)
+}
+
+// VolumeBucket is the number of emails in one period of a timeline
+type VolumeBucket struct {
+	Start    time.Time
+	DateFrom string // First day of the period (YYYY-MM-DD)
+	DateTo   string // Last day of the period (YYYY-MM-DD)
+	Count    int
+}
+
+// Label returns a human-readable name for the period
+func (b *VolumeBucket) Label(granularity string) string {
+	switch granularity {
+	case GranularityWeek:
+		return "Week of " + b.Start.Format("Jan 2, 2006")
+	case GranularityMonth:
+		return b.Start.Format("Jan 2006")
+	}
+	return b.Start.Format("Jan 2, 2006")
+}
+
+// nextPeriod returns the start of the period after start
+func nextPeriod(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// newVolumeBucket creates an empty bucket for the period starting at start
+func newVolumeBucket(start time.Time, granularity string) *VolumeBucket {
+	return &VolumeBucket{
+		Start:    start,
+		DateFrom: start.Format("2006-01-02"),
+		DateTo:   nextPeriod(start, granularity).AddDate(0, 0, -1).Format("2006-01-02"),
+	}
+}
+
+// GetVolume counts emails matching a filter set per day, week or month, in
+// date order. Periods without email between the first and last are included
+// with a zero count.
+func (db *DB) GetVolume(f SearchFilters, granularity string) ([]*VolumeBucket, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	period, err := periodExpr(granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	from, args := f.from("e.date IS NOT NULL")
+	rows, err := db.Query("SELECT "+period+" AS period, COUNT(*)"+from+" GROUP BY period ORDER BY period", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count volume: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []*VolumeBucket
+	for rows.Next() {
+		var start string
+		var count int
+		if err := rows.Scan(&start, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		t, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			continue // Unparseable stored date
+		}
+		b := newVolumeBucket(t, granularity)
+		b.Count = count
+		buckets = append(buckets, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating volume: %w", err)
+	}
+
+	return fillVolumeGaps(buckets, granularity), nil
+}
+
+// fillVolumeGaps inserts empty buckets for periods without email
+func fillVolumeGaps(buckets []*VolumeBucket, granularity string) []*VolumeBucket {
+	if len(buckets) < 2 {
+		return buckets
+	}
+
+	var filled []*VolumeBucket
+	start := buckets[0].Start
+	for _, b := range buckets {
+		for start.Before(b.Start) {
+			if len(filled) >= maxFilledBuckets {
+				return buckets
+			}
+			filled = append(filled, newVolumeBucket(start, granularity))
+			start = nextPeriod(start, granularity)
+		}
+		filled = append(filled, b)
+		start = nextPeriod(b.Start, granularity)
+	}
+	return filled
+}
+
+// GetActivityHeatmap counts emails matching a filter set by weekday (0 =
+// Sunday) and hour of day, in the sender's local time as written in the Date header
+func (db *DB) GetActivityHeatmap(f SearchFilters) ([7][24]int, error) {
+	var heatmap [7][24]int
+	if err := f.Validate(); err != nil {
+		return heatmap, err
+	}
+
+	from, args := f.from("e.date IS NOT NULL")
+	rows, err := db.Query(`
+		SELECT CAST(strftime('%w', substr(e.date, 1, 10)) AS INTEGER) AS weekday,
+		       CAST(substr(e.date, 12, 2) AS INTEGER) AS hour,
+		       COUNT(*)`+from+`
+		GROUP BY weekday, hour
+	`, args...)
+	if err != nil {
+		return heatmap, fmt.Errorf("failed to count activity: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var weekday, hour, count int
+		if err := rows.Scan(&weekday, &hour, &count); err != nil {
+			return heatmap, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		if weekday >= 0 && weekday < 7 && hour >= 0 && hour < 24 {
+			heatmap[weekday][hour] += count
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return heatmap, fmt.Errorf("error iterating activity: %w", err)
+	}
+
+	return heatmap, nil
+}
+
+// CountEntry is a value with the number of emails it appears in
+type CountEntry struct {
+	Key   string
+	Name  string // Display name, if any
+	Count int
+}
+
+// GetTopSenders retrieves the senders of the most emails matching a filter set
+func (db *DB) GetTopSenders(f SearchFilters, limit int) ([]*CountEntry, error) {
+	return db.topCounts(f, "LOWER(e.sender)", "MAX(COALESCE(e.sender_name, ''))", limit)
+}
+
+// GetTopSenderDomains retrieves the sender domains of the most emails matching a filter set
+func (db *DB) GetTopSenderDomains(f SearchFilters, limit int) ([]*CountEntry, error) {
+	return db.topCounts(f, "LOWER(SUBSTR(e.sender, INSTR(e.sender, '@') + 1))", "''", limit,
+		"INSTR(e.sender, '@') > 0")
+}
+
+// topCounts groups filtered emails by an expression and returns the largest groups
+func (db *DB) topCounts(f SearchFilters, keyExpr, nameExpr string, limit int, extra ...string) ([]*CountEntry, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	from, args := f.from(append([]string{"e.sender <> ''"}, extra...)...)
+	args = append(args, limit)
+	rows, err := db.Query("SELECT "+keyExpr+" AS k, "+nameExpr+", COUNT(*) AS c"+from+
+		" GROUP BY k ORDER BY c DESC, k ASC LIMIT ?", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count top values: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*CountEntry
+	for rows.Next() {
+		e := &CountEntry{}
+		if err := rows.Scan(&e.Key, &e.Name, &e.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan top value: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating top values: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// insertAnalyticsFixtures inserts emails spread over two months, with a gap
+// in February, from two domains
+func insertAnalyticsFixtures(t *testing.T, db *DB) {
+	t.Helper()
+
+	undated := CreateTestEmail("Undated", "carol@acme.com", "e")
+	undated.Date = NullTime{}
+
+	est := time.FixedZone("EST", -5*3600)
+	InsertTestEmails(t, db, []*Email{
+		CreateTestEmailWithDate("Kickoff", "alice@acme.com", "a", time.Date(2024, 1, 8, 9, 15, 0, 0, est)),   // Monday
+		CreateTestEmailWithDate("Follow up", "alice@acme.com", "b", time.Date(2024, 1, 8, 9, 45, 0, 0, est)), // Monday
+		CreateTestEmailWithDate("Late", "bob@other.org", "c", time.Date(2024, 1, 13, 23, 5, 0, 0, est)),      // Saturday
+		CreateTestEmailWithDate("Spring", "alice@acme.com", "d", time.Date(2024, 3, 1, 14, 0, 0, 0, est)),    // Friday
+		undated,
+	})
+}
+
+// TestGetVolume tests bucketing by day, week and month with gaps filled
+func TestGetVolume(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertAnalyticsFixtures(t, db)
+
+	months, err := db.GetVolume(SearchFilters{}, GranularityMonth)
+	require.NoError(t, err)
+	require.Len(t, months, 3, "February is filled in")
+	assert.Equal(t, "2024-01-01", months[0].DateFrom)
+	assert.Equal(t, "2024-01-31", months[0].DateTo)
+	assert.Equal(t, 3, months[0].Count)
+	assert.Equal(t, 0, months[1].Count)
+	assert.Equal(t, 1, months[2].Count)
+	assert.Equal(t, "Jan 2024", months[0].Label(GranularityMonth))
+
+	weeks, err := db.GetVolume(SearchFilters{}, GranularityWeek)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-08", weeks[0].DateFrom, "Weeks start on Monday")
+	assert.Equal(t, "2024-01-14", weeks[0].DateTo)
+	assert.Equal(t, 3, weeks[0].Count)
+
+	days, err := db.GetVolume(SearchFilters{Sender: "bob"}, GranularityDay)
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+	assert.Equal(t, "2024-01-13", days[0].DateFrom)
+
+	_, err = db.GetVolume(SearchFilters{}, "year")
+	assert.Error(t, err)
+}
+
+// TestDateToIncludesWholeDay tests that drill-downs ending on a day include its emails
+func TestDateToIncludesWholeDay(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertAnalyticsFixtures(t, db)
+
+	count, err := db.CountFiltered(SearchFilters{DateFrom: "2024-01-08", DateTo: "2024-01-08"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// TestGetActivityHeatmap tests counting by weekday and local hour
+func TestGetActivityHeatmap(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertAnalyticsFixtures(t, db)
+
+	heatmap, err := db.GetActivityHeatmap(SearchFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, heatmap[1][9], "Monday 9am in the sender's time zone")
+	assert.Equal(t, 1, heatmap[6][23], "Saturday 11pm")
+	assert.Equal(t, 1, heatmap[5][14], "Friday 2pm")
+
+	heatmap, err = db.GetActivityHeatmap(SearchFilters{Query: "kickoff"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, heatmap[1][9])
+}
+
+// TestTopSendersAndDomains tests top counts for a filter set
+func TestTopSendersAndDomains(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertAnalyticsFixtures(t, db)
+
+	senders, err := db.GetTopSenders(SearchFilters{}, 10)
+	require.NoError(t, err)
+	require.Len(t, senders, 3)
+	assert.Equal(t, "alice@acme.com", senders[0].Key)
+	assert.Equal(t, 3, senders[0].Count)
+
+	domains, err := db.GetTopSenderDomains(SearchFilters{}, 1)
+	require.NoError(t, err)
+	require.Len(t, domains, 1)
+	assert.Equal(t, "acme.com", domains[0].Key)
+	assert.Equal(t, 4, domains[0].Count)
+
+	domains, err = db.GetTopSenderDomains(SearchFilters{DateFrom: "2024-01-10"}, 10)
+	require.NoError(t, err)
+	assert.Len(t, domains, 2)
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/parser"
+)
+
+// AttachmentReader streams an attachment's decoded content from its .eml
+// file. It is an io.ReadSeeker over the size recorded at indexing, so it can
+// be served with http.ServeContent: seeking forward skips decoded bytes and
+// seeking backward reads the file again from the start.
+type AttachmentReader struct {
+	Attachment *Attachment
+	ModTime    time.Time // Modification time of the .eml file
+
+	path string
+	file *os.File
+	body io.Reader
+	pos  int64 // Offset the next Read starts at
+	read int64 // Offset reached in body
+}
+
+// OpenAttachment opens an attachment for streaming. It returns nil, nil
+// when the attachment does not exist.
+func (db *DB) OpenAttachment(attachmentID int64) (*AttachmentReader, error) {
+	att, err := db.GetAttachmentByID(attachmentID)
+	if err != nil || att == nil {
+		return nil, err
+	}
+
+	email, err := db.GetEmailByID(att.EmailID)
+	if err != nil {
+		return nil, err
+	}
+	if email == nil {
+		return nil, fmt.Errorf("email not found for attachment")
+	}
+
+	absolutePath, err := db.ResolveEmailPath(email.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %w", err)
+	}
+
+	ar := &AttachmentReader{Attachment: att, path: absolutePath}
+	if err := ar.reopen(); err != nil {
+		return nil, err
+	}
+	if info, err := ar.file.Stat(); err == nil {
+		ar.ModTime = info.ModTime()
+	}
+	return ar, nil
+}
+
+// reopen starts reading the attachment from the beginning of the file
+func (ar *AttachmentReader) reopen() error {
+	if ar.file != nil {
+		ar.file.Close()
+		ar.file, ar.body = nil, nil
+	}
+
+	f, err := os.Open(ar.path)
+	if err != nil {
+		return fmt.Errorf("failed to open .eml file: %w", err)
+	}
+	body, err := parser.FindAttachment(f, ar.Attachment.Key())
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to find attachment %s in %s: %w", ar.Attachment.Filename, ar.path, err)
+	}
+	ar.file, ar.body, ar.read = f, body, 0
+	return nil
+}
+
+// Read reads decoded content from the current offset
+func (ar *AttachmentReader) Read(p []byte) (int, error) {
+	if ar.pos >= ar.Attachment.Size {
+		return 0, io.EOF
+	}
+	if ar.pos < ar.read || ar.body == nil {
+		if err := ar.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	if ar.pos > ar.read {
+		skipped, err := io.CopyN(io.Discard, ar.body, ar.pos-ar.read)
+		ar.read += skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if remaining := ar.Attachment.Size - ar.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := ar.body.Read(p)
+	ar.read += int64(n)
+	ar.pos = ar.read
+	if err == io.EOF && ar.pos < ar.Attachment.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read. Nothing is read until then.
+func (ar *AttachmentReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += ar.pos
+	case io.SeekEnd:
+		offset += ar.Attachment.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	ar.pos = offset
+	return offset, nil
+}
+
+// Close closes the .eml file
+func (ar *AttachmentReader) Close() error {
+	if ar.file == nil {
+		return nil
+	}
+	err := ar.file.Close()
+	ar.file, ar.body = nil, nil
+	return err
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// insertAttachmentEmail writes an email with a base64 attachment and indexes
+// its metadata
+func insertAttachmentEmail(t *testing.T, db *DB, data []byte) int64 {
+	t.Helper()
+
+	dir := t.TempDir()
+	db.SetEmailsPath(dir)
+	content := "From: sender@test.com\r\n" +
+		"Subject: Report\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nSee attached\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"report.bin\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(data) + "\r\n" +
+		"--b--\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "report.eml"), []byte(content), 0644))
+
+	email := CreateTestEmail("Report", "sender@test.com", "See attached")
+	email.FilePath = "report.eml"
+	emailID, err := db.InsertEmail(email)
+	require.NoError(t, err)
+	id, err := db.InsertAttachment(&Attachment{
+		EmailID:     emailID,
+		Filename:    "report.bin",
+		ContentType: "application/octet-stream",
+		Size:        int64(len(data)),
+	})
+	require.NoError(t, err)
+	return id
+}
+
+// TestOpenAttachment tests streaming and seeking within an attachment
+func TestOpenAttachment(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	id := insertAttachmentEmail(t, db, data)
+
+	ar, err := db.OpenAttachment(id)
+	require.NoError(t, err)
+	require.NotNil(t, ar)
+	defer ar.Close()
+	assert.Equal(t, "report.bin", ar.Attachment.Filename)
+
+	all, err := io.ReadAll(ar)
+	require.NoError(t, err)
+	assert.Equal(t, data, all)
+
+	// Seeking reports the recorded size and reads from any offset
+	size, err := ar.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	for _, offset := range []int64{50000, 12, 99995} {
+		_, err = ar.Seek(offset, io.SeekStart)
+		require.NoError(t, err)
+		part := make([]byte, 5)
+		_, err = io.ReadFull(ar, part)
+		require.NoError(t, err)
+		assert.Equal(t, data[offset:offset+5], part)
+	}
+}
+
+// TestOpenAttachmentMissing tests unknown attachments and damaged files
+func TestOpenAttachmentMissing(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	ar, err := db.OpenAttachment(999)
+	assert.NoError(t, err)
+	assert.Nil(t, ar)
+
+	id := insertAttachmentEmail(t, db, []byte("data"))
+	require.NoError(t, os.WriteFile(filepath.Join(db.emailsPath, "report.eml"), []byte("Subject: Gone\r\n\r\nNothing\r\n"), 0644))
+	_, err = db.OpenAttachment(id)
+	assert.ErrorContains(t, err, "attachment not found in email")
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,11 +16,35 @@ var ErrPathTraversal = errors.New("path traversal detected")
 
 type DB struct {
 	*sql.DB
+	path       string // Database file, for backups
 	emailsPath string // Root path for resolving relative .eml file paths
+
+	nearDuplicates nearDuplicateCache // Clusters computed since emails last changed
 }
 
-// Open opens a connection to the SQLite database and initializes the schema
+// Open opens a connection to the SQLite database and migrates its schema to
+// the latest version, backing up an existing database first
 func Open(dbPath string) (*DB, error) {
+	db, err := OpenUnmigrated(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	backup, err := db.migrateOnOpen()
+	if backup != "" {
+		log.Printf("Backed up database to %s before migrating", backup)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return db, nil
+}
+
+// OpenUnmigrated opens a connection to the SQLite database without touching
+// its schema, for inspecting and changing migrations
+func OpenUnmigrated(dbPath string) (*DB, error) {
 	// Ensure the directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -39,7 +64,8 @@ func Open(dbPath string) (*DB, error) {
 	sqlDB.SetMaxIdleConns(1)
 
 	db := &DB{
-		DB: sqlDB,
+		DB:   sqlDB,
+		path: dbPath,
 		// emailsPath will be set via SetEmailsPath after opening
 	}
 
@@ -49,12 +75,6 @@ func Open(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to enable performance pragmas: %w", err)
 	}
 
-	// Initialize schema
-	if err := db.initSchema(); err != nil {
-		sqlDB.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
-	}
-
 	return db, nil
 }
 
@@ -114,6 +134,19 @@ func (db *DB) ResolveEmailPath(relativePath string) (string, error) {
 	return absResolved, nil
 }
 
+// ReadRawEmail reads the bytes of an email's .eml file
+func (db *DB) ReadRawEmail(email *Email) ([]byte, error) {
+	absPath, err := db.ResolveEmailPath(email.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", email.FilePath, err)
+	}
+	return raw, nil
+}
+
 // enablePerformancePragmas sets SQLite PRAGMAs for optimal performance
 func (db *DB) enablePerformancePragmas() error {
 	pragmas := []string{
@@ -135,15 +168,6 @@ func (db *DB) enablePerformancePragmas() error {
 	return nil
 }
 
-// initSchema creates all tables, indexes, and triggers
-func (db *DB) initSchema() error {
-	_, err := db.Exec(schema)
-	if err != nil {
-		return fmt.Errorf("failed to execute schema: %w", err)
-	}
-	return nil
-}
-
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.DB.Close()
@@ -194,46 +218,73 @@ func (db *DB) Analyze() error {
 	return nil
 }
 
-// GetDatabaseSize returns the database file size in bytes
-func (db *DB) GetDatabaseSize() (int64, error) {
-	var pageCount, pageSize int64
-	err := db.QueryRow("PRAGMA page_count").Scan(&pageCount)
+// OptimizeFTS merges the full-text index's segments, which build up as
+// emails are added, so searches read fewer of them
+func (db *DB) OptimizeFTS() error {
+	_, err := db.Exec("INSERT INTO emails_fts(emails_fts) VALUES('optimize')")
 	if err != nil {
-		return 0, fmt.Errorf("failed to get page count: %w", err)
+		return fmt.Errorf("failed to optimize search index: %w", err)
 	}
+	return nil
+}
 
-	err = db.QueryRow("PRAGMA page_size").Scan(&pageSize)
+// IntegrityCheck runs SQLite's integrity check and returns the problems it
+// reports, or nil if the database is intact
+func (db *DB) IntegrityCheck() ([]string, error) {
+	rows, err := db.Query("PRAGMA integrity_check")
 	if err != nil {
-		return 0, fmt.Errorf("failed to get page size: %w", err)
+		return nil, fmt.Errorf("failed to check database integrity: %w", err)
 	}
+	defer rows.Close()
 
-	return pageCount * pageSize, nil
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating integrity check: %w", err)
+	}
+
+	return problems, nil
 }
 
-// MigrateToOptimizedSchema migrates an existing database to the optimized schema
-// This removes duplicate data (body_html, raw_headers, cc, bcc, attachment BLOBs)
-func (db *DB) MigrateToOptimizedSchema() error {
-	// Check if migration is needed by checking if old columns exist
-	var hasBodyHTML bool
-	err := db.QueryRow(`
-		SELECT COUNT(*) > 0
-		FROM pragma_table_info('emails')
-		WHERE name = 'body_html'
-	`).Scan(&hasBodyHTML)
+// CheckpointWAL copies the write-ahead log into the database file and
+// truncates it, returning how many log pages were written back
+func (db *DB) CheckpointWAL() (int, error) {
+	var busy, logPages, checkpointed int
+	err := db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logPages, &checkpointed)
 	if err != nil {
-		return fmt.Errorf("failed to check schema: %w", err)
+		return 0, fmt.Errorf("failed to checkpoint WAL: %w", err)
 	}
+	if busy != 0 {
+		return 0, errors.New("failed to checkpoint WAL: database busy")
+	}
+	if checkpointed < 0 {
+		// Not in WAL mode, e.g. an in-memory database
+		return 0, nil
+	}
+	return checkpointed, nil
+}
 
-	if !hasBodyHTML {
-		// Already migrated
-		return nil
+// GetDatabaseSize returns the database file size in bytes
+func (db *DB) GetDatabaseSize() (int64, error) {
+	var pageCount, pageSize int64
+	err := db.QueryRow("PRAGMA page_count").Scan(&pageCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get page count: %w", err)
 	}
 
-	// Run migration
-	_, err = db.Exec(migrationSchema)
+	err = db.QueryRow("PRAGMA page_size").Scan(&pageSize)
 	if err != nil {
-		return fmt.Errorf("failed to run migration: %w", err)
+		return 0, fmt.Errorf("failed to get page size: %w", err)
 	}
 
-	return nil
+	return pageCount * pageSize, nil
 }
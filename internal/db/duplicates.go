@@ -0,0 +1,211 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Duplicate match kinds
+const (
+	DuplicateByMessageID = "message-id"
+	DuplicateByContent   = "content"
+)
+
+// duplicateOfEarlier matches emails "e" that have an earlier copy, either with
+// the same Message-ID or the same normalized content hash. Collapsing keeps
+// the first-indexed copy of each message.
+const duplicateOfEarlier = `EXISTS (
+	SELECT 1 FROM emails d
+	WHERE d.id < e.id
+	  AND ((e.message_id <> '' AND d.message_id = e.message_id)
+	    OR (e.content_hash <> '' AND d.content_hash = e.content_hash))
+)`
+
+// DuplicateGroup is a set of emails that are copies of the same message
+type DuplicateGroup struct {
+	Kind   string // DuplicateByMessageID or DuplicateByContent
+	Key    string // The shared Message-ID or content hash
+	Emails []*Email
+}
+
+// DuplicateCopy is another copy of an email, with the reasons it matched
+type DuplicateCopy struct {
+	ID              int64
+	FilePath        string
+	Subject         string
+	Date            NullTime
+	SameMessageID   bool
+	SameContentHash bool
+}
+
+// DuplicateSummary counts duplicate groups and redundant copies
+type DuplicateSummary struct {
+	MessageIDGroups int
+	ContentGroups   int
+	RedundantCopies int // Emails hidden when duplicates are collapsed
+}
+
+// groupQuery returns the GROUP BY query selecting duplicate keys of a kind.
+// Content groups whose members all share one Message-ID are left out because
+// they are already reported as Message-ID duplicates.
+func groupQuery(kind string) (string, error) {
+	switch kind {
+	case DuplicateByMessageID:
+		return `
+			SELECT message_id, COUNT(*) AS copies FROM emails
+			WHERE message_id IS NOT NULL AND message_id <> ''
+			GROUP BY message_id
+			HAVING COUNT(*) > 1`, nil
+	case DuplicateByContent:
+		return `
+			SELECT content_hash, COUNT(*) AS copies FROM emails
+			WHERE content_hash IS NOT NULL AND content_hash <> ''
+			GROUP BY content_hash
+			HAVING COUNT(*) > 1
+			   AND (COUNT(DISTINCT message_id) > 1 OR SUM(COALESCE(message_id, '') = '') > 0)`, nil
+	}
+	return "", errors.New("unknown duplicate kind")
+}
+
+// GetDuplicateSummary counts duplicate groups of each kind and redundant copies
+func (db *DB) GetDuplicateSummary() (*DuplicateSummary, error) {
+	summary := &DuplicateSummary{}
+
+	for kind, count := range map[string]*int{
+		DuplicateByMessageID: &summary.MessageIDGroups,
+		DuplicateByContent:   &summary.ContentGroups,
+	} {
+		query, _ := groupQuery(kind)
+		if err := db.QueryRow("SELECT COUNT(*) FROM (" + query + ")").Scan(count); err != nil {
+			return nil, fmt.Errorf("failed to count duplicate groups: %w", err)
+		}
+	}
+
+	err := db.QueryRow("SELECT COUNT(*) FROM emails e WHERE " + duplicateOfEarlier).Scan(&summary.RedundantCopies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count redundant copies: %w", err)
+	}
+
+	return summary, nil
+}
+
+// ListDuplicateGroups retrieves duplicate groups of one kind, largest first
+func (db *DB) ListDuplicateGroups(kind string, limit, offset int) ([]*DuplicateGroup, error) {
+	query, err := groupQuery(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(query+" ORDER BY copies DESC, 1 ASC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate groups: %w", err)
+	}
+
+	var groups []*DuplicateGroup
+	for rows.Next() {
+		var copies int
+		g := &DuplicateGroup{Kind: kind}
+		if err := rows.Scan(&g.Key, &copies); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan duplicate group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating duplicate groups: %w", err)
+	}
+
+	// Load members once the group cursor is closed (single connection)
+	column := "message_id"
+	if kind == DuplicateByContent {
+		column = "content_hash"
+	}
+	for _, g := range groups {
+		g.Emails, err = db.listEmailsWhere(column+" = ?", g.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+// listEmailsWhere retrieves summary fields of emails matching a condition, in index order
+func (db *DB) listEmailsWhere(condition string, args ...interface{}) ([]*Email, error) {
+	rows, err := db.Query(`
+		SELECT id, file_path, COALESCE(message_id, ''), COALESCE(subject, ''), sender,
+		       COALESCE(sender_name, ''), date, COALESCE(file_size, 0)
+		FROM emails
+		WHERE `+condition+`
+		ORDER BY id ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []*Email
+	for rows.Next() {
+		e := &Email{}
+		if err := rows.Scan(&e.ID, &e.FilePath, &e.MessageID, &e.Subject, &e.Sender, &e.SenderName, &e.Date, &e.FileSize); err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		emails = append(emails, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating emails: %w", err)
+	}
+
+	return emails, nil
+}
+
+// MessageIDExists reports whether an email with the given Message-ID is
+// indexed
+func (db *DB) MessageIDExists(messageID string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM emails WHERE message_id = ?)", messageID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message id: %w", err)
+	}
+	return exists, nil
+}
+
+// FindDuplicatesOf retrieves the other copies of an email, matched by
+// Message-ID or normalized content hash
+func (db *DB) FindDuplicatesOf(email *Email) ([]*DuplicateCopy, error) {
+	if email.MessageID == "" && email.ContentHash == "" {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT id, file_path, COALESCE(subject, ''), date,
+		       (? <> '' AND message_id = ?), (? <> '' AND content_hash = ?)
+		FROM emails
+		WHERE id <> ?
+		  AND ((? <> '' AND message_id = ?) OR (? <> '' AND content_hash = ?))
+		ORDER BY id ASC
+	`, email.MessageID, email.MessageID, email.ContentHash, email.ContentHash,
+		email.ID,
+		email.MessageID, email.MessageID, email.ContentHash, email.ContentHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	var copies []*DuplicateCopy
+	for rows.Next() {
+		c := &DuplicateCopy{}
+		if err := rows.Scan(&c.ID, &c.FilePath, &c.Subject, &c.Date, &c.SameMessageID, &c.SameContentHash); err != nil {
+			return nil, fmt.Errorf("failed to scan duplicate: %w", err)
+		}
+		copies = append(copies, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating duplicates: %w", err)
+	}
+
+	return copies, nil
+}
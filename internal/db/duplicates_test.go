@@ -0,0 +1,97 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// insertDuplicateFixtures inserts three copies of one message (two sharing a
+// Message-ID, one only matching by content) and one unrelated email
+func insertDuplicateFixtures(t *testing.T, db *DB) []*Email {
+	t.Helper()
+
+	first := CreateTestEmail("Report", "alice@test.com", "Body")
+	first.FilePath = "custodian-a/report.eml"
+	first.ContentHash = "hash-report"
+
+	sameID := CreateTestEmail("Report", "alice@test.com", "Body")
+	sameID.FilePath = "custodian-b/report.eml"
+	sameID.ContentHash = "hash-report"
+
+	sameContent := CreateTestEmail("Report", "alice@test.com", "Body")
+	sameContent.FilePath = "custodian-c/report.eml"
+	sameContent.MessageID = "<rewritten@test.com>"
+	sameContent.ContentHash = "hash-report"
+
+	other := CreateTestEmail("Other", "bob@test.com", "Unrelated")
+	other.ContentHash = "hash-other"
+
+	return InsertTestEmails(t, db, []*Email{first, sameID, sameContent, other})
+}
+
+// TestDuplicateGroups tests grouping by Message-ID and by content hash
+func TestDuplicateGroups(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertDuplicateFixtures(t, db)
+
+	summary, err := db.GetDuplicateSummary()
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.MessageIDGroups)
+	assert.Equal(t, 1, summary.ContentGroups)
+	assert.Equal(t, 2, summary.RedundantCopies)
+
+	groups, err := db.ListDuplicateGroups(DuplicateByMessageID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "<Report@test.com>", groups[0].Key)
+	require.Len(t, groups[0].Emails, 2)
+	assert.Equal(t, emails[0].ID, groups[0].Emails[0].ID, "Members are in index order")
+
+	groups, err = db.ListDuplicateGroups(DuplicateByContent, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Len(t, groups[0].Emails, 3)
+
+	_, err = db.ListDuplicateGroups("bogus", 10, 0)
+	assert.Error(t, err)
+}
+
+// TestFindDuplicatesOf tests the "also found at" lookup
+func TestFindDuplicatesOf(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertDuplicateFixtures(t, db)
+
+	copies, err := db.FindDuplicatesOf(emails[0])
+	require.NoError(t, err)
+	require.Len(t, copies, 2)
+	assert.Equal(t, "custodian-b/report.eml", copies[0].FilePath)
+	assert.True(t, copies[0].SameMessageID)
+	assert.True(t, copies[0].SameContentHash)
+	assert.Equal(t, "custodian-c/report.eml", copies[1].FilePath)
+	assert.False(t, copies[1].SameMessageID)
+	assert.True(t, copies[1].SameContentHash)
+
+	copies, err = db.FindDuplicatesOf(emails[3])
+	require.NoError(t, err)
+	assert.Empty(t, copies)
+}
+
+// TestCollapseDuplicates tests that collapsing keeps only the first copy
+func TestCollapseDuplicates(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertDuplicateFixtures(t, db)
+
+	count, err := db.CountFiltered(SearchFilters{CollapseDuplicates: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	results, err := db.SearchFiltered(SearchFilters{Query: "Report", CollapseDuplicates: true}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, emails[0].ID, results[0].ID)
+}
@@ -83,14 +83,27 @@ type Email struct {
 	SenderName       string
 	Recipients       string
 	Date             NullTime
+	DateSource       string // Where Date came from, see parser.DateSourceHeader; empty for emails indexed before it was recorded
 	BodyTextPreview  string // First 10KB for FTS5 search only
 	HasAttachments   bool
 	AttachmentCount  int
 	FileSize         int64
+	SHA256           string // Hex SHA-256 of the .eml file at intake
+	ContentHash      string // Normalized content hash for duplicate detection
+	BodyHash         string // Hex SHA-256 of the parsed text and HTML bodies that redactions are made on
+	MinHash          []byte // Encoded MinHash signature of the body, nil if it has no text
+	AuthVerdict      string // SPF/DKIM/DMARC verdict at intake, see parser.AuthVerdicts
+	ParserVersion    int    // indexer.ParserVersion that produced this record; 0 if indexed before versions were stamped
 	IndexedAt        NullTime
 	UpdatedAt        NullTime
 }
 
+// DateUncertain reports whether the date came from a fallback rather than
+// the Date header
+func (e *Email) DateUncertain() bool {
+	return parser.DateUncertain(e.DateSource)
+}
+
 // GetDate returns the date as time.Time, or zero time if NULL
 func (e *Email) GetDate() time.Time {
 	if e.Date.Valid {
@@ -124,26 +137,49 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	Size        int64
+	SHA256      string // Hex SHA-256 of the decoded content at intake
+}
+
+// Key returns the key matching the attachment to its part of the email
+func (a *Attachment) Key() parser.AttachmentKey {
+	return parser.AttachmentKey{Filename: a.Filename, ContentType: a.ContentType, Size: a.Size}
 }
 
 // InsertEmail inserts a new email into the database (metadata only)
 func (db *DB) InsertEmail(email *Email) (int64, error) {
+	defer db.nearDuplicates.invalidate()
+
 	result, err := db.Exec(`
 		INSERT INTO emails (
 			file_path, message_id, in_reply_to, thread_references,
 			subject, sender, sender_name, recipients, date,
-			body_text_preview, has_attachments, attachment_count, file_size
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			body_text_preview, has_attachments, attachment_count, file_size, sha256, content_hash, minhash, auth_verdict, date_source,
+			parser_version, body_hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		email.FilePath, email.MessageID, email.InReplyTo, email.ThreadReferences,
 		email.Subject, email.Sender, email.SenderName, email.Recipients, email.Date,
 		email.BodyTextPreview, email.HasAttachments, email.AttachmentCount, email.FileSize,
+		nullString(email.SHA256), nullString(email.ContentHash), email.MinHash, email.AuthVerdict, email.DateSource,
+		email.ParserVersion, nullString(email.BodyHash),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert email: %w", err)
 	}
 
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	exec := func(args ...interface{}) (sql.Result, error) {
+		return db.Exec(insertMinHashBandSQL, args...)
+	}
+	if err := insertMinHashBands(exec, id, email.MinHash); err != nil {
+		return 0, err
+	}
+
+	return id, nil
 }
 
 // EmailExists checks if an email with the given file path already exists
@@ -163,12 +199,14 @@ func (db *DB) GetEmailByID(id int64) (*Email, error) {
 		SELECT id, file_path, message_id, in_reply_to, thread_references,
 		       subject, sender, sender_name, recipients, date,
 		       body_text_preview, has_attachments, attachment_count, file_size,
+		       COALESCE(sha256, ''), COALESCE(content_hash, ''), COALESCE(date_source, ''), parser_version,
 		       indexed_at, updated_at
 		FROM emails WHERE id = ?
 	`, id).Scan(
 		&email.ID, &email.FilePath, &email.MessageID, &email.InReplyTo, &email.ThreadReferences,
 		&email.Subject, &email.Sender, &email.SenderName, &email.Recipients, &email.Date,
 		&email.BodyTextPreview, &email.HasAttachments, &email.AttachmentCount, &email.FileSize,
+		&email.SHA256, &email.ContentHash, &email.DateSource, &email.ParserVersion,
 		&email.IndexedAt, &email.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -186,7 +224,7 @@ func (db *DB) ListEmails(limit, offset int) ([]*Email, error) {
 		SELECT id, file_path, message_id, in_reply_to, thread_references,
 		       subject, sender, sender_name, recipients, date,
 		       body_text_preview, has_attachments, attachment_count, file_size,
-		       indexed_at, updated_at
+		       COALESCE(date_source, ''), indexed_at, updated_at
 		FROM emails
 		ORDER BY date DESC
 		LIMIT ? OFFSET ?
@@ -203,7 +241,7 @@ func (db *DB) ListEmails(limit, offset int) ([]*Email, error) {
 			&email.ID, &email.FilePath, &email.MessageID, &email.InReplyTo, &email.ThreadReferences,
 			&email.Subject, &email.Sender, &email.SenderName, &email.Recipients, &email.Date,
 			&email.BodyTextPreview, &email.HasAttachments, &email.AttachmentCount, &email.FileSize,
-			&email.IndexedAt, &email.UpdatedAt,
+			&email.DateSource, &email.IndexedAt, &email.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan email: %w", err)
@@ -231,9 +269,9 @@ func (db *DB) CountEmails() (int, error) {
 // InsertAttachment inserts an attachment into the database (metadata only)
 func (db *DB) InsertAttachment(att *Attachment) (int64, error) {
 	result, err := db.Exec(`
-		INSERT INTO attachments (email_id, filename, content_type, size)
-		VALUES (?, ?, ?, ?)
-	`, att.EmailID, att.Filename, att.ContentType, att.Size)
+		INSERT INTO attachments (email_id, filename, content_type, size, sha256)
+		VALUES (?, ?, ?, ?, ?)
+	`, att.EmailID, att.Filename, att.ContentType, att.Size, nullString(att.SHA256))
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert attachment: %w", err)
 	}
@@ -244,7 +282,7 @@ func (db *DB) InsertAttachment(att *Attachment) (int64, error) {
 // GetAttachmentsByEmailID retrieves all attachments for an email (metadata only)
 func (db *DB) GetAttachmentsByEmailID(emailID int64) ([]*Attachment, error) {
 	rows, err := db.Query(`
-		SELECT id, email_id, filename, content_type, size
+		SELECT id, email_id, filename, content_type, size, COALESCE(sha256, '')
 		FROM attachments WHERE email_id = ?
 	`, emailID)
 	if err != nil {
@@ -255,7 +293,7 @@ func (db *DB) GetAttachmentsByEmailID(emailID int64) ([]*Attachment, error) {
 	var attachments []*Attachment
 	for rows.Next() {
 		att := &Attachment{}
-		err := rows.Scan(&att.ID, &att.EmailID, &att.Filename, &att.ContentType, &att.Size)
+		err := rows.Scan(&att.ID, &att.EmailID, &att.Filename, &att.ContentType, &att.Size, &att.SHA256)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan attachment: %w", err)
 		}
@@ -273,9 +311,9 @@ func (db *DB) GetAttachmentsByEmailID(emailID int64) ([]*Attachment, error) {
 func (db *DB) GetAttachmentByID(id int64) (*Attachment, error) {
 	att := &Attachment{}
 	err := db.QueryRow(`
-		SELECT id, email_id, filename, content_type, size
+		SELECT id, email_id, filename, content_type, size, COALESCE(sha256, '')
 		FROM attachments WHERE id = ?
-	`, id).Scan(&att.ID, &att.EmailID, &att.Filename, &att.ContentType, &att.Size)
+	`, id).Scan(&att.ID, &att.EmailID, &att.Filename, &att.ContentType, &att.Size, &att.SHA256)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -288,6 +326,8 @@ func (db *DB) GetAttachmentByID(id int64) (*Attachment, error) {
 // InsertEmailsBatch inserts multiple emails in a single transaction
 // Returns the inserted email IDs in the same order as the input
 func (db *DB) InsertEmailsBatch(emails []*Email) ([]int64, error) {
+	defer db.nearDuplicates.invalidate()
+
 	if len(emails) == 0 {
 		return []int64{}, nil
 	}
@@ -302,20 +342,29 @@ func (db *DB) InsertEmailsBatch(emails []*Email) ([]int64, error) {
 		INSERT INTO emails (
 			file_path, message_id, in_reply_to, thread_references,
 			subject, sender, sender_name, recipients, date,
-			body_text_preview, has_attachments, attachment_count, file_size
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			body_text_preview, has_attachments, attachment_count, file_size, sha256, content_hash, minhash, auth_verdict, date_source,
+			parser_version, body_hash
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
+	bandStmt, err := tx.Prepare(insertMinHashBandSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer bandStmt.Close()
+
 	ids := make([]int64, 0, len(emails))
 	for _, email := range emails {
 		result, err := stmt.Exec(
 			email.FilePath, email.MessageID, email.InReplyTo, email.ThreadReferences,
 			email.Subject, email.Sender, email.SenderName, email.Recipients, email.Date,
 			email.BodyTextPreview, email.HasAttachments, email.AttachmentCount, email.FileSize,
+			nullString(email.SHA256), nullString(email.ContentHash), email.MinHash, email.AuthVerdict, email.DateSource,
+			email.ParserVersion, nullString(email.BodyHash),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to insert email %s: %w", email.FilePath, err)
@@ -325,6 +374,9 @@ func (db *DB) InsertEmailsBatch(emails []*Email) ([]int64, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get last insert id: %w", err)
 		}
+		if err := insertMinHashBands(bandStmt.Exec, id, email.MinHash); err != nil {
+			return nil, err
+		}
 		ids = append(ids, id)
 	}
 
@@ -348,8 +400,8 @@ func (db *DB) InsertAttachmentsBatch(attachments []*Attachment) error {
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT INTO attachments (email_id, filename, content_type, size)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO attachments (email_id, filename, content_type, size, sha256)
+		VALUES (?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -357,7 +409,7 @@ func (db *DB) InsertAttachmentsBatch(attachments []*Attachment) error {
 	defer stmt.Close()
 
 	for _, att := range attachments {
-		_, err := stmt.Exec(att.EmailID, att.Filename, att.ContentType, att.Size)
+		_, err := stmt.Exec(att.EmailID, att.Filename, att.ContentType, att.Size, nullString(att.SHA256))
 		if err != nil {
 			return fmt.Errorf("failed to insert attachment %s: %w", att.Filename, err)
 		}
@@ -654,52 +706,11 @@ func (db *DB) GetEmailWithFullContent(id int64) (*EmailWithContent, error) {
 	}, nil
 }
 
-// GetAttachmentData retrieves attachment data by parsing the .eml file
-// Returns the attachment data for the given attachment ID
-func (db *DB) GetAttachmentData(attachmentID int64) ([]byte, error) {
-	// Get attachment metadata
-	att, err := db.GetAttachmentByID(attachmentID)
-	if err != nil {
-		return nil, err
-	}
-	if att == nil {
-		return nil, fmt.Errorf("attachment not found")
-	}
-
-	// Get email to find the .eml file path
-	email, err := db.GetEmailByID(att.EmailID)
-	if err != nil {
-		return nil, err
-	}
-	if email == nil {
-		return nil, fmt.Errorf("email not found for attachment")
-	}
-
-	// Resolve relative path to absolute path
-	absolutePath, err := db.ResolveEmailPath(email.FilePath)
-	if err != nil {
-		return nil, fmt.Errorf("invalid file path: %w", err)
-	}
-
-	// Parse the .eml file
-	parsed, err := parser.ParseEMLFile(absolutePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse .eml file %s: %w", absolutePath, err)
-	}
-
-	// Find the matching attachment by filename
-	for _, parsedAtt := range parsed.Attachments {
-		if parsedAtt.Filename == att.Filename {
-			return parsedAtt.Data, nil
-		}
-	}
-
-	return nil, fmt.Errorf("attachment %s not found in .eml file", att.Filename)
-}
-
 // DeleteEmail deletes an email and its attachments from the database
 // The .eml file is NOT deleted from disk
 func (db *DB) DeleteEmail(id int64) error {
+	defer db.nearDuplicates.invalidate()
+
 	result, err := db.Exec("DELETE FROM emails WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete email: %w", err)
@@ -719,6 +730,8 @@ func (db *DB) DeleteEmail(id int64) error {
 
 // DeleteEmailsBatch deletes multiple emails in a single transaction
 func (db *DB) DeleteEmailsBatch(ids []int64) error {
+	defer db.nearDuplicates.invalidate()
+
 	if len(ids) == 0 {
 		return nil
 	}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"database/sql"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -294,3 +296,42 @@ func TestSettings(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "updated_value", value, "Setting should be updated")
 }
+
+// TestAddedColumnsOnExistingDatabase tests that Open adds newer columns to old databases
+func TestAddedColumnsOnExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+
+	old, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = old.Exec(`
+		CREATE TABLE emails (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, file_path TEXT UNIQUE NOT NULL,
+			message_id TEXT, in_reply_to TEXT, thread_references TEXT, subject TEXT,
+			sender TEXT NOT NULL, sender_name TEXT, recipients TEXT, date DATETIME,
+			body_text_preview TEXT, has_attachments BOOLEAN DEFAULT 0, attachment_count INTEGER DEFAULT 0,
+			file_size INTEGER, indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, email_id INTEGER NOT NULL,
+			filename TEXT NOT NULL, content_type TEXT, size INTEGER
+		);
+		INSERT INTO emails (file_path, sender) VALUES ('old.eml', 'old@test.com');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	records, err := db.ListFileHashes()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Empty(t, records[0].SHA256, "Existing rows have no intake hash")
+
+	// Opening again must not try to add the columns twice
+	require.NoError(t, db.Close())
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/pii"
+)
+
+// dateUncertain matches emails "e" dated by a fallback rather than their
+// Date header
+const dateUncertain = "e.date_source IN ('received', 'resent-date', 'file', 'none')"
+
+// SearchFilters holds the full set of filters applied to search, count and
+// listing queries. The zero value matches every email.
+type SearchFilters struct {
+	Query          string
+	Sender         string
+	Recipient      string
+	HasAttachments bool
+	DateFrom       string
+	DateTo         string
+
+	// CollapseDuplicates shows only the first-indexed copy of each message
+	CollapseDuplicates bool
+
+	// Sensitive limits results to emails with PII findings of a type, or of
+	// any type when set to SensitiveAny
+	Sensitive string
+
+	// Link limits results to emails with a link whose URL contains it
+	Link string
+
+	// Domain limits results to emails linking to a domain or its subdomains
+	Domain string
+
+	// Auth limits results to emails with an authentication verdict, one of
+	// parser.AuthVerdicts
+	Auth string
+
+	// DateUncertain limits results to emails dated by a fallback because
+	// their Date header was missing or invalid
+	DateUncertain bool
+}
+
+// IsEmpty reports whether no filter is set
+func (f SearchFilters) IsEmpty() bool {
+	return f == SearchFilters{}
+}
+
+// Validate checks filter input lengths to prevent abuse
+func (f SearchFilters) Validate() error {
+	if len(f.Query) > 500 || len(f.Sender) > 255 || len(f.Recipient) > 255 ||
+		len(f.Link) > 500 || len(f.Domain) > 255 {
+		return errors.New("search term too long")
+	}
+	if f.Sensitive != "" && f.Sensitive != SensitiveAny && !pii.Type(f.Sensitive).Valid() {
+		return errors.New("unknown sensitive data type")
+	}
+	if f.Auth != "" && !slices.Contains(parser.AuthVerdicts, f.Auth) {
+		return errors.New("unknown authentication verdict")
+	}
+	return nil
+}
+
+// WithQueryOperators moves "link:" and "domain:" terms typed in the search
+// box out of Query and into the Link and Domain filters
+func (f SearchFilters) WithQueryOperators() SearchFilters {
+	terms := strings.Fields(f.Query)
+	kept := terms[:0]
+	for _, term := range terms {
+		name, value, ok := strings.Cut(term, ":")
+		switch {
+		case ok && value != "" && strings.EqualFold(name, "link") && f.Link == "":
+			f.Link = value
+		case ok && value != "" && strings.EqualFold(name, "domain") && f.Domain == "":
+			f.Domain = value
+		default:
+			kept = append(kept, term)
+		}
+	}
+	if len(kept) < len(terms) {
+		f.Query = strings.Join(kept, " ")
+	}
+	return f
+}
+
+// conditions builds the WHERE conditions and arguments for the filter set.
+// Callers must join emails_fts when Query is set, and alias emails as "e".
+func (f SearchFilters) conditions() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	// FTS5 search
+	if f.Query != "" {
+		conditions = append(conditions, "emails_fts MATCH ?")
+		args = append(args, buildFTSQuery(f.Query))
+	}
+
+	// Sender filter
+	if f.Sender != "" {
+		conditions = append(conditions, "e.sender LIKE ?")
+		args = append(args, "%"+f.Sender+"%")
+	}
+
+	// Recipient filter
+	if f.Recipient != "" {
+		conditions = append(conditions, "e.recipients LIKE ?")
+		args = append(args, "%"+f.Recipient+"%")
+	}
+
+	// Attachments filter
+	if f.HasAttachments {
+		conditions = append(conditions, "e.has_attachments = 1")
+	}
+
+	// Date range filters
+	if f.DateFrom != "" {
+		conditions = append(conditions, "e.date >= ?")
+		args = append(args, f.DateFrom)
+	}
+	if f.DateTo != "" {
+		// A plain YYYY-MM-DD end date includes that whole day
+		if _, err := time.Parse("2006-01-02", f.DateTo); err == nil {
+			conditions = append(conditions, "e.date < date(?, '+1 day')")
+		} else {
+			conditions = append(conditions, "e.date <= ?")
+		}
+		args = append(args, f.DateTo)
+	}
+
+	if f.CollapseDuplicates {
+		conditions = append(conditions, "NOT "+duplicateOfEarlier)
+	}
+
+	// Sensitive data filter
+	if f.Sensitive == SensitiveAny {
+		conditions = append(conditions, hasPIIFindings)
+	} else if f.Sensitive != "" {
+		conditions = append(conditions, hasPIIFindingsOfType)
+		args = append(args, f.Sensitive)
+	}
+
+	// Link filters
+	if f.Link != "" {
+		conditions = append(conditions, hasLinkLike)
+		args = append(args, "%"+f.Link+"%")
+	}
+	if domain := normalizeDomain(f.Domain); domain != "" {
+		conditions = append(conditions, hasLinkToDomain)
+		args = append(args, domain, "%."+domain)
+	}
+
+	// Authentication filter
+	if f.Auth != "" {
+		conditions = append(conditions, "e.auth_verdict = ?")
+		args = append(args, f.Auth)
+	}
+
+	if f.DateUncertain {
+		conditions = append(conditions, dateUncertain)
+	}
+
+	return conditions, args
+}
+
+// from builds the FROM and WHERE clauses selecting emails "e" that match the
+// filter set and any extra conditions, for aggregate queries over filtered results
+func (f SearchFilters) from(extra ...string) (string, []interface{}) {
+	conditions, args := f.conditions()
+	conditions = append(conditions, extra...)
+	clause := " FROM emails e"
+	if f.Query != "" {
+		clause += " JOIN emails_fts ON e.id = emails_fts.rowid"
+	}
+	if len(conditions) > 0 {
+		clause += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return clause, args
+}
+
+// buildFTSQuery converts a user query into an FTS5 MATCH expression with
+// fuzzy matching: "john doe" -> "john"* "doe"*
+func buildFTSQuery(query string) string {
+	terms := strings.Fields(query)
+	fuzzyTerms := make([]string, len(terms))
+	for i, term := range terms {
+		// For terms with special characters (like @, .), quote them without wildcard
+		if strings.ContainsAny(term, "@.-") {
+			fuzzyTerms[i] = escapeFTS5(term)
+		} else {
+			// For regular terms, escape and add wildcard
+			escapedTerm := strings.ReplaceAll(term, `"`, `""`)
+			fuzzyTerms[i] = `"` + escapedTerm + `"` + "*"
+		}
+	}
+	return strings.Join(fuzzyTerms, " ")
+}
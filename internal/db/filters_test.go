@@ -0,0 +1,35 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchFiltered_DateToInclusive tests that a plain end date includes
+// emails sent during that day
+func TestSearchFiltered_DateToInclusive(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	InsertTestEmails(t, db, []*Email{
+		CreateTestEmailWithDate("Before", "alice@test.com", "Body", time.Date(2024, 1, 7, 23, 0, 0, 0, time.UTC)),
+		CreateTestEmailWithDate("During", "alice@test.com", "Body", time.Date(2024, 1, 8, 15, 30, 0, 0, time.UTC)),
+		CreateTestEmailWithDate("After", "alice@test.com", "Body", time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC)),
+	})
+
+	results, err := db.SearchFiltered(SearchFilters{DateTo: "2024-01-08"}, 10, 0)
+	require.NoError(t, err)
+	var subjects []string
+	for _, r := range results {
+		subjects = append(subjects, r.Subject)
+	}
+	assert.ElementsMatch(t, []string{"Before", "During"}, subjects)
+
+	results, err = db.SearchFiltered(SearchFilters{DateFrom: "2024-01-08", DateTo: "2024-01-08"}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "During", results[0].Subject)
+}
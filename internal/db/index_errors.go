@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// IndexError is a file that could not be indexed, kept until it indexes
+type IndexError struct {
+	FilePath      string
+	Category      string // One of indexer.FailCategories
+	Message       string
+	Attempts      int // Scans that have failed on the file
+	FirstFailedAt NullTime
+	LastFailedAt  NullTime
+}
+
+// RecordIndexErrors stores indexing failures, counting repeat failures of
+// the same file as further attempts
+func (db *DB) RecordIndexErrors(errs []*IndexError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO index_errors (file_path, category, message, first_failed_at, last_failed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(file_path) DO UPDATE SET
+			category = excluded.category,
+			message = excluded.message,
+			attempts = attempts + 1,
+			last_failed_at = excluded.last_failed_at
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, e := range errs {
+		if _, err := stmt.Exec(e.FilePath, e.Category, e.Message, now, now); err != nil {
+			return fmt.Errorf("failed to record index error for %s: %w", e.FilePath, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ClearIndexErrors removes the failures recorded for files that have now
+// been indexed
+func (db *DB) ClearIndexErrors(filePaths []string) error {
+	if len(filePaths) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("DELETE FROM index_errors WHERE file_path = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, path := range filePaths {
+		if _, err := stmt.Exec(path); err != nil {
+			return fmt.Errorf("failed to clear index error for %s: %w", path, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PruneIndexErrors removes the failures recorded for files that are not in
+// filePaths, the files currently in the emails folder
+func (db *DB) PruneIndexErrors(filePaths []string) error {
+	errs, err := db.ListIndexErrors()
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool, len(filePaths))
+	for _, path := range filePaths {
+		present[path] = true
+	}
+	var gone []string
+	for _, e := range errs {
+		if !present[e.FilePath] {
+			gone = append(gone, e.FilePath)
+		}
+	}
+	return db.ClearIndexErrors(gone)
+}
+
+// ListIndexErrors returns all recorded indexing failures, most recent first
+func (db *DB) ListIndexErrors() ([]*IndexError, error) {
+	rows, err := db.Query(`
+		SELECT file_path, category, message, attempts, first_failed_at, last_failed_at
+		FROM index_errors
+		ORDER BY last_failed_at DESC, file_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list index errors: %w", err)
+	}
+	defer rows.Close()
+
+	var errs []*IndexError
+	for rows.Next() {
+		e := &IndexError{}
+		if err := rows.Scan(&e.FilePath, &e.Category, &e.Message, &e.Attempts, &e.FirstFailedAt, &e.LastFailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan index error: %w", err)
+		}
+		errs = append(errs, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating index errors: %w", err)
+	}
+
+	return errs, nil
+}
+
+// CountIndexErrors returns how many files have unresolved indexing failures
+func (db *DB) CountIndexErrors() (int, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM index_errors").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count index errors: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIndexErrors tests recording, repeating, clearing and pruning failures
+func TestIndexErrors(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	require.NoError(t, db.RecordIndexErrors([]*IndexError{
+		{FilePath: "a.eml", Category: "charset", Message: "unknown charset"},
+		{FilePath: "b.eml", Category: "unreadable", Message: "permission denied"},
+	}))
+	require.NoError(t, db.RecordIndexErrors([]*IndexError{
+		{FilePath: "a.eml", Category: "malformed MIME", Message: "bad header"},
+	}))
+
+	errs, err := db.ListIndexErrors()
+	require.NoError(t, err)
+	require.Len(t, errs, 2)
+	byPath := map[string]*IndexError{}
+	for _, e := range errs {
+		byPath[e.FilePath] = e
+	}
+	assert.Equal(t, 2, byPath["a.eml"].Attempts)
+	assert.Equal(t, "malformed MIME", byPath["a.eml"].Category, "Latest failure should win")
+	assert.Equal(t, "bad header", byPath["a.eml"].Message)
+	assert.True(t, byPath["a.eml"].FirstFailedAt.Valid)
+	assert.Equal(t, 1, byPath["b.eml"].Attempts)
+
+	require.NoError(t, db.ClearIndexErrors([]string{"a.eml", "never-failed.eml"}))
+	count, err := db.CountIndexErrors()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// b.eml is no longer in the folder
+	require.NoError(t, db.PruneIndexErrors([]string{"c.eml"}))
+	count, err = db.CountIndexErrors()
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
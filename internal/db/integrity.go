@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// FileHash is the intake record of one indexed .eml file
+type FileHash struct {
+	EmailID   int64
+	FilePath  string
+	FileSize  int64
+	SHA256    string // Empty for emails indexed before hashing was introduced
+	MessageID string
+	IndexedAt NullTime
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// ListFileHashes retrieves the intake hash of every indexed email, ordered by path
+func (db *DB) ListFileHashes() ([]*FileHash, error) {
+	rows, err := db.Query(`
+		SELECT id, file_path, COALESCE(file_size, 0), COALESCE(sha256, ''),
+		       COALESCE(message_id, ''), indexed_at
+		FROM emails
+		ORDER BY file_path ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []*FileHash
+	for rows.Next() {
+		h := &FileHash{}
+		if err := rows.Scan(&h.EmailID, &h.FilePath, &h.FileSize, &h.SHA256, &h.MessageID, &h.IndexedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file hash: %w", err)
+		}
+		hashes = append(hashes, h)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating file hashes: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// ListAttachmentHashes retrieves all attachments grouped by email ID
+func (db *DB) ListAttachmentHashes() (map[int64][]*Attachment, error) {
+	rows, err := db.Query(`
+		SELECT id, email_id, filename, COALESCE(content_type, ''), COALESCE(size, 0), COALESCE(sha256, '')
+		FROM attachments
+		ORDER BY email_id, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachment hashes: %w", err)
+	}
+	defer rows.Close()
+
+	byEmail := make(map[int64][]*Attachment)
+	for rows.Next() {
+		att := &Attachment{}
+		if err := rows.Scan(&att.ID, &att.EmailID, &att.Filename, &att.ContentType, &att.Size, &att.SHA256); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment hash: %w", err)
+		}
+		byEmail[att.EmailID] = append(byEmail[att.EmailID], att)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating attachment hashes: %w", err)
+	}
+
+	return byEmail, nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hasLinkLike and hasLinkToDomain match emails "e" containing a link; the
+// former takes a LIKE pattern for the URL, the latter a domain twice (exact
+// match, then a LIKE pattern for its subdomains)
+const (
+	hasLinkLike     = "EXISTS (SELECT 1 FROM links l WHERE l.email_id = e.id AND l.url LIKE ?)"
+	hasLinkToDomain = "EXISTS (SELECT 1 FROM links l WHERE l.email_id = e.id AND (l.domain = ? OR l.domain LIKE ?))"
+)
+
+// Link is a URL found in an email body
+type Link struct {
+	ID          int64
+	EmailID     int64
+	URL         string
+	Domain      string
+	DisplayText string // Visible text of an HTML anchor, empty for bare URLs
+	Source      string // text or html
+	Mismatch    bool   // Anchor text names a different domain than the URL
+}
+
+// DomainCount is the number of links to one domain in a set of emails
+type DomainCount struct {
+	Domain     string
+	Emails     int
+	Links      int
+	Mismatched int // Links whose anchor text names another domain
+}
+
+// normalizeDomain lowercases a domain filter and strips a leading "www.", as
+// stored domains are
+func normalizeDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+}
+
+// SaveLinks replaces the links of an email
+func (db *DB) SaveLinks(emailID int64, links []*Link) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM links WHERE email_id = ?", emailID); err != nil {
+		return fmt.Errorf("failed to clear links: %w", err)
+	}
+	for _, l := range links {
+		_, err := tx.Exec(`
+			INSERT INTO links (email_id, url, domain, display_text, source, mismatch)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, emailID, l.URL, l.Domain, l.DisplayText, l.Source, l.Mismatch)
+		if err != nil {
+			return fmt.Errorf("failed to insert link: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetLinks retrieves the links of an email, mismatched ones first
+func (db *DB) GetLinks(emailID int64) ([]*Link, error) {
+	rows, err := db.Query(`
+		SELECT id, email_id, url, domain, display_text, source, mismatch
+		FROM links
+		WHERE email_id = ?
+		ORDER BY mismatch DESC, id ASC
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*Link
+	for rows.Next() {
+		l := &Link{}
+		if err := rows.Scan(&l.ID, &l.EmailID, &l.URL, &l.Domain, &l.DisplayText, &l.Source, &l.Mismatch); err != nil {
+			return nil, fmt.Errorf("failed to scan link: %w", err)
+		}
+		links = append(links, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating links: %w", err)
+	}
+
+	return links, nil
+}
+
+// GetLinkedDomains counts the links to each domain in the emails matching the
+// filters, most widely linked first
+func (db *DB) GetLinkedDomains(f SearchFilters) ([]*DomainCount, error) {
+	from, args := f.from()
+	rows, err := db.Query(`
+		SELECT l.domain, COUNT(DISTINCT l.email_id), COUNT(*), COALESCE(SUM(l.mismatch), 0)
+		FROM links l
+		WHERE l.email_id IN (SELECT e.id`+from+`)
+		GROUP BY l.domain
+		ORDER BY COUNT(DISTINCT l.email_id) DESC, l.domain ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count linked domains: %w", err)
+	}
+	defer rows.Close()
+
+	var domains []*DomainCount
+	for rows.Next() {
+		d := &DomainCount{}
+		if err := rows.Scan(&d.Domain, &d.Emails, &d.Links, &d.Mismatched); err != nil {
+			return nil, fmt.Errorf("failed to scan domain count: %w", err)
+		}
+		domains = append(domains, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain counts: %w", err)
+	}
+
+	return domains, nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLinks tests storing links, the link filters and the domain inventory
+func TestLinks(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	emails := InsertTestEmails(t, db, []*Email{
+		CreateTestEmail("Phish", "alice@acme.com", "a"),
+		CreateTestEmail("Docs", "bob@acme.com", "b"),
+		CreateTestEmail("Plain", "carol@acme.com", "c"),
+	})
+
+	require.NoError(t, db.SaveLinks(emails[0].ID, []*Link{
+		{URL: "https://login.evil.net/x", Domain: "login.evil.net", DisplayText: "https://mybank.com", Source: "html", Mismatch: true},
+		{URL: "https://docs.example.com/a", Domain: "docs.example.com", Source: "text"},
+	}))
+	require.NoError(t, db.SaveLinks(emails[1].ID, []*Link{
+		{URL: "https://example.com/b", Domain: "example.com", Source: "text"},
+	}))
+
+	links, err := db.GetLinks(emails[0].ID)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.True(t, links[0].Mismatch, "Mismatched links come first")
+	assert.Equal(t, "https://mybank.com", links[0].DisplayText)
+
+	count, err := db.CountFiltered(SearchFilters{Domain: "WWW.Example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "Domain filter matches subdomains")
+
+	count, err = db.CountFiltered(SearchFilters{Domain: "evil.net"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	results, err := db.SearchFiltered(SearchFilters{Link: "example.com/b"}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Docs", results[0].Subject)
+
+	domains, err := db.GetLinkedDomains(SearchFilters{})
+	require.NoError(t, err)
+	require.Len(t, domains, 3)
+	assert.Equal(t, &DomainCount{Domain: "docs.example.com", Emails: 1, Links: 1}, domains[0])
+	assert.Equal(t, &DomainCount{Domain: "login.evil.net", Emails: 1, Links: 1, Mismatched: 1}, domains[2])
+
+	domains, err = db.GetLinkedDomains(SearchFilters{Sender: "bob"})
+	require.NoError(t, err)
+	require.Len(t, domains, 1)
+	assert.Equal(t, "example.com", domains[0].Domain)
+
+	// Replacing and deleting clear old links
+	require.NoError(t, db.SaveLinks(emails[0].ID, nil))
+	_, err = db.Exec("DELETE FROM emails WHERE id = ?", emails[1].ID)
+	require.NoError(t, err)
+	domains, err = db.GetLinkedDomains(SearchFilters{})
+	require.NoError(t, err)
+	assert.Empty(t, domains)
+}
+
+// TestWithQueryOperators tests moving link: and domain: terms out of the query
+func TestWithQueryOperators(t *testing.T) {
+	f := SearchFilters{Query: "invoice domain:example.com LINK:/pay due"}.WithQueryOperators()
+	assert.Equal(t, SearchFilters{Query: "invoice due", Domain: "example.com", Link: "/pay"}, f)
+
+	f = SearchFilters{Query: "domain:a.com", Domain: "b.com"}.WithQueryOperators()
+	assert.Equal(t, "domain:a.com", f.Query, "An explicit filter wins")
+	assert.Equal(t, "b.com", f.Domain)
+
+	f = SearchFilters{Query: "time 10:30"}.WithQueryOperators()
+	assert.Equal(t, "time 10:30", f.Query)
+}
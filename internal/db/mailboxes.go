@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// folderOf is the folder of an email's file_path, with its trailing slash:
+// "2024/March/" for "2024/March/a.eml" and "" for a file at the top. Trimming
+// every character that is not a slash from the end leaves the folder.
+const folderOf = "rtrim(file_path, replace(file_path, '/', ''))"
+
+// ListAllEmails lists every email's ID, path, sender, subject, date and size,
+// in ID order
+func (db *DB) ListAllEmails() ([]*Email, error) {
+	return db.listEmailsWhere("1 = 1")
+}
+
+// ListEmailsAfter lists the emails with an ID above id, as ListAllEmails does
+func (db *DB) ListEmailsAfter(id int64) ([]*Email, error) {
+	return db.listEmailsWhere("id > ?", id)
+}
+
+// ListAllEmailIDs returns the ID of every email, in order
+func (db *DB) ListAllEmailIDs() ([]int64, error) {
+	return db.queryIDs("SELECT id FROM emails ORDER BY id")
+}
+
+// MaxEmailID returns the highest email ID, or 0 with no emails
+func (db *DB) MaxEmailID() (int64, error) {
+	var id int64
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM emails").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get highest email id: %w", err)
+	}
+	return id, nil
+}
+
+// ListEmailFolders returns every folder holding emails directly, such as
+// "2024/March", sorted. Emails at the top of the collection have no folder.
+func (db *DB) ListEmailFolders() ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ` + folderOf + ` AS folder
+		FROM emails
+		WHERE folder != ''
+		ORDER BY folder
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []string
+	for rows.Next() {
+		var folder string
+		if err := rows.Scan(&folder); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		folders = append(folders, strings.TrimSuffix(folder, "/"))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating folders: %w", err)
+	}
+	return folders, nil
+}
+
+// ListFolderEmails lists the emails directly in a folder, not its
+// subfolders, as ListAllEmails does
+func (db *DB) ListFolderEmails(folder string) ([]*Email, error) {
+	return db.listEmailsWhere(folderOf+" = ?", folder+"/")
+}
+
+// ListFolderEmailIDs returns the IDs of the emails directly in a folder, in
+// order
+func (db *DB) ListFolderEmailIDs(folder string) ([]int64, error) {
+	return db.queryIDs("SELECT id FROM emails WHERE "+folderOf+" = ? ORDER BY id", folder+"/")
+}
+
+// ListMatchingEmails lists the emails matching a filter set, as ListAllEmails
+// does
+func (db *DB) ListMatchingEmails(f SearchFilters) ([]*Email, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	sqlQuery, args := searchIDQuery(f)
+	return db.listEmailsWhere("id IN ("+sqlQuery+")", args...)
+}
+
+// SearchEmailIDs returns the IDs of every email matching a filter set, in ID
+// order
+func (db *DB) SearchEmailIDs(f SearchFilters) ([]int64, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	sqlQuery, args := searchIDQuery(f)
+	return db.queryIDs(sqlQuery+" ORDER BY e.id", args...)
+}
+
+// searchIDQuery builds a query selecting the IDs of the emails matching a
+// filter set
+func searchIDQuery(f SearchFilters) (string, []interface{}) {
+	conditions, args := f.conditions()
+	sqlQuery := "SELECT e.id FROM emails e"
+	if f.Query != "" {
+		sqlQuery += " JOIN emails_fts ON e.id = emails_fts.rowid"
+	}
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return sqlQuery, args
+}
+
+// queryIDs runs a query selecting email IDs
+func (db *DB) queryIDs(sqlQuery string, args ...interface{}) ([]int64, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search emails: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan email id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating emails: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchEmailIDs tests that filters return every matching ID in order
+func TestSearchEmailIDs(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	emails := InsertTestEmails(t, db, []*Email{
+		CreateTestEmail("Invoice March", "alice@test.com", "Invoice attached"),
+		CreateTestEmail("Lunch", "bob@test.com", "See you at noon"),
+		CreateTestEmail("Invoice April", "alice@test.com", "Invoice in body"),
+	})
+
+	ids, err := db.SearchEmailIDs(SearchFilters{Query: "invoice"})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{emails[0].ID, emails[2].ID}, ids)
+
+	ids, err = db.SearchEmailIDs(SearchFilters{Sender: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{emails[1].ID}, ids)
+
+	all, err := db.ListAllEmails()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+// TestListEmailFolders tests that folders and their emails come from the
+// file paths, without the emails in subfolders
+func TestListEmailFolders(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	var list []*Email
+	for _, p := range []string{"top.eml", "2024/March/a.eml", "2024/b.eml", "2024/March/c.eml", "other/d.eml"} {
+		e := CreateTestEmail(p, "alice@test.com", "Body")
+		e.FilePath = p
+		list = append(list, e)
+	}
+	emails := InsertTestEmails(t, db, list)
+
+	folders, err := db.ListEmailFolders()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2024", "2024/March", "other"}, folders)
+
+	ids, err := db.ListFolderEmailIDs("2024/March")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{emails[1].ID, emails[3].ID}, ids)
+
+	inFolder, err := db.ListFolderEmails("2024")
+	require.NoError(t, err)
+	require.Len(t, inFolder, 1)
+	assert.Equal(t, "2024/b.eml", inFolder[0].FilePath)
+
+	after, err := db.ListEmailsAfter(emails[2].ID)
+	require.NoError(t, err)
+	require.Len(t, after, 2)
+	assert.Equal(t, emails[3].ID, after[0].ID)
+
+	maxID, err := db.MaxEmailID()
+	require.NoError(t, err)
+	assert.Equal(t, emails[4].ID, maxID)
+
+	matching, err := db.ListMatchingEmails(SearchFilters{Query: "body"})
+	require.NoError(t, err)
+	assert.Len(t, matching, 5)
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// migration is a numbered schema change. Each runs in a transaction together
+// with its schema_migrations row, so it is either applied whole or not at all.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+	down    func(tx *sql.Tx) error // nil if the migration cannot be rolled back
+}
+
+// migrations lists every schema change in order. Versions are never reused
+// or renumbered: add changes to the end.
+var migrations = []migration{
+	{version: 1, name: "baseline", up: migrateBaseline},
+	{version: 2, name: "email parser version",
+		up: execSQL(`
+			ALTER TABLE emails ADD COLUMN parser_version INTEGER NOT NULL DEFAULT 0;
+			CREATE INDEX idx_emails_parser_version ON emails(parser_version);
+		`),
+		down: execSQL(`
+			DROP INDEX idx_emails_parser_version;
+			ALTER TABLE emails DROP COLUMN parser_version;
+		`)},
+	{version: 3, name: "scan job kinds",
+		up:   execSQL("ALTER TABLE scan_jobs ADD COLUMN kind TEXT NOT NULL DEFAULT 'scan'"),
+		down: execSQL("ALTER TABLE scan_jobs DROP COLUMN kind")},
+	// An external content FTS5 table cannot be updated in place: the old
+	// terms have to be deleted with the old values before the new ones go in
+	{version: 4, name: "search index update trigger",
+		up: execSQL(`
+			DROP TRIGGER emails_au;
+			CREATE TRIGGER emails_au AFTER UPDATE OF subject, sender, sender_name, recipients, body_text_preview ON emails BEGIN
+			    INSERT INTO emails_fts(emails_fts, rowid, subject, sender, sender_name, recipients, body_text_preview)
+			    VALUES ('delete', old.id, old.subject, old.sender, old.sender_name, old.recipients, old.body_text_preview);
+			    INSERT INTO emails_fts(rowid, subject, sender, sender_name, recipients, body_text_preview)
+			    VALUES (new.id, new.subject, new.sender, new.sender_name, new.recipients, new.body_text_preview);
+			END;
+			INSERT INTO emails_fts(emails_fts) VALUES ('rebuild');
+		`),
+		down: execSQL(`
+			DROP TRIGGER emails_au;
+			CREATE TRIGGER emails_au AFTER UPDATE ON emails BEGIN
+			    UPDATE emails_fts
+			    SET subject = new.subject,
+			        sender = new.sender,
+			        sender_name = new.sender_name,
+			        recipients = new.recipients,
+			        body_text_preview = new.body_text_preview
+			    WHERE rowid = new.id;
+			END;
+		`)},
+	{version: 5, name: "saved search filters",
+		up: execSQL(`
+			ALTER TABLE saved_searches ADD COLUMN collapse_duplicates BOOLEAN NOT NULL DEFAULT 0;
+			ALTER TABLE saved_searches ADD COLUMN sensitive TEXT NOT NULL DEFAULT '';
+			ALTER TABLE saved_searches ADD COLUMN link TEXT NOT NULL DEFAULT '';
+			ALTER TABLE saved_searches ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+			ALTER TABLE saved_searches ADD COLUMN auth TEXT NOT NULL DEFAULT '';
+			ALTER TABLE saved_searches ADD COLUMN date_uncertain BOOLEAN NOT NULL DEFAULT 0;
+		`),
+		down: execSQL(`
+			ALTER TABLE saved_searches DROP COLUMN collapse_duplicates;
+			ALTER TABLE saved_searches DROP COLUMN sensitive;
+			ALTER TABLE saved_searches DROP COLUMN link;
+			ALTER TABLE saved_searches DROP COLUMN domain;
+			ALTER TABLE saved_searches DROP COLUMN auth;
+			ALTER TABLE saved_searches DROP COLUMN date_uncertain;
+		`)},
+	// A re-parse compares body hashes to tell whether redaction offsets
+	// still point at the text they were made on
+	{version: 6, name: "body hashes and stale redactions",
+		up: execSQL(`
+			ALTER TABLE emails ADD COLUMN body_hash TEXT;
+			ALTER TABLE redactions ADD COLUMN stale BOOLEAN NOT NULL DEFAULT 0;
+		`),
+		down: execSQL(`
+			ALTER TABLE redactions DROP COLUMN stale;
+			ALTER TABLE emails DROP COLUMN body_hash;
+		`)},
+}
+
+// migrationsTable records the applied migrations; it is created outside the
+// migrations, as they are tracked in it
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+);
+`
+
+// execSQL returns a migration step running query
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// migrateBaseline creates the schema as it was before migrations were
+// versioned, bringing databases made by any earlier release up to it
+func migrateBaseline(tx *sql.Tx) error {
+	legacy, err := columnExists(tx, "emails", "body_html")
+	if err != nil {
+		return err
+	}
+	if legacy {
+		if _, err := tx.Exec(migrationSchema); err != nil {
+			return fmt.Errorf("failed to rebuild pre-optimization tables: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("failed to execute schema: %w", err)
+	}
+
+	for _, c := range addedColumns {
+		exists, err := columnExists(tx, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	if _, err := tx.Exec(schemaIndexes); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// columnExists reports whether a table has a column
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`
+		SELECT COUNT(*) > 0
+		FROM pragma_table_info(?)
+		WHERE name = ?
+	`, table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check column %s.%s: %w", table, column, err)
+	}
+	return exists, nil
+}
+
+// Migration is a schema migration and whether it has been applied
+type Migration struct {
+	Version    int
+	Name       string
+	Applied    bool
+	AppliedAt  NullTime
+	Reversible bool
+}
+
+// LatestSchemaVersion returns the schema version this build migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the version of the last applied migration, or 0 for
+// a database that has never been migrated
+func (db *DB) SchemaVersion() (int, error) {
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return 0, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrations lists every migration known to this build with its status,
+// followed by any applied migrations it does not know
+func (db *DB) Migrations() ([]Migration, error) {
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	rows, err := db.Query("SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]Migration)
+	for rows.Next() {
+		m := Migration{Applied: true}
+		if err := rows.Scan(&m.Version, &m.Name, &m.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[m.Version] = m
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating migrations: %w", err)
+	}
+
+	var list []Migration
+	for _, m := range migrations {
+		status := Migration{Version: m.version, Name: m.name, Reversible: m.down != nil}
+		if a, ok := applied[m.version]; ok {
+			status.Applied, status.AppliedAt = true, a.AppliedAt
+			delete(applied, m.version)
+		}
+		list = append(list, status)
+	}
+	for version := LatestSchemaVersion() + 1; len(applied) > 0; version++ {
+		if a, ok := applied[version]; ok {
+			list = append(list, a)
+			delete(applied, version)
+		}
+	}
+	return list, nil
+}
+
+// Migrate applies pending migrations up to and including version, returning
+// how many it applied
+func (db *DB) Migrate(version int) (int, error) {
+	return db.migrate(migrations, version)
+}
+
+// Rollback undoes applied migrations newer than version, newest first,
+// returning how many it undid
+func (db *DB) Rollback(version int) (int, error) {
+	return db.rollback(migrations, version)
+}
+
+// migrate applies the pending migrations in list up to version
+func (db *DB) migrate(list []migration, version int) (int, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if current > list[len(list)-1].version {
+		return 0, fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, list[len(list)-1].version)
+	}
+
+	count := 0
+	for _, m := range list {
+		if m.version <= current || m.version > version {
+			continue
+		}
+		err := db.inTx(func(tx *sql.Tx) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				m.version, m.name, time.Now())
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// rollback undoes the applied migrations in list newer than version
+func (db *DB) rollback(list []migration, version int) (int, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	// Check first, so a rollback is not left halfway
+	for _, m := range list {
+		if m.version <= current && m.version > version && m.down == nil {
+			return 0, fmt.Errorf("migration %d (%s) cannot be rolled back", m.version, m.name)
+		}
+	}
+
+	count := 0
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if m.version > current || m.version <= version {
+			continue
+		}
+		err := db.inTx(func(tx *sql.Tx) error {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to roll back migration %d (%s): %w", m.version, m.name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// inTx runs fn in a transaction, committing if it succeeds
+func (db *DB) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist yet
+func (db *DB) Backup(path string) error {
+	_, err := db.Exec("VACUUM INTO ?", path)
+	if err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// BackupBeforeMigrating backs up a database that has data to a file beside
+// it, named after the current schema version and the time. It returns the
+// backup's path, or "" if there was nothing to back up.
+func (db *DB) BackupBeforeMigrating() (string, error) {
+	if db.path == "" || db.path == ":memory:" || strings.HasPrefix(db.path, "file::memory:") {
+		return "", nil
+	}
+	var tables int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations'").Scan(&tables)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for existing tables: %w", err)
+	}
+	if tables == 0 {
+		return "", nil
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("%s.v%d-%s.bak", db.path, current, time.Now().Format("20060102-150405"))
+	if err := db.Backup(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// migrateOnOpen brings the schema up to date, first backing up a database
+// that already has data. It returns the backup's path, or "" if none was
+// needed.
+func (db *DB) migrateOnOpen() (string, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return "", err
+	}
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return "", fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+	if current == latest {
+		return "", nil
+	}
+
+	backup, err := db.BackupBeforeMigrating()
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Migrate(latest); err != nil {
+		return backup, err
+	}
+	return backup, nil
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrationVersionsAreSequential tests that migrations are numbered 1, 2, 3...
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, m.name)
+		assert.NotEmpty(t, m.name)
+		assert.NotNil(t, m.up, m.name)
+	}
+}
+
+// TestOpenMigratesLegacyDatabase tests that Open brings a database from an
+// early release up to date and backs it up first
+func TestOpenMigratesLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "emails.db")
+
+	// Pre-optimization schema: body_html, no threading columns
+	old, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = old.Exec(`
+		CREATE TABLE emails (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, file_path TEXT UNIQUE NOT NULL,
+			message_id TEXT, subject TEXT, sender TEXT NOT NULL, sender_name TEXT,
+			recipients TEXT, date DATETIME, body_text TEXT, body_html TEXT,
+			has_attachments BOOLEAN DEFAULT 0, attachment_count INTEGER DEFAULT 0, file_size INTEGER,
+			indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, email_id INTEGER NOT NULL,
+			filename TEXT NOT NULL, content_type TEXT, size INTEGER, data BLOB
+		);
+		INSERT INTO emails (file_path, sender, subject, body_text, body_html)
+		VALUES ('old.eml', 'old@test.com', 'Quarterly numbers', 'See attached', '<p>See attached</p>');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	var matches int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM emails_fts WHERE emails_fts MATCH 'quarterly'").Scan(&matches))
+	assert.Equal(t, 1, matches, "Search index rebuilt from the old rows")
+	var preview string
+	require.NoError(t, db.QueryRow("SELECT body_text_preview FROM emails").Scan(&preview))
+	assert.Equal(t, "See attached", preview)
+
+	var hasBodyHTML bool
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('emails') WHERE name = 'body_html'").Scan(&hasBodyHTML))
+	assert.False(t, hasBodyHTML)
+
+	backups, err := filepath.Glob(path + ".v0-*.bak")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	backup, err := sql.Open("sqlite", backups[0])
+	require.NoError(t, err)
+	defer backup.Close()
+	require.NoError(t, backup.QueryRow("SELECT COUNT(*) > 0 FROM pragma_table_info('emails') WHERE name = 'body_html'").Scan(&hasBodyHTML))
+	assert.True(t, hasBodyHTML, "Backup keeps the schema from before migrating")
+
+	// Up to date databases are neither migrated nor backed up again
+	require.NoError(t, db.Close())
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	backups, err = filepath.Glob(path + ".*.bak")
+	require.NoError(t, err)
+	assert.Len(t, backups, 1)
+}
+
+// TestMigrateAndRollback tests applying and undoing migrations, and that a
+// failing migration leaves nothing behind
+func TestMigrateAndRollback(t *testing.T) {
+	db, err := OpenUnmigrated(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	list := []migration{
+		{version: 1, name: "notes", up: execSQL("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)")},
+		{version: 2, name: "note titles",
+			up:   execSQL("ALTER TABLE notes ADD COLUMN title TEXT"),
+			down: execSQL("ALTER TABLE notes DROP COLUMN title")},
+		{version: 3, name: "broken", up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errors.New("disk full")
+		}},
+	}
+
+	applied, err := db.migrate(list, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	_, err = db.Exec("INSERT INTO notes (body, title) VALUES ('b', 't')")
+	require.NoError(t, err)
+
+	applied, err = db.migrate(list, 3)
+	require.Error(t, err)
+	assert.Zero(t, applied)
+	assert.Contains(t, err.Error(), "migration 3 (broken)")
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'").Scan(&tables))
+	assert.Zero(t, tables, "Failed migration is rolled back")
+
+	undone, err := db.rollback(list, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, undone)
+	_, err = db.Exec("INSERT INTO notes (body, title) VALUES ('b', 't')")
+	assert.Error(t, err, "Column removed by the rollback")
+
+	_, err = db.rollback(list, 0)
+	assert.ErrorContains(t, err, "cannot be rolled back")
+	version, err = db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+
+	// A database from a newer build is left alone
+	_, err = db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9, 'future', CURRENT_TIMESTAMP)")
+	require.NoError(t, err)
+	_, err = db.migrate(list, 3)
+	assert.ErrorContains(t, err, "newer than this build supports")
+}
+
+// TestMigrations tests listing migrations with their status
+func TestMigrations(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	list, err := db.Migrations()
+	require.NoError(t, err)
+	require.Len(t, list, len(migrations))
+	assert.Equal(t, "baseline", list[0].Name)
+	for _, m := range list {
+		assert.True(t, m.Applied, m.Name)
+		assert.True(t, m.AppliedAt.Valid, m.Name)
+	}
+	assert.False(t, list[0].Reversible)
+
+	// Later migrations roll back and apply again cleanly
+	undone, err := db.Rollback(1)
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion()-1, undone)
+	applied, err := db.Migrate(LatestSchemaVersion())
+	require.NoError(t, err)
+	assert.Equal(t, undone, applied)
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Correspondence counts emails from one sender to one set of recipients
+type Correspondence struct {
+	Sender     string // Lowercased address
+	SenderName string
+	Recipients []string // Lowercased To addresses
+	Count      int
+}
+
+// GetCorrespondence counts emails matching a filter set per sender and
+// recipient list, the raw material for a who-talks-to-whom graph
+func (db *DB) GetCorrespondence(f SearchFilters) ([]*Correspondence, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	from, args := f.from("e.sender <> ''")
+	rows, err := db.Query(`
+		SELECT LOWER(e.sender) AS s, MAX(COALESCE(e.sender_name, '')), LOWER(COALESCE(e.recipients, '')) AS r, COUNT(*)`+from+`
+		GROUP BY s, r
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count correspondence: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*Correspondence
+	for rows.Next() {
+		c := &Correspondence{}
+		var recipients string
+		if err := rows.Scan(&c.Sender, &c.SenderName, &recipients, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan correspondence: %w", err)
+		}
+		for _, r := range strings.Split(recipients, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				c.Recipients = append(c.Recipients, r)
+			}
+		}
+		result = append(result, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating correspondence: %w", err)
+	}
+
+	return result, nil
+}
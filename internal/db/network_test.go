@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetCorrespondence tests grouping by sender and recipient list
+func TestGetCorrespondence(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	first := CreateTestEmail("Plan", "Alice@acme.com", "a")
+	first.Recipients = "Bob@acme.com, carol@other.org"
+	second := CreateTestEmail("Plan v2", "alice@acme.com", "b")
+	second.Recipients = "bob@acme.com, carol@other.org"
+	reply := CreateTestEmail("Re: Plan", "bob@acme.com", "c")
+	reply.Recipients = "alice@acme.com"
+	InsertTestEmails(t, db, []*Email{first, second, reply})
+
+	rows, err := db.GetCorrespondence(SearchFilters{})
+	require.NoError(t, err)
+	require.Len(t, rows, 2, "Addresses are compared case-insensitively")
+
+	for _, r := range rows {
+		if r.Sender == "alice@acme.com" {
+			assert.Equal(t, 2, r.Count)
+			assert.Equal(t, []string{"bob@acme.com", "carol@other.org"}, r.Recipients)
+		}
+	}
+
+	rows, err = db.GetCorrespondence(SearchFilters{Query: "reply"})
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
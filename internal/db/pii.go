@@ -0,0 +1,168 @@
+package db
+
+import "fmt"
+
+// Sources of PII findings
+const (
+	PIISourceBody       = "body"
+	PIISourceHTML       = "html"
+	PIISourceAttachment = "attachment"
+)
+
+// SensitiveAny is the SearchFilters.Sensitive value matching emails with any
+// kind of sensitive data
+const SensitiveAny = "any"
+
+// hasPIIFindings and hasPIIFindingsOfType match emails "e" with sensitive
+// data; the latter takes the finding type as an argument
+const (
+	hasPIIFindings       = "EXISTS (SELECT 1 FROM pii_findings pf WHERE pf.email_id = e.id)"
+	hasPIIFindingsOfType = "EXISTS (SELECT 1 FROM pii_findings pf WHERE pf.email_id = e.id AND pf.type = ?)"
+)
+
+// PIIFinding is a piece of sensitive data found in an email. Start and End are
+// byte offsets of the value in the source text (the plain text body, the HTML
+// body, or the named attachment).
+type PIIFinding struct {
+	ID                 int64
+	EmailID            int64
+	Type               string
+	Source             string
+	AttachmentFilename string
+	Start              int
+	End                int
+	Masked             string
+}
+
+// PIITypeCount is the number of findings and flagged emails of one type
+type PIITypeCount struct {
+	Type     string
+	Emails   int
+	Findings int
+}
+
+// PIIReport summarizes the sensitive data found in a set of emails
+type PIIReport struct {
+	Total     int // Emails matching the filters
+	Unscanned int // Emails the PII scan has not run on yet
+	Flagged   int // Emails with at least one finding
+	ByType    []*PIITypeCount
+}
+
+// SavePIIFindings replaces the findings of an email and marks it as scanned
+func (db *DB) SavePIIFindings(emailID int64, findings []*PIIFinding) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM pii_findings WHERE email_id = ?", emailID); err != nil {
+		return fmt.Errorf("failed to clear pii findings: %w", err)
+	}
+	for _, f := range findings {
+		_, err := tx.Exec(`
+			INSERT INTO pii_findings (email_id, type, source, attachment_filename, start_offset, end_offset, masked)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, emailID, f.Type, f.Source, f.AttachmentFilename, f.Start, f.End, f.Masked)
+		if err != nil {
+			return fmt.Errorf("failed to insert pii finding: %w", err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE emails SET pii_scanned = 1 WHERE id = ?", emailID); err != nil {
+		return fmt.Errorf("failed to mark email as scanned: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetPIIFindings retrieves the findings of an email in source and offset order
+func (db *DB) GetPIIFindings(emailID int64) ([]*PIIFinding, error) {
+	rows, err := db.Query(`
+		SELECT id, email_id, type, source, attachment_filename, start_offset, end_offset, masked
+		FROM pii_findings
+		WHERE email_id = ?
+		ORDER BY source, attachment_filename, start_offset
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pii findings: %w", err)
+	}
+	defer rows.Close()
+
+	var findings []*PIIFinding
+	for rows.Next() {
+		f := &PIIFinding{}
+		if err := rows.Scan(&f.ID, &f.EmailID, &f.Type, &f.Source, &f.AttachmentFilename, &f.Start, &f.End, &f.Masked); err != nil {
+			return nil, fmt.Errorf("failed to scan pii finding: %w", err)
+		}
+		findings = append(findings, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pii findings: %w", err)
+	}
+
+	return findings, nil
+}
+
+// EmailsNeedingPIIScan retrieves the emails the PII scan has not run on
+func (db *DB) EmailsNeedingPIIScan() ([]*Email, error) {
+	return db.listEmailsWhere("pii_scanned = 0 OR pii_scanned IS NULL")
+}
+
+// ResetPIIScan deletes every finding and marks all emails as unscanned
+func (db *DB) ResetPIIScan() error {
+	if _, err := db.Exec("DELETE FROM pii_findings"); err != nil {
+		return fmt.Errorf("failed to clear pii findings: %w", err)
+	}
+	if _, err := db.Exec("UPDATE emails SET pii_scanned = 0"); err != nil {
+		return fmt.Errorf("failed to reset pii scan: %w", err)
+	}
+	return nil
+}
+
+// GetPIIReport summarizes the sensitive data in the emails matching the filters
+func (db *DB) GetPIIReport(f SearchFilters) (*PIIReport, error) {
+	report := &PIIReport{}
+
+	from, args := f.from()
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(SUM(CASE WHEN e.pii_scanned THEN 0 ELSE 1 END), 0)"+from, args...).
+		Scan(&report.Total, &report.Unscanned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count scanned emails: %w", err)
+	}
+
+	flagged, flaggedArgs := f.from(hasPIIFindings)
+	if err := db.QueryRow("SELECT COUNT(*)"+flagged, flaggedArgs...).Scan(&report.Flagged); err != nil {
+		return nil, fmt.Errorf("failed to count flagged emails: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT pf.type, COUNT(DISTINCT pf.email_id), COUNT(*)
+		FROM pii_findings pf
+		WHERE pf.email_id IN (SELECT e.id`+from+`)
+		GROUP BY pf.type
+		ORDER BY COUNT(DISTINCT pf.email_id) DESC, pf.type ASC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pii findings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := &PIITypeCount{}
+		if err := rows.Scan(&c.Type, &c.Emails, &c.Findings); err != nil {
+			return nil, fmt.Errorf("failed to scan pii count: %w", err)
+		}
+		report.ByType = append(report.ByType, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pii counts: %w", err)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSavePIIFindings tests storing, replacing and resetting findings
+func TestSavePIIFindings(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	emails := InsertTestEmails(t, db, []*Email{
+		CreateTestEmail("Card", "alice@acme.com", "card"),
+		CreateTestEmail("Plain", "bob@acme.com", "nothing"),
+	})
+
+	pending, err := db.EmailsNeedingPIIScan()
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	require.NoError(t, db.SavePIIFindings(emails[0].ID, []*PIIFinding{
+		{Type: "phone", Source: PIISourceBody, Start: 40, End: 52, Masked: "***-***-0132"},
+		{Type: "credit_card", Source: PIISourceBody, Start: 5, End: 24, Masked: "**** **** **** 1111"},
+		{Type: "password", Source: PIISourceAttachment, AttachmentFilename: "creds.txt", Start: 10, End: 18, Masked: "********"},
+	}))
+	require.NoError(t, db.SavePIIFindings(emails[1].ID, nil))
+
+	findings, err := db.GetPIIFindings(emails[0].ID)
+	require.NoError(t, err)
+	require.Len(t, findings, 3)
+	assert.Equal(t, PIISourceAttachment, findings[0].Source)
+	assert.Equal(t, "credit_card", findings[1].Type, "Body findings in offset order")
+	assert.Equal(t, 5, findings[1].Start)
+
+	pending, err = db.EmailsNeedingPIIScan()
+	require.NoError(t, err)
+	assert.Empty(t, pending, "An email without findings still counts as scanned")
+
+	// Saving again replaces the previous findings
+	require.NoError(t, db.SavePIIFindings(emails[0].ID, []*PIIFinding{
+		{Type: "iban", Source: PIISourceBody, Start: 0, End: 22, Masked: "****************5432"},
+	}))
+	findings, err = db.GetPIIFindings(emails[0].ID)
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, "iban", findings[0].Type)
+
+	require.NoError(t, db.ResetPIIScan())
+	findings, err = db.GetPIIFindings(emails[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+	pending, err = db.EmailsNeedingPIIScan()
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+// TestPIIReportAndFilter tests the sensitive data report and search filter
+func TestPIIReportAndFilter(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	emails := InsertTestEmails(t, db, []*Email{
+		CreateTestEmail("Card", "alice@acme.com", "a"),
+		CreateTestEmail("Card and phone", "bob@acme.com", "b"),
+		CreateTestEmail("Clean", "carol@other.org", "c"),
+		CreateTestEmail("Unscanned", "dave@other.org", "d"),
+	})
+	require.NoError(t, db.SavePIIFindings(emails[0].ID, []*PIIFinding{
+		{Type: "credit_card", Source: PIISourceBody, Masked: "1111"},
+	}))
+	require.NoError(t, db.SavePIIFindings(emails[1].ID, []*PIIFinding{
+		{Type: "credit_card", Source: PIISourceBody, Masked: "1111"},
+		{Type: "credit_card", Source: PIISourceBody, Start: 30, Masked: "4444"},
+		{Type: "phone", Source: PIISourceBody, Masked: "0132"},
+	}))
+	require.NoError(t, db.SavePIIFindings(emails[2].ID, nil))
+
+	report, err := db.GetPIIReport(SearchFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 1, report.Unscanned)
+	assert.Equal(t, 2, report.Flagged)
+	require.Len(t, report.ByType, 2)
+	assert.Equal(t, &PIITypeCount{Type: "credit_card", Emails: 2, Findings: 3}, report.ByType[0])
+	assert.Equal(t, &PIITypeCount{Type: "phone", Emails: 1, Findings: 1}, report.ByType[1])
+
+	report, err = db.GetPIIReport(SearchFilters{Sender: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Flagged)
+	require.Len(t, report.ByType, 1)
+
+	count, err := db.CountFiltered(SearchFilters{Sensitive: SensitiveAny})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	results, err := db.SearchFiltered(SearchFilters{Sensitive: "phone"}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Card and phone", results[0].Subject)
+
+	assert.NoError(t, SearchFilters{Sensitive: "iban"}.Validate())
+	assert.Error(t, SearchFilters{Sensitive: "bogus"}.Validate())
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrBatesNumberUsed is returned when a production would reuse Bates numbers
+var ErrBatesNumberUsed = errors.New("bates number already used")
+
+// Production represents a recorded eDiscovery production
+type Production struct {
+	ID            int64
+	Name          string
+	Prefix        string
+	Custodian     string
+	StartNumber   int64
+	EndNumber     int64
+	DocumentCount int
+	CreatedAt     NullTime
+}
+
+// ProductionDocument is one numbered document in a production:
+// either an email or one of its attachments
+type ProductionDocument struct {
+	ID           int64
+	ProductionID int64
+	Bates        string
+	BatesNumber  int64
+	EmailID      int64
+	AttachmentID sql.NullInt64 // Invalid for the parent email itself
+	ParentBates  string        // Bates of the parent email for attachments
+	MD5          string
+}
+
+// NextBatesNumber returns the first unused Bates number for a prefix
+func (db *DB) NextBatesNumber(prefix string) (int64, error) {
+	var next int64
+	err := db.QueryRow(`
+		SELECT COALESCE(MAX(end_number), 0) + 1 FROM productions WHERE prefix = ?
+	`, prefix).Scan(&next)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next Bates number: %w", err)
+	}
+	return next, nil
+}
+
+// CreateProduction records a production and reserves all of its Bates numbers
+// in a single transaction. It fails if any number in the range was already
+// used for the same prefix, so numbers are never handed out twice.
+func (db *DB) CreateProduction(p *Production, docs []*ProductionDocument) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var used int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(MAX(end_number), 0) FROM productions WHERE prefix = ?
+	`, p.Prefix).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check Bates range: %w", err)
+	}
+	if p.StartNumber <= used {
+		return 0, fmt.Errorf("%w: %d for prefix %q (next free is %d)", ErrBatesNumberUsed, p.StartNumber, p.Prefix, used+1)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO productions (name, prefix, custodian, start_number, end_number, document_count)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, p.Name, p.Prefix, p.Custodian, p.StartNumber, p.EndNumber, len(docs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert production: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO production_documents (production_id, bates, bates_number, email_id, attachment_id, parent_bates)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, doc := range docs {
+		if _, err := stmt.Exec(id, doc.Bates, doc.BatesNumber, doc.EmailID, doc.AttachmentID, doc.ParentBates); err != nil {
+			return 0, fmt.Errorf("failed to insert production document %s: %w", doc.Bates, err)
+		}
+		doc.ProductionID = id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	p.ID = id
+	p.DocumentCount = len(docs)
+	return id, nil
+}
+
+// SetProductionHashes stores the MD5 hashes computed while rendering documents
+func (db *DB) SetProductionHashes(productionID int64, hashes map[string]string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE production_documents SET md5 = ? WHERE production_id = ? AND bates = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for bates, md5 := range hashes {
+		if _, err := stmt.Exec(md5, productionID, bates); err != nil {
+			return fmt.Errorf("failed to update hash for %s: %w", bates, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ListProductions retrieves all productions, newest first
+func (db *DB) ListProductions() ([]*Production, error) {
+	rows, err := db.Query(`
+		SELECT id, name, prefix, custodian, start_number, end_number, document_count, created_at
+		FROM productions
+		ORDER BY id DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list productions: %w", err)
+	}
+	defer rows.Close()
+
+	var productions []*Production
+	for rows.Next() {
+		p := &Production{}
+		err := rows.Scan(&p.ID, &p.Name, &p.Prefix, &p.Custodian, &p.StartNumber, &p.EndNumber, &p.DocumentCount, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan production: %w", err)
+		}
+		productions = append(productions, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating productions: %w", err)
+	}
+
+	return productions, nil
+}
+
+// GetProductionDocuments retrieves the documents of a production in Bates order
+func (db *DB) GetProductionDocuments(productionID int64) ([]*ProductionDocument, error) {
+	rows, err := db.Query(`
+		SELECT id, production_id, bates, bates_number, email_id, attachment_id,
+		       COALESCE(parent_bates, ''), COALESCE(md5, '')
+		FROM production_documents
+		WHERE production_id = ?
+		ORDER BY bates_number ASC
+	`, productionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get production documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []*ProductionDocument
+	for rows.Next() {
+		d := &ProductionDocument{}
+		err := rows.Scan(&d.ID, &d.ProductionID, &d.Bates, &d.BatesNumber, &d.EmailID, &d.AttachmentID, &d.ParentBates, &d.MD5)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan production document: %w", err)
+		}
+		docs = append(docs, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating production documents: %w", err)
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRedactionNotFound is returned when deleting a redaction that does not exist
+var ErrRedactionNotFound = errors.New("redaction not found")
+
+// Redaction is a span of an email body hidden in redacted renderings. Start
+// and End are byte offsets in the plain text body (source "body") or the HTML
+// body (source "html").
+type Redaction struct {
+	ID        int64
+	EmailID   int64
+	Source    string
+	Start     int
+	End       int
+	Label     string
+	Stale     bool // The body changed since it was made; see UpdateParsedEmail
+	CreatedAt NullTime
+}
+
+// AddRedaction stores a redaction. Marking the same span twice is a no-op,
+// except that it confirms a stale redaction of that span.
+func (db *DB) AddRedaction(r *Redaction) error {
+	_, err := db.Exec(`
+		INSERT INTO redactions (email_id, source, start_offset, end_offset, label)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(email_id, source, start_offset, end_offset) DO UPDATE SET stale = 0
+	`, r.EmailID, r.Source, r.Start, r.End, r.Label)
+	if err != nil {
+		return fmt.Errorf("failed to add redaction: %w", err)
+	}
+	return nil
+}
+
+// AcceptPIIFindings turns an email's body findings into redactions and
+// returns how many were added; stale redactions of the same spans are
+// confirmed. Attachment findings are skipped because redacted renderings
+// leave attachments out.
+func (db *DB) AcceptPIIFindings(emailID int64) (int, error) {
+	_, err := db.Exec(`
+		UPDATE redactions SET stale = 0
+		WHERE email_id = ? AND stale AND EXISTS (
+			SELECT 1 FROM pii_findings f
+			WHERE f.email_id = redactions.email_id AND f.source = redactions.source
+			  AND f.start_offset = redactions.start_offset AND f.end_offset = redactions.end_offset
+		)
+	`, emailID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to confirm redactions: %w", err)
+	}
+
+	result, err := db.Exec(`
+		INSERT OR IGNORE INTO redactions (email_id, source, start_offset, end_offset, label)
+		SELECT email_id, source, start_offset, end_offset, type
+		FROM pii_findings
+		WHERE email_id = ? AND source IN (?, ?)
+	`, emailID, PIISourceBody, PIISourceHTML)
+	if err != nil {
+		return 0, fmt.Errorf("failed to accept pii findings: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(n), nil
+}
+
+// GetRedactions retrieves an email's redactions in source and offset order
+func (db *DB) GetRedactions(emailID int64) ([]*Redaction, error) {
+	rows, err := db.Query(`
+		SELECT id, email_id, source, start_offset, end_offset, label, stale, created_at
+		FROM redactions
+		WHERE email_id = ?
+		ORDER BY source, start_offset, end_offset
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redactions: %w", err)
+	}
+	defer rows.Close()
+
+	var redactions []*Redaction
+	for rows.Next() {
+		r := &Redaction{}
+		if err := rows.Scan(&r.ID, &r.EmailID, &r.Source, &r.Start, &r.End, &r.Label, &r.Stale, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan redaction: %w", err)
+		}
+		redactions = append(redactions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating redactions: %w", err)
+	}
+
+	return redactions, nil
+}
+
+// DeleteRedaction removes one of an email's redactions
+func (db *DB) DeleteRedaction(emailID, id int64) error {
+	result, err := db.Exec("DELETE FROM redactions WHERE id = ? AND email_id = ?", id, emailID)
+	if err != nil {
+		return fmt.Errorf("failed to delete redaction: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrRedactionNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedactions tests adding, accepting and deleting redactions
+func TestRedactions(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	emails := InsertTestEmails(t, db, []*Email{
+		CreateTestEmail("Card", "alice@acme.com", "card"),
+	})
+	id := emails[0].ID
+
+	require.NoError(t, db.SavePIIFindings(id, []*PIIFinding{
+		{Type: "credit_card", Source: PIISourceBody, Start: 5, End: 24, Masked: "**** **** **** 1111"},
+		{Type: "password", Source: PIISourceAttachment, AttachmentFilename: "creds.txt", Start: 10, End: 18, Masked: "********"},
+	}))
+
+	require.NoError(t, db.AddRedaction(&Redaction{EmailID: id, Source: PIISourceBody, Start: 30, End: 40, Label: "name"}))
+	require.NoError(t, db.AddRedaction(&Redaction{EmailID: id, Source: PIISourceBody, Start: 30, End: 40}), "Duplicate span is ignored")
+
+	n, err := db.AcceptPIIFindings(id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "Attachment findings are not accepted")
+	n, err = db.AcceptPIIFindings(id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "Accepting twice adds nothing")
+
+	redactions, err := db.GetRedactions(id)
+	require.NoError(t, err)
+	require.Len(t, redactions, 2)
+	assert.Equal(t, "credit_card", redactions[0].Label)
+	assert.Equal(t, 5, redactions[0].Start)
+	assert.Equal(t, "name", redactions[1].Label)
+
+	require.NoError(t, db.DeleteRedaction(id, redactions[1].ID))
+	assert.ErrorIs(t, db.DeleteRedaction(id, redactions[1].ID), ErrRedactionNotFound)
+	assert.ErrorIs(t, db.DeleteRedaction(id+1, redactions[0].ID), ErrRedactionNotFound, "Redaction belongs to another email")
+
+	// Deleting the email removes its redactions
+	_, err = db.Exec("DELETE FROM emails WHERE id = ?", id)
+	require.NoError(t, err)
+	redactions, err = db.GetRedactions(id)
+	require.NoError(t, err)
+	assert.Empty(t, redactions)
+}
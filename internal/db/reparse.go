@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// EmailsBelowParserVersion lists up to limit emails indexed by a parser
+// older than version with IDs above afterID, oldest first, so callers can
+// page through them
+func (db *DB) EmailsBelowParserVersion(version int, afterID int64, limit int) ([]*Email, error) {
+	return db.listEmailsWhere(`id IN (
+		SELECT id FROM emails WHERE parser_version < ? AND id > ? ORDER BY id LIMIT ?
+	)`, version, afterID, limit)
+}
+
+// CountEmailsBelowParserVersion counts the emails indexed by a parser older
+// than version
+func (db *DB) CountEmailsBelowParserVersion(version int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM emails WHERE parser_version < ?", version).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count emails to re-parse: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateParsedEmail replaces an email's parsed metadata and attachments with
+// those from parsing its file again. The email keeps its ID, and each
+// attachment row keeps its ID when a part with the same filename, content
+// type and size is still there; its hash is taken from the new parse.
+// Parts that match no row get new rows, and rows that match no part are
+// deleted. IDs are never reused, so a production that listed a deleted row
+// never ends up pointing at other content. The file's size, hash and
+// authentication verdict recorded at intake are kept.
+//
+// Sensitive data findings are cleared for the next PII scan. When the body
+// hash changes, or was not recorded, the email's redactions are marked
+// stale: their offsets may no longer cover the text they were made on.
+func (db *DB) UpdateParsedEmail(email *Email, attachments []*Attachment) error {
+	defer db.nearDuplicates.invalidate()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldBodyHash sql.NullString
+	if err := tx.QueryRow("SELECT body_hash FROM emails WHERE id = ?", email.ID).Scan(&oldBodyHash); err != nil {
+		return fmt.Errorf("failed to get email %s: %w", email.FilePath, err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE emails
+		SET message_id = ?, in_reply_to = ?, thread_references = ?,
+		    subject = ?, sender = ?, sender_name = ?, recipients = ?, date = ?, date_source = ?,
+		    body_text_preview = ?, has_attachments = ?, attachment_count = ?,
+		    content_hash = ?, minhash = ?, parser_version = ?, body_hash = ?,
+		    pii_scanned = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`,
+		email.MessageID, email.InReplyTo, email.ThreadReferences,
+		email.Subject, email.Sender, email.SenderName, email.Recipients, email.Date, email.DateSource,
+		email.BodyTextPreview, email.HasAttachments, email.AttachmentCount,
+		nullString(email.ContentHash), email.MinHash, email.ParserVersion, nullString(email.BodyHash),
+		email.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update email %s: %w", email.FilePath, err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM pii_findings WHERE email_id = ?", email.ID); err != nil {
+		return fmt.Errorf("failed to clear pii findings: %w", err)
+	}
+	if !oldBodyHash.Valid || oldBodyHash.String != email.BodyHash {
+		if _, err := tx.Exec("UPDATE redactions SET stale = 1 WHERE email_id = ?", email.ID); err != nil {
+			return fmt.Errorf("failed to flag redactions: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM email_minhash_bands WHERE email_id = ?", email.ID); err != nil {
+		return fmt.Errorf("failed to clear minhash bands: %w", err)
+	}
+	bandStmt, err := tx.Prepare(insertMinHashBandSQL)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer bandStmt.Close()
+	if err := insertMinHashBands(bandStmt.Exec, email.ID, email.MinHash); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, filename, COALESCE(content_type, ''), COALESCE(size, 0) FROM attachments WHERE email_id = ? ORDER BY id", email.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get attachments: %w", err)
+	}
+	var existing []*Attachment
+	for rows.Next() {
+		att := &Attachment{}
+		if err := rows.Scan(&att.ID, &att.Filename, &att.ContentType, &att.Size); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		existing = append(existing, att)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating attachments: %w", err)
+	}
+
+	matched := make(map[int64]bool, len(existing))
+	for _, att := range attachments {
+		var row *Attachment
+		for _, candidate := range existing {
+			if !matched[candidate.ID] && candidate.Key() == att.Key() {
+				row = candidate
+				break
+			}
+		}
+		if row != nil {
+			matched[row.ID] = true
+			_, err = tx.Exec("UPDATE attachments SET sha256 = ? WHERE id = ?", nullString(att.SHA256), row.ID)
+		} else {
+			_, err = tx.Exec("INSERT INTO attachments (email_id, filename, content_type, size, sha256) VALUES (?, ?, ?, ?, ?)",
+				email.ID, att.Filename, att.ContentType, att.Size, nullString(att.SHA256))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save attachment %s: %w", att.Filename, err)
+		}
+	}
+	for _, row := range existing {
+		if matched[row.ID] {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM attachments WHERE id = ?", row.ID); err != nil {
+			return fmt.Errorf("failed to delete attachment: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEmailsBelowParserVersion tests paging through stale emails by ID
+func TestEmailsBelowParserVersion(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	var stale []int64
+	for i := 1; i <= 5; i++ {
+		email := CreateTestEmail(fmt.Sprintf("email%d", i), "a@test.com", "Body")
+		if i == 3 {
+			email.ParserVersion = 2 // Up to date
+		}
+		id, err := db.InsertEmail(email)
+		require.NoError(t, err)
+		if i != 3 {
+			stale = append(stale, id)
+		}
+	}
+
+	count, err := db.CountEmailsBelowParserVersion(2)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	var seen []int64
+	var afterID int64
+	for {
+		page, err := db.EmailsBelowParserVersion(2, afterID, 3)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		assert.LessOrEqual(t, len(page), 3)
+		for _, email := range page {
+			seen = append(seen, email.ID)
+			afterID = email.ID
+		}
+	}
+	assert.Equal(t, stale, seen)
+}
+
+// TestUpdateParsedEmailMatchesAttachments tests that attachment rows follow
+// their part when a new parser finds the parts in another order
+func TestUpdateParsedEmailMatchesAttachments(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	email := CreateTestEmail("parts", "a@test.com", "Body")
+	email.BodyHash = "body-v1"
+	id, err := db.InsertEmail(email)
+	require.NoError(t, err)
+	email.ID = id
+
+	rowID := make(map[string]int64)
+	for _, att := range []*Attachment{
+		{Filename: "image001.png", ContentType: "image/png", Size: 10, SHA256: "hash-a"},
+		{Filename: "image001.png", ContentType: "image/png", Size: 20, SHA256: "hash-b"},
+		{Filename: "gone.txt", ContentType: "text/plain", Size: 5, SHA256: "hash-gone"},
+	} {
+		att.EmailID = id
+		attID, err := db.InsertAttachment(att)
+		require.NoError(t, err)
+		rowID[att.SHA256] = attID
+	}
+	require.NoError(t, db.AddRedaction(&Redaction{EmailID: id, Source: PIISourceBody, Start: 0, End: 4}))
+
+	// The new parser lists the parts the other way round, drops one and
+	// finds another
+	require.NoError(t, db.UpdateParsedEmail(email, []*Attachment{
+		{Filename: "new.pdf", ContentType: "application/pdf", Size: 30, SHA256: "hash-new"},
+		{Filename: "image001.png", ContentType: "image/png", Size: 20, SHA256: "hash-b2"},
+		{Filename: "image001.png", ContentType: "image/png", Size: 10, SHA256: "hash-a2"},
+	}))
+
+	attachments, err := db.GetAttachmentsByEmailID(id)
+	require.NoError(t, err)
+	require.Len(t, attachments, 3)
+	byID := make(map[int64]*Attachment)
+	for _, att := range attachments {
+		byID[att.ID] = att
+	}
+	require.Contains(t, byID, rowID["hash-a"])
+	assert.Equal(t, "hash-a2", byID[rowID["hash-a"]].SHA256, "Hash is taken from the matching part")
+	assert.Equal(t, int64(10), byID[rowID["hash-a"]].Size)
+	require.Contains(t, byID, rowID["hash-b"])
+	assert.Equal(t, "hash-b2", byID[rowID["hash-b"]].SHA256)
+	assert.NotContains(t, byID, rowID["hash-gone"], "A row without a part is deleted")
+	for attID, att := range byID {
+		if att.Filename == "new.pdf" {
+			assert.Greater(t, attID, rowID["hash-gone"], "New parts never reuse an ID")
+		}
+	}
+
+	// The body did not change, so the redaction still applies
+	redactions, err := db.GetRedactions(id)
+	require.NoError(t, err)
+	require.Len(t, redactions, 1)
+	assert.False(t, redactions[0].Stale)
+
+	email.BodyHash = "body-v2"
+	require.NoError(t, db.UpdateParsedEmail(email, nil))
+	redactions, err = db.GetRedactions(id)
+	require.NoError(t, err)
+	assert.True(t, redactions[0].Stale, "A changed body leaves redactions to check")
+
+	// Marking the span again confirms it
+	require.NoError(t, db.AddRedaction(&Redaction{EmailID: id, Source: PIISourceBody, Start: 0, End: 4}))
+	redactions, err = db.GetRedactions(id)
+	require.NoError(t, err)
+	require.Len(t, redactions, 1)
+	assert.False(t, redactions[0].Stale)
+}
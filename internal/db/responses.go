@@ -0,0 +1,315 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// replyPairs selects every reply "e" with its parent "p" and the response
+// time in seconds. Only replies from someone other than the parent's sender
+// count, duplicate copies of a reply are skipped, and a parent with several
+// copies is matched to its first-indexed one.
+const replyPairs = `
+	SELECT p.id AS parent_id, COALESCE(p.subject, '') AS parent_subject, LOWER(p.sender) AS parent_sender,
+	       e.id AS reply_id, LOWER(e.sender) AS reply_sender,
+	       (julianday(e.date) - julianday(p.date)) * 86400 AS seconds
+	FROM emails e
+	JOIN emails p ON p.id = (SELECT MIN(id) FROM emails WHERE message_id = e.in_reply_to)
+	WHERE e.in_reply_to IS NOT NULL AND e.in_reply_to <> ''
+	  AND e.date IS NOT NULL AND p.date IS NOT NULL
+	  AND LOWER(e.sender) <> LOWER(p.sender)
+	  AND julianday(e.date) >= julianday(p.date)
+	  AND NOT ` + duplicateOfEarlier
+
+// addressInRecipients matches emails "e" whose To list contains an address (lowercased)
+const addressInRecipients = `(', ' || LOWER(COALESCE(e.recipients, '')) || ',') LIKE '%, ' || ? || ',%'`
+
+// ResponseTimeStat summarizes response times for a contact, domain or set of messages
+type ResponseTimeStat struct {
+	Key            string
+	Replies        int
+	AverageSeconds float64
+	FastestSeconds float64
+	SlowestSeconds float64
+}
+
+// ReplyGap is the time between a message and a reply to it
+type ReplyGap struct {
+	ParentID      int64
+	ParentSubject string
+	ParentSender  string
+	ReplyID       int64
+	ReplySender   string
+	Seconds       float64
+}
+
+// UnansweredEmail is a message nobody (or a given contact) replied to
+type UnansweredEmail struct {
+	ID      int64
+	Subject string
+	Sender  string
+	Date    NullTime
+}
+
+// ResponseSummary is the archive-wide reply analytics
+type ResponseSummary struct {
+	FirstReply  ResponseTimeStat
+	ByContact   []*ResponseTimeStat
+	ByDomain    []*ResponseTimeStat
+	LongestGaps []*ReplyGap
+	Unanswered  int
+}
+
+// ContactResponseStats is the reply analytics for one address
+type ContactResponseStats struct {
+	Address string
+	// How quickly the contact replies to others
+	RepliesSent ResponseTimeStat
+	// How quickly others first reply to the contact's messages
+	FirstReplyReceived ResponseTimeStat
+	// Messages to the contact that the contact never replied to
+	UnansweredInbound     int
+	UnansweredInboundList []*UnansweredEmail
+	LongestGaps           []*ReplyGap
+}
+
+// ThreadResponseStats is the reply analytics for one conversation
+type ThreadResponseStats struct {
+	RootID            int64
+	Subject           string
+	Messages          int
+	Replies           int
+	FirstReplySeconds float64 // 0 if nobody replied to the first message
+	AverageSeconds    float64
+	LongestGapSeconds float64
+}
+
+// GetResponseSummary computes archive-wide reply analytics, listing up to
+// limit contacts, domains and gaps
+func (db *DB) GetResponseSummary(limit int) (*ResponseSummary, error) {
+	summary := &ResponseSummary{}
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(first), 0), COALESCE(MIN(first), 0), COALESCE(MAX(first), 0)
+		FROM (SELECT MIN(seconds) AS first FROM (`+replyPairs+`) GROUP BY parent_id)
+	`).Scan(&summary.FirstReply.Replies, &summary.FirstReply.AverageSeconds,
+		&summary.FirstReply.FastestSeconds, &summary.FirstReply.SlowestSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute first reply times: %w", err)
+	}
+
+	if summary.ByContact, err = db.responseTimesBy("reply_sender", limit); err != nil {
+		return nil, err
+	}
+	if summary.ByDomain, err = db.responseTimesBy("SUBSTR(reply_sender, INSTR(reply_sender, '@') + 1)", limit); err != nil {
+		return nil, err
+	}
+	if summary.LongestGaps, err = db.longestGaps("", limit); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM emails e
+		WHERE e.message_id IS NOT NULL AND e.message_id <> ''
+		  AND NOT EXISTS (
+			SELECT 1 FROM emails r
+			WHERE r.in_reply_to = e.message_id AND LOWER(r.sender) <> LOWER(e.sender)
+		  )
+		  AND NOT ` + duplicateOfEarlier).Scan(&summary.Unanswered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unanswered emails: %w", err)
+	}
+
+	return summary, nil
+}
+
+// responseTimesBy groups reply times by an expression over replyPairs columns,
+// most replies first
+func (db *DB) responseTimesBy(keyExpr string, limit int) ([]*ResponseTimeStat, error) {
+	rows, err := db.Query(`
+		SELECT `+keyExpr+` AS k, COUNT(*) AS n, AVG(seconds), MIN(seconds), MAX(seconds)
+		FROM (`+replyPairs+`)
+		GROUP BY k
+		ORDER BY n DESC, k ASC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute response times: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*ResponseTimeStat
+	for rows.Next() {
+		s := &ResponseTimeStat{}
+		if err := rows.Scan(&s.Key, &s.Replies, &s.AverageSeconds, &s.FastestSeconds, &s.SlowestSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan response time: %w", err)
+		}
+		stats = append(stats, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating response times: %w", err)
+	}
+
+	return stats, nil
+}
+
+// longestGaps retrieves the slowest replies, optionally only those to or from an address
+func (db *DB) longestGaps(address string, limit int) ([]*ReplyGap, error) {
+	rows, err := db.Query(`
+		SELECT parent_id, parent_subject, parent_sender, reply_id, reply_sender, seconds
+		FROM (`+replyPairs+`)
+		WHERE ? = '' OR parent_sender = ? OR reply_sender = ?
+		ORDER BY seconds DESC
+		LIMIT ?
+	`, address, address, address, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reply gaps: %w", err)
+	}
+	defer rows.Close()
+
+	var gaps []*ReplyGap
+	for rows.Next() {
+		g := &ReplyGap{}
+		if err := rows.Scan(&g.ParentID, &g.ParentSubject, &g.ParentSender, &g.ReplyID, &g.ReplySender, &g.Seconds); err != nil {
+			return nil, fmt.Errorf("failed to scan reply gap: %w", err)
+		}
+		gaps = append(gaps, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reply gaps: %w", err)
+	}
+
+	return gaps, nil
+}
+
+// GetContactResponseStats computes reply analytics for one address, listing
+// up to limit unanswered messages and gaps
+func (db *DB) GetContactResponseStats(address string, limit int) (*ContactResponseStats, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	stats := &ContactResponseStats{Address: address}
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(seconds), 0), COALESCE(MIN(seconds), 0), COALESCE(MAX(seconds), 0)
+		FROM (`+replyPairs+`)
+		WHERE reply_sender = ?
+	`, address).Scan(&stats.RepliesSent.Replies, &stats.RepliesSent.AverageSeconds,
+		&stats.RepliesSent.FastestSeconds, &stats.RepliesSent.SlowestSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute contact reply times: %w", err)
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(first), 0), COALESCE(MIN(first), 0), COALESCE(MAX(first), 0)
+		FROM (
+			SELECT MIN(seconds) AS first FROM (`+replyPairs+`)
+			WHERE parent_sender = ?
+			GROUP BY parent_id
+		)
+	`, address).Scan(&stats.FirstReplyReceived.Replies, &stats.FirstReplyReceived.AverageSeconds,
+		&stats.FirstReplyReceived.FastestSeconds, &stats.FirstReplyReceived.SlowestSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute contact first reply times: %w", err)
+	}
+
+	// Inbound messages the contact never answered
+	unanswered := `
+		FROM emails e
+		WHERE ` + addressInRecipients + `
+		  AND LOWER(e.sender) <> ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM emails r
+			WHERE e.message_id <> '' AND r.in_reply_to = e.message_id AND LOWER(r.sender) = ?
+		  )
+		  AND NOT ` + duplicateOfEarlier
+
+	err = db.QueryRow("SELECT COUNT(*)"+unanswered, address, address, address).Scan(&stats.UnansweredInbound)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unanswered emails: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.id, COALESCE(e.subject, ''), e.sender, e.date`+unanswered+`
+		ORDER BY e.date DESC
+		LIMIT ?
+	`, address, address, address, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unanswered emails: %w", err)
+	}
+	for rows.Next() {
+		u := &UnansweredEmail{}
+		if err := rows.Scan(&u.ID, &u.Subject, &u.Sender, &u.Date); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan unanswered email: %w", err)
+		}
+		stats.UnansweredInboundList = append(stats.UnansweredInboundList, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unanswered emails: %w", err)
+	}
+
+	if stats.LongestGaps, err = db.longestGaps(address, limit); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetThreadResponseStats computes reply analytics for the conversation
+// containing an email, or returns nil if the email does not exist
+func (db *DB) GetThreadResponseStats(emailID int64) (*ThreadResponseStats, error) {
+	email, err := db.GetEmailByID(emailID)
+	if err != nil || email == nil {
+		return nil, err
+	}
+	root, err := db.findConversationRoot(email)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := db.getConversationEmailsRecursive(root.MessageID, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		emails = []*Email{root} // Root without a Message-ID
+	}
+
+	stats := &ThreadResponseStats{
+		RootID:   root.ID,
+		Subject:  root.Subject,
+		Messages: len(emails),
+	}
+
+	byMessageID := make(map[string]*Email, len(emails))
+	for _, e := range emails {
+		if _, ok := byMessageID[e.MessageID]; !ok {
+			byMessageID[e.MessageID] = e
+		}
+	}
+
+	var total float64
+	for _, e := range emails {
+		parent, ok := byMessageID[e.InReplyTo]
+		if !ok || e.InReplyTo == "" || !e.Date.Valid || !parent.Date.Valid ||
+			strings.EqualFold(e.Sender, parent.Sender) || e.Date.Time.Before(parent.Date.Time) {
+			continue
+		}
+
+		seconds := e.Date.Time.Sub(parent.Date.Time).Seconds()
+		stats.Replies++
+		total += seconds
+		if seconds > stats.LongestGapSeconds {
+			stats.LongestGapSeconds = seconds
+		}
+		if parent.ID == root.ID && (stats.FirstReplySeconds == 0 || seconds < stats.FirstReplySeconds) {
+			stats.FirstReplySeconds = seconds
+		}
+	}
+	if stats.Replies > 0 {
+		stats.AverageSeconds = total / float64(stats.Replies)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// insertReplyFixtures inserts a thread where bob answers alice after two
+// hours and carol after a day, alice answers bob after 30 minutes, plus an
+// unanswered message to bob and a duplicate copy of carol's reply
+func insertReplyFixtures(t *testing.T, db *DB) []*Email {
+	t.Helper()
+
+	start := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+	email := func(id, inReplyTo, sender, recipients string, after time.Duration) *Email {
+		e := CreateTestEmailWithDate("Budget "+id, sender, "body "+id, start.Add(after))
+		e.MessageID = "<" + id + "@test>"
+		e.InReplyTo = inReplyTo
+		e.Recipients = recipients
+		e.FilePath = id + ".eml"
+		return e
+	}
+
+	carolCopy := email("carol-reply", "<root@test>", "carol@other.org", "alice@acme.com", 24*time.Hour)
+	carolCopy.FilePath = "copy/carol-reply.eml"
+
+	return InsertTestEmails(t, db, []*Email{
+		email("root", "", "alice@acme.com", "bob@acme.com, carol@other.org", 0),
+		email("bob-reply", "<root@test>", "Bob@acme.com", "alice@acme.com", 2*time.Hour),
+		email("carol-reply", "<root@test>", "carol@other.org", "alice@acme.com", 24*time.Hour),
+		email("alice-reply", "<bob-reply@test>", "alice@acme.com", "bob@acme.com", 2*time.Hour+30*time.Minute),
+		email("self-reply", "<root@test>", "alice@acme.com", "bob@acme.com", time.Hour),
+		email("ignored", "", "dave@acme.com", "bob@acme.com", 48*time.Hour),
+		carolCopy,
+	})
+}
+
+// TestGetResponseSummary tests archive-wide reply analytics
+func TestGetResponseSummary(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertReplyFixtures(t, db)
+
+	summary, err := db.GetResponseSummary(10)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, summary.FirstReply.Replies, "Root and bob's reply were answered")
+	assert.InDelta(t, (2*3600+30*60)/2.0, summary.FirstReply.AverageSeconds, 1)
+
+	require.Len(t, summary.ByContact, 3)
+	for _, c := range summary.ByContact {
+		assert.Equal(t, 1, c.Replies, "Duplicate copies and replies to yourself don't count")
+	}
+
+	require.Len(t, summary.ByDomain, 2)
+	assert.Equal(t, "acme.com", summary.ByDomain[0].Key)
+	assert.Equal(t, 2, summary.ByDomain[0].Replies)
+
+	require.NotEmpty(t, summary.LongestGaps)
+	assert.Equal(t, "carol@other.org", summary.LongestGaps[0].ReplySender)
+	assert.InDelta(t, 24*3600, summary.LongestGaps[0].Seconds, 1)
+
+	// carol-reply, alice-reply, self-reply and ignored have no reply from someone else
+	assert.Equal(t, 4, summary.Unanswered)
+}
+
+// TestGetContactResponseStats tests reply analytics for one address
+func TestGetContactResponseStats(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	insertReplyFixtures(t, db)
+
+	stats, err := db.GetContactResponseStats("BOB@acme.com", 10)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@acme.com", stats.Address)
+	assert.Equal(t, 1, stats.RepliesSent.Replies)
+	assert.InDelta(t, 2*3600, stats.RepliesSent.AverageSeconds, 1)
+	assert.Equal(t, 1, stats.FirstReplyReceived.Replies)
+	assert.InDelta(t, 30*60, stats.FirstReplyReceived.AverageSeconds, 1)
+
+	// Bob answered root but not alice's reply, her note or dave's message
+	assert.Equal(t, 3, stats.UnansweredInbound)
+	require.Len(t, stats.UnansweredInboundList, 3)
+	assert.Equal(t, "Budget ignored", stats.UnansweredInboundList[0].Subject, "Newest first")
+	assert.Len(t, stats.LongestGaps, 2)
+}
+
+// TestGetThreadResponseStats tests reply analytics for one conversation
+func TestGetThreadResponseStats(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertReplyFixtures(t, db)
+
+	stats, err := db.GetThreadResponseStats(emails[3].ID)
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, emails[0].ID, stats.RootID)
+	assert.InDelta(t, 2*3600, stats.FirstReplySeconds, 1)
+	assert.InDelta(t, 24*3600, stats.LongestGapSeconds, 1)
+	assert.GreaterOrEqual(t, stats.Replies, 3)
+
+	stats, err = db.GetThreadResponseStats(99999)
+	require.NoError(t, err)
+	assert.Nil(t, stats)
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDuplicateName is returned when a named record already exists
+var ErrDuplicateName = errors.New("name already exists")
+
+// SavedSearch represents a named filter set (a "smart folder")
+type SavedSearch struct {
+	ID        int64
+	Name      string
+	Filters   SearchFilters
+	CreatedAt NullTime
+	UpdatedAt NullTime
+}
+
+// CreateSavedSearch stores a new named search and returns its ID
+func (db *DB) CreateSavedSearch(name string, f SearchFilters) (int64, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("saved search name is required")
+	}
+	if len(name) > 100 {
+		return 0, errors.New("saved search name too long")
+	}
+	if err := f.Validate(); err != nil {
+		return 0, err
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO saved_searches (name, query, sender, recipient, has_attachments, date_from, date_to,
+		                            collapse_duplicates, sensitive, link, domain, auth, date_uncertain)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, name, f.Query, f.Sender, f.Recipient, f.HasAttachments, f.DateFrom, f.DateTo,
+		f.CollapseDuplicates, f.Sensitive, f.Link, f.Domain, f.Auth, f.DateUncertain)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return 0, ErrDuplicateName
+		}
+		return 0, fmt.Errorf("failed to create saved search: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// UpdateSavedSearch replaces the filters of an existing saved search
+func (db *DB) UpdateSavedSearch(id int64, f SearchFilters) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	result, err := db.Exec(`
+		UPDATE saved_searches
+		SET query = ?, sender = ?, recipient = ?, has_attachments = ?,
+		    date_from = ?, date_to = ?, collapse_duplicates = ?, sensitive = ?,
+		    link = ?, domain = ?, auth = ?, date_uncertain = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, f.Query, f.Sender, f.Recipient, f.HasAttachments, f.DateFrom, f.DateTo,
+		f.CollapseDuplicates, f.Sensitive, f.Link, f.Domain, f.Auth, f.DateUncertain, id)
+	if err != nil {
+		return fmt.Errorf("failed to update saved search: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+
+	return nil
+}
+
+// GetSavedSearch retrieves a saved search by ID
+func (db *DB) GetSavedSearch(id int64) (*SavedSearch, error) {
+	s := &SavedSearch{}
+	err := db.QueryRow(`
+		SELECT id, name, query, sender, recipient, has_attachments, date_from, date_to,
+		       collapse_duplicates, sensitive, link, domain, auth, date_uncertain,
+		       created_at, updated_at
+		FROM saved_searches WHERE id = ?
+	`, id).Scan(
+		&s.ID, &s.Name, &s.Filters.Query, &s.Filters.Sender, &s.Filters.Recipient,
+		&s.Filters.HasAttachments, &s.Filters.DateFrom, &s.Filters.DateTo,
+		&s.Filters.CollapseDuplicates, &s.Filters.Sensitive, &s.Filters.Link,
+		&s.Filters.Domain, &s.Filters.Auth, &s.Filters.DateUncertain,
+		&s.CreatedAt, &s.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved search: %w", err)
+	}
+	return s, nil
+}
+
+// ListSavedSearches retrieves all saved searches ordered by name
+func (db *DB) ListSavedSearches() ([]*SavedSearch, error) {
+	rows, err := db.Query(`
+		SELECT id, name, query, sender, recipient, has_attachments, date_from, date_to,
+		       collapse_duplicates, sensitive, link, domain, auth, date_uncertain,
+		       created_at, updated_at
+		FROM saved_searches
+		ORDER BY name COLLATE NOCASE ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	var searches []*SavedSearch
+	for rows.Next() {
+		s := &SavedSearch{}
+		err := rows.Scan(
+			&s.ID, &s.Name, &s.Filters.Query, &s.Filters.Sender, &s.Filters.Recipient,
+			&s.Filters.HasAttachments, &s.Filters.DateFrom, &s.Filters.DateTo,
+			&s.Filters.CollapseDuplicates, &s.Filters.Sensitive, &s.Filters.Link,
+			&s.Filters.Domain, &s.Filters.Auth, &s.Filters.DateUncertain,
+			&s.CreatedAt, &s.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating saved searches: %w", err)
+	}
+
+	return searches, nil
+}
+
+// DeleteSavedSearch removes a saved search
+func (db *DB) DeleteSavedSearch(id int64) error {
+	result, err := db.Exec("DELETE FROM saved_searches WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+
+	return nil
+}
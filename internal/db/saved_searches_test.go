@@ -0,0 +1,131 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/pii"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSavedSearchCRUD tests creating, listing, updating and deleting saved searches
+func TestSavedSearchCRUD(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	filters := SearchFilters{Query: "invoice", Sender: "alice@test.com", HasAttachments: true}
+	id, err := db.CreateSavedSearch("Invoices", filters)
+	require.NoError(t, err)
+	assert.Greater(t, id, int64(0))
+
+	// Duplicate names are rejected
+	_, err = db.CreateSavedSearch("Invoices", SearchFilters{})
+	assert.ErrorIs(t, err, ErrDuplicateName)
+
+	// Empty names are rejected
+	_, err = db.CreateSavedSearch("  ", SearchFilters{})
+	assert.Error(t, err)
+
+	saved, err := db.GetSavedSearch(id)
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+	assert.Equal(t, "Invoices", saved.Name)
+	assert.Equal(t, filters, saved.Filters)
+
+	_, err = db.CreateSavedSearch("attachments", SearchFilters{HasAttachments: true})
+	require.NoError(t, err)
+
+	list, err := db.ListSavedSearches()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "attachments", list[0].Name, "Should sort case-insensitively by name")
+
+	require.NoError(t, db.UpdateSavedSearch(id, SearchFilters{Query: "receipt"}))
+	saved, err = db.GetSavedSearch(id)
+	require.NoError(t, err)
+	assert.Equal(t, "receipt", saved.Filters.Query)
+	assert.Empty(t, saved.Filters.Sender)
+
+	require.NoError(t, db.DeleteSavedSearch(id))
+	saved, err = db.GetSavedSearch(id)
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+	assert.Error(t, db.DeleteSavedSearch(id), "Deleting twice should fail")
+}
+
+// TestSavedSearchCount tests that a saved search's filters drive the live count
+func TestSavedSearchCount(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	InsertTestEmails(t, db, []*Email{
+		CreateTestEmailWithAttachments("Invoice March", "alice@test.com", "Invoice attached", 1),
+		CreateTestEmail("Invoice April", "alice@test.com", "Invoice in body"),
+		CreateTestEmail("Lunch", "bob@test.com", "See you at noon"),
+	})
+
+	id, err := db.CreateSavedSearch("Alice invoices", SearchFilters{Query: "invoice", Sender: "alice"})
+	require.NoError(t, err)
+
+	saved, err := db.GetSavedSearch(id)
+	require.NoError(t, err)
+
+	count, err := db.CountFiltered(saved.Filters)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	saved.Filters.HasAttachments = true
+	count, err = db.CountFiltered(saved.Filters)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestSavedSearchStoresEveryFilter tests that every filter a search can use
+// comes back from a saved search unchanged
+func TestSavedSearchStoresEveryFilter(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	filters := SearchFilters{
+		Query:              "invoice",
+		Sender:             "alice@test.com",
+		Recipient:          "bob@test.com",
+		HasAttachments:     true,
+		DateFrom:           "2024-01-01",
+		DateTo:             "2024-12-31",
+		CollapseDuplicates: true,
+		Sensitive:          string(pii.IBAN),
+		Link:               "/invoices/",
+		Domain:             "example.com",
+		Auth:               parser.AuthFail,
+		DateUncertain:      true,
+	}
+	// A filter added later must be set above, and so stored
+	v := reflect.ValueOf(filters)
+	for i := 0; i < v.NumField(); i++ {
+		require.False(t, v.Field(i).IsZero(), "set %s in this test", v.Type().Field(i).Name)
+	}
+
+	id, err := db.CreateSavedSearch("Everything", filters)
+	require.NoError(t, err)
+	saved, err := db.GetSavedSearch(id)
+	require.NoError(t, err)
+	assert.Equal(t, filters, saved.Filters)
+
+	list, err := db.ListSavedSearches()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, filters, list[0].Filters)
+
+	changed := filters
+	changed.Sensitive = SensitiveAny
+	changed.Auth = parser.AuthPass
+	changed.CollapseDuplicates = false
+	require.NoError(t, db.UpdateSavedSearch(id, changed))
+	saved, err = db.GetSavedSearch(id)
+	require.NoError(t, err)
+	assert.Equal(t, changed, saved.Filters)
+}
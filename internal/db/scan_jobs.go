@@ -0,0 +1,190 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Scan job statuses
+const (
+	ScanJobRunning     = "running"
+	ScanJobComplete    = "complete"
+	ScanJobCancelled   = "cancelled"
+	ScanJobFailed      = "failed"
+	ScanJobInterrupted = "interrupted" // The application stopped mid-scan
+)
+
+// Scan job kinds
+const (
+	ScanJobKindScan    = "scan"    // Index new files in the emails folder
+	ScanJobKindRetry   = "retry"   // Index files that failed before
+	ScanJobKindReparse = "reparse" // Parse indexed emails again after a parser upgrade
+)
+
+// ScanJob is the record of one scan of the emails folder
+type ScanJob struct {
+	ID         int64
+	Kind       string
+	Status     string
+	StartedAt  NullTime
+	FinishedAt NullTime
+	TotalFound int
+	NewIndexed int
+	Skipped    int
+	Failed     int
+	Error      string
+}
+
+// ScanJobFailure is a file a scan could not index
+type ScanJobFailure struct {
+	JobID    int64
+	FilePath string
+	Error    string
+}
+
+// CreateScanJob records a scan of the given kind starting now and returns
+// its ID
+func (db *DB) CreateScanJob(kind string) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO scan_jobs (kind, status, started_at) VALUES (?, ?, ?)
+	`, kind, ScanJobRunning, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create scan job: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return id, nil
+}
+
+// FinishScanJob stores a scan's final status, counts and failed files
+// (path to error message)
+func (db *DB) FinishScanJob(job *ScanJob, failures map[string]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE scan_jobs
+		SET status = ?, finished_at = ?, total_found = ?, new_indexed = ?, skipped = ?, failed = ?, error = ?
+		WHERE id = ?
+	`, job.Status, time.Now(), job.TotalFound, job.NewIndexed, job.Skipped, job.Failed, job.Error, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update scan job: %w", err)
+	}
+
+	if len(failures) > 0 {
+		stmt, err := tx.Prepare("INSERT INTO scan_job_failures (job_id, file_path, error) VALUES (?, ?, ?)")
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		paths := make([]string, 0, len(failures))
+		for path := range failures {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if _, err := stmt.Exec(job.ID, path, failures[path]); err != nil {
+				return fmt.Errorf("failed to insert scan failure: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// InterruptScanJobs marks scans left running by a previous run of the
+// application as interrupted
+func (db *DB) InterruptScanJobs() error {
+	_, err := db.Exec("UPDATE scan_jobs SET status = ? WHERE status = ?", ScanJobInterrupted, ScanJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to mark interrupted scan jobs: %w", err)
+	}
+	return nil
+}
+
+// GetScanJob returns a scan job by ID, or nil if it does not exist
+func (db *DB) GetScanJob(id int64) (*ScanJob, error) {
+	job := &ScanJob{}
+	err := db.QueryRow(`
+		SELECT id, kind, status, started_at, finished_at, total_found, new_indexed, skipped, failed, error
+		FROM scan_jobs WHERE id = ?
+	`, id).Scan(&job.ID, &job.Kind, &job.Status, &job.StartedAt, &job.FinishedAt,
+		&job.TotalFound, &job.NewIndexed, &job.Skipped, &job.Failed, &job.Error)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan job: %w", err)
+	}
+	return job, nil
+}
+
+// ListScanJobs returns the most recent scan jobs, newest first
+func (db *DB) ListScanJobs(limit int) ([]*ScanJob, error) {
+	rows, err := db.Query(`
+		SELECT id, kind, status, started_at, finished_at, total_found, new_indexed, skipped, failed, error
+		FROM scan_jobs
+		ORDER BY id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scan jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*ScanJob
+	for rows.Next() {
+		job := &ScanJob{}
+		err := rows.Scan(&job.ID, &job.Kind, &job.Status, &job.StartedAt, &job.FinishedAt,
+			&job.TotalFound, &job.NewIndexed, &job.Skipped, &job.Failed, &job.Error)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scan jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ListScanJobFailures returns the files a scan job could not index
+func (db *DB) ListScanJobFailures(jobID int64) ([]*ScanJobFailure, error) {
+	rows, err := db.Query(`
+		SELECT job_id, file_path, error FROM scan_job_failures
+		WHERE job_id = ?
+		ORDER BY file_path
+	`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scan failures: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []*ScanJobFailure
+	for rows.Next() {
+		f := &ScanJobFailure{}
+		if err := rows.Scan(&f.JobID, &f.FilePath, &f.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan scan failure: %w", err)
+		}
+		failures = append(failures, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating scan failures: %w", err)
+	}
+
+	return failures, nil
+}
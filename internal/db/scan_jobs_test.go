@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScanJobLifecycle tests recording, finishing and listing scan jobs
+func TestScanJobLifecycle(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	first, err := db.CreateScanJob(ScanJobKindScan)
+	require.NoError(t, err)
+
+	job, err := db.GetScanJob(first)
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, ScanJobRunning, job.Status)
+	assert.True(t, job.StartedAt.Valid)
+	assert.False(t, job.FinishedAt.Valid)
+
+	job.Status = ScanJobComplete
+	job.TotalFound, job.NewIndexed, job.Failed = 3, 1, 2
+	require.NoError(t, db.FinishScanJob(job, map[string]string{
+		"b.eml": "bad header",
+		"a.eml": "permission denied",
+	}))
+
+	job, err = db.GetScanJob(first)
+	require.NoError(t, err)
+	assert.Equal(t, ScanJobComplete, job.Status)
+	assert.True(t, job.FinishedAt.Valid)
+	assert.Equal(t, 2, job.Failed)
+
+	failures, err := db.ListScanJobFailures(first)
+	require.NoError(t, err)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "a.eml", failures[0].FilePath)
+	assert.Equal(t, "permission denied", failures[0].Error)
+
+	// A scan left running by a previous run is marked interrupted
+	second, err := db.CreateScanJob(ScanJobKindReparse)
+	require.NoError(t, err)
+	require.NoError(t, db.InterruptScanJobs())
+
+	jobs, err := db.ListScanJobs(10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, second, jobs[0].ID, "Newest job should come first")
+	assert.Equal(t, ScanJobInterrupted, jobs[0].Status)
+	assert.Equal(t, ScanJobKindReparse, jobs[0].Kind)
+	assert.Equal(t, ScanJobKindScan, jobs[1].Kind)
+	assert.Equal(t, ScanJobComplete, jobs[1].Status)
+
+	job, err = db.GetScanJob(999)
+	require.NoError(t, err)
+	assert.Nil(t, job)
+}
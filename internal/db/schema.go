@@ -1,7 +1,9 @@
 package db
 
 // Optimized schema that stores only metadata + search index
-// Full content (body_html, raw_headers, attachment data) is parsed from .eml files on-demand
+// Full content (body_html, raw_headers, attachment data) is parsed from .eml files on-demand.
+// This is the baseline applied by migration 1; later schema changes are new
+// migrations in migrations.go rather than edits here.
 const schema = `
 -- Main emails table (metadata only)
 CREATE TABLE IF NOT EXISTS emails (
@@ -15,10 +17,16 @@ CREATE TABLE IF NOT EXISTS emails (
     sender_name TEXT,
     recipients TEXT,
     date DATETIME,
+    date_source TEXT DEFAULT '', -- Where the date came from: header, received, resent-date, file, none
     body_text_preview TEXT,  -- First 10KB for FTS5 search only
     has_attachments BOOLEAN DEFAULT 0,
     attachment_count INTEGER DEFAULT 0,
     file_size INTEGER,
+    sha256 TEXT,             -- Hash of the .eml file at intake (chain of custody)
+    content_hash TEXT,       -- Normalized headers + body hash for duplicate detection
+    minhash BLOB,            -- MinHash signature of the body for near-duplicate detection
+    pii_scanned BOOLEAN DEFAULT 0, -- Whether the sensitive data scan has run
+    auth_verdict TEXT DEFAULT '',  -- SPF/DKIM/DMARC verdict: pass, fail, none, or '' if not analyzed
     indexed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -54,6 +62,69 @@ CREATE TRIGGER IF NOT EXISTS emails_au AFTER UPDATE ON emails BEGIN
     WHERE rowid = new.id;
 END;
 
+-- LSH bands of each email's MinHash signature; emails sharing a band are
+-- candidates for near-duplicate comparison
+CREATE TABLE IF NOT EXISTS email_minhash_bands (
+    email_id INTEGER NOT NULL,
+    band INTEGER NOT NULL,
+    hash INTEGER NOT NULL,
+    FOREIGN KEY(email_id) REFERENCES emails(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER IF NOT EXISTS emails_minhash_ad AFTER DELETE ON emails BEGIN
+    DELETE FROM email_minhash_bands WHERE email_id = old.id;
+END;
+
+-- Sensitive data found by the PII scan; only a masked value is stored
+CREATE TABLE IF NOT EXISTS pii_findings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email_id INTEGER NOT NULL,
+    type TEXT NOT NULL,             -- credit_card, iban, national_id, phone, api_key or password
+    source TEXT NOT NULL,           -- body, html or attachment
+    attachment_filename TEXT NOT NULL DEFAULT '',
+    start_offset INTEGER NOT NULL,  -- Byte offsets of the value in the source text
+    end_offset INTEGER NOT NULL,
+    masked TEXT NOT NULL,
+    FOREIGN KEY(email_id) REFERENCES emails(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER IF NOT EXISTS emails_pii_ad AFTER DELETE ON emails BEGIN
+    DELETE FROM pii_findings WHERE email_id = old.id;
+END;
+
+-- Spans of an email body hidden in redacted renderings; the .eml is never changed
+CREATE TABLE IF NOT EXISTS redactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email_id INTEGER NOT NULL,
+    source TEXT NOT NULL,           -- body or html, as for pii_findings
+    start_offset INTEGER NOT NULL,  -- Byte offsets in the source text
+    end_offset INTEGER NOT NULL,
+    label TEXT NOT NULL DEFAULT '', -- PII type for accepted findings, empty for manual marks
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(email_id, source, start_offset, end_offset),
+    FOREIGN KEY(email_id) REFERENCES emails(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER IF NOT EXISTS emails_redactions_ad AFTER DELETE ON emails BEGIN
+    DELETE FROM redactions WHERE email_id = old.id;
+END;
+
+-- URLs found in email bodies, one row per distinct URL and anchor text
+CREATE TABLE IF NOT EXISTS links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    domain TEXT NOT NULL,           -- Lowercase host without a leading "www."
+    display_text TEXT NOT NULL DEFAULT '', -- Visible text of an HTML anchor
+    source TEXT NOT NULL,           -- text or html
+    mismatch BOOLEAN NOT NULL DEFAULT 0, -- Anchor text names a different domain
+    FOREIGN KEY(email_id) REFERENCES emails(id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER IF NOT EXISTS emails_links_ad AFTER DELETE ON emails BEGIN
+    DELETE FROM links WHERE email_id = old.id;
+END;
+
 -- Attachments table (metadata only, no BLOB data)
 CREATE TABLE IF NOT EXISTS attachments (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -61,6 +132,7 @@ CREATE TABLE IF NOT EXISTS attachments (
     filename TEXT NOT NULL,
     content_type TEXT,
     size INTEGER,
+    sha256 TEXT,             -- Hash of the decoded attachment content at intake
     FOREIGN KEY(email_id) REFERENCES emails(id) ON DELETE CASCADE
 );
 
@@ -71,6 +143,97 @@ CREATE TABLE IF NOT EXISTS settings (
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Saved searches (named filter sets shown as smart folders)
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    query TEXT NOT NULL DEFAULT '',
+    sender TEXT NOT NULL DEFAULT '',
+    recipient TEXT NOT NULL DEFAULT '',
+    has_attachments BOOLEAN DEFAULT 0,
+    date_from TEXT NOT NULL DEFAULT '',
+    date_to TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- eDiscovery productions (Bates ranges are never reused per prefix)
+CREATE TABLE IF NOT EXISTS productions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    custodian TEXT NOT NULL DEFAULT '',
+    start_number INTEGER NOT NULL,
+    end_number INTEGER NOT NULL,
+    document_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per produced document (an email or one of its attachments)
+CREATE TABLE IF NOT EXISTS production_documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    production_id INTEGER NOT NULL,
+    bates TEXT UNIQUE NOT NULL,
+    bates_number INTEGER NOT NULL,
+    email_id INTEGER NOT NULL,
+    attachment_id INTEGER,          -- NULL for the parent email itself
+    parent_bates TEXT,              -- Bates of the parent email for attachments
+    md5 TEXT,
+    FOREIGN KEY(production_id) REFERENCES productions(id) ON DELETE CASCADE
+);
+
+-- Scan runs, kept as a history of what each scan found
+CREATE TABLE IF NOT EXISTS scan_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    status TEXT NOT NULL,           -- running, complete, cancelled, failed or interrupted
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME,
+    total_found INTEGER NOT NULL DEFAULT 0,
+    new_indexed INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''  -- Why a failed scan stopped
+);
+
+-- Files a scan could not index, with the reason
+CREATE TABLE IF NOT EXISTS scan_job_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY(job_id) REFERENCES scan_jobs(id) ON DELETE CASCADE
+);
+
+-- Files that could not be indexed; a row is removed once its file indexes
+CREATE TABLE IF NOT EXISTS index_errors (
+    file_path TEXT PRIMARY KEY,
+    category TEXT NOT NULL,         -- unreadable, malformed MIME, charset or db write
+    message TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    first_failed_at DATETIME NOT NULL,
+    last_failed_at DATETIME NOT NULL
+);
+`
+
+// addedColumns lists columns added to the baseline tables before migrations
+// were versioned; migration 1 adds them to databases created without them
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"emails", "in_reply_to", "TEXT"},
+	{"emails", "thread_references", "TEXT"},
+	{"emails", "sha256", "TEXT"},
+	{"attachments", "sha256", "TEXT"},
+	{"emails", "content_hash", "TEXT"},
+	{"emails", "minhash", "BLOB"},
+	{"emails", "pii_scanned", "BOOLEAN DEFAULT 0"},
+	{"emails", "auth_verdict", "TEXT DEFAULT ''"},
+	{"emails", "date_source", "TEXT DEFAULT ''"},
+}
+
+// schemaIndexes indexes the baseline tables; it runs after addedColumns, as
+// some indexed columns are missing from older databases until then
+const schemaIndexes = `
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_emails_date ON emails(date DESC);
 CREATE INDEX IF NOT EXISTS idx_emails_sender ON emails(sender);
@@ -79,9 +242,22 @@ CREATE INDEX IF NOT EXISTS idx_emails_file_path ON emails(file_path);
 CREATE INDEX IF NOT EXISTS idx_emails_message_id ON emails(message_id);
 CREATE INDEX IF NOT EXISTS idx_emails_in_reply_to ON emails(in_reply_to);
 CREATE INDEX IF NOT EXISTS idx_attachments_email_id ON attachments(email_id);
+CREATE INDEX IF NOT EXISTS idx_email_minhash_bands_hash ON email_minhash_bands(band, hash);
+CREATE INDEX IF NOT EXISTS idx_email_minhash_bands_email_id ON email_minhash_bands(email_id);
+CREATE INDEX IF NOT EXISTS idx_pii_findings_email_id ON pii_findings(email_id);
+CREATE INDEX IF NOT EXISTS idx_pii_findings_type ON pii_findings(type, email_id);
+CREATE INDEX IF NOT EXISTS idx_links_email_id ON links(email_id);
+CREATE INDEX IF NOT EXISTS idx_links_domain ON links(domain, email_id);
+CREATE INDEX IF NOT EXISTS idx_productions_prefix ON productions(prefix);
+CREATE INDEX IF NOT EXISTS idx_production_documents_production_id ON production_documents(production_id);
+CREATE INDEX IF NOT EXISTS idx_scan_job_failures_job_id ON scan_job_failures(job_id);
+CREATE INDEX IF NOT EXISTS idx_emails_content_hash ON emails(content_hash);
+CREATE INDEX IF NOT EXISTS idx_emails_auth_verdict ON emails(auth_verdict);
 `
 
-// Migration schema for upgrading existing databases
+// migrationSchema rebuilds the emails and attachments tables of databases
+// from before the optimized schema; migration 1 runs it when they still have
+// a body_html column
 const migrationSchema = `
 -- Migration: Remove duplicate data columns
 -- These columns store data that can be parsed from .eml files on-demand
@@ -180,7 +356,4 @@ DROP TABLE attachments;
 ALTER TABLE attachments_new RENAME TO attachments;
 
 CREATE INDEX IF NOT EXISTS idx_attachments_email_id ON attachments(email_id);
-
--- Step 8: VACUUM to reclaim space
-VACUUM;
 `
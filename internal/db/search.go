@@ -1,7 +1,6 @@
 package db
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 	"unicode"
@@ -10,7 +9,8 @@ import (
 // EmailSearchResult represents a search result with snippet
 type EmailSearchResult struct {
 	Email
-	Snippet string
+	Snippet    string
+	Collection string // Set by searches across collections to the one holding the email
 }
 
 // escapeFTS5 escapes special FTS5 characters and wraps terms in quotes
@@ -52,27 +52,14 @@ func (db *DB) SearchEmails(query string, limit int) ([]*EmailSearchResult, error
 	}
 
 	// Build FTS5 MATCH query with fuzzy matching
-	// Add wildcards to each term for fuzzy matching: "john doe" -> "john* doe*"
-	terms := strings.Fields(query)
-	fuzzyTerms := make([]string, len(terms))
-	for i, term := range terms {
-		// For terms with special characters (like @, .), quote them without wildcard
-		if strings.ContainsAny(term, "@.-") {
-			fuzzyTerms[i] = escapeFTS5(term)
-		} else {
-			// For regular terms, escape and add wildcard
-			escapedTerm := strings.ReplaceAll(term, `"`, `""`)
-			fuzzyTerms[i] = `"` + escapedTerm + `"` + "*"
-		}
-	}
-	fuzzyQuery := strings.Join(fuzzyTerms, " ")
+	fuzzyQuery := buildFTSQuery(query)
 
 	sql := `
 		SELECT
 			e.id, e.file_path, e.message_id, e.subject, e.sender, e.sender_name,
 			e.recipients, e.date, e.body_text_preview,
 			e.has_attachments, e.attachment_count, e.file_size,
-			e.indexed_at, e.updated_at,
+			COALESCE(e.date_source, ''), e.indexed_at, e.updated_at,
 			snippet(emails_fts, 4, '<mark>', '</mark>', '...', 32) as snippet
 		FROM emails e
 		JOIN emails_fts ON e.id = emails_fts.rowid
@@ -94,7 +81,7 @@ func (db *DB) SearchEmails(query string, limit int) ([]*EmailSearchResult, error
 			&result.ID, &result.FilePath, &result.MessageID, &result.Subject, &result.Sender, &result.SenderName,
 			&result.Recipients, &result.Date, &result.BodyTextPreview,
 			&result.HasAttachments, &result.AttachmentCount, &result.FileSize,
-			&result.IndexedAt, &result.UpdatedAt,
+			&result.DateSource, &result.IndexedAt, &result.UpdatedAt,
 			&result.Snippet,
 		)
 		if err != nil {
@@ -117,60 +104,39 @@ func (db *DB) SearchEmailsWithFilters(query, sender, recipient string, hasAttach
 
 // SearchEmailsWithFiltersAndOffset performs a search with additional filters and pagination
 func (db *DB) SearchEmailsWithFiltersAndOffset(query, sender, recipient string, hasAttachments bool, dateFrom, dateTo string, limit, offset int) ([]*EmailSearchResult, error) {
-	// Validate input lengths to prevent abuse
-	if len(query) > 500 || len(sender) > 255 || len(recipient) > 255 {
-		return nil, errors.New("search term too long")
-	}
-
-	// Build WHERE clause
-	var conditions []string
-	var args []interface{}
-
-	// FTS5 search
-	if query != "" {
-		terms := strings.Fields(query)
-		fuzzyTerms := make([]string, len(terms))
-		for i, term := range terms {
-			// For terms with special characters (like @, .), quote them without wildcard
-			if strings.ContainsAny(term, "@.-") {
-				fuzzyTerms[i] = escapeFTS5(term)
-			} else {
-				// For regular terms, escape and add wildcard
-				escapedTerm := strings.ReplaceAll(term, `"`, `""`)
-				fuzzyTerms[i] = `"` + escapedTerm + `"` + "*"
-			}
-		}
-		fuzzyQuery := strings.Join(fuzzyTerms, " ")
-		conditions = append(conditions, "emails_fts MATCH ?")
-		args = append(args, fuzzyQuery)
-	}
+	return db.SearchFiltered(SearchFilters{
+		Query:          query,
+		Sender:         sender,
+		Recipient:      recipient,
+		HasAttachments: hasAttachments,
+		DateFrom:       dateFrom,
+		DateTo:         dateTo,
+	}, limit, offset)
+}
 
-	// Sender filter
-	if sender != "" {
-		conditions = append(conditions, "e.sender LIKE ?")
-		args = append(args, "%"+sender+"%")
+// SearchFiltered performs a search using a full filter set with pagination.
+// Results are ordered by relevance when there is a query, else newest first.
+func (db *DB) SearchFiltered(f SearchFilters, limit, offset int) ([]*EmailSearchResult, error) {
+	order := "e.date DESC"
+	if f.Query != "" {
+		order = "rank"
 	}
+	return db.searchFiltered(f, order, limit, offset)
+}
 
-	// Recipient filter
-	if recipient != "" {
-		conditions = append(conditions, "e.recipients LIKE ?")
-		args = append(args, "%"+recipient+"%")
-	}
+// SearchFilteredByDate performs a search as SearchFiltered does, but always
+// orders the results newest first, with ties broken by ID
+func (db *DB) SearchFilteredByDate(f SearchFilters, limit, offset int) ([]*EmailSearchResult, error) {
+	return db.searchFiltered(f, "e.date DESC, e.id DESC", limit, offset)
+}
 
-	// Attachments filter
-	if hasAttachments {
-		conditions = append(conditions, "e.has_attachments = 1")
+// searchFiltered runs a filtered search ordered by the given ORDER BY clause
+func (db *DB) searchFiltered(f SearchFilters, order string, limit, offset int) ([]*EmailSearchResult, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
 	}
 
-	// Date range filters
-	if dateFrom != "" {
-		conditions = append(conditions, "e.date >= ?")
-		args = append(args, dateFrom)
-	}
-	if dateTo != "" {
-		conditions = append(conditions, "e.date <= ?")
-		args = append(args, dateTo)
-	}
+	conditions, args := f.conditions()
 
 	// Build SQL query
 	sqlQuery := `
@@ -178,11 +144,11 @@ func (db *DB) SearchEmailsWithFiltersAndOffset(query, sender, recipient string,
 			e.id, e.file_path, e.message_id, e.subject, e.sender, e.sender_name,
 			e.recipients, e.date, e.body_text_preview,
 			e.has_attachments, e.attachment_count, e.file_size,
-			e.indexed_at, e.updated_at
+			COALESCE(e.date_source, ''), e.indexed_at, e.updated_at
 	`
 
 	var snippet string
-	if query != "" {
+	if f.Query != "" {
 		snippet = `, snippet(emails_fts, 4, '<mark>', '</mark>', '...', 32) as snippet`
 		sqlQuery += snippet + `
 		FROM emails e
@@ -199,13 +165,7 @@ func (db *DB) SearchEmailsWithFiltersAndOffset(query, sender, recipient string,
 		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	if query != "" {
-		sqlQuery += " ORDER BY rank"
-	} else {
-		sqlQuery += " ORDER BY e.date DESC"
-	}
-
-	sqlQuery += " LIMIT ? OFFSET ?"
+	sqlQuery += " ORDER BY " + order + " LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
 
 	rows, err := db.Query(sqlQuery, args...)
@@ -221,7 +181,7 @@ func (db *DB) SearchEmailsWithFiltersAndOffset(query, sender, recipient string,
 			&result.ID, &result.FilePath, &result.MessageID, &result.Subject, &result.Sender, &result.SenderName,
 			&result.Recipients, &result.Date, &result.BodyTextPreview,
 			&result.HasAttachments, &result.AttachmentCount, &result.FileSize,
-			&result.IndexedAt, &result.UpdatedAt,
+			&result.DateSource, &result.IndexedAt, &result.UpdatedAt,
 			&result.Snippet,
 		)
 		if err != nil {
@@ -243,70 +203,137 @@ func (db *DB) SearchEmailsWithFiltersAndOffset(query, sender, recipient string,
 	return results, nil
 }
 
-// truncateText truncates text to maxLen characters
-func truncateText(text string, maxLen int) string {
-	if len(text) <= maxLen {
-		return text
+// iterateChunk bounds how many emails IterateFiltered loads per query
+const iterateChunk = 500
+
+// IterateFiltered streams every email matching the filter set to fn, ordered by date.
+// Only the matching IDs are held in memory; emails are loaded in chunks and no
+// cursor is open while fn runs, so slow consumers such as downloads never hold
+// the single database connection.
+func (db *DB) IterateFiltered(f SearchFilters, fn func(*Email) error) error {
+	if err := f.Validate(); err != nil {
+		return err
 	}
-	return text[:maxLen] + "..."
-}
 
-// CountFilteredEmails returns the total count of emails matching the filters
-func (db *DB) CountFilteredEmails(query, sender, recipient string, hasAttachments bool, dateFrom, dateTo string) (int, error) {
-	// Build WHERE clause
-	var conditions []string
-	var args []interface{}
-
-	// FTS5 search
-	if query != "" {
-		terms := strings.Fields(query)
-		fuzzyTerms := make([]string, len(terms))
-		for i, term := range terms {
-			// For terms with special characters (like @, .), quote them without wildcard
-			if strings.ContainsAny(term, "@.-") {
-				fuzzyTerms[i] = escapeFTS5(term)
-			} else {
-				// For regular terms, escape and add wildcard
-				escapedTerm := strings.ReplaceAll(term, `"`, `""`)
-				fuzzyTerms[i] = `"` + escapedTerm + `"` + "*"
+	conditions, args := f.conditions()
+
+	sqlQuery := "SELECT e.id FROM emails e"
+	if f.Query != "" {
+		sqlQuery += ` JOIN emails_fts ON e.id = emails_fts.rowid`
+	}
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sqlQuery += " ORDER BY e.date ASC, e.id ASC"
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return fmt.Errorf("failed to iterate emails: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan email id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating emails: %w", err)
+	}
+
+	for start := 0; start < len(ids); start += iterateChunk {
+		chunk := ids[start:min(start+iterateChunk, len(ids))]
+		emails, err := db.emailsByID(chunk)
+		if err != nil {
+			return err
+		}
+		for _, id := range chunk {
+			// Emails deleted since the IDs were read are skipped
+			if email := emails[id]; email != nil {
+				if err := fn(email); err != nil {
+					return err
+				}
 			}
 		}
-		fuzzyQuery := strings.Join(fuzzyTerms, " ")
-		conditions = append(conditions, "emails_fts MATCH ?")
-		args = append(args, fuzzyQuery)
 	}
 
-	// Sender filter
-	if sender != "" {
-		conditions = append(conditions, "e.sender LIKE ?")
-		args = append(args, "%"+sender+"%")
+	return nil
+}
+
+// emailsByID loads the emails with the given IDs, keyed by ID
+func (db *DB) emailsByID(ids []int64) (map[int64]*Email, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
 	}
 
-	// Recipient filter
-	if recipient != "" {
-		conditions = append(conditions, "e.recipients LIKE ?")
-		args = append(args, "%"+recipient+"%")
+	rows, err := db.Query(`
+		SELECT e.id, e.file_path, e.message_id, e.in_reply_to, e.thread_references,
+		       e.subject, e.sender, e.sender_name, e.recipients, e.date,
+		       e.body_text_preview, e.has_attachments, e.attachment_count, e.file_size,
+		       COALESCE(e.date_source, ''), e.indexed_at, e.updated_at
+		FROM emails e
+		WHERE e.id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails: %w", err)
 	}
+	defer rows.Close()
 
-	// Attachments filter
-	if hasAttachments {
-		conditions = append(conditions, "e.has_attachments = 1")
+	emails := make(map[int64]*Email, len(ids))
+	for rows.Next() {
+		email := &Email{}
+		err := rows.Scan(
+			&email.ID, &email.FilePath, &email.MessageID, &email.InReplyTo, &email.ThreadReferences,
+			&email.Subject, &email.Sender, &email.SenderName, &email.Recipients, &email.Date,
+			&email.BodyTextPreview, &email.HasAttachments, &email.AttachmentCount, &email.FileSize,
+			&email.DateSource, &email.IndexedAt, &email.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan email: %w", err)
+		}
+		emails[email.ID] = email
 	}
 
-	// Date range filters
-	if dateFrom != "" {
-		conditions = append(conditions, "e.date >= ?")
-		args = append(args, dateFrom)
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating emails: %w", err)
 	}
-	if dateTo != "" {
-		conditions = append(conditions, "e.date <= ?")
-		args = append(args, dateTo)
+
+	return emails, nil
+}
+
+// truncateText truncates text to maxLen characters
+func truncateText(text string, maxLen int) string {
+	if len(text) <= maxLen {
+		return text
 	}
+	return text[:maxLen] + "..."
+}
+
+// CountFilteredEmails returns the total count of emails matching the filters
+func (db *DB) CountFilteredEmails(query, sender, recipient string, hasAttachments bool, dateFrom, dateTo string) (int, error) {
+	return db.CountFiltered(SearchFilters{
+		Query:          query,
+		Sender:         sender,
+		Recipient:      recipient,
+		HasAttachments: hasAttachments,
+		DateFrom:       dateFrom,
+		DateTo:         dateTo,
+	})
+}
+
+// CountFiltered returns the total count of emails matching a filter set
+func (db *DB) CountFiltered(f SearchFilters) (int, error) {
+	conditions, args := f.conditions()
 
 	// Build SQL query
 	sqlQuery := `SELECT COUNT(*) FROM emails e`
 
-	if query != "" {
+	if f.Query != "" {
 		sqlQuery += ` JOIN emails_fts ON e.id = emails_fts.rowid`
 	}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -305,6 +306,82 @@ func TestSearchEmailsWithFilters(t *testing.T) {
 	}
 }
 
+// TestSearchFiltered_Auth tests the authentication verdict filter
+func TestSearchFiltered_Auth(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	signed := CreateTestEmail("Signed", "alice@test.com", "Body 1")
+	signed.AuthVerdict = "pass"
+	forged := CreateTestEmail("Forged", "bob@test.com", "Body 2")
+	forged.AuthVerdict = "fail"
+	InsertTestEmails(t, db, []*Email{signed, forged, CreateTestEmail("Plain", "carol@test.com", "Body 3")})
+
+	results, err := db.SearchFiltered(SearchFilters{Auth: "fail"}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Forged", results[0].Subject)
+
+	count, err := db.CountFiltered(SearchFilters{Auth: "pass"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.Error(t, SearchFilters{Auth: "maybe"}.Validate())
+}
+
+// TestSearchFiltered_DateUncertain tests the filter for emails dated by a fallback
+func TestSearchFiltered_DateUncertain(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	dated := CreateTestEmail("Dated", "alice@test.com", "Body 1")
+	dated.DateSource = "header"
+	received := CreateTestEmail("From Received", "bob@test.com", "Body 2")
+	received.DateSource = "received"
+	InsertTestEmails(t, db, []*Email{dated, received, CreateTestEmail("Legacy", "carol@test.com", "Body 3")})
+
+	results, err := db.SearchFiltered(SearchFilters{DateUncertain: true}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "From Received", results[0].Subject)
+	assert.True(t, results[0].DateUncertain())
+
+	email, err := db.GetEmailByID(results[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "received", email.DateSource)
+}
+
+// TestIterateFiltered tests that emails are visited in date order across
+// chunks and that the callback may query the database
+func TestIterateFiltered(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var emails []*Email
+	for i := 0; i < iterateChunk+20; i++ {
+		// Insert newest first so date order differs from ID order
+		emails = append(emails, CreateTestEmailWithDate(fmt.Sprintf("Email %d", i), "alice@test.com", "Body", base.Add(-time.Duration(i)*time.Hour)))
+	}
+	InsertTestEmails(t, db, emails)
+
+	var visited []int64
+	err := db.IterateFiltered(SearchFilters{}, func(email *Email) error {
+		// A query inside the callback would block if a cursor were still open
+		loaded, err := db.GetEmailByID(email.ID)
+		require.NoError(t, err)
+		require.NotNil(t, loaded)
+		visited = append(visited, email.ID)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, visited, len(emails))
+	for i, id := range visited {
+		assert.Equal(t, emails[len(emails)-1-i].ID, id)
+	}
+}
+
 // TestTruncateText tests the text truncation helper
 func TestTruncateText(t *testing.T) {
 	tests := []struct {
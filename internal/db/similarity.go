@@ -0,0 +1,379 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/felo/eml-viewer/internal/similarity"
+)
+
+// maxBucketPairs is the bucket size above which members are only compared to
+// the first member instead of to each other, bounding work on huge buckets
+const maxBucketPairs = 50
+
+const insertMinHashBandSQL = "INSERT INTO email_minhash_bands (email_id, band, hash) VALUES (?, ?, ?)"
+
+// SimilarEmail is an email with its estimated similarity to another email
+type SimilarEmail struct {
+	ID         int64
+	FilePath   string
+	Subject    string
+	Sender     string
+	SenderName string
+	Date       NullTime
+	Similarity float64 // Estimated Jaccard similarity of the bodies (0-1)
+}
+
+// NearDuplicateCluster is a set of emails with near-identical bodies. Each
+// member's Similarity is measured against the first member.
+type NearDuplicateCluster struct {
+	Emails []*SimilarEmail
+}
+
+// insertMinHashBands stores the LSH bands of an encoded signature
+func insertMinHashBands(exec func(args ...interface{}) (sql.Result, error), emailID int64, minhash []byte) error {
+	sig, ok := similarity.Decode(minhash)
+	if !ok {
+		return nil
+	}
+	for band, hash := range similarity.Bands(sig) {
+		if _, err := exec(emailID, band, hash); err != nil {
+			return fmt.Errorf("failed to insert minhash band: %w", err)
+		}
+	}
+	return nil
+}
+
+// FindSimilarEmails retrieves emails whose bodies are at least threshold
+// similar to the given email, most similar first
+func (db *DB) FindSimilarEmails(emailID int64, threshold float64, limit int) ([]*SimilarEmail, error) {
+	var minhash []byte
+	err := db.QueryRow("SELECT minhash FROM emails WHERE id = ?", emailID).Scan(&minhash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minhash: %w", err)
+	}
+	sig, ok := similarity.Decode(minhash)
+	if !ok {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT id, file_path, COALESCE(subject, ''), sender, COALESCE(sender_name, ''), date, minhash
+		FROM emails
+		WHERE id IN (
+			SELECT DISTINCT b2.email_id
+			FROM email_minhash_bands b1
+			JOIN email_minhash_bands b2 ON b2.band = b1.band AND b2.hash = b1.hash
+			WHERE b1.email_id = ? AND b2.email_id <> ?
+		)
+	`, emailID, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar emails: %w", err)
+	}
+	defer rows.Close()
+
+	var similar []*SimilarEmail
+	for rows.Next() {
+		e := &SimilarEmail{}
+		var other []byte
+		if err := rows.Scan(&e.ID, &e.FilePath, &e.Subject, &e.Sender, &e.SenderName, &e.Date, &other); err != nil {
+			return nil, fmt.Errorf("failed to scan similar email: %w", err)
+		}
+		otherSig, ok := similarity.Decode(other)
+		if !ok {
+			continue
+		}
+		if e.Similarity = similarity.Similarity(sig, otherSig); e.Similarity >= threshold {
+			similar = append(similar, e)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating similar emails: %w", err)
+	}
+
+	sort.SliceStable(similar, func(i, j int) bool {
+		if similar[i].Similarity != similar[j].Similarity {
+			return similar[i].Similarity > similar[j].Similarity
+		}
+		return similar[i].ID < similar[j].ID
+	})
+	if limit > 0 && len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	return similar, nil
+}
+
+// nearDuplicateCache keeps the clusters computed for the last threshold, so
+// paging through them does not recompute the whole archive. Writes that add,
+// re-parse or delete emails invalidate it.
+type nearDuplicateCache struct {
+	mu        sync.Mutex
+	gen       uint64 // Bumped by every invalidation
+	cachedGen uint64 // Generation the clusters were computed at
+	valid     bool
+	threshold float64
+	clusters  []clusterIDs
+}
+
+// clusterIDs is a computed cluster: member IDs with the lead first, and each
+// member's similarity to the lead
+type clusterIDs struct {
+	ids        []int64
+	similarity []float64
+}
+
+// invalidate drops the cached clusters
+func (c *nearDuplicateCache) invalidate() {
+	c.mu.Lock()
+	c.gen++
+	c.valid = false
+	c.mu.Unlock()
+}
+
+// NearDuplicateClusters groups emails whose bodies are at least threshold
+// similar, largest clusters first. It returns one page of clusters and the
+// total number of clusters.
+func (db *DB) NearDuplicateClusters(threshold float64, limit, offset int) ([]*NearDuplicateCluster, int, error) {
+	clusters, err := db.cachedNearDuplicates(threshold)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(clusters)
+	if offset >= total {
+		return nil, total, nil
+	}
+	clusters = clusters[offset:]
+	if limit > 0 && len(clusters) > limit {
+		clusters = clusters[:limit]
+	}
+
+	result := make([]*NearDuplicateCluster, 0, len(clusters))
+	for _, c := range clusters {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(c.ids)), ",")
+		args := make([]interface{}, len(c.ids))
+		similarityOf := make(map[int64]float64, len(c.ids))
+		for i, id := range c.ids {
+			args[i] = id
+			similarityOf[id] = c.similarity[i]
+		}
+		emails, err := db.listEmailsWhere("id IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		cluster := &NearDuplicateCluster{}
+		for _, e := range emails {
+			cluster.Emails = append(cluster.Emails, &SimilarEmail{
+				ID:         e.ID,
+				FilePath:   e.FilePath,
+				Subject:    e.Subject,
+				Sender:     e.Sender,
+				SenderName: e.SenderName,
+				Date:       e.Date,
+				Similarity: similarityOf[e.ID],
+			})
+		}
+		result = append(result, cluster)
+	}
+
+	return result, total, nil
+}
+
+// cachedNearDuplicates returns the clusters for a threshold, computing them
+// only when emails changed or the threshold differs from the cached one
+func (db *DB) cachedNearDuplicates(threshold float64) ([]clusterIDs, error) {
+	c := &db.nearDuplicates
+	c.mu.Lock()
+	if c.valid && c.cachedGen == c.gen && c.threshold == threshold {
+		clusters := c.clusters
+		c.mu.Unlock()
+		return clusters, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	clusters, err := db.computeNearDuplicates(threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clusters computed while emails changed are returned but not kept
+	c.mu.Lock()
+	if c.gen == gen {
+		c.valid, c.cachedGen, c.threshold, c.clusters = true, gen, threshold, clusters
+	}
+	c.mu.Unlock()
+	return clusters, nil
+}
+
+// computeNearDuplicates clusters every email with a signature by unioning
+// pairs that share an LSH bucket and clear the threshold
+func (db *DB) computeNearDuplicates(threshold float64) ([]clusterIDs, error) {
+	buckets, err := db.minHashBuckets()
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	signatures, err := db.minHashSignatures()
+	if err != nil {
+		return nil, err
+	}
+
+	// Union emails whose signatures clear the threshold
+	parent := make(map[int64]int64)
+	var find func(int64) int64
+	find = func(id int64) int64 {
+		p, ok := parent[id]
+		if !ok || p == id {
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+	union := func(a, b int64) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// The lowest ID becomes the root so clusters are led by the first-indexed email
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+		parent[ra] = ra
+	}
+
+	compared := make(map[[2]int64]bool)
+	compare := func(a, b int64) {
+		if a > b {
+			a, b = b, a
+		}
+		key := [2]int64{a, b}
+		if compared[key] {
+			return
+		}
+		compared[key] = true
+		sa, okA := signatures[a]
+		sb, okB := signatures[b]
+		if okA && okB && similarity.Similarity(sa, sb) >= threshold {
+			union(a, b)
+		}
+	}
+
+	for _, members := range buckets {
+		if len(members) > maxBucketPairs {
+			for _, m := range members[1:] {
+				compare(members[0], m)
+			}
+			continue
+		}
+		for i := range members {
+			for j := i + 1; j < len(members); j++ {
+				compare(members[i], members[j])
+			}
+		}
+	}
+
+	groups := make(map[int64][]int64)
+	for id := range parent {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+
+	var clusters []clusterIDs
+	for _, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		c := clusterIDs{ids: ids, similarity: make([]float64, len(ids))}
+		for i, id := range ids {
+			c.similarity[i] = similarity.Similarity(signatures[ids[0]], signatures[id])
+		}
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].ids) != len(clusters[j].ids) {
+			return len(clusters[i].ids) > len(clusters[j].ids)
+		}
+		return clusters[i].ids[0] < clusters[j].ids[0]
+	})
+
+	return clusters, nil
+}
+
+// minHashBuckets retrieves the email IDs of every LSH band bucket with more than one member
+func (db *DB) minHashBuckets() ([][]int64, error) {
+	rows, err := db.Query(`
+		SELECT GROUP_CONCAT(email_id)
+		FROM email_minhash_bands
+		GROUP BY band, hash
+		HAVING COUNT(*) > 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list minhash buckets: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets [][]int64
+	for rows.Next() {
+		var list string
+		if err := rows.Scan(&list); err != nil {
+			return nil, fmt.Errorf("failed to scan minhash bucket: %w", err)
+		}
+		var members []int64
+		for _, s := range strings.Split(list, ",") {
+			var id int64
+			if _, err := fmt.Sscan(s, &id); err == nil {
+				members = append(members, id)
+			}
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+		buckets = append(buckets, members)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating minhash buckets: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// minHashSignatures retrieves the MinHash signature of every email that has one
+func (db *DB) minHashSignatures() (map[int64]similarity.Signature, error) {
+	rows, err := db.Query("SELECT id, minhash FROM emails WHERE minhash IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list minhash signatures: %w", err)
+	}
+	defer rows.Close()
+
+	signatures := make(map[int64]similarity.Signature)
+	for rows.Next() {
+		var id int64
+		var minhash []byte
+		if err := rows.Scan(&id, &minhash); err != nil {
+			return nil, fmt.Errorf("failed to scan minhash signature: %w", err)
+		}
+		if sig, ok := similarity.Decode(minhash); ok {
+			signatures[id] = sig
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating minhash signatures: %w", err)
+	}
+
+	return signatures, nil
+}
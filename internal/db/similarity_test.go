@@ -0,0 +1,129 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/similarity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const similarityMemo = `Please find attached the quarterly revenue forecast for the northern region.
+The numbers assume the new pricing takes effect in March and that the two
+pending contracts close before the end of the quarter. Let me know if you
+have any questions before the board meeting on Friday afternoon.`
+
+// createSignedEmail creates a test email with a MinHash signature of its body
+func createSignedEmail(subject, body string) *Email {
+	email := CreateTestEmail(subject, "alice@test.com", body)
+	if sig, ok := similarity.Compute(body); ok {
+		email.MinHash = sig.Encode()
+	}
+	return email
+}
+
+// insertSimilarFixtures inserts a memo, a lightly edited copy, a forward of
+// it, an unrelated email and an email without a body
+func insertSimilarFixtures(t *testing.T, db *DB) []*Email {
+	t.Helper()
+
+	return InsertTestEmails(t, db, []*Email{
+		createSignedEmail("Forecast", similarityMemo),
+		createSignedEmail("Forecast v2", similarityMemo+" Thanks."),
+		createSignedEmail("Fwd: Forecast", "FYI see below.\n"+similarityMemo),
+		createSignedEmail("Lunch", "Lunch is moved to the cafeteria on the second floor starting next week."),
+		createSignedEmail("Empty", ""),
+	})
+}
+
+// TestFindSimilarEmails tests looking up near-duplicates of one email
+func TestFindSimilarEmails(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertSimilarFixtures(t, db)
+
+	similar, err := db.FindSimilarEmails(emails[0].ID, 0.8, 10)
+	require.NoError(t, err)
+	require.Len(t, similar, 2)
+	for _, s := range similar {
+		assert.Contains(t, []int64{emails[1].ID, emails[2].ID}, s.ID)
+		assert.GreaterOrEqual(t, s.Similarity, 0.8)
+	}
+	assert.GreaterOrEqual(t, similar[0].Similarity, similar[1].Similarity, "Most similar first")
+
+	similar, err = db.FindSimilarEmails(emails[0].ID, 0.8, 1)
+	require.NoError(t, err)
+	assert.Len(t, similar, 1)
+
+	similar, err = db.FindSimilarEmails(emails[4].ID, 0.8, 10)
+	require.NoError(t, err)
+	assert.Empty(t, similar, "Emails without a body have no signature")
+
+	similar, err = db.FindSimilarEmails(99999, 0.8, 10)
+	require.NoError(t, err)
+	assert.Empty(t, similar)
+}
+
+// TestNearDuplicateClusters tests clustering and threshold handling
+func TestNearDuplicateClusters(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertSimilarFixtures(t, db)
+
+	clusters, total, err := db.NearDuplicateClusters(0.8, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, clusters, 1)
+	require.Len(t, clusters[0].Emails, 3)
+	assert.Equal(t, emails[0].ID, clusters[0].Emails[0].ID, "Clusters are led by the first-indexed email")
+	assert.Equal(t, 1.0, clusters[0].Emails[0].Similarity)
+
+	clusters, total, err = db.NearDuplicateClusters(1.0, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, clusters)
+
+	clusters, total, err = db.NearDuplicateClusters(0.8, 10, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Empty(t, clusters)
+}
+
+// TestNearDuplicateClustersCache tests that clusters are reused until emails change
+func TestNearDuplicateClustersCache(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertSimilarFixtures(t, db)
+
+	_, total, err := db.NearDuplicateClusters(0.8, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+
+	// Bands removed behind the cache's back are not noticed
+	_, err = db.Exec("DELETE FROM email_minhash_bands")
+	require.NoError(t, err)
+	_, total, err = db.NearDuplicateClusters(0.8, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total, "Served from the cache")
+
+	// Deleting an email through the DB recomputes the clusters
+	require.NoError(t, db.DeleteEmail(emails[0].ID))
+	_, total, err = db.NearDuplicateClusters(0.8, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+}
+
+// TestDeleteEmailRemovesMinHashBands tests that bands do not outlive their email
+func TestDeleteEmailRemovesMinHashBands(t *testing.T) {
+	db := SetupTestDB(t)
+	defer CleanupTestDB(t, db)
+	emails := insertSimilarFixtures(t, db)
+
+	var bands int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM email_minhash_bands WHERE email_id = ?", emails[0].ID).Scan(&bands))
+	assert.Equal(t, similarity.NumBands, bands)
+
+	require.NoError(t, db.DeleteEmail(emails[0].ID))
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM email_minhash_bands WHERE email_id = ?", emails[0].ID).Scan(&bands))
+	assert.Equal(t, 0, bands)
+}
@@ -0,0 +1,307 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// Format identifies an export output format
+type Format string
+
+const (
+	FormatMbox Format = "mbox" // Single mboxrd file
+	FormatZip  Format = "zip"  // Zip of the original .eml files
+	FormatCSV  Format = "csv"  // Metadata columns only
+
+	FormatRedactedText Format = "redacted-txt"  // Zip of redacted plain text renderings
+	FormatRedactedHTML Format = "redacted-html" // Zip of redacted printable HTML renderings
+)
+
+// ErrUnknownFormat is returned for unsupported export formats
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ParseFormat validates a format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatMbox, FormatZip, FormatCSV, FormatRedactedText, FormatRedactedHTML:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMbox:
+		return "application/mbox"
+	case FormatZip, FormatRedactedText, FormatRedactedHTML:
+		return "application/zip"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file extension for the format
+func (f Format) Extension() string {
+	switch f {
+	case FormatRedactedText, FormatRedactedHTML:
+		return "-redacted.zip"
+	}
+	return "." + string(f)
+}
+
+// Result contains statistics about an export operation
+type Result struct {
+	Exported     int
+	Skipped      int
+	SkippedFiles []string
+	SkipReasons  map[string]string // Why each skipped file was left out
+}
+
+// Exporter streams filtered emails out of the archive
+type Exporter struct {
+	db *db.DB
+}
+
+// NewExporter creates a new exporter
+func NewExporter(database *db.DB) *Exporter {
+	return &Exporter{db: database}
+}
+
+// Export writes every email matching the filters to w in the given format
+// Files are copied straight from disk one at a time; nothing is buffered in memory.
+// Emails whose .eml file cannot be read are skipped and reported in the result.
+func (e *Exporter) Export(w io.Writer, format Format, filters db.SearchFilters) (*Result, error) {
+	switch format {
+	case FormatMbox:
+		return e.exportMbox(w, filters)
+	case FormatZip:
+		return e.exportZip(w, filters)
+	case FormatCSV:
+		return e.exportCSV(w, filters)
+	case FormatRedactedText:
+		return e.exportRedacted(w, filters, false)
+	case FormatRedactedHTML:
+		return e.exportRedacted(w, filters, true)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// skip records an email that could not be exported
+func (r *Result) skip(email *db.Email, err error) {
+	log.Printf("Export: skipping %s: %v", email.FilePath, err)
+	r.Skipped++
+	r.SkippedFiles = append(r.SkippedFiles, email.FilePath)
+	if r.SkipReasons == nil {
+		r.SkipReasons = make(map[string]string)
+	}
+	r.SkipReasons[email.FilePath] = err.Error()
+}
+
+// exportMbox writes an mboxrd file
+func (e *Exporter) exportMbox(w io.Writer, filters db.SearchFilters) (*Result, error) {
+	result := &Result{}
+	bw := bufio.NewWriter(w)
+
+	err := e.db.IterateFiltered(filters, func(email *db.Email) error {
+		path, err := e.db.ResolveEmailPath(email.FilePath)
+		if err != nil {
+			result.skip(email, err)
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			result.skip(email, err)
+			return nil
+		}
+		defer f.Close()
+
+		if _, err := bw.WriteString(mboxFromLine(email)); err != nil {
+			return err
+		}
+		if err := writeMboxBody(bw, f); err != nil {
+			return fmt.Errorf("failed to write %s: %w", email.FilePath, err)
+		}
+		result.Exported++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, bw.Flush()
+}
+
+// mboxFromLine builds the "From " separator line for a message
+func mboxFromLine(email *db.Email) string {
+	sender := strings.TrimSpace(email.Sender)
+	if sender == "" || strings.ContainsAny(sender, " \t") {
+		sender = "MAILER-DAEMON"
+	}
+	date := time.Unix(0, 0).UTC()
+	if email.Date.Valid {
+		date = email.Date.Time.UTC()
+	}
+	return "From " + sender + " " + date.Format(time.ANSIC) + "\n"
+}
+
+// writeMboxBody copies a message using mboxrd quoting: any line matching
+// ^>*From  gets one extra '>' so readers can reverse it unambiguously.
+// Line endings are normalized to LF and the message ends with a blank line.
+func writeMboxBody(w *bufio.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	atLineStart := true
+	lastWasNewline := false
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if atLineStart && isFromLine(line) {
+				if err := w.WriteByte('>'); err != nil {
+					return err
+				}
+			}
+			complete := line[len(line)-1] == '\n'
+			if complete {
+				line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+			}
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			if complete {
+				if err := w.WriteByte('\n'); err != nil {
+					return err
+				}
+			}
+			atLineStart = complete
+			lastWasNewline = complete
+		}
+		if err == bufio.ErrBufferFull {
+			// Very long line: keep copying without treating the rest as a new line
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !lastWasNewline {
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return w.WriteByte('\n')
+}
+
+// isFromLine reports whether a line matches ^>*From
+func isFromLine(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, ">")
+	return bytes.HasPrefix(trimmed, []byte("From "))
+}
+
+// exportZip writes a zip archive of the original .eml files, keeping their
+// relative paths inside the emails folder
+func (e *Exporter) exportZip(w io.Writer, filters db.SearchFilters) (*Result, error) {
+	result := &Result{}
+	zw := zip.NewWriter(w)
+
+	err := e.db.IterateFiltered(filters, func(email *db.Email) error {
+		path, err := e.db.ResolveEmailPath(email.FilePath)
+		if err != nil {
+			result.skip(email, err)
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			result.skip(email, err)
+			return nil
+		}
+		defer f.Close()
+
+		header := &zip.FileHeader{
+			Name:   email.FilePath,
+			Method: zip.Deflate,
+		}
+		if info, err := f.Stat(); err == nil {
+			header.Modified = info.ModTime()
+		}
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to zip: %w", email.FilePath, err)
+		}
+		if _, err := io.Copy(entry, f); err != nil {
+			return fmt.Errorf("failed to write %s to zip: %w", email.FilePath, err)
+		}
+		result.Exported++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, zw.Close()
+}
+
+// csvHeader lists the metadata columns written by CSV exports
+var csvHeader = []string{
+	"id", "file_path", "message_id", "in_reply_to", "date",
+	"sender", "sender_name", "recipients", "subject",
+	"has_attachments", "attachment_count", "file_size",
+}
+
+// exportCSV writes one metadata row per email
+func (e *Exporter) exportCSV(w io.Writer, filters db.SearchFilters) (*Result, error) {
+	result := &Result{}
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(csvHeader); err != nil {
+		return result, err
+	}
+
+	err := e.db.IterateFiltered(filters, func(email *db.Email) error {
+		date := ""
+		if email.Date.Valid {
+			date = email.Date.Time.Format(time.RFC3339)
+		}
+		record := []string{
+			strconv.FormatInt(email.ID, 10),
+			email.FilePath,
+			email.MessageID,
+			email.InReplyTo,
+			date,
+			email.Sender,
+			email.SenderName,
+			email.Recipients,
+			email.Subject,
+			strconv.FormatBool(email.HasAttachments),
+			strconv.Itoa(email.AttachmentCount),
+			strconv.FormatInt(email.FileSize, 10),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		result.Exported++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	cw.Flush()
+	return result, cw.Error()
+}
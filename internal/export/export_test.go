@@ -0,0 +1,213 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupExportDB creates a database with two emails backed by .eml files
+func setupExportDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	dir := t.TempDir()
+	database := db.SetupTestDB(t)
+	database.SetEmailsPath(dir)
+	t.Cleanup(func() { db.CleanupTestDB(t, database) })
+
+	files := map[string]string{
+		"inbox/one.eml": "From: alice@test.com\r\nSubject: One\r\n\r\nHello\r\nFrom the start of a line\r\n>From quoted\r\n",
+		"two.eml":       "From: bob@test.com\nSubject: Two\n\nSecond body",
+	}
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	one := db.CreateTestEmailWithDate("One", "alice@test.com", "Hello", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	one.FilePath = "inbox/one.eml"
+	two := db.CreateTestEmailWithDate("Two", "bob@test.com", "Second body", time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC))
+	two.FilePath = "two.eml"
+	missing := db.CreateTestEmail("Missing", "carol@test.com", "Gone")
+	missing.FilePath = "missing.eml"
+	db.InsertTestEmails(t, database, []*db.Email{one, two, missing})
+
+	return database
+}
+
+// TestExportMbox tests mboxrd output with From-line quoting
+func TestExportMbox(t *testing.T) {
+	database := setupExportDB(t)
+
+	var buf bytes.Buffer
+	result, err := NewExporter(database).Export(&buf, FormatMbox, db.SearchFilters{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.Exported)
+	assert.Equal(t, 1, result.Skipped, "Missing .eml file should be skipped")
+	assert.Equal(t, []string{"missing.eml"}, result.SkippedFiles)
+
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "From alice@test.com Mon Jan  1 10:00:00 2024\n"))
+	assert.Contains(t, out, "\n>From the start of a line\n")
+	assert.Contains(t, out, "\n>>From quoted\n")
+	assert.Contains(t, out, "From bob@test.com Thu Feb  1 10:00:00 2024\n")
+	assert.NotContains(t, out, "\r", "Line endings should be normalized")
+	assert.True(t, strings.HasSuffix(out, "Second body\n\n"))
+}
+
+// TestExportZip tests that the zip keeps relative paths and original bytes
+func TestExportZip(t *testing.T) {
+	database := setupExportDB(t)
+
+	var buf bytes.Buffer
+	result, err := NewExporter(database).Export(&buf, FormatZip, db.SearchFilters{Sender: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Exported)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	assert.Equal(t, "inbox/one.eml", zr.File[0].Name)
+
+	rc, err := zr.File[0].Open()
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "From the start of a line\r\n", "Zip should contain the file unchanged")
+}
+
+// TestExportCSV tests metadata rows
+func TestExportCSV(t *testing.T) {
+	database := setupExportDB(t)
+
+	var buf bytes.Buffer
+	result, err := NewExporter(database).Export(&buf, FormatCSV, db.SearchFilters{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Exported, "CSV does not need the .eml files")
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, "inbox/one.eml", records[1][1])
+	assert.Equal(t, "2024-01-01T10:00:00Z", records[1][4])
+}
+
+// TestParseFormat tests format validation
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("MBOX")
+	require.NoError(t, err)
+	assert.Equal(t, FormatMbox, f)
+
+	f, err = ParseFormat("redacted-html")
+	require.NoError(t, err)
+	assert.Equal(t, FormatRedactedHTML, f)
+
+	_, err = ParseFormat("pst")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+// TestExportRedacted tests that redacted renderings hide marked spans
+func TestExportRedacted(t *testing.T) {
+	database := setupExportDB(t)
+
+	emails, err := database.ListEmails(10, 0)
+	require.NoError(t, err)
+	var one *db.Email
+	for _, e := range emails {
+		if e.Subject == "One" {
+			one = e
+		}
+	}
+	require.NotNil(t, one)
+	// "Hello" in the body of one.eml
+	require.NoError(t, database.AddRedaction(&db.Redaction{EmailID: one.ID, Source: db.PIISourceBody, Start: 0, End: 5}))
+
+	for _, format := range []Format{FormatRedactedText, FormatRedactedHTML} {
+		var buf bytes.Buffer
+		result, err := NewExporter(database).Export(&buf, format, db.SearchFilters{Sender: "alice"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Exported)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		require.Len(t, zr.File, 1)
+		rc, err := zr.File[0].Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+
+		body := string(data)
+		assert.NotContains(t, body, "Hello", format)
+		assert.Contains(t, body, "From the start of a line", format)
+		assert.Contains(t, body, "alice@test.com", format)
+	}
+}
+
+// TestExportRedactedSkipsInvalidRedactions tests that an email whose
+// redaction no longer fits its body is left out with the reason
+func TestExportRedactedSkipsInvalidRedactions(t *testing.T) {
+	database := setupExportDB(t)
+
+	emails, err := database.ListEmails(10, 0)
+	require.NoError(t, err)
+	for _, e := range emails {
+		if e.Subject == "One" {
+			require.NoError(t, database.AddRedaction(&db.Redaction{EmailID: e.ID, Source: db.PIISourceBody, Start: 0, End: 500}))
+		}
+	}
+
+	var buf bytes.Buffer
+	result, err := NewExporter(database).Export(&buf, FormatRedactedText, db.SearchFilters{Sender: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Exported)
+	assert.Equal(t, []string{"inbox/one.eml"}, result.SkippedFiles)
+	assert.Contains(t, result.SkipReasons["inbox/one.eml"], "does not fit")
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	assert.Equal(t, "SKIPPED.txt", zr.File[0].Name)
+	rc, err := zr.File[0].Open()
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "inbox/one.eml: redaction does not fit the text")
+	assert.NotContains(t, string(data), "Hello")
+}
+
+func TestExportRedactedSkipsStaleRedactions(t *testing.T) {
+	database := setupExportDB(t)
+
+	emails, err := database.ListEmails(10, 0)
+	require.NoError(t, err)
+	for _, e := range emails {
+		if e.Subject == "One" {
+			require.NoError(t, database.AddRedaction(&db.Redaction{EmailID: e.ID, Source: db.PIISourceBody, Start: 0, End: 1}))
+			e.BodyHash = "changed"
+			require.NoError(t, database.UpdateParsedEmail(e, nil))
+		}
+	}
+
+	var buf bytes.Buffer
+	result, err := NewExporter(database).Export(&buf, FormatRedactedText, db.SearchFilters{Sender: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Exported)
+	assert.Equal(t, []string{"inbox/one.eml"}, result.SkippedFiles)
+	assert.Contains(t, result.SkipReasons["inbox/one.eml"], "body changed")
+}
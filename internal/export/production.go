@@ -0,0 +1,421 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/parser"
+)
+
+// Concordance DAT delimiters
+const (
+	datQuote     = "\u00fe" // þ wraps every field
+	datDelimiter = "\u0014" // ¶ in the Concordance code page separates fields
+	datNewline   = "\u00ae" // ® replaces line breaks inside fields
+)
+
+// batesDigits is the zero-padded width of the numeric part of a Bates number
+const batesDigits = 8
+
+// validPrefix restricts Bates prefixes to characters safe in file names
+var validPrefix = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// ErrInvalidProduction is returned when a production cannot be made as
+// requested: a missing name, a bad prefix or start number, or no documents
+var ErrInvalidProduction = errors.New("invalid production")
+
+// ProductionOptions configures an eDiscovery production
+type ProductionOptions struct {
+	Name        string // Production name, used for load file names
+	Prefix      string // Bates prefix, e.g. "ABC"
+	Custodian   string // Custodian recorded for every document
+	Volume      string // Volume label written to the OPT file
+	StartNumber int64  // First Bates number; 0 means the next unused number
+}
+
+// ProductionResult describes a completed production
+type ProductionResult struct {
+	Production   *db.Production
+	Emails       int
+	Attachments  int
+	SkippedFiles []string
+}
+
+// Producer renders filtered emails into a Bates-numbered production
+type Producer struct {
+	db *db.DB
+}
+
+// NewProducer creates a new producer
+func NewProducer(database *db.DB) *Producer {
+	return &Producer{db: database}
+}
+
+// plannedDoc is a document with its reserved Bates number
+type plannedDoc struct {
+	doc        *db.ProductionDocument
+	email      *db.Email
+	attachment *db.Attachment // nil for the parent email
+	part       int            // For attachments: index of the matching parsed part
+	family     []*plannedDoc  // for emails: the email followed by its attachments
+}
+
+// FormatBates formats a Bates number with the prefix and zero padding
+func FormatBates(prefix string, n int64) string {
+	return fmt.Sprintf("%s%0*d", prefix, batesDigits, n)
+}
+
+// Produce reserves Bates numbers for every email matching the filters and their
+// attachments, records the production, then writes a zip with NATIVES/, TEXT/
+// and DATA/ (Concordance DAT and Opticon OPT load files) to w.
+func (p *Producer) Produce(w io.Writer, opts ProductionOptions, filters db.SearchFilters) (*ProductionResult, error) {
+	if strings.TrimSpace(opts.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidProduction)
+	}
+	if !validPrefix.MatchString(opts.Prefix) {
+		return nil, fmt.Errorf("%w: bates prefix must be 1-20 letters, digits, '-' or '_'", ErrInvalidProduction)
+	}
+	if opts.Volume == "" {
+		opts.Volume = "VOL001"
+	}
+
+	result := &ProductionResult{}
+
+	// Collect matching emails first; Bates numbers are planned for the whole set
+	var emails []*db.Email
+	err := p.db.IterateFiltered(filters, func(email *db.Email) error {
+		emails = append(emails, email)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start := opts.StartNumber
+	if start == 0 {
+		start, err = p.db.NextBatesNumber(opts.Prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Assign numbers: each email is followed by its attachments
+	next := start
+	var families []*plannedDoc
+	var docs []*db.ProductionDocument
+	for _, email := range emails {
+		absPath, err := p.db.ResolveEmailPath(email.FilePath)
+		if err == nil {
+			_, err = os.Stat(absPath)
+		}
+		if err != nil {
+			result.SkippedFiles = append(result.SkippedFiles, email.FilePath)
+			continue
+		}
+
+		atts, err := p.db.GetAttachmentsByEmailID(email.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every attachment must be found in the file before numbers are
+		// reserved, so a production never contains an empty native
+		parts, err := matchAttachments(absPath, atts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot produce %s: %w", email.FilePath, err)
+		}
+
+		parentBates := FormatBates(opts.Prefix, next)
+		parent := &plannedDoc{
+			doc: &db.ProductionDocument{
+				Bates:       parentBates,
+				BatesNumber: next,
+				EmailID:     email.ID,
+			},
+			email: email,
+		}
+		next++
+		parent.family = append(parent.family, parent)
+		docs = append(docs, parent.doc)
+
+		for i, att := range atts {
+			child := &plannedDoc{
+				doc: &db.ProductionDocument{
+					Bates:        FormatBates(opts.Prefix, next),
+					BatesNumber:  next,
+					EmailID:      email.ID,
+					AttachmentID: sql.NullInt64{Int64: att.ID, Valid: true},
+					ParentBates:  parentBates,
+				},
+				email:      email,
+				attachment: att,
+				part:       parts[i],
+			}
+			next++
+			parent.family = append(parent.family, child)
+			docs = append(docs, child.doc)
+		}
+
+		families = append(families, parent)
+		result.Emails++
+		result.Attachments += len(atts)
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%w: no documents match the selected filters", ErrInvalidProduction)
+	}
+
+	production := &db.Production{
+		Name:        opts.Name,
+		Prefix:      opts.Prefix,
+		Custodian:   opts.Custodian,
+		StartNumber: start,
+		EndNumber:   next - 1,
+	}
+	if _, err := p.db.CreateProduction(production, docs); err != nil {
+		if errors.Is(err, db.ErrBatesNumberUsed) {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProduction, err)
+		}
+		return nil, err
+	}
+	result.Production = production
+
+	hashes, err := p.writeProduction(w, opts, families)
+	if err != nil {
+		return result, err
+	}
+
+	if err := p.db.SetProductionHashes(production.ID, hashes); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// writeProduction renders every family into the zip and returns MD5 hashes by Bates
+func (p *Producer) writeProduction(w io.Writer, opts ProductionOptions, families []*plannedDoc) (map[string]string, error) {
+	zw := zip.NewWriter(w)
+	hashes := make(map[string]string)
+
+	base := sanitizeName(opts.Name)
+	var dat, opt strings.Builder
+	writeDATRow(&dat, datFields)
+
+	for _, parent := range families {
+		absPath, err := p.db.ResolveEmailPath(parent.email.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := os.ReadFile(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", parent.email.FilePath, err)
+		}
+		parsed, err := parser.ParseEML(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", parent.email.FilePath, err)
+		}
+
+		last := parent.family[len(parent.family)-1].doc.Bates
+		var attachBates []string
+		for _, member := range parent.family[1:] {
+			attachBates = append(attachBates, member.doc.Bates)
+		}
+
+		for _, member := range parent.family {
+			var native []byte
+			var nativeName, text, filename, docType string
+			if member.attachment == nil {
+				native = raw
+				nativeName = member.doc.Bates + ".eml"
+				text = emailText(parsed)
+				filename = path.Base(parent.email.FilePath)
+				docType = "Email"
+			} else {
+				// The file may have changed since the part was matched
+				if member.part >= len(parsed.Attachments) || member.attachment.Key() != parsed.Attachments[member.part].Key() {
+					return nil, fmt.Errorf("attachment %s of %s changed during the production", member.attachment.Filename, parent.email.FilePath)
+				}
+				native = parsed.Attachments[member.part].Data
+				nativeName = member.doc.Bates + attachmentExt(member.attachment.Filename)
+				if strings.HasPrefix(member.attachment.ContentType, "text/") {
+					text = string(native)
+				}
+				filename = member.attachment.Filename
+				docType = "Attachment"
+			}
+
+			sum := md5.Sum(native)
+			hash := hex.EncodeToString(sum[:])
+			hashes[member.doc.Bates] = hash
+
+			nativePath := "NATIVES/" + nativeName
+			textPath := "TEXT/" + member.doc.Bates + ".txt"
+			if err := writeZipFile(zw, nativePath, native); err != nil {
+				return nil, err
+			}
+			if err := writeZipFile(zw, textPath, []byte(text)); err != nil {
+				return nil, err
+			}
+
+			date := ""
+			if parent.email.Date.Valid {
+				date = parent.email.Date.Time.Format("01/02/2006 15:04:05")
+			}
+			writeDATRow(&dat, []string{
+				member.doc.Bates,
+				member.doc.Bates,
+				parent.doc.Bates,
+				last,
+				member.doc.ParentBates,
+				strings.Join(attachBates, ";"),
+				opts.Custodian,
+				formatAddress(parent.email.SenderName, parent.email.Sender),
+				strings.Join(parsed.Recipients, "; "),
+				strings.Join(parsed.CC, "; "),
+				date,
+				parent.email.Subject,
+				filename,
+				docType,
+				hash,
+				nativePath,
+				textPath,
+			})
+
+			// One page per document; Y marks the first page of each document
+			fmt.Fprintf(&opt, "%s,%s,%s,Y,,,1\r\n", member.doc.Bates, opts.Volume, strings.ReplaceAll(nativePath, "/", `\`))
+		}
+	}
+
+	if err := writeZipFile(zw, "DATA/"+base+".dat", []byte(dat.String())); err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(zw, "DATA/"+base+".opt", []byte(opt.String())); err != nil {
+		return nil, err
+	}
+
+	return hashes, zw.Close()
+}
+
+// matchAttachments finds the parsed part of each stored attachment by
+// filename, content type and size, and returns the part indexes in order
+func matchAttachments(absPath string, atts []*db.Attachment) ([]int, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	parsed, err := parser.ParseEMLFile(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make([]bool, len(parsed.Attachments))
+	parts := make([]int, len(atts))
+	for i, att := range atts {
+		parts[i] = -1
+		for j, part := range parsed.Attachments {
+			if !used[j] && att.Key() == part.Key() {
+				used[j] = true
+				parts[i] = j
+				break
+			}
+		}
+		if parts[i] < 0 {
+			return nil, fmt.Errorf("attachment %s not found in the .eml file", att.Filename)
+		}
+	}
+	return parts, nil
+}
+
+// datFields lists the Concordance DAT columns in order
+var datFields = []string{
+	"BEGBATES", "ENDBATES", "BEGATTACH", "ENDATTACH", "PARENTBATES", "ATTACHBATES",
+	"CUSTODIAN", "FROM", "TO", "CC", "DATESENT", "SUBJECT", "FILENAME", "DOCTYPE",
+	"MD5HASH", "NATIVELINK", "TEXTLINK",
+}
+
+// writeDATRow writes one Concordance-delimited row
+func writeDATRow(b *strings.Builder, fields []string) {
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(datDelimiter)
+		}
+		field = strings.ReplaceAll(field, "\r\n", datNewline)
+		field = strings.ReplaceAll(field, "\n", datNewline)
+		field = strings.ReplaceAll(field, datQuote, "")
+		b.WriteString(datQuote + field + datQuote)
+	}
+	b.WriteString("\r\n")
+}
+
+// writeZipFile adds a complete file to the zip
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return fmt.Errorf("failed to add %s to zip: %w", name, err)
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to zip: %w", name, err)
+	}
+	return nil
+}
+
+// emailText renders the extracted text of an email with its key headers
+func emailText(parsed *parser.ParsedEmail) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", formatAddress(parsed.SenderName, parsed.Sender))
+	fmt.Fprintf(&b, "To: %s\n", strings.Join(parsed.Recipients, ", "))
+	if len(parsed.CC) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\n", strings.Join(parsed.CC, ", "))
+	}
+	if !parsed.Date.IsZero() {
+		fmt.Fprintf(&b, "Date: %s\n", parsed.Date.Format(time.RFC1123Z))
+	}
+	fmt.Fprintf(&b, "Subject: %s\n\n", parsed.Subject)
+	b.WriteString(parsed.BodyText)
+	return b.String()
+}
+
+// formatAddress formats a display name and address
+func formatAddress(name, address string) string {
+	if name == "" {
+		return address
+	}
+	return name + " <" + address + ">"
+}
+
+// attachmentExt returns a safe file extension for an attachment filename
+func attachmentExt(filename string) string {
+	ext := strings.ToLower(path.Ext(strings.ReplaceAll(filename, `\`, "/")))
+	if len(ext) < 2 || len(ext) > 10 || strings.ContainsAny(ext, " /\\") {
+		return ".bin"
+	}
+	return ext
+}
+
+// sanitizeName turns a production name into a safe file base name
+func sanitizeName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '_'
+		}
+		return -1
+	}, name)
+	if cleaned == "" {
+		cleaned = "production"
+	}
+	return cleaned
+}
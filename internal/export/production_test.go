@@ -0,0 +1,186 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const attachmentEML = "From: Dana <dana@test.com>\r\n" +
+	"To: erin@test.com\r\n" +
+	"Subject: Report\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"See attached\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"attachment text\r\n" +
+	"--b1--\r\n"
+
+// setupProductionDB extends the export fixtures with an email that has an attachment
+func setupProductionDB(t *testing.T) *db.DB {
+	t.Helper()
+
+	database := setupExportDB(t)
+	path := filepath.Join(database.GetEmailsPath(), "report.eml")
+	require.NoError(t, os.WriteFile(path, []byte(attachmentEML), 0644))
+
+	report := db.CreateTestEmailWithDate("Report", "dana@test.com", "See attached", time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC))
+	report.FilePath = "report.eml"
+	report.HasAttachments = true
+	report.AttachmentCount = 1
+	db.InsertTestEmails(t, database, []*db.Email{report})
+
+	_, err := database.InsertAttachment(&db.Attachment{
+		EmailID:     report.ID,
+		Filename:    "notes.txt",
+		ContentType: "text/plain",
+		Size:        15,
+	})
+	require.NoError(t, err)
+
+	return database
+}
+
+// readZip returns the contents of every file in a zip by name
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+// TestProduceFamilies tests Bates numbering, family relationships and load files
+func TestProduceFamilies(t *testing.T) {
+	database := setupProductionDB(t)
+
+	var buf bytes.Buffer
+	result, err := NewProducer(database).Produce(&buf, ProductionOptions{
+		Name:      "First Production",
+		Prefix:    "ABC",
+		Custodian: "Legal",
+	}, db.SearchFilters{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, result.Emails)
+	assert.Equal(t, 1, result.Attachments)
+	assert.Equal(t, []string{"missing.eml"}, result.SkippedFiles)
+	assert.Equal(t, int64(1), result.Production.StartNumber)
+	assert.Equal(t, int64(4), result.Production.EndNumber)
+
+	files := readZip(t, buf.Bytes())
+	assert.Contains(t, files, "NATIVES/ABC00000001.eml")
+	assert.Equal(t, "attachment text", files["NATIVES/ABC00000004.txt"])
+	assert.Contains(t, files["TEXT/ABC00000003.txt"], "See attached")
+
+	dat := strings.Split(strings.TrimSuffix(files["DATA/First_Production.dat"], "\r\n"), "\r\n")
+	require.Len(t, dat, 5, "Header plus one row per document")
+	assert.True(t, strings.HasPrefix(dat[0], datQuote+"BEGBATES"+datQuote+datDelimiter))
+
+	// The attachment row points back to its parent email
+	attachRow := strings.Split(dat[4], datDelimiter)
+	assert.Equal(t, datQuote+"ABC00000004"+datQuote, attachRow[0])
+	assert.Equal(t, datQuote+"ABC00000003"+datQuote, attachRow[2], "BEGATTACH")
+	assert.Equal(t, datQuote+"ABC00000004"+datQuote, attachRow[3], "ENDATTACH")
+	assert.Equal(t, datQuote+"ABC00000003"+datQuote, attachRow[4], "PARENTBATES")
+
+	assert.True(t, strings.HasPrefix(files["DATA/First_Production.opt"], "ABC00000001,VOL001,NATIVES\\ABC00000001.eml,Y,,,1\r\n"))
+
+	docs, err := database.GetProductionDocuments(result.Production.ID)
+	require.NoError(t, err)
+	require.Len(t, docs, 4)
+	assert.True(t, docs[3].AttachmentID.Valid)
+	assert.Equal(t, "ABC00000003", docs[3].ParentBates)
+	assert.Len(t, docs[3].MD5, 32, "Hashes are recorded after rendering")
+}
+
+// TestProduceNeverReusesNumbers tests that a second production continues the range
+func TestProduceNeverReusesNumbers(t *testing.T) {
+	database := setupProductionDB(t)
+	producer := NewProducer(database)
+
+	_, err := producer.Produce(io.Discard, ProductionOptions{Name: "One", Prefix: "ABC"}, db.SearchFilters{Sender: "alice"})
+	require.NoError(t, err)
+
+	second, err := producer.Produce(io.Discard, ProductionOptions{Name: "Two", Prefix: "ABC"}, db.SearchFilters{Sender: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), second.Production.StartNumber)
+
+	_, err = producer.Produce(io.Discard, ProductionOptions{Name: "Three", Prefix: "ABC", StartNumber: 2}, db.SearchFilters{})
+	assert.ErrorIs(t, err, ErrInvalidProduction, "An explicit start inside a used range must be rejected")
+	assert.ErrorIs(t, err, db.ErrBatesNumberUsed)
+
+	other, err := producer.Produce(io.Discard, ProductionOptions{Name: "Other", Prefix: "XYZ"}, db.SearchFilters{Sender: "bob"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), other.Production.StartNumber, "Each prefix has its own sequence")
+
+	productions, err := database.ListProductions()
+	require.NoError(t, err)
+	assert.Len(t, productions, 3)
+}
+
+// TestProduceValidation tests option validation
+func TestProduceValidation(t *testing.T) {
+	database := setupProductionDB(t)
+	producer := NewProducer(database)
+
+	_, err := producer.Produce(io.Discard, ProductionOptions{Prefix: "ABC"}, db.SearchFilters{})
+	assert.ErrorIs(t, err, ErrInvalidProduction)
+
+	_, err = producer.Produce(io.Discard, ProductionOptions{Name: "Bad", Prefix: "A/B"}, db.SearchFilters{})
+	assert.ErrorIs(t, err, ErrInvalidProduction)
+
+	_, err = producer.Produce(io.Discard, ProductionOptions{Name: "Empty", Prefix: "ABC"}, db.SearchFilters{Sender: "nobody"})
+	assert.ErrorIs(t, err, ErrInvalidProduction)
+}
+
+// TestProduceMissingAttachment tests that an attachment missing from its file
+// fails the production before any numbers are reserved
+func TestProduceMissingAttachment(t *testing.T) {
+	database := setupProductionDB(t)
+
+	emails, err := database.SearchFiltered(db.SearchFilters{Sender: "dana"}, 1, 0)
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+	_, err = database.InsertAttachment(&db.Attachment{
+		EmailID:     emails[0].ID,
+		Filename:    "notes.txt",
+		ContentType: "text/plain",
+		Size:        99,
+	})
+	require.NoError(t, err)
+
+	_, err = NewProducer(database).Produce(io.Discard, ProductionOptions{Name: "Broken", Prefix: "ABC"}, db.SearchFilters{})
+	assert.ErrorContains(t, err, "attachment notes.txt not found")
+	assert.NotErrorIs(t, err, ErrInvalidProduction, "A broken file is not the caller's mistake")
+
+	productions, err := database.ListProductions()
+	require.NoError(t, err)
+	assert.Empty(t, productions)
+}
@@ -0,0 +1,152 @@
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/redact"
+)
+
+// RedactedDocument prepares an email for redacted output. The plain text body
+// is used when there is one; otherwise the HTML body's redactions are applied
+// to the markup, which is then reduced to text so nothing hidden in it leaks.
+// It fails with redact.ErrInvalidSpan if a redaction is stale or does not
+// fit the body used, rather than show the text it was meant to hide.
+func RedactedDocument(content *db.EmailWithContent, redactions []*db.Redaction) (*redact.Document, error) {
+	doc := &redact.Document{
+		Subject: content.Subject,
+		From:    content.Sender,
+		To:      content.Recipients,
+		CC:      strings.Join(content.CC, ", "),
+	}
+	if content.SenderName != "" {
+		doc.From = content.SenderName + " <" + content.Sender + ">"
+	}
+	if content.Date.Valid {
+		doc.Date = content.Date.Time.Format(time.RFC1123Z)
+	}
+	for _, att := range content.Attachments {
+		doc.Attachments = append(doc.Attachments, att.Filename)
+	}
+
+	for _, r := range redactions {
+		if r.Stale {
+			return nil, fmt.Errorf("%w: marked before the body changed", redact.ErrInvalidSpan)
+		}
+	}
+
+	if strings.TrimSpace(content.BodyText) != "" {
+		doc.Body = content.BodyText
+		doc.Spans = redactionSpans(redactions, db.PIISourceBody)
+		if err := redact.Check(doc.Body, doc.Spans); err != nil {
+			return nil, err
+		}
+	} else {
+		spans := redactionSpans(redactions, db.PIISourceHTML)
+		if err := redact.Check(content.BodyHTML, spans); err != nil {
+			return nil, err
+		}
+		doc.Body = redact.HTMLText(redact.Apply(content.BodyHTML, spans))
+	}
+	return doc, nil
+}
+
+// redactionSpans returns the spans of the redactions from one source
+func redactionSpans(redactions []*db.Redaction, source string) []redact.Span {
+	var spans []redact.Span
+	for _, r := range redactions {
+		if r.Source == source {
+			spans = append(spans, redact.Span{Start: r.Start, End: r.End})
+		}
+	}
+	return spans
+}
+
+// LoadRedactedDocument reads an email from disk and prepares it for redacted
+// output, or returns nil if the email does not exist. It fails as
+// RedactedDocument does when a redaction does not fit.
+func LoadRedactedDocument(database *db.DB, id int64) (*redact.Document, error) {
+	content, err := database.GetEmailWithFullContent(id)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	redactions, err := database.GetRedactions(id)
+	if err != nil {
+		return nil, err
+	}
+	return RedactedDocument(content, redactions)
+}
+
+// WriteRedacted writes a redacted document as text or HTML
+func WriteRedacted(w io.Writer, doc *redact.Document, asHTML bool) error {
+	if asHTML {
+		return redact.WriteHTML(w, doc)
+	}
+	return redact.WriteText(w, doc)
+}
+
+// exportRedacted writes a zip of redacted text or HTML renderings, one per
+// email, named after the email's ID. Emails that cannot be rendered, such as
+// those with a redaction that no longer fits their body, are left out and
+// listed with the reason in a SKIPPED.txt entry.
+func (e *Exporter) exportRedacted(w io.Writer, filters db.SearchFilters, asHTML bool) (*Result, error) {
+	result := &Result{}
+
+	ext := ".txt"
+	if asHTML {
+		ext = ".html"
+	}
+
+	// IterateFiltered holds no cursor while the callback runs, so each
+	// email's document can be loaded as it is reached
+	zw := zip.NewWriter(w)
+	err := e.db.IterateFiltered(filters, func(email *db.Email) error {
+		doc, err := LoadRedactedDocument(e.db, email.ID)
+		if err != nil {
+			result.skip(email, err)
+			return nil
+		}
+		if doc == nil {
+			result.skip(email, fmt.Errorf("email not found"))
+			return nil
+		}
+
+		header := &zip.FileHeader{
+			Name:   fmt.Sprintf("%d%s", email.ID, ext),
+			Method: zip.Deflate,
+		}
+		if email.Date.Valid {
+			header.Modified = email.Date.Time
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to zip: %w", header.Name, err)
+		}
+		if err := WriteRedacted(entry, doc, asHTML); err != nil {
+			return fmt.Errorf("failed to write %s to zip: %w", header.Name, err)
+		}
+		result.Exported++
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if len(result.SkippedFiles) > 0 {
+		entry, err := zw.Create("SKIPPED.txt")
+		if err != nil {
+			return result, fmt.Errorf("failed to add SKIPPED.txt to zip: %w", err)
+		}
+		for _, path := range result.SkippedFiles {
+			if _, err := fmt.Fprintf(entry, "%s: %s\n", path, result.SkipReasons[path]); err != nil {
+				return result, fmt.Errorf("failed to write SKIPPED.txt to zip: %w", err)
+			}
+		}
+	}
+
+	return result, zw.Close()
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// topEntriesLimit is the number of senders and domains listed on the dashboard
+const topEntriesLimit = 10
+
+// weekdayOrder lists weekdays Monday first, as indexes into the heatmap
+var weekdayOrder = []struct {
+	Name    string
+	Weekday int
+}{
+	{"Mon", 1}, {"Tue", 2}, {"Wed", 3}, {"Thu", 4}, {"Fri", 5}, {"Sat", 6}, {"Sun", 0},
+}
+
+// volumeBar is one bar of the volume chart
+type volumeBar struct {
+	Label  string
+	Count  int
+	Height int // Percentage of the tallest bar
+	URL    string
+}
+
+// heatmapRow is one weekday of the activity heatmap
+type heatmapRow struct {
+	Name  string
+	Cells []heatmapCell
+}
+
+// heatmapCell is one hour of the activity heatmap
+type heatmapCell struct {
+	Hour  int
+	Count int
+	Level int // Shade from 0 (none) to 4 (busiest)
+}
+
+// topEntry is one row of a top senders or domains list
+type topEntry struct {
+	*db.CountEntry
+	Width int // Percentage of the largest count
+	URL   string
+}
+
+// drillDownURL links to the search results for a filter set
+func drillDownURL(f db.SearchFilters) string {
+	return "/search?" + filterValues(f).Encode()
+}
+
+// narrowDates restricts a filter set to a date range, keeping any tighter bounds it already has
+func narrowDates(f db.SearchFilters, from, to string) db.SearchFilters {
+	if f.DateFrom == "" || from > f.DateFrom {
+		f.DateFrom = from
+	}
+	if f.DateTo == "" || to < f.DateTo {
+		f.DateTo = to
+	}
+	return f
+}
+
+// AnalyticsPage shows message volume over time, an hour-by-weekday activity
+// heatmap, and the top senders and domains for a filter set
+func (h *Handlers) AnalyticsPage(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	granularity := r.URL.Query().Get("granularity")
+	if granularity != db.GranularityDay && granularity != db.GranularityWeek {
+		granularity = db.GranularityMonth
+	}
+
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	volume, err := h.db.GetVolume(filters, granularity)
+	if err != nil {
+		log.Printf("Failed to load volume: %v", err)
+		http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+		return
+	}
+	heatmap, err := h.db.GetActivityHeatmap(filters)
+	if err != nil {
+		log.Printf("Failed to load activity heatmap: %v", err)
+		http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+		return
+	}
+	senders, err := h.db.GetTopSenders(filters, topEntriesLimit)
+	if err != nil {
+		log.Printf("Failed to load top senders: %v", err)
+		http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+		return
+	}
+	domains, err := h.db.GetTopSenderDomains(filters, topEntriesLimit)
+	if err != nil {
+		log.Printf("Failed to load top domains: %v", err)
+		http.Error(w, "Failed to load analytics", http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	bars := volumeBars(volume, filters, granularity)
+
+	data := map[string]interface{}{
+		"PageTitle":   "Analytics - EML Viewer",
+		"Stats":       stats,
+		"Filters":     filters,
+		"Granularity": granularity,
+		"Volume":      bars,
+		"Heatmap":     heatmapRows(heatmap),
+		"Senders": topEntries(senders, func(e *db.CountEntry) db.SearchFilters {
+			f := filters
+			f.Sender = e.Key
+			return f
+		}),
+		"Domains": topEntries(domains, func(e *db.CountEntry) db.SearchFilters {
+			f := filters
+			f.Sender = "@" + e.Key
+			return f
+		}),
+	}
+
+	if len(bars) > 0 {
+		data["VolumeStart"] = bars[0].Label
+		data["VolumeEnd"] = bars[len(bars)-1].Label
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "analytics.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// volumeBars scales volume buckets into chart bars linking to their emails
+func volumeBars(buckets []*db.VolumeBucket, filters db.SearchFilters, granularity string) []volumeBar {
+	max := 0
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+
+	bars := make([]volumeBar, len(buckets))
+	for i, b := range buckets {
+		bars[i] = volumeBar{
+			Label: b.Label(granularity),
+			Count: b.Count,
+			URL:   drillDownURL(narrowDates(filters, b.DateFrom, b.DateTo)),
+		}
+		if max > 0 {
+			bars[i].Height = b.Count * 100 / max
+		}
+	}
+	return bars
+}
+
+// heatmapRows arranges heatmap counts Monday first with shading levels
+func heatmapRows(counts [7][24]int) []heatmapRow {
+	max := 0
+	for _, day := range counts {
+		for _, c := range day {
+			if c > max {
+				max = c
+			}
+		}
+	}
+
+	rows := make([]heatmapRow, 0, len(weekdayOrder))
+	for _, d := range weekdayOrder {
+		row := heatmapRow{Name: d.Name}
+		for hour, c := range counts[d.Weekday] {
+			cell := heatmapCell{Hour: hour, Count: c}
+			if c > 0 && max > 0 {
+				cell.Level = 1 + (c*4-1)/max
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// topEntries scales top counts into list rows linking to their emails
+func topEntries(entries []*db.CountEntry, filterFor func(*db.CountEntry) db.SearchFilters) []topEntry {
+	rows := make([]topEntry, len(entries))
+	for i, e := range entries {
+		rows[i] = topEntry{
+			CountEntry: e,
+			Width:      e.Count * 100 / entries[0].Count,
+			URL:        drillDownURL(filterFor(e)),
+		}
+	}
+	return rows
+}
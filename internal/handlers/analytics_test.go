@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnalyticsPage tests the dashboard renders drill-down links for a filter set
+func TestAnalyticsPage(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmailWithDate("Budget", "alice@acme.com", "a", time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)),
+		db.CreateTestEmailWithDate("Budget v2", "alice@acme.com", "b", time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)),
+	})
+
+	w := httptest.NewRecorder()
+	h.AnalyticsPage(w, httptest.NewRequest("GET", "/analytics?sender=alice&date_from=2024-01-05", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+
+	assert.Contains(t, body, "Volume per month")
+	assert.Contains(t, body, "/search?date_from=2024-01-05&amp;date_to=2024-01-31&amp;sender=alice", "Bars keep tighter filter bounds")
+	assert.Contains(t, body, "/search?date_from=2024-03-01&amp;date_to=2024-03-31&amp;sender=alice")
+	assert.Contains(t, body, "alice@acme.com")
+	assert.Contains(t, body, "sender=%40acme.com", "Domains drill into a sender filter")
+
+	w = httptest.NewRecorder()
+	h.AnalyticsPage(w, httptest.NewRequest("GET", "/analytics?granularity=week", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Week of Jan 8, 2024")
+}
+
+// TestSearchFullPage tests that linking to /search renders the full results page
+func TestSearchFullPage(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmailWithDate("Budget", "alice@acme.com", "a", time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)),
+	})
+
+	w := httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?date_from=2024-01-08&date_to=2024-01-08", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "<html")
+	assert.Contains(t, body, "Budget")
+	assert.Contains(t, body, `value="2024-01-08"`)
+
+	req := httptest.NewRequest("GET", "/search?date_from=2024-01-08", nil)
+	req.Header.Set("HX-Request", "true")
+	w = httptest.NewRecorder()
+	h.Search(w, req)
+	assert.NotContains(t, w.Body.String(), "<html", "HTMX requests still get the fragment")
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// apiEmail is the JSON representation of an email's metadata
+type apiEmail struct {
+	ID              int64      `json:"id"`
+	FilePath        string     `json:"file_path"`
+	MessageID       string     `json:"message_id,omitempty"`
+	InReplyTo       string     `json:"in_reply_to,omitempty"`
+	Subject         string     `json:"subject"`
+	Sender          string     `json:"sender"`
+	SenderName      string     `json:"sender_name,omitempty"`
+	Recipients      string     `json:"recipients,omitempty"`
+	Date            *time.Time `json:"date,omitempty"`
+	HasAttachments  bool       `json:"has_attachments"`
+	AttachmentCount int        `json:"attachment_count"`
+	FileSize        int64      `json:"file_size"`
+	Snippet         string     `json:"snippet,omitempty"`
+}
+
+// toAPIEmail converts an email record to its JSON representation
+func toAPIEmail(e *db.Email) apiEmail {
+	out := apiEmail{
+		ID:              e.ID,
+		FilePath:        e.FilePath,
+		MessageID:       e.MessageID,
+		InReplyTo:       e.InReplyTo,
+		Subject:         e.Subject,
+		Sender:          e.Sender,
+		SenderName:      e.SenderName,
+		Recipients:      e.Recipients,
+		HasAttachments:  e.HasAttachments,
+		AttachmentCount: e.AttachmentCount,
+		FileSize:        e.FileSize,
+	}
+	if e.Date.Valid {
+		d := e.Date.Time
+		out.Date = &d
+	}
+	return out
+}
+
+// apiFilters is the JSON representation of a filter set
+type apiFilters struct {
+	Query          string `json:"q,omitempty"`
+	Sender         string `json:"sender,omitempty"`
+	Recipient      string `json:"recipient,omitempty"`
+	HasAttachments bool   `json:"has_attachments,omitempty"`
+	DateFrom       string `json:"date_from,omitempty"`
+	DateTo         string `json:"date_to,omitempty"`
+
+	CollapseDuplicates bool   `json:"collapse_duplicates,omitempty"`
+	Sensitive          string `json:"sensitive,omitempty"`
+	Link               string `json:"link,omitempty"`
+	Domain             string `json:"domain,omitempty"`
+	Auth               string `json:"auth,omitempty"`
+	DateUncertain      bool   `json:"date_uncertain,omitempty"`
+}
+
+// toAPIFilters converts a filter set to its JSON representation
+func toAPIFilters(f db.SearchFilters) apiFilters {
+	return apiFilters{
+		Query:          f.Query,
+		Sender:         f.Sender,
+		Recipient:      f.Recipient,
+		HasAttachments: f.HasAttachments,
+		DateFrom:       f.DateFrom,
+		DateTo:         f.DateTo,
+
+		CollapseDuplicates: f.CollapseDuplicates,
+		Sensitive:          f.Sensitive,
+		Link:               f.Link,
+		Domain:             f.Domain,
+		Auth:               f.Auth,
+		DateUncertain:      f.DateUncertain,
+	}
+}
+
+// writeJSON encodes v as the JSON response body
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
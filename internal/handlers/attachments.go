@@ -47,37 +47,31 @@ func (h *Handlers) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get attachment metadata from database
-	att, err := h.db.GetAttachmentByID(id)
+	// Find the attachment in its .eml file, reading only as far as needed
+	ar, err := h.db.OpenAttachment(id)
 	if err != nil {
-		http.Error(w, "Failed to load attachment", http.StatusInternalServerError)
+		log.Printf("Error opening attachment: %v", err)
+		http.Error(w, "Failed to load attachment data", http.StatusInternalServerError)
 		return
 	}
-	if att == nil {
+	if ar == nil {
 		http.Error(w, "Attachment not found", http.StatusNotFound)
 		return
 	}
-
-	// Get attachment data by parsing .eml file
-	data, err := h.db.GetAttachmentData(id)
-	if err != nil {
-		log.Printf("Error getting attachment data: %v", err)
-		http.Error(w, "Failed to load attachment data", http.StatusInternalServerError)
-		return
-	}
+	defer ar.Close()
 
 	// Sanitize filename for security
-	safeFilename := sanitizeFilename(att.Filename)
+	safeFilename := sanitizeFilename(ar.Attachment.Filename)
 
 	// Set headers for download using proper encoding
 	w.Header().Set("Content-Disposition",
 		mime.FormatMediaType("attachment", map[string]string{
 			"filename": safeFilename,
 		}))
-	w.Header().Set("Content-Type", att.ContentType)
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(data)), 10))
+	w.Header().Set("Content-Type", ar.Attachment.ContentType)
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	// Write attachment data
-	w.Write(data)
+	// Stream the decoded content, with Range requests and Content-Length
+	// handled by ServeContent
+	http.ServeContent(w, r, safeFilename, ar.ModTime, ar)
 }
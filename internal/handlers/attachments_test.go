@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// download requests an attachment, with an optional Range header
+func download(h *Handlers, id int64, rangeHeader string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/attachments/%d/download", id), nil)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", fmt.Sprintf("%d", id))
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	h.DownloadAttachment(w, req)
+	return w
+}
+
+// TestDownloadAttachment tests full and ranged attachment downloads
+func TestDownloadAttachment(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer db.CleanupTestDB(t, database)
+	defer os.RemoveAll(tempDir)
+
+	filename := createTestEMLFileWithAttachments(t, tempDir, "with-attachments.eml",
+		"sender@test.com", "recipient@test.com", "Attachments", "See attached")
+	parsed, err := parser.ParseEMLFile(filepath.Join(tempDir, filename))
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 2)
+	image := parsed.Attachments[1].Data
+
+	email := db.CreateTestEmail("Attachments", "sender@test.com", "See attached")
+	email.FilePath = filename
+	emailID, err := database.InsertEmail(email)
+	require.NoError(t, err)
+	id, err := database.InsertAttachment(&db.Attachment{
+		EmailID:     emailID,
+		Filename:    "image.png",
+		ContentType: "image/png",
+		Size:        int64(len(image)),
+	})
+	require.NoError(t, err)
+
+	w := download(h, id, "")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, image, w.Body.Bytes())
+	assert.Equal(t, fmt.Sprint(len(image)), w.Header().Get("Content-Length"))
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename=image.png`)
+
+	w = download(h, id, "bytes=10-19")
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, image[10:20], w.Body.Bytes())
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, fmt.Sprintf("bytes 10-19/%d", len(image)), w.Header().Get("Content-Range"))
+
+	w = download(h, id, "bytes=-8")
+	assert.Equal(t, 206, w.Code)
+	assert.Equal(t, image[len(image)-8:], w.Body.Bytes())
+
+	w = download(h, id, fmt.Sprintf("bytes=%d-", len(image)+10))
+	assert.Equal(t, 416, w.Code)
+
+	assert.Equal(t, 404, download(h, id+100, "").Code)
+}
+
+// TestDownloadAttachmentSharedFilename tests that attachments sharing a
+// filename each download their own content
+func TestDownloadAttachmentSharedFilename(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer db.CleanupTestDB(t, database)
+	defer os.RemoveAll(tempDir)
+
+	content := "From: sender@test.com\r\n" +
+		"Subject: Signatures\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Two logos\r\n" +
+		"--b1\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"image001.png\"\r\n" +
+		"\r\n" +
+		"first logo\r\n" +
+		"--b1\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"image001.png\"\r\n" +
+		"\r\n" +
+		"the second logo\r\n" +
+		"--b1--\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "logos.eml"), []byte(content), 0644))
+	parsed, err := parser.ParseEMLFile(filepath.Join(tempDir, "logos.eml"))
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 2)
+
+	email := db.CreateTestEmail("Signatures", "sender@test.com", "Two logos")
+	email.FilePath = "logos.eml"
+	emailID, err := database.InsertEmail(email)
+	require.NoError(t, err)
+
+	// Stored in the other order, so matching by position would fail too
+	for i := len(parsed.Attachments) - 1; i >= 0; i-- {
+		part := parsed.Attachments[i]
+		id, err := database.InsertAttachment(&db.Attachment{
+			EmailID:     emailID,
+			Filename:    part.Filename,
+			ContentType: part.ContentType,
+			Size:        part.Size,
+		})
+		require.NoError(t, err)
+
+		w := download(h, id, "")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, part.Data, w.Body.Bytes())
+	}
+}
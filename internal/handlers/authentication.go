@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiAuthResult is the JSON representation of one authentication method's result
+type apiAuthResult struct {
+	Method     string            `json:"method"`
+	Result     string            `json:"result"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// apiDKIMSignature is the JSON representation of an offline DKIM check
+type apiDKIMSignature struct {
+	Domain    string   `json:"domain"`
+	Selector  string   `json:"selector"`
+	Algorithm string   `json:"algorithm"`
+	Headers   []string `json:"headers"`
+	BodyHash  string   `json:"body_hash"`
+	Signature string   `json:"signature"`
+	Result    string   `json:"result"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// apiAuthSummary is the JSON representation of an email's authentication
+type apiAuthSummary struct {
+	Verdict         string             `json:"verdict"`
+	AuthServID      string             `json:"authserv_id,omitempty"`
+	SPF             string             `json:"spf,omitempty"`
+	DKIM            string             `json:"dkim,omitempty"`
+	DMARC           string             `json:"dmarc,omitempty"`
+	ARC             string             `json:"arc,omitempty"`
+	ARCInstances    int                `json:"arc_instances"`
+	Results         []apiAuthResult    `json:"results"`
+	OriginalResults []apiAuthResult    `json:"original_results,omitempty"`
+	Signatures      []apiDKIMSignature `json:"signatures"`
+}
+
+// authClass returns the badge colors for an authentication result
+func authClass(result string) string {
+	switch result {
+	case parser.AuthPass:
+		return "bg-green-100 text-green-800"
+	case parser.AuthFail, "softfail", "permerror", parser.DKIMInvalid:
+		return "bg-red-100 text-red-800"
+	}
+	return "bg-gray-100 text-gray-700"
+}
+
+// analyzeAuth analyzes the authentication headers of a raw email, verifying
+// DKIM signatures against the configured key store
+func (h *Handlers) analyzeAuth(raw []byte) *parser.AuthSummary {
+	keys, err := parser.LoadDKIMKeys(h.cfg.DKIMKeysPath)
+	if err != nil {
+		log.Printf("Failed to load DKIM keys: %v", err)
+	}
+	return parser.AnalyzeAuth(raw, keys)
+}
+
+// rawEmail reads the .eml file of the email in the {id} URL parameter,
+// writing an error response and returning false if it can't
+func (h *Handlers) rawEmail(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil {
+		log.Printf("Failed to load email %d: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return nil, false
+	}
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	raw, err := h.db.ReadRawEmail(email)
+	if err != nil {
+		log.Printf("Failed to read email %d: %v", id, err)
+		http.Error(w, "Failed to read email", http.StatusInternalServerError)
+		return nil, false
+	}
+	return raw, true
+}
+
+// apiAuthResults converts authentication results for JSON output
+func apiAuthResults(results []parser.AuthResult) []apiAuthResult {
+	out := make([]apiAuthResult, len(results))
+	for i, r := range results {
+		out[i] = apiAuthResult{Method: r.Method, Result: r.Result, Properties: r.Properties}
+	}
+	return out
+}
+
+// APIEmailAuth returns the SPF/DKIM/DMARC/ARC analysis of one email as JSON
+func (h *Handlers) APIEmailAuth(w http.ResponseWriter, r *http.Request) {
+	raw, ok := h.rawEmail(w, r)
+	if !ok {
+		return
+	}
+	summary := h.analyzeAuth(raw)
+
+	out := apiAuthSummary{
+		Verdict:         summary.Verdict,
+		AuthServID:      summary.AuthServID,
+		SPF:             summary.SPF,
+		DKIM:            summary.DKIM,
+		DMARC:           summary.DMARC,
+		ARC:             summary.ARC,
+		ARCInstances:    summary.ARCInstances,
+		Results:         apiAuthResults(summary.Results),
+		OriginalResults: apiAuthResults(summary.OriginalResults),
+		Signatures:      make([]apiDKIMSignature, len(summary.Signatures)),
+	}
+	for i, s := range summary.Signatures {
+		out.Signatures[i] = apiDKIMSignature{
+			Domain:    s.Domain,
+			Selector:  s.Selector,
+			Algorithm: s.Algorithm,
+			Headers:   s.Headers,
+			BodyHash:  s.BodyHash,
+			Signature: s.Signature,
+			Result:    s.Result(),
+			Error:     s.Error,
+		}
+	}
+	writeJSON(w, out)
+}
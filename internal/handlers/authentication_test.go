@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuthHandlers tests the security panel, the auth API and the auth filter
+func TestAuthHandlers(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+
+	content := "Authentication-Results: mx.acme.com;\r\n" +
+		" spf=pass smtp.mailfrom=bank.com;\r\n" +
+		" dkim=fail (bad signature) header.d=bank.com;\r\n" +
+		" dmarc=fail header.from=bank.com\r\n" +
+		"From: security@bank.com\r\n" +
+		"To: bob@acme.com\r\n" +
+		"Subject: Verify your account\r\n" +
+		"\r\n" +
+		"Click here.\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "phish.eml"), []byte(content), 0644))
+
+	email := db.CreateTestEmail("Verify your account", "security@bank.com", "Click here.")
+	email.FilePath = "phish.eml"
+	email.AuthVerdict = "fail"
+	id, err := database.InsertEmail(email)
+	require.NoError(t, err)
+	db.InsertTestEmails(t, database, []*db.Email{db.CreateTestEmail("Lunch", "carol@acme.com", "Noon?")})
+	idStr := strconv.FormatInt(id, 10)
+
+	w := httptest.NewRecorder()
+	h.ViewEmail(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr, nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Security")
+	assert.Contains(t, w.Body.String(), "checked by mx.acme.com")
+	assert.Contains(t, w.Body.String(), "/search?auth=fail")
+
+	w = httptest.NewRecorder()
+	h.APIEmailAuth(w, withURLParam(httptest.NewRequest("GET", "/api/emails/"+idStr+"/auth", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary apiAuthSummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, "fail", summary.Verdict)
+	assert.Equal(t, "pass", summary.SPF)
+	assert.Equal(t, "fail", summary.DMARC)
+	require.Len(t, summary.Results, 3)
+	assert.Equal(t, "bank.com", summary.Results[1].Properties["header.d"])
+
+	w = httptest.NewRecorder()
+	h.APIEmailAuth(w, withURLParam(httptest.NewRequest("GET", "/api/emails/999/auth", nil), "id", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?auth=fail", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Verify your account")
+	assert.NotContains(t, w.Body.String(), "Lunch")
+
+	w = httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?auth=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
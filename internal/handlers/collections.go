@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// collectionCookie remembers the collection a browser is looking at
+const collectionCookie = "collection"
+
+// Collections serves each collection from its own handlers and routes. The
+// collection is picked by the ?collection= parameter for that request only,
+// then by the collection cookie, falling back to the first collection. Only
+// Switch changes the cookie.
+type Collections struct {
+	names    []string
+	handlers map[string]*Handlers
+	routes   map[string]http.Handler
+}
+
+// NewCollections creates an empty set of collections
+func NewCollections() *Collections {
+	return &Collections{
+		handlers: make(map[string]*Handlers),
+		routes:   make(map[string]http.Handler),
+	}
+}
+
+// Add registers a collection's handlers and the routes serving them
+func (c *Collections) Add(name string, h *Handlers, routes http.Handler) {
+	h.collection = name
+	h.collections = c
+	c.names = append(c.names, name)
+	c.handlers[name] = h
+	c.routes[name] = routes
+}
+
+// Names lists the collections in the order they were added
+func (c *Collections) Names() []string {
+	return c.names
+}
+
+// Handlers returns a collection's handlers, or nil
+func (c *Collections) Handlers(name string) *Handlers {
+	return c.handlers[name]
+}
+
+// ServeHTTP routes a request to the chosen collection
+func (c *Collections) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(c.names) == 0 {
+		http.Error(w, "No collections configured", http.StatusServiceUnavailable)
+		return
+	}
+	name := c.names[0]
+	if param := r.URL.Query().Get("collection"); c.handlers[param] != nil {
+		name = param
+	} else if cookie, err := r.Cookie(collectionCookie); err == nil && c.handlers[cookie.Value] != nil {
+		name = cookie.Value
+	}
+	c.routes[name].ServeHTTP(w, r)
+}
+
+// Switch selects the collection named in the form and shows its emails, or
+// the page at next when it is a path on this site
+func (c *Collections) Switch(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("collection")
+	if c.handlers[name] == nil {
+		http.Error(w, "Unknown collection", http.StatusBadRequest)
+		return
+	}
+	setCollectionCookie(w, name)
+
+	next := r.FormValue("next")
+	if !isLocalPath(next) {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// isLocalPath reports whether a redirect target stays on this site
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
+
+// setCollectionCookie remembers the chosen collection for the session
+func setCollectionCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     collectionCookie,
+		Value:    name,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// collectionNames lists every collection, or just this one when it is not
+// part of a set
+func (h *Handlers) collectionNames() []string {
+	if h.collections == nil {
+		return []string{h.collection}
+	}
+	return h.collections.Names()
+}
+
+// searchAllCollections runs a search in every collection and merges the
+// results newest first, tagging each with its collection. It returns the
+// page at offset and the total number of matches.
+func (h *Handlers) searchAllCollections(filters db.SearchFilters, limit, offset int) ([]*db.EmailSearchResult, int, error) {
+	var results []*db.EmailSearchResult
+	total := 0
+	for _, name := range h.collectionNames() {
+		other := h
+		if h.collections != nil {
+			other = h.collections.Handlers(name)
+		}
+
+		// Results are merged by date, so each collection is searched newest
+		// first; its first offset+limit results then hold every one of its
+		// results that can land on the merged page
+		found, err := other.db.SearchFilteredByDate(filters, offset+limit, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		count, err := other.db.CountFiltered(filters)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, result := range found {
+			result.Collection = name
+		}
+		results = append(results, found...)
+		total += count
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].GetDate().After(results[j].GetDate())
+	})
+	if offset >= len(results) {
+		return nil, total, nil
+	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, total, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCollections tests choosing a collection per request and searching
+// across collections
+func TestCollections(t *testing.T) {
+	acme, acmeDB, acmeDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(acmeDir)
+	defer db.CleanupTestDB(t, acmeDB)
+	globex, globexDB, globexDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(globexDir)
+	defer db.CleanupTestDB(t, globexDB)
+
+	createTestEMLFile(t, acmeDir, "a.eml", "alice@acme.com", "bob@acme.com", "Acme budget", "Numbers")
+	createTestEMLFile(t, globexDir, "g.eml", "gina@globex.com", "hank@globex.com", "Globex budget", "Numbers")
+	_, err := indexer.NewIndexer(acmeDB, acmeDir, false).IndexAll()
+	require.NoError(t, err)
+	_, err = indexer.NewIndexer(globexDB, globexDir, false).IndexAll()
+	require.NoError(t, err)
+
+	set := NewCollections()
+	for name, h := range map[string]*Handlers{"acme": acme, "globex": globex} {
+		set.Add(name, h, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+	}
+	served := set.Names()[0]
+
+	// The first collection is served until another is chosen
+	w := httptest.NewRecorder()
+	set.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, served, w.Body.String())
+
+	// The parameter picks the collection for one request only
+	other := set.Names()[1]
+	w = httptest.NewRecorder()
+	set.ServeHTTP(w, httptest.NewRequest("GET", "/email/1?collection="+other, nil))
+	assert.Equal(t, other, w.Body.String())
+	assert.Empty(t, w.Result().Cookies(), "Only Switch changes the collection")
+
+	req := httptest.NewRequest("POST", "/collections/switch", strings.NewReader("collection="+other+"&next=/email/1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	set.Switch(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/email/1", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, other, cookies[0].Value)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	set.ServeHTTP(w, req)
+	assert.Equal(t, other, w.Body.String())
+
+	req = httptest.NewRequest("POST", "/collections/switch", strings.NewReader("collection="+served+"&next=//evil.example"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	set.Switch(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/", w.Header().Get("Location"), "Only local pages are opened after switching")
+	assert.Equal(t, served, w.Result().Cookies()[0].Value)
+
+	req = httptest.NewRequest("POST", "/collections/switch", strings.NewReader("collection=../etc"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	set.Switch(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Searching one collection finds only its emails
+	req = httptest.NewRequest("GET", "/search?q=budget", nil)
+	req.Header.Set("HX-Request", "true")
+	w = httptest.NewRecorder()
+	acme.Search(w, req)
+	assert.Contains(t, w.Body.String(), "Acme budget")
+	assert.NotContains(t, w.Body.String(), "Globex budget")
+
+	req = httptest.NewRequest("GET", "/search?q=budget&collections=all", nil)
+	req.Header.Set("HX-Request", "true")
+	w = httptest.NewRecorder()
+	acme.Search(w, req)
+	body := w.Body.String()
+	assert.Contains(t, body, "Acme budget")
+	assert.Contains(t, body, "Globex budget")
+	assert.Contains(t, body, `name="collection" value="globex"`, "Results switch to their collection")
+	assert.Contains(t, body, "Showing 2 of 2 emails")
+
+	// The header offers the other collections
+	w = httptest.NewRecorder()
+	acme.Index(w, httptest.NewRequest("GET", "/", nil))
+	assert.Contains(t, w.Body.String(), `<option value="globex"`)
+	assert.Contains(t, w.Body.String(), `name="collections"`)
+}
+
+// TestSearchAllCollectionsPages tests that results merged from several
+// collections are paged newest first, whatever their relevance
+func TestSearchAllCollectionsPages(t *testing.T) {
+	acme, acmeDB := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, acmeDB)
+	globex, globexDB := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, globexDB)
+
+	set := NewCollections()
+	set.Add("acme", acme, http.NotFoundHandler())
+	set.Add("globex", globex, http.NotFoundHandler())
+
+	// The oldest emails mention the term most, so they rank first
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for i := 0; i < 8; i++ {
+		subject := fmt.Sprintf("day%d", i)
+		body := strings.Repeat("budget ", 8-i)
+		database := acmeDB
+		if i%2 == 1 {
+			database = globexDB
+		}
+		_, err := database.InsertEmail(db.CreateTestEmailWithDate(subject, "a@test.com", body, base.AddDate(0, 0, i)))
+		require.NoError(t, err)
+		want = append([]string{subject}, want...)
+	}
+
+	var got []string
+	for offset := 0; offset < 8; offset += 3 {
+		page, total, err := acme.searchAllCollections(db.SearchFilters{Query: "budget"}, 3, offset)
+		require.NoError(t, err)
+		assert.Equal(t, 8, total)
+		for _, result := range page {
+			got = append(got, result.Subject)
+		}
+	}
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/parser"
+)
+
+// hopRow is one hop of the delivery path on the email page
+type hopRow struct {
+	parser.Hop
+	DelayText string // Formatted delay since the previous hop, empty if unknown
+}
+
+// apiHop is the JSON representation of one hop of the delivery path
+type apiHop struct {
+	From         string   `json:"from,omitempty"`
+	By           string   `json:"by,omitempty"`
+	IP           string   `json:"ip,omitempty"`
+	With         string   `json:"with,omitempty"`
+	ID           string   `json:"id,omitempty"`
+	For          string   `json:"for,omitempty"`
+	Time         string   `json:"time,omitempty"`
+	DelaySeconds *float64 `json:"delay_seconds,omitempty"`
+	Flags        []string `json:"flags,omitempty"`
+}
+
+// hopRows formats the hops of a delivery path for display
+func hopRows(hops []parser.Hop) []hopRow {
+	rows := make([]hopRow, len(hops))
+	for i, hop := range hops {
+		rows[i] = hopRow{Hop: hop}
+		if !hop.HasDelay {
+			continue
+		}
+		if hop.Delay < 0 {
+			rows[i].DelayText = "-" + formatDuration(-hop.Delay.Seconds())
+		} else {
+			rows[i].DelayText = formatDuration(hop.Delay.Seconds())
+		}
+	}
+	return rows
+}
+
+// APIEmailHops returns the delivery path of one email as JSON, oldest hop first
+func (h *Handlers) APIEmailHops(w http.ResponseWriter, r *http.Request) {
+	raw, ok := h.rawEmail(w, r)
+	if !ok {
+		return
+	}
+
+	hops := parser.TraceReceived(raw)
+	out := make([]apiHop, len(hops))
+	for i, hop := range hops {
+		out[i] = apiHop{From: hop.From, By: hop.By, IP: hop.IP, With: hop.With, ID: hop.ID, For: hop.For, Flags: hop.Flags}
+		if !hop.Time.IsZero() {
+			out[i].Time = hop.Time.Format(time.RFC3339)
+		}
+		if hop.HasDelay {
+			seconds := hop.Delay.Seconds()
+			out[i].DelaySeconds = &seconds
+		}
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeliveryHandlers tests the delivery path table and API
+func TestDeliveryHandlers(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+
+	content := "Received: from relay.example.net (relay.example.net [198.51.100.7])\r\n" +
+		"\tby mx.acme.com with ESMTPS id Q1; Mon, 1 Jan 2024 12:00:00 +0000\r\n" +
+		"Received: from laptop ([10.0.0.5]) by relay.example.net with ESMTPSA; Mon, 1 Jan 2024 10:00:00 +0000\r\n" +
+		"From: alice@example.net\r\nTo: bob@acme.com\r\nSubject: Late\r\n\r\nSorry for the delay.\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "late.eml"), []byte(content), 0644))
+
+	email := db.CreateTestEmail("Late", "alice@example.net", "Sorry for the delay.")
+	email.FilePath = "late.eml"
+	id, err := database.InsertEmail(email)
+	require.NoError(t, err)
+	idStr := strconv.FormatInt(id, 10)
+
+	w := httptest.NewRecorder()
+	h.ViewEmail(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr, nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Delivery path (2 hops)")
+	assert.Contains(t, w.Body.String(), "2h 0m")
+	assert.Contains(t, w.Body.String(), "private IP")
+
+	w = httptest.NewRecorder()
+	h.APIEmailHops(w, withURLParam(httptest.NewRequest("GET", "/api/emails/"+idStr+"/hops", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	var hops []apiHop
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hops))
+	require.Len(t, hops, 2)
+	assert.Equal(t, "10.0.0.5", hops[0].IP)
+	assert.Nil(t, hops[0].DelaySeconds, "The first hop has no delay")
+	assert.Equal(t, "mx.acme.com", hops[1].By)
+	require.NotNil(t, hops[1].DelaySeconds)
+	assert.Equal(t, 7200.0, *hops[1].DelaySeconds)
+	assert.Equal(t, []string{"slow"}, hops[1].Flags)
+
+	w = httptest.NewRecorder()
+	h.APIEmailHops(w, withURLParam(httptest.NewRequest("GET", "/api/emails/999/hops", nil), "id", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
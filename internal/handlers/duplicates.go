@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// duplicateGroupsPerPage is the number of groups shown per report page
+const duplicateGroupsPerPage = 50
+
+// DuplicatesPage shows groups of emails that are copies of the same message
+func (h *Handlers) DuplicatesPage(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind != db.DuplicateByContent {
+		kind = db.DuplicateByMessageID
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	summary, err := h.db.GetDuplicateSummary()
+	if err != nil {
+		log.Printf("Failed to summarize duplicates: %v", err)
+		http.Error(w, "Failed to load duplicates", http.StatusInternalServerError)
+		return
+	}
+
+	groups, err := h.db.ListDuplicateGroups(kind, duplicateGroupsPerPage, offset)
+	if err != nil {
+		log.Printf("Failed to list duplicates: %v", err)
+		http.Error(w, "Failed to load duplicates", http.StatusInternalServerError)
+		return
+	}
+
+	total := summary.MessageIDGroups
+	if kind == db.DuplicateByContent {
+		total = summary.ContentGroups
+	}
+
+	prevOffset := offset - duplicateGroupsPerPage
+	if prevOffset < 0 {
+		prevOffset = 0
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":  "Duplicates - EML Viewer",
+		"Stats":      stats,
+		"Summary":    summary,
+		"Kind":       kind,
+		"Groups":     groups,
+		"Offset":     offset,
+		"Total":      total,
+		"PrevOffset": prevOffset,
+		"NextOffset": offset + duplicateGroupsPerPage,
+		"HasMore":    offset+duplicateGroupsPerPage < total,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "duplicates.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
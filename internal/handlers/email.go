@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/felo/eml-viewer/internal/parser"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -65,6 +66,34 @@ func (h *Handlers) ViewEmail(w http.ResponseWriter, r *http.Request) {
 		log.Printf("First 100 chars of HTML: %s", emailWithContent.BodyHTML[:100])
 	}
 
+	// Other copies of the same message (non-fatal if the lookup fails)
+	duplicates, err := h.db.FindDuplicatesOf(emailWithContent.Email)
+	if err != nil {
+		log.Printf("Failed to find duplicates of email %d: %v", id, err)
+	}
+
+	// Sensitive data found by the PII scan (non-fatal if the lookup fails)
+	findings, err := h.db.GetPIIFindings(id)
+	if err != nil {
+		log.Printf("Failed to load findings for email %d: %v", id, err)
+	}
+
+	// Links found in the body (non-fatal if the lookup fails)
+	links, err := h.db.GetLinks(id)
+	if err != nil {
+		log.Printf("Failed to load links for email %d: %v", id, err)
+	}
+
+	// Authentication and delivery path from the headers (non-fatal if the file can't be read)
+	var auth *parser.AuthSummary
+	var hops []hopRow
+	if raw, err := h.db.ReadRawEmail(emailWithContent.Email); err != nil {
+		log.Printf("Failed to read email %d: %v", id, err)
+	} else {
+		auth = h.analyzeAuth(raw)
+		hops = hopRows(parser.TraceReceived(raw))
+	}
+
 	// Prepare template data
 	pageTitle := "Email - EML Viewer"
 	if emailWithContent.Subject != "" {
@@ -82,6 +111,11 @@ func (h *Handlers) ViewEmail(w http.ResponseWriter, r *http.Request) {
 		"BCC":         emailWithContent.BCC,
 		"RawHeaders":  emailWithContent.RawHeaders,
 		"Attachments": emailWithContent.Attachments,
+		"Duplicates":  duplicates,
+		"Findings":    piiFindingRows(findings),
+		"Links":       links,
+		"Auth":        auth,
+		"Hops":        hops,
 	}
 
 	// Debug: verify data before template
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/export"
+)
+
+// Export streams the emails matching the search filters as mbox, zip or CSV
+func (h *Handlers) Export(w http.ResponseWriter, r *http.Request) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, "Invalid export format (use mbox, zip or csv)", http.StatusBadRequest)
+		return
+	}
+
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := "emails-" + time.Now().Format("20060102-150405") + format.Extension()
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{
+			"filename": filename,
+		}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Large exports can take longer than the server's WriteTimeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Headers are already sent once streaming starts, so errors can only be logged
+	result, err := export.NewExporter(h.db).Export(w, format, filters)
+	if err != nil {
+		log.Printf("Export failed: %v", err)
+		return
+	}
+	log.Printf("Export complete: %d exported, %d skipped", result.Exported, result.Skipped)
+}
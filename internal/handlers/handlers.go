@@ -2,13 +2,20 @@ package handlers
 
 import (
 	"embed"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/felo/eml-viewer/internal/config"
 	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/pii"
+	"github.com/felo/eml-viewer/internal/scanjob"
+	"github.com/felo/eml-viewer/internal/scheduler"
 )
 
 // Handlers holds all HTTP handlers and their dependencies
@@ -17,14 +24,20 @@ type Handlers struct {
 	cfg          *config.Config
 	templates    *template.Template
 	shutdownChan chan os.Signal
+	scans        *scanjob.Manager
+	scheduler    *scheduler.Scheduler
+	collection   string       // Name of the collection these handlers serve
+	collections  *Collections // Every collection, if served as a set
 }
 
 // New creates a new Handlers instance
 func New(database *db.DB, cfg *config.Config) *Handlers {
-	return &Handlers{
+	h := &Handlers{
 		db:  database,
 		cfg: cfg,
 	}
+	h.scans = scanjob.NewManager(database, h.newScanIndexer)
+	return h
 }
 
 // SetShutdownChannel sets the shutdown channel for the handlers
@@ -32,6 +45,16 @@ func (h *Handlers) SetShutdownChannel(ch chan os.Signal) {
 	h.shutdownChan = ch
 }
 
+// ScanJobs returns the manager running scan jobs, for scheduled scans
+func (h *Handlers) ScanJobs() *scanjob.Manager {
+	return h.scans
+}
+
+// SetScheduler sets the maintenance scheduler whose status is shown
+func (h *Handlers) SetScheduler(s *scheduler.Scheduler) {
+	h.scheduler = s
+}
+
 // LoadTemplates loads HTML templates from embedded filesystem
 func (h *Handlers) LoadTemplates(embeddedFiles embed.FS) error {
 	// Create template with custom functions
@@ -46,6 +69,24 @@ func (h *Handlers) LoadTemplates(embeddedFiles embed.FS) error {
 		"html": func(s string) template.HTML {
 			return template.HTML(s)
 		},
+		"duration": formatDuration,
+		"collection": func() string {
+			return h.collection
+		},
+		"collections": h.collectionNames,
+		"piiTypes": func() []pii.Type {
+			return pii.Types
+		},
+		"authVerdicts": func() []string {
+			return parser.AuthVerdicts
+		},
+		"authClass": authClass,
+		"contactURL": func(address string) string {
+			return "/contact/" + url.PathEscape(strings.ToLower(address))
+		},
+		"percent": func(f float64) string {
+			return fmt.Sprintf("%.0f%%", f*100)
+		},
 		"sanitizeHTML": func(s string) template.HTML {
 			// Return unsanitized - iframe sandbox provides security
 			// Log first 100 chars to debug
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"testing"
 	"time"
 
@@ -146,6 +147,23 @@ func TestAllRequiredTemplatesExist(t *testing.T) {
 	}
 }
 
+// Test that every filter control sends the whole filter set, so changing one
+// filter keeps the others
+func TestFilterControlsIncludeAllFilters(t *testing.T) {
+	content, err := web.Assets.ReadFile("templates/components/filters.html")
+	require.NoError(t, err)
+
+	includes := regexp.MustCompile(`hx-include="([^"]*)"`).FindAllStringSubmatch(string(content), -1)
+	require.NotEmpty(t, includes)
+	names := []string{"q", "sender", "recipient", "has_attachments", "date_from", "date_to",
+		"collapse_duplicates", "sensitive", "link", "domain", "auth", "date_uncertain", "collections"}
+	for _, include := range includes {
+		for _, name := range names {
+			assert.Contains(t, include[1], "[name='"+name+"']")
+		}
+	}
+}
+
 // Test that index template renders with data
 func TestIndexTemplateRendersWithData(t *testing.T) {
 	h, _ := setupTestHandlers(t)
@@ -427,6 +445,27 @@ func TestSearchHandlerWithResults(t *testing.T) {
 	assert.Contains(t, body, "href=\"/email/")
 }
 
+// Test Search handler filtering and marking emails with uncertain dates
+func TestSearchHandlerDateUncertain(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	undated := db.CreateTestEmail("Undated Memo", "memo@test.com", "No date header")
+	undated.DateSource = "file"
+	dated := db.CreateTestEmail("Dated Memo", "memo@test.com", "Has a date header")
+	dated.DateSource = "header"
+	db.InsertTestEmails(t, database, []*db.Email{undated, dated})
+
+	w := httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?date_uncertain=true", nil))
+
+	assert.Equal(t, 200, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "Undated Memo")
+	assert.Contains(t, body, "date uncertain")
+	assert.NotContains(t, body, "Dated Memo")
+}
+
 // Test Search handler with no results
 func TestSearchHandlerNoResults(t *testing.T) {
 	h, database := setupTestHandlers(t)
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/scheduler"
+)
+
+// apiHealth is the JSON representation of the application's health
+type apiHealth struct {
+	Status   string          `json:"status"` // "ok", or "degraded" if anything failed
+	Database string          `json:"database"`
+	Scanning bool            `json:"scanning"`
+	Tasks    []apiTaskStatus `json:"tasks"`
+}
+
+// apiTaskStatus is the JSON representation of a maintenance task's status
+type apiTaskStatus struct {
+	Name       string     `json:"name"`
+	Interval   string     `json:"interval"` // Empty if the task is disabled
+	Running    bool       `json:"running"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+// toAPITaskStatus converts a task status to its JSON representation
+func toAPITaskStatus(s scheduler.Status) apiTaskStatus {
+	out := apiTaskStatus{
+		Name:       s.Name,
+		Running:    s.Running,
+		DurationMs: s.LastDuration.Milliseconds(),
+		Result:     s.LastResult,
+		Error:      s.LastError,
+	}
+	if s.Enabled() {
+		out.Interval = s.Interval.String()
+		next := s.NextRun
+		out.NextRun = &next
+	}
+	if !s.LastRun.IsZero() {
+		last := s.LastRun
+		out.LastRun = &last
+	}
+	return out
+}
+
+// maintenanceStatus returns the scheduled tasks' statuses, or nil if no
+// scheduler is running
+func (h *Handlers) maintenanceStatus() []scheduler.Status {
+	if h.scheduler == nil {
+		return nil
+	}
+	return h.scheduler.Status()
+}
+
+// Health reports whether the database is reachable and the last run of each
+// maintenance task, answering 503 if anything is failing
+func (h *Handlers) Health(w http.ResponseWriter, r *http.Request) {
+	health := apiHealth{
+		Status:   "ok",
+		Database: "ok",
+		Scanning: h.scans.Running() != nil,
+		Tasks:    []apiTaskStatus{},
+	}
+
+	if err := h.db.PingContext(r.Context()); err != nil {
+		log.Printf("Health check failed to reach database: %v", err)
+		health.Status, health.Database = "degraded", "unreachable"
+	}
+	for _, s := range h.maintenanceStatus() {
+		health.Tasks = append(health.Tasks, toAPITaskStatus(s))
+		if s.LastError != "" {
+			health.Status = "degraded"
+		}
+	}
+
+	if health.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, health)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// domainRow is one linked domain on the domains page
+type domainRow struct {
+	*db.DomainCount
+	URL string
+}
+
+// apiDomainCount is the JSON representation of the links to one domain
+type apiDomainCount struct {
+	Domain     string `json:"domain"`
+	Emails     int    `json:"emails"`
+	Links      int    `json:"links"`
+	Mismatched int    `json:"mismatched"`
+}
+
+// apiLink is the JSON representation of a link in an email
+type apiLink struct {
+	URL         string `json:"url"`
+	Domain      string `json:"domain"`
+	DisplayText string `json:"display_text,omitempty"`
+	Source      string `json:"source"`
+	Mismatch    bool   `json:"mismatch"`
+}
+
+// domainRows links each domain to the emails that link to it
+func domainRows(domains []*db.DomainCount, filters db.SearchFilters) []domainRow {
+	rows := make([]domainRow, len(domains))
+	for i, d := range domains {
+		f := filters
+		f.Domain = d.Domain
+		rows[i] = domainRow{DomainCount: d, URL: drillDownURL(f)}
+	}
+	return rows
+}
+
+// DomainsPage lists the domains linked from emails matching the filters
+func (h *Handlers) DomainsPage(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domains, err := h.db.GetLinkedDomains(filters)
+	if err != nil {
+		log.Printf("Failed to load linked domains: %v", err)
+		http.Error(w, "Failed to load linked domains", http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	mismatched := 0
+	for _, d := range domains {
+		mismatched += d.Mismatched
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":  "Linked Domains - EML Viewer",
+		"Stats":      stats,
+		"Filters":    filters,
+		"Rows":       domainRows(domains, filters),
+		"Mismatched": mismatched,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "domains.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// APIDomains returns the linked domains for a filter set as JSON
+func (h *Handlers) APIDomains(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domains, err := h.db.GetLinkedDomains(filters)
+	if err != nil {
+		log.Printf("Failed to load linked domains: %v", err)
+		http.Error(w, "Failed to load linked domains", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]apiDomainCount, len(domains))
+	for i, d := range domains {
+		out[i] = apiDomainCount{Domain: d.Domain, Emails: d.Emails, Links: d.Links, Mismatched: d.Mismatched}
+	}
+	writeJSON(w, out)
+}
+
+// APIEmailLinks returns the links in one email as JSON
+func (h *Handlers) APIEmailLinks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil {
+		log.Printf("Failed to load email %d: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return
+	}
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	links, err := h.db.GetLinks(id)
+	if err != nil {
+		log.Printf("Failed to load links for email %d: %v", id, err)
+		http.Error(w, "Failed to load links", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]apiLink, len(links))
+	for i, l := range links {
+		out[i] = apiLink{URL: l.URL, Domain: l.Domain, DisplayText: l.DisplayText, Source: l.Source, Mismatch: l.Mismatch}
+	}
+	writeJSON(w, out)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLinkHandlers tests the domains page, the link APIs and the search operators
+func TestLinkHandlers(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	emails := db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmail("Phish", "alice@acme.com", "verify your account"),
+		db.CreateTestEmail("Newsletter", "bob@acme.com", "verify your subscription"),
+	})
+	require.NoError(t, database.SaveLinks(emails[0].ID, []*db.Link{
+		{URL: "https://login.evil.net/x", Domain: "login.evil.net", DisplayText: "mybank.com", Source: "html", Mismatch: true},
+	}))
+	require.NoError(t, database.SaveLinks(emails[1].ID, []*db.Link{
+		{URL: "https://news.example.com/unsubscribe", Domain: "news.example.com", Source: "text"},
+	}))
+
+	w := httptest.NewRecorder()
+	h.DomainsPage(w, httptest.NewRequest("GET", "/domains", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "login.evil.net")
+	assert.Contains(t, w.Body.String(), "/search?domain=news.example.com")
+
+	w = httptest.NewRecorder()
+	h.APIDomains(w, httptest.NewRequest("GET", "/api/domains?sender=alice", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var domains []apiDomainCount
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &domains))
+	assert.Equal(t, []apiDomainCount{{Domain: "login.evil.net", Emails: 1, Links: 1, Mismatched: 1}}, domains)
+
+	id := strconv.FormatInt(emails[0].ID, 10)
+	w = httptest.NewRecorder()
+	h.APIEmailLinks(w, withURLParam(httptest.NewRequest("GET", "/api/emails/"+id+"/links", nil), "id", id))
+	require.Equal(t, http.StatusOK, w.Code)
+	var links []apiLink
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+	require.Len(t, links, 1)
+	assert.True(t, links[0].Mismatch)
+	assert.Equal(t, "mybank.com", links[0].DisplayText)
+
+	w = httptest.NewRecorder()
+	h.APIEmailLinks(w, withURLParam(httptest.NewRequest("GET", "/api/emails/999/links", nil), "id", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// domain: in the search box becomes the domain filter
+	w = httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?q=verify+domain:example.com", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Newsletter")
+	assert.NotContains(t, w.Body.String(), "Phish")
+	assert.Contains(t, w.Body.String(), `name="domain"`)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/network"
+)
+
+// defaultNetworkNodes is the number of busiest addresses drawn in the browser
+const defaultNetworkNodes = 100
+
+// networkGraph builds the correspondence graph for a filter set, pruned by
+// the request's max_nodes and min_weight parameters
+func (h *Handlers) networkGraph(r *http.Request, filters db.SearchFilters, defaultMaxNodes int) (*network.Graph, error) {
+	maxNodes := defaultMaxNodes
+	if v, err := strconv.Atoi(r.URL.Query().Get("max_nodes")); err == nil && v >= 0 {
+		maxNodes = v
+	}
+	minWeight := 1
+	if v, err := strconv.Atoi(r.URL.Query().Get("min_weight")); err == nil && v > 1 {
+		minWeight = v
+	}
+
+	rows, err := h.db.GetCorrespondence(filters)
+	if err != nil {
+		return nil, err
+	}
+	return network.Build(rows).Prune(maxNodes, minWeight), nil
+}
+
+// NetworkPage shows the correspondence network drawn in the browser
+func (h *Handlers) NetworkPage(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	maxNodes := defaultNetworkNodes
+	if v, err := strconv.Atoi(r.URL.Query().Get("max_nodes")); err == nil && v > 0 {
+		maxNodes = v
+	}
+	minWeight := 1
+	if v, err := strconv.Atoi(r.URL.Query().Get("min_weight")); err == nil && v > 1 {
+		minWeight = v
+	}
+
+	data := map[string]interface{}{
+		"PageTitle": "Network - EML Viewer",
+		"Stats":     stats,
+		"Filters":   parseSearchFilters(r),
+		"MaxNodes":  maxNodes,
+		"MinWeight": minWeight,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "network.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// APINetwork returns the correspondence graph as JSON for the in-browser view
+func (h *Handlers) APINetwork(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	g, err := h.networkGraph(r, filters, defaultNetworkNodes)
+	if err != nil {
+		log.Printf("Failed to build network: %v", err)
+		http.Error(w, "Failed to build network", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, g)
+}
+
+// ExportNetwork downloads the correspondence graph as GraphML, GEXF or JSON.
+// Unlike the browser view, every address is included unless max_nodes is set.
+func (h *Handlers) ExportNetwork(w http.ResponseWriter, r *http.Request) {
+	format, err := network.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, "Invalid graph format (use graphml, gexf or json)", http.StatusBadRequest)
+		return
+	}
+
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	g, err := h.networkGraph(r, filters, 0)
+	if err != nil {
+		log.Printf("Failed to build network: %v", err)
+		http.Error(w, "Failed to build network", http.StatusInternalServerError)
+		return
+	}
+
+	dw := &downloadWriter{
+		w:           w,
+		contentType: format.ContentType(),
+		filename:    "network-" + time.Now().Format("20060102-150405") + format.Extension(),
+	}
+	if err := network.Write(dw, g, format); err != nil {
+		log.Printf("Network export failed: %v", err)
+	}
+}
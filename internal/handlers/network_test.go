@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNetworkHandlers tests the network page, JSON API and graph downloads
+func TestNetworkHandlers(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	plan := db.CreateTestEmail("Plan", "alice@acme.com", "a")
+	plan.Recipients = "bob@acme.com"
+	reply := db.CreateTestEmail("Re: Plan", "bob@acme.com", "b")
+	reply.Recipients = "alice@acme.com"
+	db.InsertTestEmails(t, database, []*db.Email{plan, reply})
+
+	w := httptest.NewRecorder()
+	h.NetworkPage(w, httptest.NewRequest("GET", "/network?sender=alice", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "network-canvas")
+	assert.Contains(t, w.Body.String(), `value="alice"`)
+
+	w = httptest.NewRecorder()
+	h.APINetwork(w, httptest.NewRequest("GET", "/api/network", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var g network.Graph
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &g))
+	assert.Len(t, g.Nodes, 2)
+	assert.Len(t, g.Edges, 2)
+
+	w = httptest.NewRecorder()
+	h.APINetwork(w, httptest.NewRequest("GET", "/api/network?sender=alice", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &g))
+	assert.Len(t, g.Edges, 1)
+
+	w = httptest.NewRecorder()
+	h.ExportNetwork(w, httptest.NewRequest("GET", "/network/export?format=gexf", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gexf+xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".gexf")
+	assert.Contains(t, w.Body.String(), "<gexf")
+
+	w = httptest.NewRecorder()
+	h.ExportNetwork(w, httptest.NewRequest("GET", "/network/export?format=dot", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/felo/eml-viewer/internal/scanjob"
+)
+
+// problemCategory is a failure category with its count, for the filter links
+type problemCategory struct {
+	Name   string
+	Count  int
+	Active bool
+}
+
+// ProblemsPage lists files that could not be indexed, with the reason
+func (h *Handlers) ProblemsPage(w http.ResponseWriter, r *http.Request) {
+	errs, err := h.db.ListIndexErrors()
+	if err != nil {
+		log.Printf("Failed to list index errors: %v", err)
+		http.Error(w, "Failed to load problems", http.StatusInternalServerError)
+		return
+	}
+
+	category := r.URL.Query().Get("category")
+	counts := make(map[string]int)
+	var shown []*db.IndexError
+	for _, e := range errs {
+		counts[e.Category]++
+		if category == "" || e.Category == category {
+			shown = append(shown, e)
+		}
+	}
+
+	var categories []problemCategory
+	for _, name := range indexer.FailCategories {
+		if counts[name] > 0 {
+			categories = append(categories, problemCategory{Name: name, Count: counts[name], Active: name == category})
+		}
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":  "Problems - EML Viewer",
+		"Stats":      stats,
+		"Problems":   shown,
+		"Total":      len(errs),
+		"Categories": categories,
+		"Category":   category,
+		"Scanning":   h.scans.Running() != nil,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "problems.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// RetryProblems starts a scan job indexing failed files again: the files
+// named by the file form values, or with all=true every failed file in the
+// optional category. The browser is sent to the scan page to follow it.
+func (h *Handlers) RetryProblems(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	errs, err := h.db.ListIndexErrors()
+	if err != nil {
+		log.Printf("Failed to list index errors: %v", err)
+		http.Error(w, "Failed to load problems", http.StatusInternalServerError)
+		return
+	}
+
+	// Only recorded failures are retried, so any path reaching the indexer
+	// came from a scan of the emails folder
+	requested := make(map[string]bool)
+	for _, path := range r.Form["file"] {
+		requested[path] = true
+	}
+	all := formBool(r, "all")
+	category := r.FormValue("category")
+
+	var files []string
+	for _, e := range errs {
+		if requested[e.FilePath] || (all && (category == "" || e.Category == category)) {
+			files = append(files, e.FilePath)
+		}
+	}
+	if len(files) == 0 {
+		http.Error(w, "No matching problems to retry", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.scans.Retry(files); err != nil {
+		if errors.Is(err, scanjob.ErrRunning) {
+			http.Error(w, "Scan already in progress", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to start retry: %v", err)
+		http.Error(w, "Failed to start retry", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/scan", http.StatusSeeOther)
+}
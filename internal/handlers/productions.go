@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/export"
+)
+
+// ProductionsPage lists past productions and offers a form to create a new one
+// Filter parameters in the query string prefill the form
+func (h *Handlers) ProductionsPage(w http.ResponseWriter, r *http.Request) {
+	productions, err := h.db.ListProductions()
+	if err != nil {
+		log.Printf("Failed to list productions: %v", err)
+		http.Error(w, "Failed to load productions", http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":   "Productions - EML Viewer",
+		"Stats":       stats,
+		"Productions": productions,
+		"Filters":     parseSearchFilters(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "productions.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// CreateProduction numbers the emails matching the submitted filters and
+// streams the production zip
+func (h *Handlers) CreateProduction(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := export.ProductionOptions{
+		Name:      strings.TrimSpace(r.FormValue("name")),
+		Prefix:    strings.TrimSpace(r.FormValue("prefix")),
+		Custodian: strings.TrimSpace(r.FormValue("custodian")),
+		Volume:    strings.TrimSpace(r.FormValue("volume")),
+	}
+	if start := strings.TrimSpace(r.FormValue("start")); start != "" {
+		n, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, "Start number must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.StartNumber = n
+	}
+
+	// Headers are only sent once the zip starts, so validation and numbering
+	// errors can still be reported with a proper status
+	dw := &downloadWriter{
+		w:           w,
+		contentType: "application/zip",
+		filename:    "production-" + opts.Prefix + ".zip",
+	}
+	result, err := export.NewProducer(h.db).Produce(dw, opts, filters)
+	if err != nil {
+		if !dw.started && errors.Is(err, export.ErrInvalidProduction) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Production failed: %v", err)
+		if !dw.started {
+			http.Error(w, "Failed to create production", http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("Production %q complete: %s-%s, %d emails, %d attachments, %d skipped",
+		result.Production.Name,
+		export.FormatBates(result.Production.Prefix, result.Production.StartNumber),
+		export.FormatBates(result.Production.Prefix, result.Production.EndNumber),
+		result.Emails, result.Attachments, len(result.SkippedFiles))
+}
+
+// downloadWriter sets attachment download headers on the first write
+type downloadWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (d *downloadWriter) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Type", d.contentType)
+		d.w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{
+				"filename": d.filename,
+			}))
+		d.w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	return d.w.Write(p)
+}
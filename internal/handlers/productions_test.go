@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createProduction posts the production form
+func createProduction(h *Handlers, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/productions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.CreateProduction(w, req)
+	return w
+}
+
+// TestCreateProductionErrors tests that only the caller's mistakes are
+// answered with 400
+func TestCreateProductionErrors(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer db.CleanupTestDB(t, database)
+	defer os.RemoveAll(tempDir)
+
+	filename := createTestEMLFile(t, tempDir, "plain.eml", "sender@test.com", "recipient@test.com", "Plain", "Hello")
+	email := db.CreateTestEmail("Plain", "sender@test.com", "Hello")
+	email.FilePath = filename
+	emailID, err := database.InsertEmail(email)
+	require.NoError(t, err)
+
+	w := createProduction(h, url.Values{"prefix": {"ABC"}})
+	assert.Equal(t, 400, w.Code, "Missing name")
+
+	w = createProduction(h, url.Values{"name": {"Bad"}, "prefix": {"A/B"}})
+	assert.Equal(t, 400, w.Code, "Invalid prefix")
+
+	w = createProduction(h, url.Values{"name": {"Start"}, "prefix": {"ABC"}, "start": {"0"}})
+	assert.Equal(t, 400, w.Code, "Invalid start number")
+
+	w = createProduction(h, url.Values{"name": {"Empty"}, "prefix": {"ABC"}, "sender": {"nobody"}})
+	assert.Equal(t, 400, w.Code, "No matching emails")
+	assert.Contains(t, w.Body.String(), "no documents match")
+
+	// An attachment missing from its file is a problem with the collection
+	_, err = database.InsertAttachment(&db.Attachment{EmailID: emailID, Filename: "notes.txt", ContentType: "text/plain", Size: 99})
+	require.NoError(t, err)
+	w = createProduction(h, url.Values{"name": {"Broken"}, "prefix": {"ABC"}})
+	assert.Equal(t, 500, w.Code)
+	assert.NotContains(t, w.Body.String(), "notes.txt", "Internal errors are logged, not shown")
+}
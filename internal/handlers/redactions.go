@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/export"
+	"github.com/felo/eml-viewer/internal/pii"
+	"github.com/felo/eml-viewer/internal/redact"
+	"github.com/go-chi/chi/v5"
+)
+
+// redactionRow is one redaction on the redact page
+type redactionRow struct {
+	*db.Redaction
+	Label string
+	Text  string
+}
+
+// redactionSource returns the text redactions are marked against: the plain
+// text body, or the HTML source when there is no plain text
+func redactionSource(content *db.EmailWithContent) (source, text string) {
+	if strings.TrimSpace(content.BodyText) != "" {
+		return db.PIISourceBody, content.BodyText
+	}
+	return db.PIISourceHTML, content.BodyHTML
+}
+
+// redactURL returns the redact page of an email
+func redactURL(id int64) string {
+	return "/email/" + strconv.FormatInt(id, 10) + "/redact"
+}
+
+// emailIDParam parses the {id} URL parameter, writing a 400 if it is invalid
+func emailIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// RedactPage shows an email's body with its redactions highlighted, where
+// spans can be marked and detected findings accepted
+func (h *Handlers) RedactPage(w http.ResponseWriter, r *http.Request) {
+	id, ok := emailIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	content, err := h.db.GetEmailWithFullContent(id)
+	if err != nil {
+		log.Printf("Error loading email %d for redaction: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return
+	}
+	if content == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	redactions, err := h.db.GetRedactions(id)
+	if err != nil {
+		log.Printf("Failed to load redactions for email %d: %v", id, err)
+		http.Error(w, "Failed to load redactions", http.StatusInternalServerError)
+		return
+	}
+
+	findings, err := h.db.GetPIIFindings(id)
+	if err != nil {
+		log.Printf("Failed to load findings for email %d: %v", id, err)
+	}
+
+	source, text := redactionSource(content)
+	var spans []redact.Span
+	var rows []redactionRow
+	for _, rd := range redactions {
+		if rd.Source != source {
+			continue
+		}
+		span := redact.Span{Start: rd.Start, End: rd.End}
+		row := redactionRow{Redaction: rd, Label: rd.Label}
+		if pii.Type(rd.Label).Valid() {
+			row.Label = pii.Type(rd.Label).Label()
+		}
+		if span.Valid(text) {
+			spans = append(spans, span)
+			row.Text = text[rd.Start:rd.End]
+		}
+		rows = append(rows, row)
+	}
+
+	// Findings in the body that have not been accepted yet
+	pending := 0
+	for _, f := range findings {
+		if f.Source != source {
+			continue
+		}
+		accepted := false
+		for _, rd := range redactions {
+			if rd.Source == f.Source && rd.Start == f.Start && rd.End == f.End && !rd.Stale {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			pending++
+		}
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":       "Redact " + content.Subject + " - EML Viewer",
+		"Email":           content.Email,
+		"Source":          source,
+		"Segments":        redact.Segments(text, spans),
+		"Redactions":      rows,
+		"PendingFindings": pending,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "redact.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// AddRedaction marks a span of an email body as redacted. The start and end
+// form fields are UTF-8 byte offsets into the body as the browser shows it.
+func (h *Handlers) AddRedaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := emailIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	start, err1 := strconv.Atoi(r.FormValue("start"))
+	end, err2 := strconv.Atoi(r.FormValue("end"))
+	if err1 != nil || err2 != nil {
+		http.Error(w, "Start and end must be integers", http.StatusBadRequest)
+		return
+	}
+
+	content, err := h.db.GetEmailWithFullContent(id)
+	if err != nil {
+		log.Printf("Error loading email %d for redaction: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return
+	}
+	if content == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	source, text := redactionSource(content)
+	if s := r.FormValue("source"); s != "" && s != source {
+		http.Error(w, "The email body has changed; reload the page", http.StatusConflict)
+		return
+	}
+	span := redact.Span{Start: redact.FromDisplay(text, start), End: redact.FromDisplay(text, end)}
+	if !span.Valid(text) {
+		http.Error(w, "Selection is outside the email body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.AddRedaction(&db.Redaction{
+		EmailID: id,
+		Source:  source,
+		Start:   span.Start,
+		End:     span.End,
+		Label:   strings.TrimSpace(r.FormValue("label")),
+	})
+	if err != nil {
+		log.Printf("Failed to add redaction to email %d: %v", id, err)
+		http.Error(w, "Failed to add redaction", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redactURL(id), http.StatusSeeOther)
+}
+
+// AcceptFindings turns an email's detected sensitive data into redactions
+func (h *Handlers) AcceptFindings(w http.ResponseWriter, r *http.Request) {
+	id, ok := emailIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.db.AcceptPIIFindings(id)
+	if err != nil {
+		log.Printf("Failed to accept findings for email %d: %v", id, err)
+		http.Error(w, "Failed to accept findings", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Accepted %d findings as redactions for email %d", n, id)
+
+	http.Redirect(w, r, redactURL(id), http.StatusSeeOther)
+}
+
+// DeleteRedaction removes one of an email's redactions
+func (h *Handlers) DeleteRedaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := emailIDParam(w, r)
+	if !ok {
+		return
+	}
+	rid, err := strconv.ParseInt(chi.URLParam(r, "rid"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid redaction ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.DeleteRedaction(id, rid); err != nil {
+		if errors.Is(err, db.ErrRedactionNotFound) {
+			http.Error(w, "Redaction not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to delete redaction %d: %v", rid, err)
+		http.Error(w, "Failed to delete redaction", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redactURL(id), http.StatusSeeOther)
+}
+
+// DownloadRedacted serves a redacted rendering of an email as text
+// (format=txt, the default) or as a printable HTML page (format=html)
+func (h *Handlers) DownloadRedacted(w http.ResponseWriter, r *http.Request) {
+	id, ok := emailIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "txt"
+	}
+	if format != "txt" && format != "html" {
+		http.Error(w, "Format must be txt or html", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := export.LoadRedactedDocument(h.db, id)
+	if errors.Is(err, redact.ErrInvalidSpan) {
+		http.Error(w, "A redaction no longer fits this email's body; review the redactions before downloading", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load email %d for redacted download: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return
+	}
+	if doc == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	contentType := "text/plain; charset=utf-8"
+	if format == "html" {
+		contentType = "text/html; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="email-`+strconv.FormatInt(id, 10)+`-redacted.`+format+`"`)
+	if err := export.WriteRedacted(w, doc, format == "html"); err != nil {
+		log.Printf("Failed to write redacted email %d: %v", id, err)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedactionHandlers tests marking, accepting, removing and downloading redactions
+func TestRedactionHandlers(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+
+	body := "Call Zoë on 555-867-5309 about the card"
+	filename := createTestEMLFile(t, tempDir, "secret.eml", "alice@acme.com", "bob@acme.com", "Secret", body)
+	email := db.CreateTestEmail("Secret", "alice@acme.com", body)
+	email.FilePath = filename
+	id, err := database.InsertEmail(email)
+	require.NoError(t, err)
+	idStr := strconv.FormatInt(id, 10)
+
+	phone := strings.Index(body, "555")
+	require.NoError(t, database.SavePIIFindings(id, []*db.PIIFinding{
+		{Type: "phone", Source: db.PIISourceBody, Start: phone, End: phone + 12, Masked: "***-***-5309"},
+	}))
+
+	post := func(handler http.HandlerFunc, form url.Values, params ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for i := 0; i+1 < len(params); i += 2 {
+			req = withURLParam(req, params[i], params[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	h.RedactPage(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redact", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Accept detected findings (1)")
+
+	// Mark "Zoë"; offsets are UTF-8 bytes
+	w = post(h.AddRedaction, url.Values{"start": {"5"}, "end": {"9"}, "source": {"body"}, "label": {"name"}}, "id", idStr)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/email/"+idStr+"/redact", w.Header().Get("Location"))
+
+	w = post(h.AddRedaction, url.Values{"start": {"5"}, "end": {"8"}}, "id", idStr)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "End splits a character")
+	w = post(h.AddRedaction, url.Values{"start": {"0"}, "end": {"4"}, "source": {"html"}}, "id", idStr)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = post(h.AcceptFindings, nil, "id", idStr)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	redactions, err := database.GetRedactions(id)
+	require.NoError(t, err)
+	require.Len(t, redactions, 2)
+
+	w = httptest.NewRecorder()
+	h.RedactPage(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redact", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Accept detected findings")
+	assert.Contains(t, w.Body.String(), "Phone number")
+
+	w = httptest.NewRecorder()
+	h.DownloadRedacted(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redacted", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "redacted.txt")
+	assert.Contains(t, w.Body.String(), "Call [REDACTED] on [REDACTED] about the card")
+
+	w = httptest.NewRecorder()
+	h.DownloadRedacted(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redacted?format=html", nil), "id", idStr))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "5309")
+	assert.NotContains(t, w.Body.String(), "Zoë")
+
+	w = httptest.NewRecorder()
+	h.DownloadRedacted(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redacted?format=pdf", nil), "id", idStr))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A redaction that no longer fits the body stops the download
+	require.NoError(t, database.AddRedaction(&db.Redaction{EmailID: id, Source: db.PIISourceBody, Start: 10, End: 5000}))
+	w = httptest.NewRecorder()
+	h.DownloadRedacted(w, withURLParam(httptest.NewRequest("GET", "/email/"+idStr+"/redacted", nil), "id", idStr))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NotContains(t, w.Body.String(), "5309")
+
+	rid := strconv.FormatInt(redactions[0].ID, 10)
+	w = post(h.DeleteRedaction, nil, "id", idStr, "rid", rid)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	w = post(h.DeleteRedaction, nil, "id", idStr, "rid", rid)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
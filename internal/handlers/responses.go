@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// responseListLimit is the number of contacts, gaps and unanswered emails listed
+const responseListLimit = 20
+
+// apiResponseTime is the JSON representation of response time statistics
+type apiResponseTime struct {
+	Key            string  `json:"key,omitempty"`
+	Replies        int     `json:"replies"`
+	AverageSeconds float64 `json:"average_seconds"`
+	FastestSeconds float64 `json:"fastest_seconds"`
+	SlowestSeconds float64 `json:"slowest_seconds"`
+}
+
+// apiReplyGap is the JSON representation of the time taken to reply to a message
+type apiReplyGap struct {
+	ParentID      int64   `json:"parent_id"`
+	ParentSubject string  `json:"parent_subject"`
+	ParentSender  string  `json:"parent_sender"`
+	ReplyID       int64   `json:"reply_id"`
+	ReplySender   string  `json:"reply_sender"`
+	Seconds       float64 `json:"seconds"`
+}
+
+// apiUnansweredEmail is the JSON representation of a message without a reply
+type apiUnansweredEmail struct {
+	ID      int64      `json:"id"`
+	Subject string     `json:"subject"`
+	Sender  string     `json:"sender"`
+	Date    *time.Time `json:"date,omitempty"`
+}
+
+func toAPIResponseTime(s *db.ResponseTimeStat) apiResponseTime {
+	return apiResponseTime{
+		Key:            s.Key,
+		Replies:        s.Replies,
+		AverageSeconds: s.AverageSeconds,
+		FastestSeconds: s.FastestSeconds,
+		SlowestSeconds: s.SlowestSeconds,
+	}
+}
+
+func toAPIResponseTimes(stats []*db.ResponseTimeStat) []apiResponseTime {
+	out := make([]apiResponseTime, len(stats))
+	for i, s := range stats {
+		out[i] = toAPIResponseTime(s)
+	}
+	return out
+}
+
+func toAPIReplyGaps(gaps []*db.ReplyGap) []apiReplyGap {
+	out := make([]apiReplyGap, len(gaps))
+	for i, g := range gaps {
+		out[i] = apiReplyGap{
+			ParentID:      g.ParentID,
+			ParentSubject: g.ParentSubject,
+			ParentSender:  g.ParentSender,
+			ReplyID:       g.ReplyID,
+			ReplySender:   g.ReplySender,
+			Seconds:       g.Seconds,
+		}
+	}
+	return out
+}
+
+// formatDuration renders a number of seconds as a short human-readable duration
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Minute)
+	switch {
+	case seconds < 60:
+		return strconv.Itoa(int(seconds)) + "s"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	days := int(d.Hours()) / 24
+	return fmt.Sprintf("%dd %dh", days, int(d.Hours())%24)
+}
+
+// contactAddress reads and normalizes the {address} URL parameter
+func contactAddress(r *http.Request) (string, bool) {
+	address, err := url.PathUnescape(chi.URLParam(r, "address"))
+	if err != nil {
+		return "", false
+	}
+	address = strings.ToLower(strings.TrimSpace(address))
+	return address, address != "" && len(address) <= 255 && strings.Contains(address, "@")
+}
+
+// ContactPage shows reply analytics for one email address
+func (h *Handlers) ContactPage(w http.ResponseWriter, r *http.Request) {
+	address, ok := contactAddress(r)
+	if !ok {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.db.GetContactResponseStats(address, responseListLimit)
+	if err != nil {
+		log.Printf("Failed to compute response times for %s: %v", address, err)
+		http.Error(w, "Failed to load contact", http.StatusInternalServerError)
+		return
+	}
+
+	sent, err := h.db.CountFiltered(db.SearchFilters{Sender: address})
+	if err != nil {
+		log.Printf("Failed to count emails from %s: %v", address, err)
+	}
+	received, err := h.db.CountFiltered(db.SearchFilters{Recipient: address})
+	if err != nil {
+		log.Printf("Failed to count emails to %s: %v", address, err)
+	}
+
+	pageStats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":   address + " - EML Viewer",
+		"Stats":       pageStats,
+		"Contact":     stats,
+		"Sent":        sent,
+		"Received":    received,
+		"SentURL":     drillDownURL(db.SearchFilters{Sender: address}),
+		"ReceivedURL": drillDownURL(db.SearchFilters{Recipient: address}),
+		"APIURL":      "/api/contacts/" + url.PathEscape(address),
+		"NetworkURL":  "/network?" + filterValues(db.SearchFilters{Sender: address}).Encode(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "contact.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// APIContact returns reply analytics for one email address as JSON
+func (h *Handlers) APIContact(w http.ResponseWriter, r *http.Request) {
+	address, ok := contactAddress(r)
+	if !ok {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.db.GetContactResponseStats(address, responseListLimit)
+	if err != nil {
+		log.Printf("Failed to compute response times for %s: %v", address, err)
+		http.Error(w, "Failed to load contact", http.StatusInternalServerError)
+		return
+	}
+
+	unanswered := make([]apiUnansweredEmail, len(stats.UnansweredInboundList))
+	for i, u := range stats.UnansweredInboundList {
+		unanswered[i] = apiUnansweredEmail{ID: u.ID, Subject: u.Subject, Sender: u.Sender}
+		if u.Date.Valid {
+			d := u.Date.Time
+			unanswered[i].Date = &d
+		}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"address":              stats.Address,
+		"replies_sent":         toAPIResponseTime(&stats.RepliesSent),
+		"first_reply_received": toAPIResponseTime(&stats.FirstReplyReceived),
+		"unanswered_inbound":   stats.UnansweredInbound,
+		"unanswered_emails":    unanswered,
+		"longest_gaps":         toAPIReplyGaps(stats.LongestGaps),
+	})
+}
+
+// APIResponseTimes returns archive-wide reply analytics as JSON
+func (h *Handlers) APIResponseTimes(w http.ResponseWriter, r *http.Request) {
+	summary, err := h.db.GetResponseSummary(responseListLimit)
+	if err != nil {
+		log.Printf("Failed to compute response times: %v", err)
+		http.Error(w, "Failed to compute response times", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"first_reply":  toAPIResponseTime(&summary.FirstReply),
+		"by_contact":   toAPIResponseTimes(summary.ByContact),
+		"by_domain":    toAPIResponseTimes(summary.ByDomain),
+		"longest_gaps": toAPIReplyGaps(summary.LongestGaps),
+		"unanswered":   summary.Unanswered,
+	})
+}
+
+// APIThreadResponseTimes returns reply analytics for the conversation containing an email
+func (h *Handlers) APIThreadResponseTimes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.db.GetThreadResponseStats(id)
+	if err != nil {
+		log.Printf("Failed to compute thread response times: %v", err)
+		http.Error(w, "Failed to compute response times", http.StatusInternalServerError)
+		return
+	}
+	if stats == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"root_id":             stats.RootID,
+		"subject":             stats.Subject,
+		"messages":            stats.Messages,
+		"replies":             stats.Replies,
+		"first_reply_seconds": stats.FirstReplySeconds,
+		"average_seconds":     stats.AverageSeconds,
+		"longest_gap_seconds": stats.LongestGapSeconds,
+	})
+}
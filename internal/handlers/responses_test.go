@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFormatDuration tests human-readable durations
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "45s", formatDuration(45))
+	assert.Equal(t, "5m", formatDuration(300))
+	assert.Equal(t, "3h 12m", formatDuration(3*3600+12*60))
+	assert.Equal(t, "2d 1h", formatDuration(49*3600))
+}
+
+// TestResponseHandlers tests the contact page and response time APIs
+func TestResponseHandlers(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	start := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+	question := db.CreateTestEmailWithDate("Question", "alice@acme.com", "q", start)
+	question.MessageID = "<q@test>"
+	question.Recipients = "bob@acme.com"
+	answer := db.CreateTestEmailWithDate("Re: Question", "bob@acme.com", "a", start.Add(2*time.Hour))
+	answer.MessageID = "<a@test>"
+	answer.InReplyTo = "<q@test>"
+	answer.Recipients = "alice@acme.com"
+	emails := db.InsertTestEmails(t, database, []*db.Email{question, answer})
+
+	w := httptest.NewRecorder()
+	h.ContactPage(w, withURLParam(httptest.NewRequest("GET", "/contact/bob%40acme.com", nil), "address", "Bob%40acme.com"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "bob@acme.com")
+	assert.Contains(t, w.Body.String(), "2h 0m")
+
+	w = httptest.NewRecorder()
+	h.ContactPage(w, withURLParam(httptest.NewRequest("GET", "/contact/bob", nil), "address", "bob"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.APIContact(w, withURLParam(httptest.NewRequest("GET", "/api/contacts/alice@acme.com", nil), "address", "alice@acme.com"))
+	require.Equal(t, http.StatusOK, w.Code)
+	var contact struct {
+		Address            string          `json:"address"`
+		FirstReplyReceived apiResponseTime `json:"first_reply_received"`
+		UnansweredInbound  int             `json:"unanswered_inbound"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &contact))
+	assert.Equal(t, "alice@acme.com", contact.Address)
+	assert.Equal(t, 1, contact.FirstReplyReceived.Replies)
+	assert.InDelta(t, 7200, contact.FirstReplyReceived.AverageSeconds, 1)
+	assert.Equal(t, 1, contact.UnansweredInbound)
+
+	w = httptest.NewRecorder()
+	h.APIResponseTimes(w, httptest.NewRequest("GET", "/api/response-times", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary struct {
+		ByDomain []apiResponseTime `json:"by_domain"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	require.Len(t, summary.ByDomain, 1)
+	assert.Equal(t, "acme.com", summary.ByDomain[0].Key)
+
+	id := strconv.FormatInt(emails[1].ID, 10)
+	w = httptest.NewRecorder()
+	h.APIThreadResponseTimes(w, withURLParam(httptest.NewRequest("GET", "/api/threads/"+id+"/response-times", nil), "id", id))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"first_reply_seconds":7200`)
+
+	w = httptest.NewRecorder()
+	h.APIThreadResponseTimes(w, withURLParam(httptest.NewRequest("GET", "/api/threads/999/response-times", nil), "id", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
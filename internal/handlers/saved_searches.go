@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// savedSearchWithCount pairs a saved search with its live result count
+type savedSearchWithCount struct {
+	*db.SavedSearch
+	Count int
+}
+
+// loadSavedSearchesWithCounts loads all saved searches and counts their current matches
+func (h *Handlers) loadSavedSearchesWithCounts() ([]savedSearchWithCount, error) {
+	searches, err := h.db.ListSavedSearches()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]savedSearchWithCount, 0, len(searches))
+	for _, s := range searches {
+		count, err := h.db.CountFiltered(s.Filters)
+		if err != nil {
+			// Log error but don't fail, just show 0 for this search
+			log.Printf("Failed to count saved search %d: %v", s.ID, err)
+			count = 0
+		}
+		result = append(result, savedSearchWithCount{SavedSearch: s, Count: count})
+	}
+	return result, nil
+}
+
+// renderSavedSearchesSidebar renders the saved searches sidebar fragment
+func (h *Handlers) renderSavedSearchesSidebar(w http.ResponseWriter) {
+	searches, err := h.loadSavedSearchesWithCounts()
+	if err != nil {
+		log.Printf("Failed to load saved searches: %v", err)
+		http.Error(w, "Failed to load saved searches", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "saved-searches", searches); err != nil {
+		log.Printf("Template error: %v", err)
+	}
+}
+
+// ListSavedSearches returns the saved searches sidebar as an HTML fragment
+func (h *Handlers) ListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	h.renderSavedSearchesSidebar(w)
+}
+
+// CreateSavedSearch saves the submitted filter set under a name
+// The name is read from the "name" form field or the HX-Prompt header
+func (h *Handlers) CreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		name = r.Header.Get("HX-Prompt")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	filters := parseSearchFilters(r)
+	if _, err := h.db.CreateSavedSearch(name, filters); err != nil {
+		if errors.Is(err, db.ErrDuplicateName) {
+			http.Error(w, "A saved search with this name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to create saved search: %v", err)
+		http.Error(w, "Failed to save search", http.StatusBadRequest)
+		return
+	}
+
+	h.renderSavedSearchesSidebar(w)
+}
+
+// DeleteSavedSearch removes a saved search and returns the updated sidebar
+func (h *Handlers) DeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid saved search ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.DeleteSavedSearch(id); err != nil {
+		log.Printf("Failed to delete saved search: %v", err)
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+
+	h.renderSavedSearchesSidebar(w)
+}
+
+// ViewSavedSearch renders the email list with a saved search's filters applied
+func (h *Handlers) ViewSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid saved search ID", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.db.GetSavedSearch(id)
+	if err != nil {
+		log.Printf("Failed to load saved search: %v", err)
+		http.Error(w, "Failed to load saved search", http.StatusInternalServerError)
+		return
+	}
+	if saved == nil {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+
+	h.renderFilteredIndex(w, saved.Name+" - EML Viewer", saved.Filters, saved)
+}
+
+// renderFilteredIndex renders the email list page with a filter set applied,
+// as a full page that can be bookmarked or linked to
+func (h *Handlers) renderFilteredIndex(w http.ResponseWriter, pageTitle string, filters db.SearchFilters, saved *db.SavedSearch) {
+	count, err := h.db.CountEmails()
+	if err != nil {
+		http.Error(w, "Failed to get email count", http.StatusInternalServerError)
+		return
+	}
+
+	matching, err := h.db.CountFiltered(filters)
+	if err != nil {
+		log.Printf("Failed to count filtered emails: %v", err)
+		http.Error(w, "Failed to load emails", http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch one more than limit to check if there are more results
+	limit := 50
+	emails, err := h.db.SearchFiltered(filters, limit+1, 0)
+	if err != nil {
+		log.Printf("Failed to search emails: %v", err)
+		http.Error(w, "Failed to load emails", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(emails) > limit
+	if hasMore {
+		emails = emails[:limit]
+	}
+
+	data := map[string]interface{}{
+		"PageTitle": pageTitle,
+		"Stats": map[string]interface{}{
+			"TotalEmails": count,
+		},
+		"Emails":        emails,
+		"MatchingCount": matching,
+		"Filters":       filters,
+		"Filtered":      true,
+		"HasMore":       hasMore,
+		"LoadMoreURL":   searchURL(filters, limit),
+	}
+	if saved != nil {
+		data["SavedSearch"] = saved
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "index.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// apiSavedSearch is the JSON representation of a saved search
+type apiSavedSearch struct {
+	ID      int64      `json:"id"`
+	Name    string     `json:"name"`
+	Filters apiFilters `json:"filters"`
+	Count   int        `json:"count"`
+	URL     string     `json:"url"`
+	APIURL  string     `json:"api_url"`
+}
+
+// toAPISavedSearch converts a saved search to its JSON representation
+func toAPISavedSearch(s *db.SavedSearch, count int) apiSavedSearch {
+	id := strconv.FormatInt(s.ID, 10)
+	return apiSavedSearch{
+		ID:      s.ID,
+		Name:    s.Name,
+		Filters: toAPIFilters(s.Filters),
+		Count:   count,
+		URL:     "/saved/" + id,
+		APIURL:  "/api/saved-searches/" + id,
+	}
+}
+
+// APIListSavedSearches returns all saved searches with live counts as JSON
+func (h *Handlers) APIListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	searches, err := h.loadSavedSearchesWithCounts()
+	if err != nil {
+		log.Printf("Failed to load saved searches: %v", err)
+		http.Error(w, "Failed to load saved searches", http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]apiSavedSearch, 0, len(searches))
+	for _, s := range searches {
+		out = append(out, toAPISavedSearch(s.SavedSearch, s.Count))
+	}
+	writeJSON(w, out)
+}
+
+// APIGetSavedSearch returns a saved search and a page of its results as JSON
+func (h *Handlers) APIGetSavedSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid saved search ID", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.db.GetSavedSearch(id)
+	if err != nil {
+		log.Printf("Failed to load saved search: %v", err)
+		http.Error(w, "Failed to load saved search", http.StatusInternalServerError)
+		return
+	}
+	if saved == nil {
+		http.Error(w, "Saved search not found", http.StatusNotFound)
+		return
+	}
+
+	limit := 50
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 && parsed <= 500 {
+		limit = parsed
+	}
+	offset := 0
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && parsed > 0 {
+		offset = parsed
+	}
+
+	count, err := h.db.CountFiltered(saved.Filters)
+	if err != nil {
+		log.Printf("Failed to count saved search: %v", err)
+		http.Error(w, "Failed to run saved search", http.StatusInternalServerError)
+		return
+	}
+
+	results, err := h.db.SearchFiltered(saved.Filters, limit, offset)
+	if err != nil {
+		log.Printf("Failed to run saved search: %v", err)
+		http.Error(w, "Failed to run saved search", http.StatusInternalServerError)
+		return
+	}
+
+	emails := make([]apiEmail, 0, len(results))
+	for _, res := range results {
+		e := toAPIEmail(&res.Email)
+		e.Snippet = res.Snippet
+		emails = append(emails, e)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"saved_search": toAPISavedSearch(saved, count),
+		"offset":       offset,
+		"limit":        limit,
+		"emails":       emails,
+	})
+}
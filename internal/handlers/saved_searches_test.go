@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withURLParam attaches a chi URL parameter to the request
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.RouteContext(req.Context())
+	if rctx == nil {
+		rctx = chi.NewRouteContext()
+	}
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// Test creating a saved search from the HTMX prompt and listing it with a live count
+func TestCreateSavedSearchHandler(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmail("Quarterly Report", "cfo@test.com", "Numbers"),
+		db.CreateTestEmail("Report draft", "cfo@test.com", "More numbers"),
+		db.CreateTestEmail("Lunch", "bob@test.com", "Noon"),
+	})
+
+	form := url.Values{"q": {"report"}, "sender": {"cfo"}}
+	req := httptest.NewRequest("POST", "/saved-searches", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Prompt", "CFO reports")
+	w := httptest.NewRecorder()
+
+	h.CreateSavedSearch(w, req)
+
+	require.Equal(t, 200, w.Code, w.Body.String())
+	body := w.Body.String()
+	assert.Contains(t, body, "CFO reports")
+	assert.Contains(t, body, ">2<", "Sidebar should show the live count")
+
+	// Saving under the same name conflicts
+	req = httptest.NewRequest("POST", "/saved-searches", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Prompt", "CFO reports")
+	w = httptest.NewRecorder()
+	h.CreateSavedSearch(w, req)
+	assert.Equal(t, 409, w.Code)
+
+	// Every filter on the page is saved, including operators in the query
+	form = url.Values{"q": {"report domain:example.com"}, "collapse_duplicates": {"true"},
+		"sensitive": {db.SensitiveAny}, "auth": {"fail"}, "date_uncertain": {"true"}}
+	req = httptest.NewRequest("POST", "/saved-searches", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Prompt", "Everything")
+	w = httptest.NewRecorder()
+	h.CreateSavedSearch(w, req)
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	searches, err := database.ListSavedSearches()
+	require.NoError(t, err)
+	require.Len(t, searches, 2)
+	want := db.SearchFilters{Query: "report", Domain: "example.com", CollapseDuplicates: true,
+		Sensitive: db.SensitiveAny, Auth: "fail", DateUncertain: true}
+	assert.Equal(t, want, searches[1].Filters)
+	assert.Equal(t, apiFilters{Query: "report", Domain: "example.com", CollapseDuplicates: true,
+		Sensitive: db.SensitiveAny, Auth: "fail", DateUncertain: true}, toAPIFilters(want))
+}
+
+// Test the saved search page and JSON API
+func TestSavedSearchViewAndAPI(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmail("Quarterly Report", "cfo@test.com", "Numbers"),
+		db.CreateTestEmail("Lunch", "bob@test.com", "Noon"),
+	})
+
+	id, err := database.CreateSavedSearch("Reports", db.SearchFilters{Query: "report"})
+	require.NoError(t, err)
+
+	req := withURLParam(httptest.NewRequest("GET", fmt.Sprintf("/saved/%d", id), nil), "id", fmt.Sprint(id))
+	w := httptest.NewRecorder()
+	h.ViewSavedSearch(w, req)
+
+	require.Equal(t, 200, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "Quarterly Report")
+	assert.NotContains(t, body, "Lunch")
+	assert.Contains(t, body, `value="report"`, "Search box should be prefilled")
+
+	req = withURLParam(httptest.NewRequest("GET", fmt.Sprintf("/api/saved-searches/%d", id), nil), "id", fmt.Sprint(id))
+	w = httptest.NewRecorder()
+	h.APIGetSavedSearch(w, req)
+
+	require.Equal(t, 200, w.Code)
+	var resp struct {
+		SavedSearch apiSavedSearch `json:"saved_search"`
+		Emails      []apiEmail     `json:"emails"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Reports", resp.SavedSearch.Name)
+	assert.Equal(t, 1, resp.SavedSearch.Count)
+	require.Len(t, resp.Emails, 1)
+	assert.Equal(t, "Quarterly Report", resp.Emails[0].Subject)
+
+	// Unknown IDs return 404
+	req = withURLParam(httptest.NewRequest("GET", "/api/saved-searches/999", nil), "id", "999")
+	w = httptest.NewRecorder()
+	h.APIGetSavedSearch(w, req)
+	assert.Equal(t, 404, w.Code)
+}
@@ -1,46 +1,30 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
-	"time"
+	"strconv"
 
 	"github.com/felo/eml-viewer/internal/db"
 	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/scanjob"
+	"github.com/go-chi/chi/v5"
 )
 
-// ScanProgress holds the current scan progress state
-type ScanProgress struct {
-	mu              sync.RWMutex
-	isScanning      bool
-	current         int
-	total           int
-	currentFile     string
-	totalFound      int
-	newIndexed      int
-	skipped         int
-	failed          int
-	completed       bool
-	err             error
-	lastUpdate      time.Time
-	progressClients []chan ProgressEvent
-}
+// scanHistoryLimit is how many past scans the history page shows
+const scanHistoryLimit = 50
 
-// ProgressEvent represents a progress update event
-type ProgressEvent struct {
-	Type string      `json:"type"` // "progress", "complete", "error"
-	Data interface{} `json:"data"`
+// apiScanJob is the JSON response for a started scan
+type apiScanJob struct {
+	ID       int64  `json:"id"`
+	Progress string `json:"progress"` // SSE stream of the job's progress
 }
 
-var (
-	scanProgress = &ScanProgress{
-		progressClients: make([]chan ProgressEvent, 0),
-	}
-)
-
 // ScanPage displays the scan page
 func (h *Handlers) ScanPage(w http.ResponseWriter, r *http.Request) {
 	// Get current stats
@@ -58,8 +42,31 @@ func (h *Handlers) ScanPage(w http.ResponseWriter, r *http.Request) {
 		lastIndexed = "Never"
 	}
 
+	// Reattach the page to a scan that is already running
+	var runningJob int64
+	var runningKind string
+	if job := h.scans.Running(); job != nil {
+		runningJob = job.ID
+		runningKind = job.Snapshot().Kind
+	}
+
+	problems, err := h.db.CountIndexErrors()
+	if err != nil {
+		log.Printf("Error counting index errors: %v", err)
+	}
+
+	stale, err := h.db.CountEmailsBelowParserVersion(indexer.ParserVersion)
+	if err != nil {
+		log.Printf("Error counting emails to re-parse: %v", err)
+	}
+
 	data := map[string]interface{}{
-		"EmailsPath": h.cfg.EmailsPath,
+		"EmailsPath":  h.cfg.EmailsPath,
+		"RunningJob":  runningJob,
+		"RunningKind": runningKind,
+		"Problems":    problems,
+		"Stale":       stale,
+		"Tasks":       h.maintenanceStatus(),
 		"Stats": map[string]interface{}{
 			"TotalEmails":     stats.TotalEmails,
 			"WithAttachments": stats.WithAttachments,
@@ -74,218 +81,285 @@ func (h *Handlers) ScanPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Scan handles manual re-scanning of emails
+// Scan starts a scan of the emails folder as a new job
 func (h *Handlers) Scan(w http.ResponseWriter, r *http.Request) {
-	scanProgress.mu.Lock()
-	if scanProgress.isScanning {
-		scanProgress.mu.Unlock()
+	job, err := h.scans.Start()
+	writeStartedScan(w, job, err)
+}
+
+// ReparseScan starts a job parsing again the emails indexed by an older
+// parser version
+func (h *Handlers) ReparseScan(w http.ResponseWriter, r *http.Request) {
+	job, err := h.scans.Reparse()
+	writeStartedScan(w, job, err)
+}
+
+// writeStartedScan responds to a request that started a scan job
+func writeStartedScan(w http.ResponseWriter, job *scanjob.Job, err error) {
+	if errors.Is(err, scanjob.ErrRunning) {
 		http.Error(w, "Scan already in progress", http.StatusConflict)
 		return
 	}
+	if err != nil {
+		log.Printf("Failed to start scan: %v", err)
+		http.Error(w, "Failed to start scan", http.StatusInternalServerError)
+		return
+	}
 
-	// Reset progress state
-	scanProgress.isScanning = true
-	scanProgress.current = 0
-	scanProgress.total = 0
-	scanProgress.currentFile = ""
-	scanProgress.totalFound = 0
-	scanProgress.newIndexed = 0
-	scanProgress.skipped = 0
-	scanProgress.failed = 0
-	scanProgress.completed = false
-	scanProgress.err = nil
-	scanProgress.lastUpdate = time.Now()
-	scanProgress.mu.Unlock()
-
-	// Run scan in background
-	go func() {
-		defer func() {
-			scanProgress.mu.Lock()
-			scanProgress.isScanning = false
-			scanProgress.completed = true
-			scanProgress.mu.Unlock()
-		}()
-
-		// Create indexer
-		idx := indexer.NewIndexer(h.db, h.cfg.EmailsPath, false)
-
-		// Run indexing with progress callback
-		result, err := idx.IndexWithProgress(func(current, total int, filePath string) {
-			scanProgress.mu.Lock()
-			scanProgress.current = current
-			scanProgress.total = total
-			scanProgress.currentFile = filePath
-			scanProgress.lastUpdate = time.Now()
-			scanProgress.mu.Unlock()
-
-			// Broadcast to all SSE clients
-			scanProgress.broadcastProgress()
-		})
-
-		scanProgress.mu.Lock()
-		if err != nil {
-			scanProgress.err = err
-			scanProgress.mu.Unlock()
-			scanProgress.broadcastError(err)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(apiScanJob{
+		ID:       job.ID,
+		Progress: fmt.Sprintf("/scan/%d/progress", job.ID),
+	}); err != nil {
+		log.Printf("Failed to encode JSON response: %v", err)
+	}
+}
 
-		// Update final stats
-		scanProgress.totalFound = result.TotalFound
-		scanProgress.newIndexed = result.NewIndexed
-		scanProgress.skipped = result.Skipped
-		scanProgress.failed = result.Failed
-		scanProgress.mu.Unlock()
+// newScanIndexer creates the indexer used by scan jobs
+func (h *Handlers) newScanIndexer() *indexer.Indexer {
+	keys, err := parser.LoadDKIMKeys(h.cfg.DKIMKeysPath)
+	if err != nil {
+		log.Printf("Warning: Failed to load DKIM keys: %v", err)
+	}
+	return indexer.NewIndexer(h.db, h.cfg.EmailsPath, false).
+		WithPIIScan(h.cfg.ScanPII).
+		WithDKIMKeys(keys).
+		WithReparseWait(h.cfg.ReparseWait)
+}
 
-		// Broadcast completion
-		scanProgress.broadcastComplete(result)
-	}()
+// CancelScan stops the running scan. Emails indexed so far are kept.
+func (h *Handlers) CancelScan(w http.ResponseWriter, r *http.Request) {
+	job := h.scans.Running()
+	if job == nil {
+		http.Error(w, "No scan in progress", http.StatusConflict)
+		return
+	}
+	job.Cancel()
 
 	w.WriteHeader(http.StatusAccepted)
-	fmt.Fprintf(w, "Scan started")
+	fmt.Fprintf(w, "Scan cancelling")
 }
 
-// ScanProgressSSE handles Server-Sent Events for scan progress
+// CancelScanJob stops a scan job by ID
+func (h *Handlers) CancelScanJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.scanJobParam(w, r)
+	if !ok {
+		return
+	}
+	if !job.Running() {
+		http.Error(w, "Scan is not running", http.StatusConflict)
+		return
+	}
+	job.Cancel()
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Scan cancelling")
+}
+
+// StopScan cancels any running scan and waits for it to stop or for ctx to
+// expire, so the database is not closed under a batch write
+func (h *Handlers) StopScan(ctx context.Context) error {
+	return h.scans.Stop(ctx)
+}
+
+// ScanProgressSSE streams the progress of the running or latest scan
 func (h *Handlers) ScanProgressSSE(w http.ResponseWriter, r *http.Request) {
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	job := h.scans.Latest()
+	if job == nil {
+		http.Error(w, "No scan has run", http.StatusNotFound)
+		return
+	}
+	streamScanJob(w, r, job)
+}
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+// ScanJobProgressSSE streams a scan job's progress as Server-Sent Events
+func (h *Handlers) ScanJobProgressSSE(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "job"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid scan job ID", http.StatusBadRequest)
+		return
+	}
+
+	if job := h.scans.Job(id); job != nil {
+		streamScanJob(w, r, job)
+		return
+	}
+
+	// Jobs no longer in memory have finished; send their recorded outcome
+	record, err := h.db.GetScanJob(id)
+	if err != nil {
+		log.Printf("Failed to get scan job: %v", err)
+		http.Error(w, "Failed to load scan job", http.StatusInternalServerError)
+		return
+	}
+	if record == nil {
+		http.Error(w, "Scan job not found", http.StatusNotFound)
 		return
 	}
 
-	// Create a channel for this client
-	clientChan := make(chan ProgressEvent, 10)
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+	eventType := scanjob.EventComplete
+	switch record.Status {
+	case db.ScanJobCancelled, db.ScanJobInterrupted:
+		eventType = scanjob.EventCancelled
+	case db.ScanJobFailed:
+		eventType = scanjob.EventError
+	}
+	sendSSE(w, flusher, eventType, scanEventData(scanjob.Event{
+		Type: eventType,
+		Progress: scanjob.Progress{
+			JobID:   record.ID,
+			Kind:    record.Kind,
+			Status:  record.Status,
+			Found:   record.TotalFound,
+			New:     record.NewIndexed,
+			Skipped: record.Skipped,
+			Failed:  record.Failed,
+			Error:   record.Error,
+		},
+	}))
+}
 
-	// Register client
-	scanProgress.mu.Lock()
-	scanProgress.progressClients = append(scanProgress.progressClients, clientChan)
+// scanJobParam looks up the in-memory job named by the {job} URL parameter,
+// writing an error response if there is none
+func (h *Handlers) scanJobParam(w http.ResponseWriter, r *http.Request) (*scanjob.Job, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "job"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid scan job ID", http.StatusBadRequest)
+		return nil, false
+	}
+	job := h.scans.Job(id)
+	if job == nil {
+		http.Error(w, "Scan job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
 
-	// Send initial state if scan is in progress
-	if scanProgress.isScanning {
-		initialData := map[string]interface{}{
-			"current": scanProgress.current,
-			"total":   scanProgress.total,
-			"file":    scanProgress.currentFile,
-			"stats": map[string]int{
-				"found":   scanProgress.totalFound,
-				"new":     scanProgress.newIndexed,
-				"skipped": scanProgress.skipped,
-				"failed":  scanProgress.failed,
-			},
-		}
-		sendSSE(w, flusher, "progress", initialData)
+// streamScanJob sends a job's events to the client until the job ends or the
+// client disconnects
+func streamScanJob(w http.ResponseWriter, r *http.Request, job *scanjob.Job) {
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
 	}
-	scanProgress.mu.Unlock()
 
-	// Listen for updates or client disconnect
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
 	ctx := r.Context()
 	for {
 		select {
 		case <-ctx.Done():
-			// Client disconnected, clean up
-			scanProgress.mu.Lock()
-			for i, ch := range scanProgress.progressClients {
-				if ch == clientChan {
-					scanProgress.progressClients = append(scanProgress.progressClients[:i], scanProgress.progressClients[i+1:]...)
-					break
-				}
-			}
-			scanProgress.mu.Unlock()
-			close(clientChan)
 			return
-
-		case event := <-clientChan:
-			sendSSE(w, flusher, event.Type, event.Data)
-
-			// Close connection after complete or error
-			if event.Type == "complete" || event.Type == "error" {
+		case event := <-events:
+			sendSSE(w, flusher, event.Type, scanEventData(event))
+			if event.Type != scanjob.EventProgress {
 				return
 			}
 		}
 	}
 }
 
-// broadcastProgress sends progress update to all connected clients
-func (sp *ScanProgress) broadcastProgress() {
-	sp.mu.RLock()
-	defer sp.mu.RUnlock()
-
-	data := map[string]interface{}{
-		"current": sp.current,
-		"total":   sp.total,
-		"file":    sp.currentFile,
-		"stats": map[string]int{
-			"found":   sp.totalFound,
-			"new":     sp.newIndexed,
-			"skipped": sp.skipped,
-			"failed":  sp.failed,
-		},
+// startSSE sets the Server-Sent Events headers
+func startSSE(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return nil, false
 	}
 
-	event := ProgressEvent{
-		Type: "progress",
-		Data: data,
-	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	return flusher, true
+}
 
-	for _, client := range sp.progressClients {
-		select {
-		case client <- event:
-		default:
-			// Client channel full, skip
+// scanEventData is the JSON payload of a scan event
+func scanEventData(event scanjob.Event) map[string]interface{} {
+	p := event.Progress
+	switch event.Type {
+	case scanjob.EventProgress:
+		return map[string]interface{}{
+			"job":     p.JobID,
+			"kind":    p.Kind,
+			"current": p.Current,
+			"total":   p.Total,
+			"file":    p.File,
+			"stats": map[string]int{
+				"found":   p.Found,
+				"new":     p.New,
+				"skipped": p.Skipped,
+				"failed":  p.Failed,
+			},
+		}
+	case scanjob.EventError:
+		return map[string]interface{}{
+			"job":   p.JobID,
+			"kind":  p.Kind,
+			"error": p.Error,
+		}
+	default:
+		return map[string]interface{}{
+			"job":     p.JobID,
+			"kind":    p.Kind,
+			"found":   p.Found,
+			"new":     p.New,
+			"skipped": p.Skipped,
+			"failed":  p.Failed,
 		}
 	}
 }
 
-// broadcastComplete sends completion event to all connected clients
-func (sp *ScanProgress) broadcastComplete(result *indexer.IndexResult) {
-	sp.mu.RLock()
-	defer sp.mu.RUnlock()
-
-	data := map[string]interface{}{
-		"found":   result.TotalFound,
-		"new":     result.NewIndexed,
-		"skipped": result.Skipped,
-		"failed":  result.Failed,
-	}
+// scanHistoryEntry is a past scan with the files it could not index
+type scanHistoryEntry struct {
+	*db.ScanJob
+	Failures []*db.ScanJobFailure
+}
 
-	event := ProgressEvent{
-		Type: "complete",
-		Data: data,
+// ScanHistory lists past scans with their counts and failed files
+func (h *Handlers) ScanHistory(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.db.ListScanJobs(scanHistoryLimit)
+	if err != nil {
+		log.Printf("Failed to list scan jobs: %v", err)
+		http.Error(w, "Failed to load scan history", http.StatusInternalServerError)
+		return
 	}
 
-	for _, client := range sp.progressClients {
-		select {
-		case client <- event:
-		default:
+	entries := make([]scanHistoryEntry, len(jobs))
+	for i, job := range jobs {
+		entries[i].ScanJob = job
+		if job.Failed == 0 {
+			continue
+		}
+		entries[i].Failures, err = h.db.ListScanJobFailures(job.ID)
+		if err != nil {
+			log.Printf("Failed to list scan failures: %v", err)
+			http.Error(w, "Failed to load scan history", http.StatusInternalServerError)
+			return
 		}
 	}
-}
 
-// broadcastError sends error event to all connected clients
-func (sp *ScanProgress) broadcastError(err error) {
-	sp.mu.RLock()
-	defer sp.mu.RUnlock()
-
-	data := map[string]interface{}{
-		"error": err.Error(),
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
 	}
 
-	event := ProgressEvent{
-		Type: "error",
-		Data: data,
+	data := map[string]interface{}{
+		"PageTitle": "Scan History - EML Viewer",
+		"Stats":     stats,
+		"Jobs":      entries,
 	}
 
-	for _, client := range sp.progressClients {
-		select {
-		case client <- event:
-		default:
-		}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "scan-history.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
 	}
 }
 
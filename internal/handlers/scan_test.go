@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/felo/eml-viewer/internal/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScanJobs tests starting a scan job, following it and the scan history
+func TestScanJobs(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+	createTestEMLFile(t, tempDir, "hello.eml", "alice@test.com", "bob@test.com", "Hello", "Hi Bob")
+
+	w := httptest.NewRecorder()
+	h.CancelScan(w, httptest.NewRequest("POST", "/scan/cancel", nil))
+	assert.Equal(t, http.StatusConflict, w.Code, "Nothing to cancel before a scan")
+
+	w = httptest.NewRecorder()
+	h.Scan(w, httptest.NewRequest("POST", "/scan", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var started apiScanJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	assert.Equal(t, fmt.Sprintf("/scan/%d/progress", started.ID), started.Progress)
+
+	job := h.scans.Job(started.ID)
+	require.NotNil(t, job)
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scan did not finish")
+	}
+
+	jobID := fmt.Sprint(started.ID)
+	w = httptest.NewRecorder()
+	h.ScanJobProgressSSE(w, withURLParam(httptest.NewRequest("GET", started.Progress, nil), "job", jobID))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "event: complete")
+	assert.Contains(t, w.Body.String(), `"new":1`)
+
+	w = httptest.NewRecorder()
+	h.CancelScanJob(w, withURLParam(httptest.NewRequest("POST", "/scan/"+jobID+"/cancel", nil), "job", jobID))
+	assert.Equal(t, http.StatusConflict, w.Code, "Finished scan should not be cancellable")
+	require.NoError(t, h.StopScan(context.Background()))
+
+	// Jobs from before a restart are streamed from their record
+	oldID, err := database.CreateScanJob(db.ScanJobKindScan)
+	require.NoError(t, err)
+	require.NoError(t, database.FinishScanJob(&db.ScanJob{ID: oldID, Status: db.ScanJobCancelled, NewIndexed: 4}, nil))
+	oldJobID := fmt.Sprint(oldID)
+	w = httptest.NewRecorder()
+	h.ScanJobProgressSSE(w, withURLParam(httptest.NewRequest("GET", "/scan/"+oldJobID+"/progress", nil), "job", oldJobID))
+	assert.Contains(t, w.Body.String(), "event: cancelled")
+	assert.Contains(t, w.Body.String(), `"new":4`)
+
+	w = httptest.NewRecorder()
+	h.ScanJobProgressSSE(w, withURLParam(httptest.NewRequest("GET", "/scan/999/progress", nil), "job", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ScanJobProgressSSE(w, withURLParam(httptest.NewRequest("GET", "/scan/abc/progress", nil), "job", "abc"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ScanHistory(w, httptest.NewRequest("GET", "/scan/history", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "#"+jobID)
+	assert.Contains(t, w.Body.String(), "Complete")
+	assert.Contains(t, w.Body.String(), "Cancelled")
+}
+
+// TestReparseScan tests re-parsing emails indexed by an older parser version
+func TestReparseScan(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+	createTestEMLFile(t, tempDir, "hello.eml", "alice@test.com", "bob@test.com", "Hello", "Hi Bob")
+	_, err := indexer.NewIndexer(database, tempDir, false).IndexAll()
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h.ScanPage(w, httptest.NewRequest("GET", "/scan", nil))
+	assert.NotContains(t, w.Body.String(), "Re-parse 1 email")
+
+	_, err = database.Exec("UPDATE emails SET parser_version = 0, subject = 'Stale'")
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.ScanPage(w, httptest.NewRequest("GET", "/scan", nil))
+	assert.Contains(t, w.Body.String(), "Re-parse 1 email indexed by an older version")
+
+	w = httptest.NewRecorder()
+	h.ReparseScan(w, httptest.NewRequest("POST", "/scan/reparse", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var started apiScanJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+
+	job := h.scans.Job(started.ID)
+	require.NotNil(t, job)
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Re-parse did not finish")
+	}
+	assert.Equal(t, db.ScanJobKindReparse, job.Snapshot().Kind)
+	assert.Equal(t, 1, job.Snapshot().New)
+
+	jobID := fmt.Sprint(started.ID)
+	w = httptest.NewRecorder()
+	h.ScanJobProgressSSE(w, withURLParam(httptest.NewRequest("GET", started.Progress, nil), "job", jobID))
+	assert.Contains(t, w.Body.String(), `"kind":"reparse"`)
+
+	emails, err := database.ListEmails(10, 0)
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+	assert.Equal(t, "Hello", emails[0].Subject)
+
+	w = httptest.NewRecorder()
+	h.ScanHistory(w, httptest.NewRequest("GET", "/scan/history", nil))
+	assert.Contains(t, w.Body.String(), "Re-parse")
+}
+
+// TestProblems tests the problems page and retrying failed files
+func TestProblems(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "broken.eml"), []byte("not an email"), 0644))
+	require.NoError(t, database.RecordIndexErrors([]*db.IndexError{
+		{FilePath: "broken.eml", Category: indexer.FailMalformed, Message: "malformed MIME header line"},
+		{FilePath: "locked.eml", Category: indexer.FailUnreadable, Message: "permission denied"},
+	}))
+
+	w := httptest.NewRecorder()
+	h.ProblemsPage(w, httptest.NewRequest("GET", "/problems", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "broken.eml")
+	assert.Contains(t, w.Body.String(), "locked.eml")
+
+	w = httptest.NewRecorder()
+	h.ProblemsPage(w, httptest.NewRequest("GET", "/problems?category=unreadable", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "broken.eml")
+	assert.Contains(t, w.Body.String(), "locked.eml")
+
+	// Paths that never failed are not retried
+	req := httptest.NewRequest("POST", "/problems/retry", strings.NewReader("file=../../etc/passwd"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.RetryProblems(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Fix the file and retry it
+	createTestEMLFile(t, tempDir, "broken.eml", "alice@test.com", "bob@test.com", "Fixed", "Now valid")
+	req = httptest.NewRequest("POST", "/problems/retry", strings.NewReader("file=broken.eml"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	h.RetryProblems(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/scan", w.Header().Get("Location"))
+
+	job := h.scans.Latest()
+	require.NotNil(t, job)
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry did not finish")
+	}
+	assert.Equal(t, 1, job.Snapshot().New)
+	assert.Equal(t, db.ScanJobKindRetry, job.Snapshot().Kind)
+
+	errs, err := database.ListIndexErrors()
+	require.NoError(t, err)
+	require.Len(t, errs, 1, "Retried file should be cleared")
+	assert.Equal(t, "locked.eml", errs[0].FilePath)
+}
+
+// TestHealth tests the health endpoint and the maintenance status on the scan page
+func TestHealth(t *testing.T) {
+	h, database, tempDir := setupTestHandlersWithTempDir(t)
+	defer os.RemoveAll(tempDir)
+	defer db.CleanupTestDB(t, database)
+
+	w := httptest.NewRecorder()
+	h.Health(w, httptest.NewRequest("GET", "/health", nil))
+	require.Equal(t, http.StatusOK, w.Code, "Healthy without a scheduler")
+	var health apiHealth
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, "ok", health.Status)
+	assert.Empty(t, health.Tasks)
+
+	failing := scheduler.Task{Name: "integrity", Interval: time.Millisecond, Run: func(context.Context) (string, error) {
+		return "", fmt.Errorf("page 7 is corrupt")
+	}}
+	sched := scheduler.New(database, failing, scheduler.Task{Name: "analyze"})
+	h.SetScheduler(sched)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		sched.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool { return !sched.Healthy() }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-stopped
+
+	w = httptest.NewRecorder()
+	h.Health(w, httptest.NewRequest("GET", "/health", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, "degraded", health.Status)
+	assert.Equal(t, "ok", health.Database)
+	require.Len(t, health.Tasks, 2)
+	assert.Equal(t, "page 7 is corrupt", health.Tasks[0].Error)
+	assert.NotNil(t, health.Tasks[0].LastRun)
+	assert.Empty(t, health.Tasks[1].Interval, "Disabled task has no interval")
+
+	w = httptest.NewRecorder()
+	h.ScanPage(w, httptest.NewRequest("GET", "/scan", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Scheduled Maintenance")
+	assert.Contains(t, w.Body.String(), "page 7 is corrupt")
+	assert.Contains(t, w.Body.String(), "Disabled")
+}
@@ -3,25 +3,104 @@ package handlers
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/felo/eml-viewer/internal/db"
 )
 
+// parseSearchFilters reads the standard filter parameters from a request's
+// query string or form body. "link:" and "domain:" terms in the query become
+// link filters.
+func parseSearchFilters(r *http.Request) db.SearchFilters {
+	return db.SearchFilters{
+		Query:              r.FormValue("q"),
+		Sender:             r.FormValue("sender"),
+		Recipient:          r.FormValue("recipient"),
+		HasAttachments:     formBool(r, "has_attachments"),
+		DateFrom:           r.FormValue("date_from"),
+		DateTo:             r.FormValue("date_to"),
+		CollapseDuplicates: formBool(r, "collapse_duplicates"),
+		Sensitive:          r.FormValue("sensitive"),
+		Link:               r.FormValue("link"),
+		Domain:             r.FormValue("domain"),
+		Auth:               r.FormValue("auth"),
+		DateUncertain:      formBool(r, "date_uncertain"),
+	}.WithQueryOperators()
+}
+
+// formBool reads a checkbox-style boolean parameter
+func formBool(r *http.Request, name string) bool {
+	v := r.FormValue(name)
+	return v == "true" || v == "1"
+}
+
+// filterValues encodes a filter set back into query parameters
+func filterValues(f db.SearchFilters) url.Values {
+	v := url.Values{}
+	if f.Query != "" {
+		v.Set("q", f.Query)
+	}
+	if f.Sender != "" {
+		v.Set("sender", f.Sender)
+	}
+	if f.Recipient != "" {
+		v.Set("recipient", f.Recipient)
+	}
+	if f.HasAttachments {
+		v.Set("has_attachments", "true")
+	}
+	if f.DateFrom != "" {
+		v.Set("date_from", f.DateFrom)
+	}
+	if f.DateTo != "" {
+		v.Set("date_to", f.DateTo)
+	}
+	if f.CollapseDuplicates {
+		v.Set("collapse_duplicates", "true")
+	}
+	if f.Sensitive != "" {
+		v.Set("sensitive", f.Sensitive)
+	}
+	if f.Link != "" {
+		v.Set("link", f.Link)
+	}
+	if f.Domain != "" {
+		v.Set("domain", f.Domain)
+	}
+	if f.Auth != "" {
+		v.Set("auth", f.Auth)
+	}
+	if f.DateUncertain {
+		v.Set("date_uncertain", "true")
+	}
+	return v
+}
+
+// searchURL builds a /search URL for the filter set at the given offset
+func searchURL(f db.SearchFilters, offset int) string {
+	v := filterValues(f)
+	v.Set("offset", strconv.Itoa(offset))
+	return "/search?" + v.Encode()
+}
+
 // Search handles search requests with filters
 func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	sender := r.URL.Query().Get("sender")
-	recipient := r.URL.Query().Get("recipient")
-	hasAttachmentsParam := r.URL.Query().Get("has_attachments")
-	dateFrom := r.URL.Query().Get("date_from")
-	dateTo := r.URL.Query().Get("date_to")
-	offsetParam := r.URL.Query().Get("offset")
+	filters := parseSearchFilters(r)
 
-	// Convert has_attachments to boolean
-	hasAttachments := hasAttachmentsParam == "true" || hasAttachmentsParam == "1"
+	// Links from other pages (e.g. analytics drill-downs) get the full page
+	if r.Header.Get("HX-Request") != "true" && !filters.IsEmpty() {
+		if err := filters.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.renderFilteredIndex(w, "Search - EML Viewer", filters, nil)
+		return
+	}
+	offsetParam := r.URL.Query().Get("offset")
 
 	// Parse offset
 	offset := 0
@@ -35,10 +114,15 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 	limit := 50
 
 	var results []*db.EmailSearchResult
+	var totalCount int
 	var err error
 
-	// If no search query and no filters, get recent emails
-	if query == "" && sender == "" && recipient == "" && !hasAttachments && dateFrom == "" && dateTo == "" {
+	// Searching every collection merges their results newest first
+	allCollections := r.FormValue("collections") == "all" && len(h.collectionNames()) > 1
+	if allCollections {
+		results, totalCount, err = h.searchAllCollections(filters, limit+1, offset)
+	} else if filters.IsEmpty() {
+		// If no search query and no filters, get recent emails
 		emails, err := h.db.ListEmails(limit+1, offset)
 		if err != nil {
 			log.Printf("Failed to list emails: %v", err)
@@ -55,7 +139,7 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	} else {
-		results, err = h.db.SearchEmailsWithFiltersAndOffset(query, sender, recipient, hasAttachments, dateFrom, dateTo, limit+1, offset)
+		results, err = h.db.SearchFiltered(filters, limit+1, offset)
 	}
 	if err != nil {
 		log.Printf("Search error: %v", err)
@@ -87,14 +171,16 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 
 	// Calculate total count for the counter
 	// If filters are applied, count only filtered results
-	var totalCount int
-	if query != "" || sender != "" || recipient != "" || hasAttachments || dateFrom != "" || dateTo != "" {
-		totalCount, err = h.db.CountFilteredEmails(query, sender, recipient, hasAttachments, dateFrom, dateTo)
+	switch {
+	case allCollections:
+		// Counted while searching
+	case !filters.IsEmpty():
+		totalCount, err = h.db.CountFiltered(filters)
 		if err != nil {
 			log.Printf("Failed to get filtered count: %v", err)
 			totalCount = 0
 		}
-	} else {
+	default:
 		// No filters, use total email count
 		totalCount, err = h.db.CountEmails()
 		if err != nil {
@@ -117,16 +203,10 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 
 	// Add "Load More" button if there are more results
 	if hasMore {
-		nextOffset := offset + limit
-
-		// Build the Load More URL - use /search endpoint to avoid full page reload
-		var loadMoreURL string
-		if query == "" && sender == "" && recipient == "" && !hasAttachments && dateFrom == "" && dateTo == "" {
-			// For no filters, still use /search but with empty params to get email-row fragments
-			loadMoreURL = fmt.Sprintf("/search?offset=%d", nextOffset)
-		} else {
-			loadMoreURL = fmt.Sprintf("/search?q=%s&sender=%s&recipient=%s&has_attachments=%s&date_from=%s&date_to=%s&offset=%d",
-				query, sender, recipient, hasAttachmentsParam, dateFrom, dateTo, nextOffset)
+		// Use /search endpoint to avoid full page reload
+		loadMoreURL := searchURL(filters, offset+limit)
+		if allCollections {
+			loadMoreURL += "&collections=all"
 		}
 
 		loadMoreBtn := fmt.Sprintf(`
@@ -142,7 +222,7 @@ func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
 					Load More
 				</button>
 			</div>
-		`, loadMoreURL, displayCount)
+		`, template.HTMLEscapeString(loadMoreURL), displayCount)
 		buf.WriteString(loadMoreBtn)
 	} else {
 		// No more results - remove the Load More button
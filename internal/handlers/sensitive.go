@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/pii"
+	"github.com/go-chi/chi/v5"
+)
+
+// sensitiveRow is one type of sensitive data on the report
+type sensitiveRow struct {
+	*db.PIITypeCount
+	Label string
+	URL   string
+}
+
+// piiFindingRow is one finding on the email page
+type piiFindingRow struct {
+	*db.PIIFinding
+	Label string
+}
+
+// apiPIITypeCount is the JSON representation of the findings of one type
+type apiPIITypeCount struct {
+	Type     string `json:"type"`
+	Emails   int    `json:"emails"`
+	Findings int    `json:"findings"`
+}
+
+// apiPIIFinding is the JSON representation of a finding in an email
+type apiPIIFinding struct {
+	Type               string `json:"type"`
+	Source             string `json:"source"`
+	AttachmentFilename string `json:"attachment_filename,omitempty"`
+	Start              int    `json:"start"`
+	End                int    `json:"end"`
+	Masked             string `json:"masked"`
+}
+
+// sensitiveRows labels report counts and links them to their emails
+func sensitiveRows(counts []*db.PIITypeCount, filters db.SearchFilters) []sensitiveRow {
+	rows := make([]sensitiveRow, len(counts))
+	for i, c := range counts {
+		f := filters
+		f.Sensitive = c.Type
+		rows[i] = sensitiveRow{
+			PIITypeCount: c,
+			Label:        pii.Type(c.Type).Label(),
+			URL:          drillDownURL(f),
+		}
+	}
+	return rows
+}
+
+// piiFindingRows labels an email's findings for display
+func piiFindingRows(findings []*db.PIIFinding) []piiFindingRow {
+	rows := make([]piiFindingRow, len(findings))
+	for i, f := range findings {
+		rows[i] = piiFindingRow{PIIFinding: f, Label: pii.Type(f.Type).Label()}
+	}
+	return rows
+}
+
+// SensitiveDataPage shows how many emails matching the filters contain each
+// kind of sensitive data
+func (h *Handlers) SensitiveDataPage(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.db.GetPIIReport(filters)
+	if err != nil {
+		log.Printf("Failed to load sensitive data report: %v", err)
+		http.Error(w, "Failed to load sensitive data report", http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	flagged := filters
+	flagged.Sensitive = db.SensitiveAny
+
+	data := map[string]interface{}{
+		"PageTitle":  "Sensitive Data - EML Viewer",
+		"Stats":      stats,
+		"Filters":    filters,
+		"Report":     report,
+		"Rows":       sensitiveRows(report.ByType, filters),
+		"FlaggedURL": drillDownURL(flagged),
+		"ScanPII":    h.cfg.ScanPII,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "sensitive.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
+
+// APISensitiveData returns the sensitive data report for a filter set as JSON
+func (h *Handlers) APISensitiveData(w http.ResponseWriter, r *http.Request) {
+	filters := parseSearchFilters(r)
+	if err := filters.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.db.GetPIIReport(filters)
+	if err != nil {
+		log.Printf("Failed to load sensitive data report: %v", err)
+		http.Error(w, "Failed to load sensitive data report", http.StatusInternalServerError)
+		return
+	}
+
+	byType := make([]apiPIITypeCount, len(report.ByType))
+	for i, c := range report.ByType {
+		byType[i] = apiPIITypeCount{Type: c.Type, Emails: c.Emails, Findings: c.Findings}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"total":     report.Total,
+		"unscanned": report.Unscanned,
+		"flagged":   report.Flagged,
+		"by_type":   byType,
+	})
+}
+
+// toAPIPIIFindings converts an email's findings for the JSON API
+func toAPIPIIFindings(findings []*db.PIIFinding) []apiPIIFinding {
+	out := make([]apiPIIFinding, len(findings))
+	for i, f := range findings {
+		out[i] = apiPIIFinding{
+			Type:               f.Type,
+			Source:             f.Source,
+			AttachmentFilename: f.AttachmentFilename,
+			Start:              f.Start,
+			End:                f.End,
+			Masked:             f.Masked,
+		}
+	}
+	return out
+}
+
+// APIEmailSensitiveData returns the sensitive data found in one email as JSON
+func (h *Handlers) APIEmailSensitiveData(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	email, err := h.db.GetEmailByID(id)
+	if err != nil {
+		log.Printf("Failed to load email %d: %v", id, err)
+		http.Error(w, "Failed to load email", http.StatusInternalServerError)
+		return
+	}
+	if email == nil {
+		http.Error(w, "Email not found", http.StatusNotFound)
+		return
+	}
+
+	findings, err := h.db.GetPIIFindings(id)
+	if err != nil {
+		log.Printf("Failed to load findings for email %d: %v", id, err)
+		http.Error(w, "Failed to load sensitive data", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, toAPIPIIFindings(findings))
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSensitiveDataHandlers tests the sensitive data report page and APIs
+func TestSensitiveDataHandlers(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	emails := db.InsertTestEmails(t, database, []*db.Email{
+		db.CreateTestEmail("Card", "alice@acme.com", "a"),
+		db.CreateTestEmail("Clean", "bob@acme.com", "b"),
+	})
+	require.NoError(t, database.SavePIIFindings(emails[0].ID, []*db.PIIFinding{
+		{Type: "credit_card", Source: db.PIISourceBody, Start: 5, End: 24, Masked: "**** **** **** 1111"},
+	}))
+
+	w := httptest.NewRecorder()
+	h.SensitiveDataPage(w, httptest.NewRequest("GET", "/sensitive", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Credit card")
+	assert.Contains(t, w.Body.String(), "/search?sensitive=credit_card")
+
+	w = httptest.NewRecorder()
+	h.SensitiveDataPage(w, httptest.NewRequest("GET", "/sensitive?sensitive=bogus", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.APISensitiveData(w, httptest.NewRequest("GET", "/api/sensitive", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var report struct {
+		Total     int               `json:"total"`
+		Unscanned int               `json:"unscanned"`
+		Flagged   int               `json:"flagged"`
+		ByType    []apiPIITypeCount `json:"by_type"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.Unscanned)
+	assert.Equal(t, 1, report.Flagged)
+	assert.Equal(t, []apiPIITypeCount{{Type: "credit_card", Emails: 1, Findings: 1}}, report.ByType)
+
+	id := strconv.FormatInt(emails[0].ID, 10)
+	w = httptest.NewRecorder()
+	h.APIEmailSensitiveData(w, withURLParam(httptest.NewRequest("GET", "/api/emails/"+id+"/sensitive", nil), "id", id))
+	require.Equal(t, http.StatusOK, w.Code)
+	var findings []apiPIIFinding
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &findings))
+	require.Len(t, findings, 1)
+	assert.Equal(t, "**** **** **** 1111", findings[0].Masked)
+
+	w = httptest.NewRecorder()
+	h.APIEmailSensitiveData(w, withURLParam(httptest.NewRequest("GET", "/api/emails/999/sensitive", nil), "id", "999"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The search page keeps the filter selected
+	w = httptest.NewRecorder()
+	h.Search(w, httptest.NewRequest("GET", "/search?sensitive=credit_card", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `value="credit_card" selected`)
+	assert.Contains(t, w.Body.String(), "Card")
+	assert.NotContains(t, w.Body.String(), "Clean")
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// similarEmailsLimit is the number of similar emails shown on an email page
+	similarEmailsLimit = 10
+	// similarClustersPerPage is the number of clusters shown per report page
+	similarClustersPerPage = 50
+)
+
+// similarityThreshold returns the ?threshold= parameter if it is a valid
+// fraction (0-1] or percentage (1-100], otherwise the configured default
+func (h *Handlers) similarityThreshold(r *http.Request) float64 {
+	t, err := strconv.ParseFloat(r.URL.Query().Get("threshold"), 64)
+	if err != nil || t <= 0 || t > 100 {
+		return h.cfg.SimilarityThreshold
+	}
+	if t > 1 {
+		t /= 100
+	}
+	return t
+}
+
+// SimilarEmails renders the panel of emails with near-identical bodies (HTMX fragment)
+func (h *Handlers) SimilarEmails(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid email ID", http.StatusBadRequest)
+		return
+	}
+
+	threshold := h.similarityThreshold(r)
+	similar, err := h.db.FindSimilarEmails(id, threshold, similarEmailsLimit)
+	if err != nil {
+		log.Printf("Failed to find emails similar to %d: %v", id, err)
+		http.Error(w, "Failed to load similar emails", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Similar":   similar,
+		"Threshold": threshold,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "similar-emails", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render similar emails", http.StatusInternalServerError)
+	}
+}
+
+// SimilarPage shows clusters of near-duplicate emails at a chosen similarity threshold
+func (h *Handlers) SimilarPage(w http.ResponseWriter, r *http.Request) {
+	threshold := h.similarityThreshold(r)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	clusters, total, err := h.db.NearDuplicateClusters(threshold, similarClustersPerPage, offset)
+	if err != nil {
+		log.Printf("Failed to cluster similar emails: %v", err)
+		http.Error(w, "Failed to load similar emails", http.StatusInternalServerError)
+		return
+	}
+
+	prevOffset := offset - similarClustersPerPage
+	if prevOffset < 0 {
+		prevOffset = 0
+	}
+
+	stats, err := h.db.GetStats()
+	if err != nil {
+		log.Printf("Failed to get stats: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"PageTitle":  "Similar Emails - EML Viewer",
+		"Stats":      stats,
+		"Clusters":   clusters,
+		"Threshold":  threshold,
+		"Percent":    int(threshold*100 + 0.5),
+		"Offset":     offset,
+		"Total":      total,
+		"PrevOffset": prevOffset,
+		"NextOffset": offset + similarClustersPerPage,
+		"HasMore":    offset+similarClustersPerPage < total,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, "similar.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/similarity"
+	"github.com/stretchr/testify/assert"
+)
+
+// insertSignedEmail inserts a test email with a MinHash signature of its body
+func insertSignedEmail(t *testing.T, database *db.DB, subject, body string) int64 {
+	t.Helper()
+
+	email := db.CreateTestEmail(subject, "alice@test.com", body)
+	sig, _ := similarity.Compute(body)
+	email.MinHash = sig.Encode()
+	return db.InsertTestEmails(t, database, []*db.Email{email})[0].ID
+}
+
+// TestSimilarHandlers tests the similar emails panel and clustering report
+func TestSimilarHandlers(t *testing.T) {
+	h, database := setupTestHandlers(t)
+	defer db.CleanupTestDB(t, database)
+
+	body := "The shipment of replacement parts left the warehouse this morning and should arrive at the plant on Tuesday."
+	id := insertSignedEmail(t, database, "Shipment update", body)
+	insertSignedEmail(t, database, "Re-sent: Shipment update", body+" Regards.")
+
+	req := withURLParam(httptest.NewRequest("GET", fmt.Sprintf("/email/%d/similar", id), nil), "id", fmt.Sprint(id))
+	w := httptest.NewRecorder()
+	h.SimilarEmails(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Re-sent: Shipment update")
+
+	w = httptest.NewRecorder()
+	h.SimilarPage(w, httptest.NewRequest("GET", "/similar?threshold=70", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "1 clusters")
+	assert.Contains(t, w.Body.String(), `value="70"`)
+
+	w = httptest.NewRecorder()
+	h.SimilarPage(w, httptest.NewRequest("GET", "/similar?threshold=bogus", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `value="80"`, "Invalid thresholds fall back to the configured default")
+}
@@ -0,0 +1,332 @@
+package imapimport
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commandTimeout bounds how long the server may take to answer a command
+const commandTimeout = 5 * time.Minute
+
+// maxLiteral bounds a literal kept in memory, so a hostile server cannot
+// exhaust it; spooled literals go to disk instead
+const maxLiteral = 256 << 20
+
+// client is a minimal IMAP4rev1 client: enough to log in, list and
+// examine mailboxes, search UIDs and fetch messages
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	tags int
+
+	// spoolDir, when set, makes readResponse write literals to temporary
+	// files in it instead of keeping them in memory. Each file is added to
+	// spooled; callers rename or remove them.
+	spoolDir string
+	spooled  []string
+}
+
+// response is an untagged server response. Each literal is left in text
+// as its {n} size marker and its contents are kept in literals, in order.
+type response struct {
+	text     string
+	literals []literalData
+}
+
+// literalData is a literal read from the server: its bytes, or the
+// temporary file they were spooled to
+type literalData struct {
+	data []byte
+	file string
+}
+
+// literal is a command argument sent as an IMAP literal
+type literal string
+
+// dial connects to a server, over TLS when tlsConfig is set, and reads its
+// greeting
+func dial(addr string, tlsConfig *tls.Config) (*client, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	c := &client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	conn.SetDeadline(time.Now().Add(commandTimeout))
+	greeting, err := c.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read server greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.text, "* OK") && !strings.HasPrefix(greeting.text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("server refused connection: %s", greeting.text)
+	}
+	return c, nil
+}
+
+// close logs out and disconnects
+func (c *client) close() error {
+	c.execute("LOGOUT")
+	return c.conn.Close()
+}
+
+// execute sends a command made of args, which are written as they are
+// except literals, and returns its untagged responses. It fails unless the
+// server answers OK.
+func (c *client) execute(args ...interface{}) ([]*response, error) {
+	c.tags++
+	tag := fmt.Sprintf("T%d", c.tags)
+	c.conn.SetDeadline(time.Now().Add(commandTimeout))
+
+	c.w.WriteString(tag)
+	var untagged []*response
+	for _, arg := range args {
+		c.w.WriteByte(' ')
+		switch arg := arg.(type) {
+		case literal:
+			// Wait for the server to ask for the literal's bytes
+			fmt.Fprintf(c.w, "{%d}\r\n", len(arg))
+			if err := c.w.Flush(); err != nil {
+				return nil, err
+			}
+			for {
+				resp, err := c.readResponse()
+				if err != nil {
+					return nil, err
+				}
+				if strings.HasPrefix(resp.text, "+") {
+					break
+				}
+				if strings.HasPrefix(resp.text, tag+" ") {
+					return nil, fmt.Errorf("server rejected command: %s", strings.TrimPrefix(resp.text, tag+" "))
+				}
+				untagged = append(untagged, resp)
+			}
+			c.w.WriteString(string(arg))
+		default:
+			fmt.Fprint(c.w, arg)
+		}
+	}
+	c.w.WriteString("\r\n")
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(resp.text, tag+" ") {
+			untagged = append(untagged, resp)
+			continue
+		}
+		status := strings.TrimPrefix(resp.text, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return untagged, fmt.Errorf("server answered %s", status)
+		}
+		return untagged, nil
+	}
+}
+
+// literalMarker matches a line ending in a literal's size
+var literalMarker = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readResponse reads a response line with its literals
+func (c *client) readResponse() (*response, error) {
+	resp := &response{}
+	var sb strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		sb.WriteString(line)
+
+		m := literalMarker.FindStringSubmatch(line)
+		if m == nil {
+			resp.text = sb.String()
+			return resp, nil
+		}
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid literal: %s", m[0])
+		}
+		if c.spoolDir != "" {
+			file, err := c.spool(n)
+			if err != nil {
+				return nil, err
+			}
+			resp.literals = append(resp.literals, literalData{file: file})
+			continue
+		}
+		if n > maxLiteral {
+			return nil, fmt.Errorf("literal too large: %s", m[0])
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		resp.literals = append(resp.literals, literalData{data: data})
+	}
+}
+
+// spool copies a literal of n bytes to a new temporary file in spoolDir
+// and returns its path
+func (c *client) spool(n int64) (string, error) {
+	f, err := os.CreateTemp(c.spoolDir, "fetch-*.part")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	c.spooled = append(c.spooled, f.Name())
+
+	// A large message may take longer than a command to arrive
+	c.conn.SetDeadline(time.Now().Add(commandTimeout))
+	_, err = io.CopyN(f, c.r, n)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write file: %w", closeErr)
+	}
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// astring formats s as a command argument: quoted, or a literal when it
+// cannot be quoted
+func astring(s string) interface{} {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f {
+			return literal(s)
+		}
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// field is a parsed part of a response: an atom, a string or a list
+type field struct {
+	atom   string
+	str    []byte // Set for quoted strings and literals
+	file   string // Set instead of str for a spooled literal
+	isStr  bool
+	list   []field
+	isList bool
+}
+
+// value returns an atom or string's text
+func (f field) value() string {
+	if f.isStr {
+		return string(f.str)
+	}
+	return f.atom
+}
+
+// fields parses a response's text, after skip bytes, into fields
+func (r *response) fields(skip int) ([]field, error) {
+	p := &fieldParser{text: r.text, pos: skip, literals: r.literals}
+	return p.parse(0)
+}
+
+// fieldParser reads fields from a response
+type fieldParser struct {
+	text     string
+	pos      int
+	literals []literalData
+	next     int // Index of the next unread literal
+}
+
+func (p *fieldParser) parse(depth int) ([]field, error) {
+	var fields []field
+	for {
+		for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+			p.pos++
+		}
+		if p.pos >= len(p.text) {
+			if depth > 0 {
+				return nil, errors.New("unterminated list in response")
+			}
+			return fields, nil
+		}
+
+		switch p.text[p.pos] {
+		case '(':
+			p.pos++
+			list, err := p.parse(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{list: list, isList: true})
+		case ')':
+			if depth == 0 {
+				return nil, errors.New("unexpected ) in response")
+			}
+			p.pos++
+			return fields, nil
+		case '"':
+			var sb strings.Builder
+			closed := false
+			for p.pos++; p.pos < len(p.text) && !closed; p.pos++ {
+				switch c := p.text[p.pos]; c {
+				case '\\':
+					p.pos++
+					if p.pos < len(p.text) {
+						sb.WriteByte(p.text[p.pos])
+					}
+				case '"':
+					closed = true
+				default:
+					sb.WriteByte(c)
+				}
+			}
+			if !closed {
+				return nil, errors.New("unterminated string in response")
+			}
+			fields = append(fields, field{str: []byte(sb.String()), isStr: true})
+		case '{':
+			end := strings.IndexByte(p.text[p.pos:], '}')
+			if end < 0 || p.next >= len(p.literals) {
+				return nil, errors.New("bad literal in response")
+			}
+			p.pos += end + 1
+			lit := p.literals[p.next]
+			fields = append(fields, field{str: lit.data, file: lit.file, isStr: true})
+			p.next++
+		default:
+			start := p.pos
+			for p.pos < len(p.text) {
+				c := p.text[p.pos]
+				if c == '[' {
+					if end := strings.IndexByte(p.text[p.pos:], ']'); end >= 0 {
+						p.pos += end + 1
+						continue
+					}
+				}
+				if c == ' ' || c == '(' || c == ')' {
+					break
+				}
+				p.pos++
+			}
+			fields = append(fields, field{atom: p.text[start:p.pos]})
+		}
+	}
+}
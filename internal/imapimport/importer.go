@@ -0,0 +1,525 @@
+// Package imapimport downloads folders from an IMAP account into the emails
+// folder as .eml files. Each run resumes after the last UID it saved, and
+// skips messages already imported or already in the archive.
+package imapimport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/imaputf7"
+)
+
+// RootFolder is the folder under the emails folder that imports go into,
+// one subfolder per account
+const RootFolder = "imap"
+
+// stateSettingPrefix stores each folder's UIDVALIDITY and last imported UID
+const stateSettingPrefix = "imap_import:"
+
+// batchSize is how many messages are fetched per command, and how often
+// progress is saved
+const batchSize = 50
+
+// Options chooses the account and folders to import
+type Options struct {
+	Addr               string // Server host:port
+	TLS                bool   // Connect over TLS, as on port 993
+	InsecureSkipVerify bool   // Accept any TLS certificate
+	User               string
+	Password           string
+	Folders            []string // Folder names; empty imports every folder
+}
+
+// Result summarizes an import
+type Result struct {
+	Folders    int
+	Downloaded int
+	Skipped    int      // Already imported, or copies of an email already in the archive
+	Files      []string // New .eml files, relative to the emails folder
+}
+
+// Importer copies IMAP folders into a collection's emails folder
+type Importer struct {
+	db         *db.DB
+	emailsPath string
+	opts       Options
+	seen       map[string]bool // Message-IDs chosen for download during this run
+}
+
+// New creates an importer writing into emailsPath and keeping its state in
+// database
+func New(database *db.DB, emailsPath string, opts Options) *Importer {
+	return &Importer{db: database, emailsPath: emailsPath, opts: opts, seen: make(map[string]bool)}
+}
+
+// folderState is what an import remembers about a folder between runs
+type folderState struct {
+	UIDValidity uint32 `json:"uidvalidity"`
+	LastUID     uint32 `json:"last_uid"`
+}
+
+// mailbox is a folder on the server
+type mailbox struct {
+	name    string // Decoded UTF-8 name
+	encoded string // Name as the server sent it
+	delim   string // Hierarchy delimiter, empty if the server has none
+}
+
+// Run imports the chosen folders. Cancelling ctx stops it between
+// messages; the next run picks up where it left off.
+func (im *Importer) Run(ctx context.Context) (*Result, error) {
+	var tlsConfig *tls.Config
+	if im.opts.TLS {
+		host, _, err := net.SplitHostPort(im.opts.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server address: %w", err)
+		}
+		tlsConfig = &tls.Config{ServerName: host, InsecureSkipVerify: im.opts.InsecureSkipVerify}
+	}
+	c, err := dial(im.opts.Addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	defer stop()
+
+	if _, err := c.execute("LOGIN", astring(im.opts.User), astring(im.opts.Password)); err != nil {
+		return nil, fmt.Errorf("failed to log in: %w", err)
+	}
+
+	folders, err := im.chooseFolders(c)
+	if err != nil {
+		return nil, im.cancelled(ctx, err)
+	}
+
+	result := &Result{}
+	for _, m := range folders {
+		if err := im.importFolder(ctx, c, m, result); err != nil {
+			return result, im.cancelled(ctx, fmt.Errorf("failed to import %s: %w", m.name, err))
+		}
+		result.Folders++
+	}
+	return result, nil
+}
+
+// cancelled reports cancellation rather than the error closing the
+// connection caused
+func (im *Importer) cancelled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// chooseFolders lists the server's folders and picks those to import
+func (im *Importer) chooseFolders(c *client) ([]*mailbox, error) {
+	responses, err := c.execute("LIST", `""`, `"*"`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	var all []*mailbox
+	for _, resp := range responses {
+		if !strings.HasPrefix(strings.ToUpper(resp.text), "* LIST ") {
+			continue
+		}
+		fields, err := resp.fields(len("* LIST "))
+		if err != nil || len(fields) != 3 || !fields[0].isList {
+			return nil, fmt.Errorf("invalid LIST response: %s", resp.text)
+		}
+		selectable := true
+		for _, attr := range fields[0].list {
+			if a := strings.ToLower(attr.atom); a == `\noselect` || a == `\nonexistent` {
+				selectable = false
+			}
+		}
+		if !selectable {
+			continue
+		}
+		m := &mailbox{encoded: fields[2].value()}
+		if !strings.EqualFold(fields[1].atom, "NIL") {
+			m.delim = fields[1].value()
+		}
+		if m.name, err = imaputf7.Decode(m.encoded); err != nil {
+			m.name = m.encoded
+		}
+		all = append(all, m)
+	}
+	if len(im.opts.Folders) == 0 {
+		return all, nil
+	}
+
+	var chosen []*mailbox
+	for _, want := range im.opts.Folders {
+		var found *mailbox
+		for _, m := range all {
+			if m.name == want || (strings.EqualFold(want, "INBOX") && strings.EqualFold(m.name, "INBOX")) {
+				found = m
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("folder %q not found on the server", want)
+		}
+		chosen = append(chosen, found)
+	}
+	return chosen, nil
+}
+
+// uidValidityCode matches the UIDVALIDITY response code of EXAMINE
+var uidValidityCode = regexp.MustCompile(`(?i)\[UIDVALIDITY (\d+)\]`)
+
+// importFolder downloads a folder's messages newer than its saved state
+func (im *Importer) importFolder(ctx context.Context, c *client, m *mailbox, result *Result) error {
+	responses, err := c.execute("EXAMINE", astring(m.encoded))
+	if err != nil {
+		return err
+	}
+	var validity uint32
+	for _, resp := range responses {
+		if match := uidValidityCode.FindStringSubmatch(resp.text); match != nil {
+			n, _ := strconv.ParseUint(match[1], 10, 32)
+			validity = uint32(n)
+		}
+	}
+
+	state, err := im.loadState(m)
+	if err != nil {
+		return err
+	}
+	dir := im.folderPath(m)
+	if state.UIDValidity != validity {
+		// UIDs from an earlier validity mean nothing now; files already
+		// downloaded are still skipped by Message-ID, including those not
+		// indexed yet
+		state = folderState{UIDValidity: validity}
+		if err := im.markDownloaded(dir); err != nil {
+			return err
+		}
+	}
+
+	uids, err := searchUIDs(c, state.LastUID)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(uids); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch := uids[start:min(start+batchSize, len(uids))]
+		if err := im.importBatch(c, dir, validity, batch, result); err != nil {
+			return err
+		}
+		state.LastUID = batch[len(batch)-1]
+		if err := im.saveState(m, state); err != nil {
+			return err
+		}
+	}
+	return im.saveState(m, state)
+}
+
+// markDownloaded adds the Message-IDs of the .eml files already in a
+// folder, relative to the emails folder, to those skipped by this run
+func (im *Importer) markDownloaded(dir string) error {
+	entries, err := os.ReadDir(filepath.Join(im.emailsPath, filepath.FromSlash(dir)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read folder: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".eml") {
+			continue
+		}
+		if messageID := readMessageID(filepath.Join(im.emailsPath, filepath.FromSlash(dir), entry.Name())); messageID != "" {
+			im.seen[messageID] = true
+		}
+	}
+	return nil
+}
+
+// readMessageID returns the Message-ID of an .eml file, or "" if it has
+// none or cannot be read
+func readMessageID(fullPath string) string {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(msg.Header.Get("Message-Id"))
+}
+
+// searchUIDs lists the folder's UIDs above last, in order
+func searchUIDs(c *client, last uint32) ([]uint32, error) {
+	responses, err := c.execute("UID SEARCH", fmt.Sprintf("UID %d:*", last+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search folder: %w", err)
+	}
+	var uids []uint32
+	for _, resp := range responses {
+		if !strings.HasPrefix(strings.ToUpper(resp.text), "* SEARCH") {
+			continue
+		}
+		for _, s := range strings.Fields(resp.text[len("* SEARCH"):]) {
+			// n:* always matches the last message, even below n
+			if n, err := strconv.ParseUint(s, 10, 32); err == nil && uint32(n) > last {
+				uids = append(uids, uint32(n))
+			}
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// importBatch downloads the messages in a batch of UIDs that are not yet in
+// the archive
+func (im *Importer) importBatch(c *client, dir string, validity uint32, uids []uint32, result *Result) error {
+	// Message-IDs come first, so copies are skipped without downloading them
+	headers, err := fetch(c, uids, "BODY.PEEK[HEADER.FIELDS (MESSAGE-ID)]")
+	if err != nil {
+		return err
+	}
+
+	var wanted []uint32
+	for _, uid := range uids {
+		if _, err := os.Stat(filepath.Join(im.emailsPath, filepath.FromSlash(fileName(dir, validity, uid)))); err == nil {
+			result.Skipped++
+			continue
+		}
+		messageID := parseMessageID(headers[uid])
+		if messageID != "" {
+			exists, err := im.db.MessageIDExists(messageID)
+			if err != nil {
+				return err
+			}
+			if exists || im.seen[messageID] {
+				result.Skipped++
+				continue
+			}
+			im.seen[messageID] = true
+		}
+		wanted = append(wanted, uid)
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	// Each message goes to disk as it arrives, then takes its name once the
+	// command has succeeded, so an interrupted import never leaves a partial
+	// .eml behind
+	fullDir := filepath.Join(im.emailsPath, filepath.FromSlash(dir))
+	if err := os.MkdirAll(fullDir, 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	files, err := fetchFiles(c, wanted, "BODY.PEEK[]", fullDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, tmp := range files {
+			os.Remove(tmp)
+		}
+	}()
+	for _, uid := range wanted {
+		tmp, ok := files[uid]
+		if !ok {
+			// Deleted on the server since the search
+			continue
+		}
+		rel := fileName(dir, validity, uid)
+		if err := os.Rename(tmp, filepath.Join(im.emailsPath, filepath.FromSlash(rel))); err != nil {
+			return fmt.Errorf("failed to write email: %w", err)
+		}
+		delete(files, uid)
+		result.Downloaded++
+		result.Files = append(result.Files, rel)
+	}
+	return nil
+}
+
+// fetch runs UID FETCH for a data item and returns each message's value
+func fetch(c *client, uids []uint32, item string) (map[uint32][]byte, error) {
+	fields, err := fetchFields(c, uids, item)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[uint32][]byte, len(fields))
+	for uid, f := range fields {
+		values[uid] = f.str
+	}
+	return values, nil
+}
+
+// fetchFiles runs UID FETCH for a data item as fetch does, but writes each
+// message's value to a temporary file in dir as it arrives. It returns the
+// files by UID; the caller renames or removes them.
+func fetchFiles(c *client, uids []uint32, item, dir string) (map[uint32]string, error) {
+	c.spoolDir, c.spooled = dir, nil
+	defer func() { c.spoolDir, c.spooled = "", nil }()
+
+	fields, err := fetchFields(c, uids, item)
+	files := make(map[uint32]string, len(fields))
+	if err == nil {
+		for uid, f := range fields {
+			if f.file != "" {
+				files[uid] = f.file
+			}
+		}
+	}
+
+	// Remove what will not be returned: everything on failure, and any
+	// value the server sent twice
+	claimed := make(map[string]bool, len(files))
+	for _, file := range files {
+		claimed[file] = true
+	}
+	for _, file := range c.spooled {
+		if !claimed[file] {
+			os.Remove(file)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// fetchFields runs UID FETCH for a data item and returns each message's
+// value as a parsed field
+func fetchFields(c *client, uids []uint32, item string) (map[uint32]field, error) {
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	responses, err := c.execute("UID FETCH", strings.Join(set, ","), "(UID "+item+")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+
+	values := make(map[uint32]field)
+	for _, resp := range responses {
+		start := strings.Index(strings.ToUpper(resp.text), " FETCH ")
+		if !strings.HasPrefix(resp.text, "* ") || start < 0 {
+			continue
+		}
+		fields, err := resp.fields(start + len(" FETCH "))
+		if err != nil || len(fields) != 1 || !fields[0].isList {
+			return nil, fmt.Errorf("invalid FETCH response: %s", resp.text)
+		}
+		var uid uint32
+		var value field
+		items := fields[0].list
+		for i := 0; i+1 < len(items); i += 2 {
+			name := strings.ToUpper(items[i].atom)
+			switch {
+			case name == "UID":
+				n, _ := strconv.ParseUint(items[i+1].atom, 10, 32)
+				uid = uint32(n)
+			case strings.HasPrefix(name, "BODY["):
+				value = items[i+1]
+			}
+		}
+		if uid != 0 {
+			values[uid] = value
+		}
+	}
+	return values, nil
+}
+
+// parseMessageID returns a message's Message-ID, or "" if it has none
+func parseMessageID(raw []byte) string {
+	if !bytes.Contains(raw, []byte("\n\n")) && !bytes.Contains(raw, []byte("\n\r\n")) {
+		raw = append(append([]byte{}, raw...), "\r\n\r\n"...)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(msg.Header.Get("Message-Id"))
+}
+
+// fileName is a message's path relative to the emails folder
+func fileName(dir string, validity, uid uint32) string {
+	return path.Join(dir, fmt.Sprintf("%d-%d.eml", validity, uid))
+}
+
+// folderPath is the folder a mailbox's messages go into, relative to the
+// emails folder, such as imap/me@example.com/Archive/2024
+func (im *Importer) folderPath(m *mailbox) string {
+	host, _, err := net.SplitHostPort(im.opts.Addr)
+	if err != nil {
+		host = im.opts.Addr
+	}
+	segments := []string{m.name}
+	if m.delim != "" {
+		segments = strings.Split(m.name, m.delim)
+	}
+
+	parts := []string{RootFolder, safeName(im.opts.User + "@" + host)}
+	for _, s := range segments {
+		parts = append(parts, safeName(s))
+	}
+	return path.Join(parts...)
+}
+
+// unsafeChars are those not allowed in file names on some systems
+var unsafeChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
+// safeName makes a folder name usable as a file name everywhere
+func safeName(name string) string {
+	name = strings.TrimRight(unsafeChars.ReplaceAllString(name, "_"), ". ")
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// stateKey names the setting holding a folder's state
+func (im *Importer) stateKey(m *mailbox) string {
+	return stateSettingPrefix + im.opts.User + "@" + im.opts.Addr + "/" + m.name
+}
+
+// loadState returns a folder's saved state, or a zero state if it was
+// never imported
+func (im *Importer) loadState(m *mailbox) (folderState, error) {
+	var state folderState
+	value, err := im.db.GetSetting(im.stateKey(m))
+	if err != nil || value == "" {
+		return state, err
+	}
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return folderState{}, errors.New("invalid saved import state for " + m.name)
+	}
+	return state, nil
+}
+
+// saveState records how far a folder has been imported
+func (im *Importer) saveState(m *mailbox, state folderState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return im.db.SetSetting(im.stateKey(m), string(data))
+}
@@ -0,0 +1,229 @@
+package imapimport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/imapserver"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupArchive indexes emails in a new collection
+func setupArchive(t *testing.T, files map[string]string) (*db.DB, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	database := db.SetupTestDB(t)
+	database.SetEmailsPath(dir)
+	t.Cleanup(func() { db.CleanupTestDB(t, database) })
+
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	_, err := indexer.NewIndexer(database, dir, false).IndexAll()
+	require.NoError(t, err)
+	return database, dir
+}
+
+// email builds a message with a Message-ID
+func email(id, subject string) string {
+	return fmt.Sprintf("From: alice@test.com\r\nMessage-ID: <%s@test.com>\r\nSubject: %s\r\n\r\n%s body\r\n", id, subject, subject)
+}
+
+// serveArchive serves a collection over IMAP as the account to import from
+func serveArchive(t *testing.T, database *db.DB) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := imapserver.New([]imapserver.Source{{Name: "remote", DB: database}}, true, "secret")
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+// listFiles lists the .eml files under dir, relative and sorted
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ".eml") {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// indexAll indexes every new file in a collection, as the import command does
+func indexAll(t *testing.T, database *db.DB, dir string) {
+	t.Helper()
+	_, err := indexer.NewIndexer(database, dir, false).IndexAll()
+	require.NoError(t, err)
+}
+
+// TestImport tests downloading a folder, resuming and picking up new emails
+func TestImport(t *testing.T) {
+	remote, remoteDir := setupArchive(t, map[string]string{
+		"one.eml":        email("one", "One"),
+		"work/two.eml":   email("two", "Two"),
+		"work/three.eml": email("three", "Three"),
+	})
+	addr := serveArchive(t, remote)
+	local, localDir := setupArchive(t, nil)
+	opts := Options{Addr: addr, User: "me", Password: "secret", Folders: []string{"Folders/work"}}
+
+	result, err := New(local, localDir, opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Folders)
+	assert.Equal(t, 2, result.Downloaded)
+	assert.Equal(t, listFiles(t, localDir), result.Files)
+
+	host, _, _ := net.SplitHostPort(addr)
+	for _, f := range result.Files {
+		assert.Regexp(t, `^imap/me@`+host+`/Folders/work/\d+-\d+\.eml$`, f)
+	}
+	var contents []string
+	for _, f := range result.Files {
+		data, err := os.ReadFile(filepath.Join(localDir, filepath.FromSlash(f)))
+		require.NoError(t, err)
+		contents = append(contents, string(data))
+	}
+	assert.Contains(t, contents, email("two", "Two"))
+	parts, err := filepath.Glob(filepath.Join(localDir, filepath.FromSlash(path.Dir(result.Files[0])), "*.part"))
+	require.NoError(t, err)
+	assert.Empty(t, parts, "Downloads are renamed or removed")
+
+	// A second run resumes after the last UID and downloads nothing
+	result, err = New(local, localDir, opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Downloaded)
+	assert.Equal(t, 0, result.Skipped, "nothing is newer than the saved UID")
+
+	// New emails on the server are picked up
+	require.NoError(t, os.WriteFile(filepath.Join(remoteDir, "work", "four.eml"), []byte(email("four", "Four")), 0644))
+	indexAll(t, remote, remoteDir)
+	result, err = New(local, localDir, opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Downloaded)
+	assert.Len(t, listFiles(t, localDir), 3)
+}
+
+// TestImportSkipsKnownMessages tests that emails already in the archive are
+// not downloaded again, from another folder or after UIDVALIDITY changes
+func TestImportSkipsKnownMessages(t *testing.T) {
+	remote, _ := setupArchive(t, map[string]string{
+		"one.eml":      email("one", "One"),
+		"work/two.eml": email("two", "Two"),
+		"work/dup.eml": email("one", "Copy of one"),
+	})
+	addr := serveArchive(t, remote)
+	local, localDir := setupArchive(t, map[string]string{"mine.eml": email("two", "Mine")})
+
+	// Two is already in the local archive; one and its copy are downloaded once
+	result, err := New(local, localDir, Options{Addr: addr, User: "me", Password: "secret"}).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Folders, "INBOX and Folders/work")
+	assert.Equal(t, 1, result.Downloaded)
+	assert.Equal(t, 4, result.Skipped)
+	indexAll(t, local, localDir)
+
+	// A new UIDVALIDITY restarts the folder, but known Message-IDs are skipped
+	require.NoError(t, remote.SetSetting("imap_uidvalidity", "42"))
+	result, err = New(local, localDir, Options{Addr: addr, User: "me", Password: "secret", Folders: []string{"INBOX"}}).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Downloaded)
+	assert.Equal(t, 3, result.Skipped)
+}
+
+// TestImportSkipsUnindexedDownloads tests that files downloaded but not yet
+// indexed are not downloaded again after UIDVALIDITY changes
+func TestImportSkipsUnindexedDownloads(t *testing.T) {
+	remote, _ := setupArchive(t, map[string]string{
+		"one.eml": email("one", "One"),
+		"two.eml": email("two", "Two"),
+	})
+	addr := serveArchive(t, remote)
+	local, localDir := setupArchive(t, nil)
+	opts := Options{Addr: addr, User: "me", Password: "secret", Folders: []string{"INBOX"}}
+
+	result, err := New(local, localDir, opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Downloaded)
+
+	require.NoError(t, remote.SetSetting("imap_uidvalidity", "42"))
+	result, err = New(local, localDir, opts).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Downloaded)
+	assert.Equal(t, 2, result.Skipped)
+	assert.Len(t, listFiles(t, localDir), 2)
+}
+
+// TestImportErrors tests failed logins and unknown folders
+func TestImportErrors(t *testing.T) {
+	remote, _ := setupArchive(t, map[string]string{"one.eml": email("one", "One")})
+	addr := serveArchive(t, remote)
+	local, localDir := setupArchive(t, nil)
+
+	_, err := New(local, localDir, Options{Addr: addr, User: "me", Password: "wrong"}).Run(context.Background())
+	assert.ErrorContains(t, err, "failed to log in")
+
+	_, err = New(local, localDir, Options{Addr: addr, User: "me", Password: "secret", Folders: []string{"Nope"}}).Run(context.Background())
+	assert.ErrorContains(t, err, `folder "Nope" not found`)
+	assert.Empty(t, listFiles(t, localDir))
+}
+
+// TestSafeName tests that folder names become portable file names
+func TestSafeName(t *testing.T) {
+	assert.Equal(t, "Re_ Fwd_ _a_b_", safeName(`Re: Fwd: "a|b"`))
+	assert.Equal(t, "_", safeName(".."))
+	assert.Equal(t, "Archive", safeName("Archive. "))
+}
+
+// TestFetchFiles tests that fetched messages are written straight to files,
+// and that nothing is left behind when the fetch fails
+func TestFetchFiles(t *testing.T) {
+	fetchFrom := func(t *testing.T, answer string) (map[uint32]string, string, error) {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go func() {
+			defer serverConn.Close()
+			bufio.NewReader(serverConn).ReadString('\n')
+			serverConn.Write([]byte(answer))
+		}()
+
+		dir := t.TempDir()
+		c := &client{conn: clientConn, r: bufio.NewReader(clientConn), w: bufio.NewWriter(clientConn)}
+		files, err := fetchFiles(c, []uint32{5}, "BODY.PEEK[]", dir)
+		return files, dir, err
+	}
+
+	files, dir, err := fetchFrom(t, "* 1 FETCH (UID 5 BODY[] {5}\r\nhello)\r\nT1 OK done\r\n")
+	require.NoError(t, err)
+	require.Contains(t, files, uint32(5))
+	assert.Equal(t, dir, filepath.Dir(files[5]))
+	data, err := os.ReadFile(files[5])
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, dir, err = fetchFrom(t, "* 1 FETCH (UID 5 BODY[] {5}\r\nhello)\r\nT1 NO failed\r\n")
+	assert.ErrorContains(t, err, "failed to fetch messages")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
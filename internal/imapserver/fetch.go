@@ -0,0 +1,439 @@
+package imapserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// internalDateLayout is the date-time format of INTERNALDATE
+const internalDateLayout = "02-Jan-2006 15:04:05 -0700"
+
+// message is an email read from its .eml file
+type message struct {
+	id   int64
+	raw  []byte // With CRLF line endings, as IMAP requires
+	root *part
+}
+
+// fetchItem is one data item a FETCH asks for
+type fetchItem struct {
+	name    string   // Upper-cased item, such as ENVELOPE, or BODY[] for sections
+	section *section // Set for BODY[...] and BODY.PEEK[...]
+}
+
+// section is a BODY[...] item: part numbers, a specifier and an optional
+// partial range
+type section struct {
+	label     string // The text inside the brackets, echoed in the response
+	parts     []int
+	specifier string // "", HEADER, HEADER.FIELDS, HEADER.FIELDS.NOT, TEXT or MIME
+	fields    []string
+	partial   bool
+	offset    int
+	count     int
+}
+
+// fetch answers FETCH and UID FETCH
+func (c *session) fetch(tag string, args []token, uid bool) {
+	if len(args) != 2 {
+		c.tagged(tag, "BAD", "FETCH needs a sequence set and items")
+		return
+	}
+	set, _ := args[0].text()
+	indexes, err := c.resolveSet(set, uid)
+	if err != nil {
+		c.tagged(tag, "BAD", err.Error())
+		return
+	}
+	items, err := parseFetchItems(args[1])
+	if err != nil {
+		c.tagged(tag, "BAD", err.Error())
+		return
+	}
+	if uid && !hasItem(items, "UID") {
+		items = append([]fetchItem{{name: "UID"}}, items...)
+	}
+
+	failed := false
+	for _, i := range indexes {
+		if !c.fetchMessage(i, items) {
+			failed = true
+		}
+	}
+	if failed {
+		c.tagged(tag, "NO", "Some messages could not be read")
+		return
+	}
+	c.tagged(tag, "OK", "FETCH completed")
+}
+
+// fetchMessage writes one message's FETCH response, reporting whether its
+// file could be read
+func (c *session) fetchMessage(i int, items []fetchItem) bool {
+	e := c.msgs[i]
+	var msg *message
+	if needsFile(items) {
+		var err error
+		if msg, err = c.load(e); err != nil {
+			log.Printf("IMAP: failed to read email %d: %v", e.ID, err)
+			fmt.Fprintf(c.w, "* %d FETCH (UID %d)\r\n", i+1, e.ID)
+			return false
+		}
+	}
+
+	fmt.Fprintf(c.w, "* %d FETCH (", i+1)
+	for n, item := range items {
+		if n > 0 {
+			c.w.WriteByte(' ')
+		}
+		switch item.name {
+		case "UID":
+			fmt.Fprintf(c.w, "UID %d", e.ID)
+		case "FLAGS":
+			c.w.WriteString(`FLAGS (\Seen)`)
+		case "INTERNALDATE":
+			c.w.WriteString("INTERNALDATE " + quote(internalDate(e).Format(internalDateLayout)))
+		case "RFC822.SIZE":
+			fmt.Fprintf(c.w, "RFC822.SIZE %d", len(msg.raw))
+		case "ENVELOPE":
+			c.w.WriteString("ENVELOPE " + envelope(msg.root.fields))
+		case "BODY":
+			c.w.WriteString("BODY " + bodyStructure(msg.root, false))
+		case "BODYSTRUCTURE":
+			c.w.WriteString("BODYSTRUCTURE " + bodyStructure(msg.root, true))
+		case "RFC822":
+			c.writeLiteral("RFC822", msg.raw)
+		case "RFC822.HEADER":
+			c.writeLiteral("RFC822.HEADER", msg.root.header)
+		case "RFC822.TEXT":
+			c.writeLiteral("RFC822.TEXT", msg.root.body)
+		default:
+			sec := item.section
+			content := sec.content(msg)
+			label := "BODY[" + sec.label + "]"
+			if sec.partial {
+				label += "<" + strconv.Itoa(sec.offset) + ">"
+				content = sec.slice(content)
+			}
+			c.writeLiteral(label, content)
+		}
+	}
+	c.w.WriteString(")\r\n")
+	return true
+}
+
+// writeLiteral writes a data item whose value is sent as a literal
+func (c *session) writeLiteral(name string, content []byte) {
+	fmt.Fprintf(c.w, "%s {%d}\r\n", name, len(content))
+	c.w.Write(content)
+}
+
+// load reads an email's file through the database's path checks
+func (c *session) load(e *db.Email) (*message, error) {
+	if c.cached != nil && c.cached.id == e.ID {
+		return c.cached, nil
+	}
+	fullPath, err := c.selected.source.DB.ResolveEmailPath(e.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	raw = normalizeLineEndings(raw)
+	c.cached = &message{id: e.ID, raw: raw, root: parsePart(raw, "text/plain", 0)}
+	return c.cached, nil
+}
+
+// normalizeLineEndings turns bare LF line endings into CRLF
+func normalizeLineEndings(raw []byte) []byte {
+	if bytes.Count(raw, []byte("\n")) == bytes.Count(raw, []byte("\r\n")) {
+		return raw
+	}
+	out := make([]byte, 0, len(raw)+bytes.Count(raw, []byte("\n")))
+	for i, b := range raw {
+		if b == '\n' && (i == 0 || raw[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// internalDate is the email's date, as the archive has no delivery time
+func internalDate(e *db.Email) time.Time {
+	if e.Date.Valid {
+		return e.Date.Time
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// needsFile reports whether any item needs the message's content
+func needsFile(items []fetchItem) bool {
+	for _, item := range items {
+		switch item.name {
+		case "UID", "FLAGS", "INTERNALDATE":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// hasItem reports whether items include the named one
+func hasItem(items []fetchItem, name string) bool {
+	for _, item := range items {
+		if item.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFetchItems parses a FETCH's item list, a macro or a single item
+func parseFetchItems(arg token) ([]fetchItem, error) {
+	if !arg.isList {
+		switch strings.ToUpper(arg.atom) {
+		case "ALL":
+			return namedItems("FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"), nil
+		case "FAST":
+			return namedItems("FLAGS", "INTERNALDATE", "RFC822.SIZE"), nil
+		case "FULL":
+			return namedItems("FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"), nil
+		}
+		item, err := parseFetchItem(arg.atom)
+		if err != nil {
+			return nil, err
+		}
+		return []fetchItem{item}, nil
+	}
+
+	var items []fetchItem
+	for _, t := range arg.list {
+		item, err := parseFetchItem(t.atom)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no fetch items")
+	}
+	return items, nil
+}
+
+func namedItems(names ...string) []fetchItem {
+	items := make([]fetchItem, len(names))
+	for i, name := range names {
+		items[i] = fetchItem{name: name}
+	}
+	return items
+}
+
+// parseFetchItem parses one item, such as ENVELOPE or BODY.PEEK[1.MIME]<0.512>
+func parseFetchItem(atom string) (fetchItem, error) {
+	open := strings.IndexByte(atom, '[')
+	if open < 0 {
+		name := strings.ToUpper(atom)
+		switch name {
+		case "UID", "FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY", "BODYSTRUCTURE",
+			"RFC822", "RFC822.HEADER", "RFC822.TEXT":
+			return fetchItem{name: name}, nil
+		}
+		return fetchItem{}, fmt.Errorf("unknown fetch item %s", atom)
+	}
+
+	// BODY.PEEK is BODY without setting \Seen, which every email has anyway
+	switch strings.ToUpper(atom[:open]) {
+	case "BODY", "BODY.PEEK":
+	default:
+		return fetchItem{}, fmt.Errorf("unknown fetch item %s", atom)
+	}
+	closing := strings.IndexByte(atom, ']')
+	if closing < open {
+		return fetchItem{}, fmt.Errorf("unterminated section in %s", atom)
+	}
+	sec, err := parseSection(atom[open+1:closing], atom[closing+1:])
+	if err != nil {
+		return fetchItem{}, err
+	}
+	return fetchItem{name: "BODY[]", section: sec}, nil
+}
+
+// parseSection parses a section's text, such as 1.2.HEADER.FIELDS (From),
+// and its partial range, such as <0.100>
+func parseSection(text, partial string) (*section, error) {
+	sec := &section{label: text}
+	rest := text
+	for rest != "" && rest[0] >= '0' && rest[0] <= '9' {
+		end := strings.IndexByte(rest, '.')
+		if end < 0 {
+			end = len(rest)
+		}
+		n, err := strconv.Atoi(rest[:end])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid part number in %s", text)
+		}
+		sec.parts = append(sec.parts, n)
+		rest = strings.TrimPrefix(rest[end:], ".")
+	}
+
+	specifier, fieldList, _ := strings.Cut(rest, " ")
+	sec.specifier = strings.ToUpper(specifier)
+	switch sec.specifier {
+	case "", "HEADER", "TEXT":
+	case "MIME":
+		if len(sec.parts) == 0 {
+			return nil, errors.New("MIME needs a part number")
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		tokens, err := parseTokens([]byte(fieldList))
+		if err != nil || len(tokens) != 1 || !tokens[0].isList {
+			return nil, fmt.Errorf("invalid header list in %s", text)
+		}
+		for _, t := range tokens[0].list {
+			if field, ok := t.text(); ok {
+				sec.fields = append(sec.fields, field)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid section %s", text)
+	}
+
+	if partial != "" {
+		if !strings.HasPrefix(partial, "<") || !strings.HasSuffix(partial, ">") {
+			return nil, fmt.Errorf("invalid partial range %s", partial)
+		}
+		offset, count, ok := strings.Cut(partial[1:len(partial)-1], ".")
+		var err1, err2 error
+		sec.offset, err1 = strconv.Atoi(offset)
+		sec.count, err2 = strconv.Atoi(count)
+		if !ok || err1 != nil || err2 != nil || sec.offset < 0 || sec.count < 0 {
+			return nil, fmt.Errorf("invalid partial range %s", partial)
+		}
+		sec.partial = true
+	}
+	return sec, nil
+}
+
+// content returns the section's bytes, or nothing if the part is missing
+func (sec *section) content(msg *message) []byte {
+	target := msg.root
+	for _, n := range sec.parts {
+		if target = target.sub(n); target == nil {
+			return nil
+		}
+	}
+
+	if len(sec.parts) == 0 {
+		switch sec.specifier {
+		case "":
+			return msg.raw
+		case "TEXT":
+			return msg.root.body
+		}
+	} else {
+		switch sec.specifier {
+		case "":
+			return target.body
+		case "MIME":
+			return target.header
+		}
+		if !target.isMessage() {
+			return nil
+		}
+		target = target.message()
+	}
+
+	switch sec.specifier {
+	case "HEADER":
+		return target.header
+	case "TEXT":
+		return target.body
+	case "HEADER.FIELDS":
+		return headerFields(target.header, sec.fields, false)
+	default:
+		return headerFields(target.header, sec.fields, true)
+	}
+}
+
+// slice cuts content to the partial range
+func (sec *section) slice(content []byte) []byte {
+	if sec.offset >= len(content) {
+		return nil
+	}
+	content = content[sec.offset:]
+	if sec.count < len(content) {
+		content = content[:sec.count]
+	}
+	return content
+}
+
+// resolveSet turns a sequence set, or a UID set, into indexes into msgs
+func (c *session) resolveSet(set string, uid bool) ([]int, error) {
+	if set == "" {
+		return nil, errors.New("missing sequence set")
+	}
+	var last int64
+	if uid && len(c.msgs) > 0 {
+		last = c.msgs[len(c.msgs)-1].ID
+	} else if !uid {
+		last = int64(len(c.msgs))
+	}
+
+	type span struct{ lo, hi int64 }
+	var spans []span
+	for _, r := range strings.Split(set, ",") {
+		from, to, isRange := strings.Cut(r, ":")
+		lo, err := parseSetNumber(from, last)
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parseSetNumber(to, last); err != nil {
+				return nil, err
+			}
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		spans = append(spans, span{lo, hi})
+	}
+
+	var indexes []int
+	for i, e := range c.msgs {
+		n := int64(i + 1)
+		if uid {
+			n = e.ID
+		}
+		for _, s := range spans {
+			if n >= s.lo && n <= s.hi {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// parseSetNumber parses a number in a sequence set, where * is the last
+func parseSetNumber(s string, last int64) (int64, error) {
+	if s == "*" {
+		return last, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid sequence set number %q", s)
+	}
+	return n, nil
+}
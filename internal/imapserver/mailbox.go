@@ -0,0 +1,214 @@
+package imapserver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/imaputf7"
+)
+
+// delimiter separates levels of the mailbox hierarchy
+const delimiter = "/"
+
+// Top-level mailboxes grouping a collection's folders and saved searches
+const (
+	foldersMailbox  = "Folders"
+	searchesMailbox = "Saved Searches"
+)
+
+// uidValiditySetting stores the UIDVALIDITY of a database. UIDs are email IDs,
+// which are never reused, so it only changes with a new database.
+const uidValiditySetting = "imap_uidvalidity"
+
+// mailbox is a read-only view of a collection's emails
+type mailbox struct {
+	name     string // Full UTF-8 name, such as "Folders/2024/March"
+	source   *Source
+	folder   string          // Set to list only the emails directly in this folder
+	search   *db.SavedSearch // Set to list only the emails a saved search finds
+	noSelect bool            // A parent in the hierarchy that holds no emails itself
+}
+
+// mailboxes lists every mailbox, INBOX first and the rest by name. With one
+// collection INBOX holds all its emails; with several each collection is a
+// mailbox of its own and INBOX is the first one.
+func (s *Server) mailboxes() ([]*mailbox, error) {
+	byName := make(map[string]*mailbox)
+	add := func(m *mailbox) {
+		if existing := byName[m.name]; existing == nil || existing.noSelect {
+			byName[m.name] = m
+		}
+	}
+
+	for i := range s.sources {
+		src := &s.sources[i]
+		prefix := ""
+		if len(s.sources) > 1 {
+			prefix = src.Name + delimiter
+			add(&mailbox{name: src.Name, source: src})
+		}
+		if i == 0 {
+			add(&mailbox{name: "INBOX", source: src})
+		}
+
+		folders, err := src.DB.ListEmailFolders()
+		if err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			add(&mailbox{name: prefix + foldersMailbox + delimiter + folder, source: src, folder: folder})
+		}
+
+		searches, err := src.DB.ListSavedSearches()
+		if err != nil {
+			return nil, err
+		}
+		for _, search := range searches {
+			name := strings.ReplaceAll(search.Name, delimiter, "-")
+			add(&mailbox{name: prefix + searchesMailbox + delimiter + name, source: src, search: search})
+		}
+	}
+
+	// Parents such as "Folders" exist so clients can show the hierarchy
+	for name := range byName {
+		for i := strings.LastIndex(name, delimiter); i > 0; i = strings.LastIndex(name[:i], delimiter) {
+			add(&mailbox{name: name[:i], noSelect: true})
+		}
+	}
+
+	list := make([]*mailbox, 0, len(byName))
+	for _, m := range byName {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].name == "INBOX") != (list[j].name == "INBOX") {
+			return list[i].name == "INBOX"
+		}
+		return list[i].name < list[j].name
+	})
+	return list, nil
+}
+
+// findMailbox returns the mailbox with a client-supplied, modified UTF-7
+// name, or nil
+func (s *Server) findMailbox(encoded string) (*mailbox, error) {
+	name, err := imaputf7.Decode(encoded)
+	if err != nil {
+		return nil, nil
+	}
+	if strings.EqualFold(name, "INBOX") {
+		name = "INBOX"
+	}
+	list, err := s.mailboxes()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range list {
+		if m.name == name {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// hasChildren reports whether any mailbox sits below m
+func hasChildren(m *mailbox, list []*mailbox) bool {
+	for _, other := range list {
+		if strings.HasPrefix(other.name, m.name+delimiter) {
+			return true
+		}
+	}
+	return false
+}
+
+// attributes formats a mailbox's LIST attributes
+func attributes(m *mailbox, list []*mailbox) string {
+	var attrs []string
+	if m.noSelect {
+		attrs = append(attrs, `\Noselect`)
+	}
+	if hasChildren(m, list) {
+		attrs = append(attrs, `\HasChildren`)
+	} else {
+		attrs = append(attrs, `\HasNoChildren`)
+	}
+	return "(" + strings.Join(attrs, " ") + ")"
+}
+
+// matchPattern matches a mailbox name against a LIST pattern, where *
+// matches anything and % anything but the delimiter
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return name == ""
+	}
+	switch pattern[0] {
+	case '*', '%':
+		for i := 0; i <= len(name); i++ {
+			if matchPattern(pattern[1:], name[i:]) {
+				return true
+			}
+			if i < len(name) && pattern[0] == '%' && name[i] == delimiter[0] {
+				return false
+			}
+		}
+		return false
+	default:
+		return name != "" && name[0] == pattern[0] && matchPattern(pattern[1:], name[1:])
+	}
+}
+
+// messages loads the emails in a mailbox, in UID order
+func (m *mailbox) messages() ([]*db.Email, error) {
+	switch {
+	case m.folder != "":
+		return m.source.DB.ListFolderEmails(m.folder)
+	case m.search != nil:
+		return m.source.DB.ListMatchingEmails(m.search.Filters)
+	default:
+		return m.source.DB.ListAllEmails()
+	}
+}
+
+// uids returns the UIDs of the emails in a mailbox, in order, without
+// loading the emails
+func (m *mailbox) uids() ([]int64, error) {
+	switch {
+	case m.folder != "":
+		return m.source.DB.ListFolderEmailIDs(m.folder)
+	case m.search != nil:
+		return m.source.DB.SearchEmailIDs(m.search.Filters)
+	default:
+		return m.source.DB.ListAllEmailIDs()
+	}
+}
+
+// uidNext returns the lowest UID a new email in the mailbox could get
+func (m *mailbox) uidNext() (int64, error) {
+	id, err := m.source.DB.MaxEmailID()
+	if err != nil {
+		return 0, err
+	}
+	return id + 1, nil
+}
+
+// uidValidity returns the database's UIDVALIDITY, creating it on first use
+func uidValidity(database *db.DB) (uint32, error) {
+	value, err := database.GetSetting(uidValiditySetting)
+	if err != nil {
+		return 0, err
+	}
+	if value != "" {
+		if n, err := strconv.ParseUint(value, 10, 32); err == nil && n > 0 {
+			return uint32(n), nil
+		}
+	}
+	n := uint32(time.Now().Unix())
+	if err := database.SetSetting(uidValiditySetting, strconv.FormatUint(uint64(n), 10)); err != nil {
+		return 0, fmt.Errorf("failed to store UIDVALIDITY: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,373 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-message/charset"
+)
+
+// maxPartDepth stops nesting attacks in hostile messages
+const maxPartDepth = 20
+
+// part is a MIME entity sliced out of the raw message bytes, so sections are
+// served exactly as stored
+type part struct {
+	header   []byte // Header block including the blank line ending it
+	body     []byte
+	fields   textproto.MIMEHeader
+	mainType string // Lower-cased, such as "text"
+	subType  string // Lower-cased, such as "plain"
+	params   map[string]string
+	children []*part // Multipart parts, or the encapsulated message of a message/rfc822 part
+}
+
+// parsePart splits raw bytes into a part, typed defaultType when it has no
+// Content-Type
+func parsePart(raw []byte, defaultType string, depth int) *part {
+	p := &part{}
+	p.header, p.body = splitHeader(raw)
+	p.fields = parseHeaderFields(p.header)
+
+	mediaType, params, err := mime.ParseMediaType(p.fields.Get("Content-Type"))
+	if err != nil || !strings.Contains(mediaType, "/") {
+		mediaType, params = defaultType, map[string]string{}
+		if defaultType == "text/plain" {
+			params["charset"] = "us-ascii"
+		}
+	}
+	p.mainType, p.subType, _ = strings.Cut(mediaType, "/")
+	p.params = params
+
+	if depth >= maxPartDepth {
+		return p
+	}
+	switch {
+	case p.mainType == "multipart" && params["boundary"] != "":
+		childType := "text/plain"
+		if p.subType == "digest" {
+			childType = "message/rfc822"
+		}
+		for _, raw := range splitMultipart(p.body, params["boundary"]) {
+			p.children = append(p.children, parsePart(raw, childType, depth+1))
+		}
+	case p.isMessage():
+		p.children = []*part{parsePart(p.body, "text/plain", depth+1)}
+	}
+	return p
+}
+
+// isMultipart reports whether the part holds other parts
+func (p *part) isMultipart() bool {
+	return p.mainType == "multipart" && len(p.children) > 0
+}
+
+// isMessage reports whether the part is an encapsulated email
+func (p *part) isMessage() bool {
+	return p.mainType == "message" && p.subType == "rfc822"
+}
+
+// message returns the email whose header and text a section refers to: the
+// encapsulated one for message/rfc822 parts, otherwise the part itself
+func (p *part) message() *part {
+	if p.isMessage() && len(p.children) == 1 {
+		return p.children[0]
+	}
+	return p
+}
+
+// sub returns part n of p, numbered from 1 as in BODY[1.2]. A part that is
+// not multipart is its own part 1.
+func (p *part) sub(n int) *part {
+	p = p.message()
+	if p.isMultipart() {
+		if n < 1 || n > len(p.children) {
+			return nil
+		}
+		return p.children[n-1]
+	}
+	if n == 1 {
+		return p
+	}
+	return nil
+}
+
+// splitHeader splits a part at the first blank line
+func splitHeader(raw []byte) (header, body []byte) {
+	for i := 0; i < len(raw); {
+		end := bytes.IndexByte(raw[i:], '\n')
+		if end < 0 {
+			return raw, nil
+		}
+		if len(bytes.TrimRight(raw[i:i+end+1], "\r\n")) == 0 {
+			return raw[:i+end+1], raw[i+end+1:]
+		}
+		i += end + 1
+	}
+	return raw, nil
+}
+
+// parseHeaderFields parses a header block, keeping what it can of a
+// malformed one
+func parseHeaderFields(header []byte) textproto.MIMEHeader {
+	block := header
+	if !bytes.HasSuffix(block, []byte("\n\n")) && !bytes.HasSuffix(block, []byte("\n\r\n")) {
+		block = append(append([]byte{}, block...), "\r\n\r\n"...)
+	}
+	fields, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(block))).ReadMIMEHeader()
+	if fields == nil {
+		fields = textproto.MIMEHeader{}
+	}
+	return fields
+}
+
+// splitMultipart returns the parts between a multipart body's boundaries
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delimiter := []byte("--" + boundary)
+	var parts [][]byte
+	start := -1
+	for i := 0; i < len(body); {
+		end := bytes.IndexByte(body[i:], '\n')
+		next := len(body)
+		if end >= 0 {
+			next = i + end + 1
+		}
+		line := bytes.TrimRight(body[i:next], " \t\r\n")
+		if bytes.HasPrefix(line, delimiter) {
+			rest := line[len(delimiter):]
+			if len(rest) == 0 || string(rest) == "--" {
+				if start >= 0 {
+					parts = append(parts, trimLineEnding(body[start:i]))
+				}
+				if len(rest) > 0 {
+					return parts
+				}
+				start = next
+			}
+		}
+		i = next
+	}
+	if start >= 0 && start < len(body) {
+		parts = append(parts, body[start:])
+	}
+	return parts
+}
+
+// trimLineEnding drops the line ending that belongs to the next boundary
+func trimLineEnding(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		return b[:len(b)-2]
+	}
+	return bytes.TrimSuffix(b, []byte("\n"))
+}
+
+// headerFields returns the header lines named in fields, or all the others
+// when not is set, ending with a blank line as BODY[HEADER.FIELDS] requires
+func headerFields(header []byte, fields []string, not bool) []byte {
+	want := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		want[textproto.CanonicalMIMEHeaderKey(f)] = true
+	}
+
+	var out []byte
+	keep := false
+	for i := 0; i < len(header); {
+		end := bytes.IndexByte(header[i:], '\n')
+		next := len(header)
+		if end >= 0 {
+			next = i + end + 1
+		}
+		line := header[i:next]
+		i = next
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := bytes.Cut(line, []byte(":"))
+			keep = want[textproto.CanonicalMIMEHeaderKey(string(bytes.TrimSpace(name)))] != not
+		}
+		if keep {
+			out = append(out, line...)
+		}
+	}
+	return append(out, "\r\n"...)
+}
+
+// countLines counts the lines in a body, including an unterminated last one
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte("\n"))
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// addressParser decodes encoded names in any charset the parser supports
+var addressParser = &mail.AddressParser{WordDecoder: &mime.WordDecoder{
+	CharsetReader: func(label string, input io.Reader) (io.Reader, error) {
+		return charset.Reader(label, input)
+	},
+}}
+
+// envelope formats a part's header as an IMAP ENVELOPE
+func envelope(fields textproto.MIMEHeader) string {
+	from := addressList(fields.Get("From"))
+	sender := addressList(fields.Get("Sender"))
+	if sender == "NIL" {
+		sender = from
+	}
+	replyTo := addressList(fields.Get("Reply-To"))
+	if replyTo == "NIL" {
+		replyTo = from
+	}
+	return fmt.Sprintf("(%s %s %s %s %s %s %s %s %s %s)",
+		nstring(fields.Get("Date")),
+		nstring(fields.Get("Subject")),
+		from, sender, replyTo,
+		addressList(fields.Get("To")),
+		addressList(fields.Get("Cc")),
+		addressList(fields.Get("Bcc")),
+		nstring(fields.Get("In-Reply-To")),
+		nstring(fields.Get("Message-Id")),
+	)
+}
+
+// addressList formats an address header as a list of (name adl mailbox
+// host), or NIL if it is missing or unparseable
+func addressList(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "NIL"
+	}
+	addrs, err := addressParser.ParseList(value)
+	if err != nil || len(addrs) == 0 {
+		return "NIL"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('(')
+	for _, addr := range addrs {
+		mailbox, host, _ := strings.Cut(addr.Address, "@")
+		name := addr.Name
+		if name != "" && !isASCII(name) {
+			name = mime.QEncoding.Encode("utf-8", name)
+		}
+		fmt.Fprintf(&sb, "(%s NIL %s %s)", nstring(name), nstring(mailbox), nstring(host))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// isASCII reports whether s has only 7-bit characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// bodyStructure formats a part as BODY, or with extension data as
+// BODYSTRUCTURE when extended is set
+func bodyStructure(p *part, extended bool) string {
+	var sb strings.Builder
+	writeBodyStructure(&sb, p, extended)
+	return sb.String()
+}
+
+func writeBodyStructure(sb *strings.Builder, p *part, extended bool) {
+	sb.WriteByte('(')
+	defer sb.WriteByte(')')
+
+	if p.isMultipart() {
+		for _, child := range p.children {
+			writeBodyStructure(sb, child, extended)
+		}
+		sb.WriteString(" " + quote(strings.ToUpper(p.subType)))
+		if extended {
+			sb.WriteString(" " + paramList(p.params, nil))
+			sb.WriteString(" " + disposition(p.fields) + " " + nstring(p.fields.Get("Content-Language")) + " " + nstring(p.fields.Get("Content-Location")))
+		}
+		return
+	}
+
+	mainType, subType := p.mainType, p.subType
+	if mainType == "multipart" {
+		// A multipart without parts is shown as the text it really is
+		mainType, subType = "text", "plain"
+	}
+	encoding := strings.TrimSpace(p.fields.Get("Content-Transfer-Encoding"))
+	if encoding == "" {
+		encoding = "7bit"
+	}
+	fmt.Fprintf(sb, "%s %s %s %s %s %s %d",
+		quote(strings.ToUpper(mainType)),
+		quote(strings.ToUpper(subType)),
+		paramList(p.params, []string{"boundary"}),
+		nstring(p.fields.Get("Content-Id")),
+		nstring(p.fields.Get("Content-Description")),
+		quote(strings.ToUpper(encoding)),
+		len(p.body),
+	)
+	switch {
+	case p.isMessage() && len(p.children) == 1:
+		msg := p.children[0]
+		sb.WriteString(" " + envelope(msg.fields) + " ")
+		writeBodyStructure(sb, msg, extended)
+		fmt.Fprintf(sb, " %d", countLines(p.body))
+	case mainType == "text":
+		fmt.Fprintf(sb, " %d", countLines(p.body))
+	}
+	if extended {
+		sb.WriteString(" " + nstring(p.fields.Get("Content-Md5")))
+		sb.WriteString(" " + disposition(p.fields) + " " + nstring(p.fields.Get("Content-Language")) + " " + nstring(p.fields.Get("Content-Location")))
+	}
+}
+
+// paramList formats parameters as a sorted ("name" "value" ...) list, or NIL
+func paramList(params map[string]string, skip []string) string {
+	var names []string
+	for name := range params {
+		skipped := false
+		for _, s := range skip {
+			skipped = skipped || name == s
+		}
+		if !skipped {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "NIL"
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		value := params[name]
+		if !isASCII(value) {
+			value = mime.QEncoding.Encode("utf-8", value)
+		}
+		items = append(items, quote(strings.ToUpper(name)), quote(value))
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+// disposition formats Content-Disposition as ("type" (params)), or NIL
+func disposition(fields textproto.MIMEHeader) string {
+	value := fields.Get("Content-Disposition")
+	if value == "" {
+		return "NIL"
+	}
+	kind, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return "NIL"
+	}
+	return "(" + quote(strings.ToUpper(kind)) + " " + paramList(params, nil) + ")"
+}
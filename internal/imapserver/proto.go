@@ -0,0 +1,244 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxCommandSize bounds a command line with its literals, so a client cannot
+// make the server buffer without limit
+const maxCommandSize = 1 << 20
+
+// errTooLong is returned for commands over maxCommandSize
+var errTooLong = errors.New("command too long")
+
+// readCommand reads a command line and any literals it carries, asking for
+// each synchronizing literal with a continuation. Literals stay in place
+// as {n}CRLF followed by their bytes, for parseTokens.
+func readCommand(r *bufio.Reader, w *bufio.Writer) ([]byte, error) {
+	var cmd []byte
+	for {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errTooLong
+		}
+		if err != nil {
+			return nil, err
+		}
+		cmd = append(cmd, line...)
+		if len(cmd) > maxCommandSize {
+			return nil, errTooLong
+		}
+
+		n, sync, ok := trailingLiteral(bytes.TrimRight(line, "\r\n"))
+		if !ok {
+			return bytes.TrimRight(cmd, "\r\n"), nil
+		}
+		if len(cmd)+n > maxCommandSize {
+			return nil, errTooLong
+		}
+		if sync {
+			w.WriteString("+ Ready for literal data\r\n")
+			if err := w.Flush(); err != nil {
+				return nil, err
+			}
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(r, literal); err != nil {
+			return nil, err
+		}
+		cmd = append(cmd, literal...)
+	}
+}
+
+// trailingLiteral reports whether a line ends with a literal's size, {n}
+// or the non-synchronizing {n+}
+func trailingLiteral(line []byte) (n int, sync bool, ok bool) {
+	if len(line) < 3 || line[len(line)-1] != '}' {
+		return 0, false, false
+	}
+	open := bytes.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false, false
+	}
+	digits := string(line[open+1 : len(line)-1])
+	sync = !strings.HasSuffix(digits, "+")
+	n, err := strconv.Atoi(strings.TrimSuffix(digits, "+"))
+	if err != nil || n < 0 {
+		return 0, false, false
+	}
+	return n, sync, true
+}
+
+// token is a parsed command argument: an atom, a string or a list
+type token struct {
+	atom   string  // Set for atoms, including NIL and BODY[...] fetch items
+	str    *string // Set for quoted strings and literals
+	list   []token // Set for parenthesized lists
+	isList bool
+}
+
+// text returns an atom or string's value
+func (t token) text() (string, bool) {
+	if t.str != nil {
+		return *t.str, true
+	}
+	if t.atom != "" && !t.isList {
+		return t.atom, true
+	}
+	return "", false
+}
+
+// parseTokens splits a command's arguments into tokens
+func parseTokens(b []byte) ([]token, error) {
+	p := &tokenParser{b: b}
+	tokens, err := p.parseList(0)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// tokenParser reads tokens from a command
+type tokenParser struct {
+	b   []byte
+	pos int
+}
+
+// parseList reads tokens until the end of input, or the close paren
+// matching an open one when depth > 0
+func (p *tokenParser) parseList(depth int) ([]token, error) {
+	var tokens []token
+	for {
+		for p.pos < len(p.b) && p.b[p.pos] == ' ' {
+			p.pos++
+		}
+		if p.pos >= len(p.b) {
+			if depth > 0 {
+				return nil, errors.New("unterminated list")
+			}
+			return tokens, nil
+		}
+
+		switch c := p.b[p.pos]; c {
+		case '(':
+			p.pos++
+			list, err := p.parseList(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{list: list, isList: true})
+		case ')':
+			if depth == 0 {
+				return nil, errors.New("unexpected )")
+			}
+			p.pos++
+			return tokens, nil
+		case '"':
+			s, err := p.parseQuoted()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{str: &s})
+		case '{':
+			s, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{str: &s})
+		default:
+			tokens = append(tokens, token{atom: p.parseAtom()})
+		}
+	}
+}
+
+// parseQuoted reads a quoted string with \" and \\ escapes
+func (p *tokenParser) parseQuoted() (string, error) {
+	var sb strings.Builder
+	for p.pos++; p.pos < len(p.b); p.pos++ {
+		switch c := p.b[p.pos]; c {
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.b) {
+				return "", errors.New("unterminated string")
+			}
+			sb.WriteByte(p.b[p.pos])
+		case '"':
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+// parseLiteral reads a {n}CRLF literal left in place by readCommand
+func (p *tokenParser) parseLiteral() (string, error) {
+	end := bytes.IndexByte(p.b[p.pos:], '}')
+	if end < 0 {
+		return "", errors.New("bad literal")
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(string(p.b[p.pos+1:p.pos+end]), "+"))
+	if err != nil || n < 0 {
+		return "", errors.New("bad literal size")
+	}
+	start := p.pos + end + 1
+	if bytes.HasPrefix(p.b[start:], []byte("\r\n")) {
+		start += 2
+	} else if bytes.HasPrefix(p.b[start:], []byte("\n")) {
+		start++
+	}
+	if start+n > len(p.b) {
+		return "", errors.New("short literal")
+	}
+	p.pos = start + n
+	return string(p.b[start : start+n]), nil
+}
+
+// parseAtom reads an atom. A [...] section is part of the atom even with
+// spaces or parens inside, so BODY[HEADER.FIELDS (From To)]<0.100> is one.
+func (p *tokenParser) parseAtom() string {
+	start := p.pos
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		if c == '[' {
+			end := bytes.IndexByte(p.b[p.pos:], ']')
+			if end < 0 {
+				p.pos = len(p.b)
+				break
+			}
+			p.pos += end + 1
+			continue
+		}
+		if c == ' ' || c == '(' || c == ')' || c == '"' {
+			break
+		}
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// quote formats s as an IMAP string: quoted if it can be, else a literal
+func quote(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f {
+			return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+		}
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// nstring formats s as a string, or NIL if empty
+func nstring(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return quote(s)
+}
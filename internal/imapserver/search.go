@@ -0,0 +1,327 @@
+package imapserver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// searchDateLayout is the date format of SEARCH keys such as SINCE
+const searchDateLayout = "2-Jan-2006"
+
+// search answers SEARCH and UID SEARCH. TO, TEXT and BODY run on the
+// database's search index; the other keys check each email's metadata, or
+// its file for CC, BCC and HEADER.
+func (c *session) search(tag string, args []token, uid bool) {
+	if len(args) >= 2 && strings.EqualFold(args[0].atom, "CHARSET") {
+		charset, _ := args[1].text()
+		if !strings.EqualFold(charset, "UTF-8") && !strings.EqualFold(charset, "US-ASCII") {
+			c.tagged(tag, "NO", "[BADCHARSET (UTF-8 US-ASCII)] Unsupported charset")
+			return
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		c.tagged(tag, "BAD", "SEARCH needs a key")
+		return
+	}
+
+	s := &searcher{c: c, tokens: args}
+	matched, err := s.all()
+	if err != nil {
+		var failed *searchFailure
+		if errors.As(err, &failed) {
+			c.serverError(tag, "search", failed.err)
+		} else {
+			c.tagged(tag, "BAD", err.Error())
+		}
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SEARCH")
+	for i, ok := range matched {
+		if !ok {
+			continue
+		}
+		n := int64(i + 1)
+		if uid {
+			n = c.msgs[i].ID
+		}
+		sb.WriteString(" " + strconv.FormatInt(n, 10))
+	}
+	c.untagged(sb.String())
+	c.tagged(tag, "OK", "SEARCH completed")
+}
+
+// searchFailure wraps errors that are the server's fault rather than the
+// client's
+type searchFailure struct{ err error }
+
+func (f *searchFailure) Error() string { return f.err.Error() }
+
+// searcher evaluates search keys into a match per selected email
+type searcher struct {
+	c      *session
+	tokens []token
+	pos    int
+}
+
+// all evaluates every remaining key, which must all match
+func (s *searcher) all() ([]bool, error) {
+	matched := s.fill(true)
+	for s.pos < len(s.tokens) {
+		key, err := s.key()
+		if err != nil {
+			return nil, err
+		}
+		for i := range matched {
+			matched[i] = matched[i] && key[i]
+		}
+	}
+	return matched, nil
+}
+
+// fill returns a match per email, all set to v
+func (s *searcher) fill(v bool) []bool {
+	matched := make([]bool, len(s.c.msgs))
+	for i := range matched {
+		matched[i] = v
+	}
+	return matched
+}
+
+// where matches the emails for which fn is true
+func (s *searcher) where(fn func(e *db.Email) bool) []bool {
+	matched := make([]bool, len(s.c.msgs))
+	for i, e := range s.c.msgs {
+		matched[i] = fn(e)
+	}
+	return matched
+}
+
+// next returns the next argument as a string
+func (s *searcher) next(key string) (string, error) {
+	if s.pos >= len(s.tokens) {
+		return "", fmt.Errorf("%s needs an argument", key)
+	}
+	t := s.tokens[s.pos]
+	s.pos++
+	value, ok := t.text()
+	if !ok {
+		return "", fmt.Errorf("invalid argument to %s", key)
+	}
+	return value, nil
+}
+
+// key evaluates one search key
+func (s *searcher) key() ([]bool, error) {
+	t := s.tokens[s.pos]
+	s.pos++
+	if t.isList {
+		sub := &searcher{c: s.c, tokens: t.list}
+		return sub.all()
+	}
+
+	name := strings.ToUpper(t.atom)
+	switch name {
+	case "ALL", "OLD", "SEEN", "UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED":
+		// Every email is seen and has no other flag
+		return s.fill(true), nil
+	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "NEW", "RECENT", "UNSEEN":
+		return s.fill(false), nil
+	case "KEYWORD", "UNKEYWORD":
+		if _, err := s.next(name); err != nil {
+			return nil, err
+		}
+		return s.fill(name == "UNKEYWORD"), nil
+
+	case "NOT":
+		if s.pos >= len(s.tokens) {
+			return nil, errors.New("NOT needs a key")
+		}
+		matched, err := s.key()
+		if err != nil {
+			return nil, err
+		}
+		for i := range matched {
+			matched[i] = !matched[i]
+		}
+		return matched, nil
+	case "OR":
+		if s.pos+1 >= len(s.tokens) {
+			return nil, errors.New("OR needs two keys")
+		}
+		left, err := s.key()
+		if err != nil {
+			return nil, err
+		}
+		if s.pos >= len(s.tokens) {
+			return nil, errors.New("OR needs two keys")
+		}
+		right, err := s.key()
+		if err != nil {
+			return nil, err
+		}
+		for i := range left {
+			left[i] = left[i] || right[i]
+		}
+		return left, nil
+
+	case "UID":
+		set, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.inSet(set, true)
+	case "LARGER", "SMALLER":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %q", value)
+		}
+		return s.where(func(e *db.Email) bool {
+			if name == "LARGER" {
+				return e.FileSize > size
+			}
+			return e.FileSize < size
+		}), nil
+
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		day, err := time.Parse(searchDateLayout, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", value)
+		}
+		return s.where(func(e *db.Email) bool {
+			if !e.Date.Valid {
+				return false
+			}
+			y, m, d := e.Date.Time.Date()
+			date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+			switch strings.TrimPrefix(name, "SENT") {
+			case "BEFORE":
+				return date.Before(day)
+			case "ON":
+				return date.Equal(day)
+			default:
+				return !date.Before(day)
+			}
+		}), nil
+
+	case "SUBJECT":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.where(func(e *db.Email) bool { return containsFold(e.Subject, value) }), nil
+	case "FROM":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.where(func(e *db.Email) bool {
+			return containsFold(e.Sender, value) || containsFold(e.SenderName, value)
+		}), nil
+	case "TO":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.indexed(db.SearchFilters{Recipient: value})
+	case "TEXT", "BODY":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.indexed(db.SearchFilters{Query: value})
+	case "CC", "BCC":
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.header(strings.ToLower(name), value)
+	case "HEADER":
+		field, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := s.next(name)
+		if err != nil {
+			return nil, err
+		}
+		return s.header(field, value)
+	}
+
+	if t.atom != "" && (t.atom[0] == '*' || (t.atom[0] >= '0' && t.atom[0] <= '9')) {
+		return s.inSet(t.atom, false)
+	}
+	return nil, fmt.Errorf("unknown search key %s", t.atom)
+}
+
+// inSet matches the emails in a sequence set, or a UID set
+func (s *searcher) inSet(set string, uid bool) ([]bool, error) {
+	indexes, err := s.c.resolveSet(set, uid)
+	if err != nil {
+		return nil, err
+	}
+	matched := s.fill(false)
+	for _, i := range indexes {
+		matched[i] = true
+	}
+	return matched, nil
+}
+
+// indexed matches the emails the database finds with filters
+func (s *searcher) indexed(filters db.SearchFilters) ([]bool, error) {
+	if filters.Query == "" && filters.Recipient == "" {
+		return s.fill(true), nil
+	}
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	ids, err := s.c.selected.source.DB.SearchEmailIDs(filters)
+	if err != nil {
+		return nil, &searchFailure{err}
+	}
+	found := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		found[id] = true
+	}
+	return s.where(func(e *db.Email) bool { return found[e.ID] }), nil
+}
+
+// header matches the emails whose file has a header field containing
+// value; an empty value matches any email with the field
+func (s *searcher) header(field, value string) ([]bool, error) {
+	matched := s.fill(false)
+	for i, e := range s.c.msgs {
+		msg, err := s.c.load(e)
+		if err != nil {
+			// An unreadable file cannot match
+			continue
+		}
+		for _, v := range msg.root.fields.Values(field) {
+			if containsFold(v, value) {
+				matched[i] = true
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// containsFold reports whether s contains substr, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,512 @@
+// Package imapserver serves the archive read-only over IMAP4rev1, so mail
+// clients such as Thunderbird can browse and search it. Each collection,
+// folder and saved search is a mailbox; messages come straight from the .eml
+// files and UIDs are email IDs.
+package imapserver
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/imaputf7"
+)
+
+// capabilities lists the extensions the server supports
+const capabilities = "IMAP4rev1 LITERAL+ UNSELECT"
+
+// idleTimeout logs out clients silent for longer than RFC 3501's minimum
+const idleTimeout = 30 * time.Minute
+
+// Source is a collection served over IMAP
+type Source struct {
+	Name string
+	DB   *db.DB
+}
+
+// Server accepts IMAP connections and serves the sources' emails
+type Server struct {
+	sources     []Source
+	requireAuth bool
+	authToken   string
+
+	validityMu sync.Mutex // Serializes creating a database's UIDVALIDITY
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// New creates a server for the given collections. With requireAuth, LOGIN
+// needs authToken as the password, as the web UI needs it as a bearer
+// token; otherwise any credentials are accepted.
+func New(sources []Source, requireAuth bool, authToken string) *Server {
+	return &Server{
+		sources:     sources,
+		requireAuth: requireAuth,
+		authToken:   authToken,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on l until Close is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("server closed")
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("failed to accept IMAP connection: %w", err)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			newSession(s, conn).serve()
+		}()
+	}
+}
+
+// Close stops accepting connections, disconnects every client and waits
+// for their sessions to end
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// uidValidity returns a source's UIDVALIDITY
+func (s *Server) uidValidity(src *Source) (uint32, error) {
+	s.validityMu.Lock()
+	defer s.validityMu.Unlock()
+	return uidValidity(src.DB)
+}
+
+// session is one client connection
+type session struct {
+	server        *Server
+	conn          net.Conn
+	r             *bufio.Reader
+	w             *bufio.Writer
+	authenticated bool
+
+	selected *mailbox
+	msgs     []*db.Email // The selected mailbox's emails; sequence number n is msgs[n-1]
+
+	cached *message // The last message read, as FETCH often asks for several items
+}
+
+func newSession(s *Server, conn net.Conn) *session {
+	return &session{
+		server: s,
+		conn:   conn,
+		r:      bufio.NewReaderSize(conn, 64*1024),
+		w:      bufio.NewWriter(conn),
+	}
+}
+
+// serve reads and answers commands until the client logs out or leaves
+func (c *session) serve() {
+	c.untagged("OK [CAPABILITY " + capabilities + "] EML Viewer IMAP server ready")
+	c.w.Flush()
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		line, err := readCommand(c.r, c.w)
+		if errors.Is(err, errTooLong) {
+			c.untagged("BAD Command line too long")
+			c.w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		tag, rest, _ := strings.Cut(string(line), " ")
+		if tag == "" || strings.ContainsAny(tag, "(){%*\"\\+") {
+			c.untagged("BAD Missing or invalid tag")
+			c.w.Flush()
+			continue
+		}
+		name, args, _ := strings.Cut(rest, " ")
+		tokens, err := parseTokens([]byte(args))
+		if err != nil {
+			c.tagged(tag, "BAD", "Invalid arguments: "+err.Error())
+			c.w.Flush()
+			continue
+		}
+
+		done := c.handle(tag, strings.ToUpper(name), tokens)
+		if err := c.w.Flush(); err != nil || done {
+			return
+		}
+	}
+}
+
+// handle runs a command, reporting whether the session is over
+func (c *session) handle(tag, name string, args []token) bool {
+	switch name {
+	case "CAPABILITY":
+		c.untagged("CAPABILITY " + capabilities)
+		c.tagged(tag, "OK", "CAPABILITY completed")
+		return false
+	case "NOOP":
+		c.noop(tag)
+		return false
+	case "LOGOUT":
+		c.untagged("BYE Logging out")
+		c.tagged(tag, "OK", "LOGOUT completed")
+		return true
+	}
+
+	if !c.authenticated {
+		switch name {
+		case "LOGIN":
+			c.login(tag, args)
+		case "AUTHENTICATE":
+			c.tagged(tag, "NO", "Use LOGIN")
+		case "STARTTLS":
+			c.tagged(tag, "BAD", "TLS is not supported on localhost")
+		default:
+			c.tagged(tag, "BAD", "Log in first")
+		}
+		return false
+	}
+
+	switch name {
+	case "LOGIN", "AUTHENTICATE":
+		c.tagged(tag, "BAD", "Already logged in")
+	case "SELECT", "EXAMINE":
+		c.selectMailbox(tag, name, args)
+	case "LIST", "LSUB":
+		c.list(tag, name, args)
+	case "STATUS":
+		c.status(tag, args)
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		// Every mailbox counts as subscribed, so clients showing only
+		// subscribed ones still see them all
+		c.tagged(tag, "OK", name+" completed")
+	case "CREATE", "DELETE", "RENAME", "APPEND":
+		c.tagged(tag, "NO", "[CANNOT] The archive is read-only")
+	default:
+		c.handleSelected(tag, name, args)
+	}
+	return false
+}
+
+// handleSelected runs a command that needs a selected mailbox
+func (c *session) handleSelected(tag, name string, args []token) {
+	uid := false
+	if name == "UID" {
+		if len(args) == 0 {
+			c.tagged(tag, "BAD", "UID needs a command")
+			return
+		}
+		sub, _ := args[0].text()
+		name, args, uid = "UID "+strings.ToUpper(sub), args[1:], true
+	}
+
+	switch name {
+	case "CHECK", "CLOSE", "UNSELECT", "EXPUNGE", "SEARCH", "FETCH", "STORE", "COPY", "MOVE",
+		"UID SEARCH", "UID FETCH", "UID STORE", "UID COPY", "UID MOVE", "UID EXPUNGE":
+	default:
+		c.tagged(tag, "BAD", "Unknown command")
+		return
+	}
+	if c.selected == nil {
+		c.tagged(tag, "BAD", "No mailbox selected")
+		return
+	}
+
+	switch strings.TrimPrefix(name, "UID ") {
+	case "CHECK":
+		c.noop(tag)
+	case "CLOSE", "UNSELECT":
+		// Nothing is ever deleted, so CLOSE has nothing to expunge
+		c.selected, c.msgs, c.cached = nil, nil, nil
+		c.tagged(tag, "OK", name+" completed")
+	case "SEARCH":
+		c.search(tag, args, uid)
+	case "FETCH":
+		c.fetch(tag, args, uid)
+	default:
+		c.tagged(tag, "NO", "[CANNOT] The archive is read-only")
+	}
+}
+
+// login checks the password against the auth token when one is required
+func (c *session) login(tag string, args []token) {
+	if len(args) != 2 {
+		c.tagged(tag, "BAD", "LOGIN needs a user name and password")
+		return
+	}
+	password, ok := args[1].text()
+	if !ok {
+		c.tagged(tag, "BAD", "Invalid password")
+		return
+	}
+	if c.server.requireAuth && subtle.ConstantTimeCompare([]byte(password), []byte(c.server.authToken)) != 1 {
+		c.tagged(tag, "NO", "[AUTHENTICATIONFAILED] Invalid credentials")
+		return
+	}
+	c.authenticated = true
+	c.tagged(tag, "OK", "[CAPABILITY "+capabilities+"] LOGIN completed")
+}
+
+// noop reports emails indexed or removed since the mailbox was selected
+func (c *session) noop(tag string) {
+	if c.selected != nil {
+		if err := c.refresh(); err != nil {
+			log.Printf("IMAP: failed to refresh %q: %v", c.selected.name, err)
+			c.tagged(tag, "NO", "[SERVERBUG] Failed to refresh the mailbox")
+			return
+		}
+	}
+	c.tagged(tag, "OK", "NOOP completed")
+}
+
+// refresh sends EXPUNGE for emails gone from the selected mailbox and
+// EXISTS when new ones arrived. New emails always get higher UIDs, so they
+// are appended, and only they are loaded.
+func (c *session) refresh() error {
+	uids, err := c.selected.uids()
+	if err != nil {
+		return err
+	}
+	present := make(map[int64]bool, len(uids))
+	for _, uid := range uids {
+		present[uid] = true
+	}
+
+	changed := false
+	for i := len(c.msgs) - 1; i >= 0; i-- {
+		if !present[c.msgs[i].ID] {
+			c.untagged(fmt.Sprintf("%d EXPUNGE", i+1))
+			c.msgs = append(c.msgs[:i], c.msgs[i+1:]...)
+			changed = true
+		}
+	}
+	var maxUID int64
+	if len(c.msgs) > 0 {
+		maxUID = c.msgs[len(c.msgs)-1].ID
+	}
+	if len(uids) > 0 && uids[len(uids)-1] > maxUID {
+		added, err := c.selected.source.DB.ListEmailsAfter(maxUID)
+		if err != nil {
+			return err
+		}
+		for _, e := range added {
+			if present[e.ID] {
+				c.msgs = append(c.msgs, e)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.untagged(fmt.Sprintf("%d EXISTS", len(c.msgs)))
+	}
+	return nil
+}
+
+// selectMailbox opens a mailbox. Both SELECT and EXAMINE open it read-only.
+func (c *session) selectMailbox(tag, name string, args []token) {
+	c.selected, c.msgs, c.cached = nil, nil, nil
+	if len(args) != 1 {
+		c.tagged(tag, "BAD", name+" needs a mailbox name")
+		return
+	}
+	m, ok := c.findSelectable(tag, args[0])
+	if !ok {
+		return
+	}
+	msgs, err := m.messages()
+	if err != nil {
+		c.serverError(tag, "load mailbox", err)
+		return
+	}
+	validity, err := c.server.uidValidity(m.source)
+	if err != nil {
+		c.serverError(tag, "load mailbox", err)
+		return
+	}
+	uidNext, err := m.uidNext()
+	if err != nil {
+		c.serverError(tag, "load mailbox", err)
+		return
+	}
+
+	c.selected, c.msgs = m, msgs
+	c.untagged(`FLAGS (\Seen)`)
+	c.untagged(fmt.Sprintf("%d EXISTS", len(msgs)))
+	c.untagged("0 RECENT")
+	c.untagged("OK [PERMANENTFLAGS ()] The archive is read-only")
+	c.untagged(fmt.Sprintf("OK [UIDVALIDITY %d] UIDs valid", validity))
+	c.untagged(fmt.Sprintf("OK [UIDNEXT %d] Predicted next UID", uidNext))
+	c.tagged(tag, "OK", "[READ-ONLY] "+name+" completed")
+}
+
+// findSelectable looks up a mailbox that holds emails, answering NO if
+// there is none
+func (c *session) findSelectable(tag string, arg token) (*mailbox, bool) {
+	encoded, ok := arg.text()
+	if !ok {
+		c.tagged(tag, "BAD", "Invalid mailbox name")
+		return nil, false
+	}
+	m, err := c.server.findMailbox(encoded)
+	if err != nil {
+		c.serverError(tag, "find mailbox", err)
+		return nil, false
+	}
+	if m == nil || m.noSelect {
+		c.tagged(tag, "NO", "[NONEXISTENT] No such mailbox")
+		return nil, false
+	}
+	return m, true
+}
+
+// list answers LIST and LSUB with the mailboxes matching a pattern
+func (c *session) list(tag, name string, args []token) {
+	if len(args) != 2 {
+		c.tagged(tag, "BAD", name+" needs a reference and a pattern")
+		return
+	}
+	reference, ok1 := args[0].text()
+	pattern, ok2 := args[1].text()
+	if !ok1 || !ok2 {
+		c.tagged(tag, "BAD", "Invalid reference or pattern")
+		return
+	}
+
+	if pattern == "" {
+		// An empty pattern asks for the delimiter
+		c.untagged(fmt.Sprintf(`%s (\Noselect) "%s" ""`, name, delimiter))
+		c.tagged(tag, "OK", name+" completed")
+		return
+	}
+
+	list, err := c.server.mailboxes()
+	if err != nil {
+		c.serverError(tag, "list mailboxes", err)
+		return
+	}
+	full := reference + pattern
+	for _, m := range list {
+		encoded := imaputf7.Encode(m.name)
+		if !matchPattern(full, encoded) && !(m.name == "INBOX" && matchPattern(strings.ToUpper(full), "INBOX")) {
+			continue
+		}
+		c.untagged(fmt.Sprintf(`%s %s "%s" %s`, name, attributes(m, list), delimiter, quote(encoded)))
+	}
+	c.tagged(tag, "OK", name+" completed")
+}
+
+// status reports a mailbox's counts without selecting it
+func (c *session) status(tag string, args []token) {
+	if len(args) != 2 || !args[1].isList {
+		c.tagged(tag, "BAD", "STATUS needs a mailbox and a list of items")
+		return
+	}
+	m, ok := c.findSelectable(tag, args[0])
+	if !ok {
+		return
+	}
+	uids, err := m.uids()
+	if err != nil {
+		c.serverError(tag, "load mailbox", err)
+		return
+	}
+
+	var items []string
+	for _, item := range args[1].list {
+		switch strings.ToUpper(item.atom) {
+		case "MESSAGES":
+			items = append(items, fmt.Sprintf("MESSAGES %d", len(uids)))
+		case "RECENT":
+			items = append(items, "RECENT 0")
+		case "UNSEEN":
+			items = append(items, "UNSEEN 0")
+		case "UIDNEXT":
+			uidNext, err := m.uidNext()
+			if err != nil {
+				c.serverError(tag, "load mailbox", err)
+				return
+			}
+			items = append(items, fmt.Sprintf("UIDNEXT %d", uidNext))
+		case "UIDVALIDITY":
+			validity, err := c.server.uidValidity(m.source)
+			if err != nil {
+				c.serverError(tag, "load mailbox", err)
+				return
+			}
+			items = append(items, fmt.Sprintf("UIDVALIDITY %d", validity))
+		default:
+			c.tagged(tag, "BAD", "Unknown status item "+item.atom)
+			return
+		}
+	}
+	c.untagged(fmt.Sprintf("STATUS %s (%s)", quote(imaputf7.Encode(m.name)), strings.Join(items, " ")))
+	c.tagged(tag, "OK", "STATUS completed")
+}
+
+// untagged writes an untagged response line
+func (c *session) untagged(line string) {
+	c.w.WriteString("* " + line + "\r\n")
+}
+
+// tagged writes a command's completion result
+func (c *session) tagged(tag, status, text string) {
+	c.w.WriteString(tag + " " + status + " " + text + "\r\n")
+}
+
+// serverError logs a failure and answers NO
+func (c *session) serverError(tag, action string, err error) {
+	log.Printf("IMAP: failed to %s: %v", action, err)
+	c.tagged(tag, "NO", "[SERVERBUG] Failed to "+action)
+}
@@ -0,0 +1,383 @@
+package imapserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reportEML = "From: Dana <dana@test.com>\r\n" +
+	"To: erin@test.com\r\n" +
+	"Cc: frank@test.com\r\n" +
+	"Subject: Report\r\n" +
+	"Date: Mon, 3 Jun 2024 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"See attached\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"attachment text\r\n" +
+	"--b1--\r\n"
+
+// setupCollection writes and indexes three emails, one in a subfolder, and
+// saves a search finding the report
+func setupCollection(t *testing.T) (*db.DB, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	database := db.SetupTestDB(t)
+	database.SetEmailsPath(dir)
+	t.Cleanup(func() { db.CleanupTestDB(t, database) })
+
+	files := map[string]string{
+		"a.eml":      "From: Alice <alice@test.com>\r\nTo: bob@test.com\r\nSubject: Lunch\r\nDate: Sat, 1 Jun 2024 12:00:00 +0000\r\n\r\nPizza on Friday\r\n",
+		"sub/b.eml":  "From: bob@test.com\nTo: alice@test.com\nSubject: Budget\nDate: Sun, 2 Jun 2024 09:30:00 +0000\n\nSecond quarter numbers\n",
+		"report.eml": reportEML,
+	}
+	writeEmails(t, dir, files)
+	result, err := indexer.NewIndexer(database, dir, false).IndexAll()
+	require.NoError(t, err)
+	require.Equal(t, 3, result.NewIndexed)
+
+	_, err = database.CreateSavedSearch("Reports", db.SearchFilters{Query: "attached"})
+	require.NoError(t, err)
+	return database, dir
+}
+
+func writeEmails(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// startServer serves sources on a random local port
+func startServer(t *testing.T, sources []Source, requireAuth bool, token string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := New(sources, requireAuth, token)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+// testClient speaks raw IMAP to the server
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	tags int
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	greeting := c.readLine()
+	require.True(t, strings.HasPrefix(greeting, "* OK"), greeting)
+	return c
+}
+
+// literalSize matches a response line ending in a literal
+var literalSize = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readLine reads a response line, with any literals it carries inline after
+// their size
+func (c *testClient) readLine() string {
+	var sb strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		require.NoError(c.t, err)
+		line = strings.TrimSuffix(line, "\r\n")
+		sb.WriteString(line)
+
+		m := literalSize.FindStringSubmatch(line)
+		if m == nil {
+			return sb.String()
+		}
+		n, _ := strconv.Atoi(m[1])
+		literal := make([]byte, n)
+		_, err = io.ReadFull(c.r, literal)
+		require.NoError(c.t, err)
+		sb.Write(literal)
+	}
+}
+
+// run sends a command, returning the untagged responses and the tagged
+// status line without its tag
+func (c *testClient) run(format string, args ...interface{}) ([]string, string) {
+	c.t.Helper()
+
+	c.tags++
+	tag := fmt.Sprintf("a%d", c.tags)
+	_, err := fmt.Fprintf(c.conn, tag+" "+format+"\r\n", args...)
+	require.NoError(c.t, err)
+
+	var untagged []string
+	for {
+		line := c.readLine()
+		if strings.HasPrefix(line, tag+" ") {
+			return untagged, strings.TrimPrefix(line, tag+" ")
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+// ok runs a command that must succeed
+func (c *testClient) ok(format string, args ...interface{}) []string {
+	c.t.Helper()
+	untagged, status := c.run(format, args...)
+	require.True(c.t, strings.HasPrefix(status, "OK"), "%s: %s", fmt.Sprintf(format, args...), status)
+	return untagged
+}
+
+// TestLogin tests that LOGIN needs the auth token when auth is required
+func TestLogin(t *testing.T) {
+	database, _ := setupCollection(t)
+	addr := startServer(t, []Source{{Name: "default", DB: database}}, true, "secret")
+	c := dial(t, addr)
+
+	_, status := c.run(`LIST "" "*"`)
+	assert.True(t, strings.HasPrefix(status, "BAD"), status)
+
+	_, status = c.run(`LOGIN user wrong`)
+	assert.True(t, strings.HasPrefix(status, "NO [AUTHENTICATIONFAILED]"), status)
+
+	c.ok(`LOGIN user secret`)
+	c.ok(`LIST "" "*"`)
+
+	// Without auth any credentials work
+	addr = startServer(t, []Source{{Name: "default", DB: database}}, false, "")
+	c = dial(t, addr)
+	c.ok(`LOGIN anyone "any thing"`)
+}
+
+// TestListAndSelect tests the mailbox hierarchy and read-only selection
+func TestListAndSelect(t *testing.T) {
+	database, _ := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "default", DB: database}}, false, ""))
+	c.ok(`LOGIN user pass`)
+
+	lines := c.ok(`LIST "" "*"`)
+	assert.Equal(t, []string{
+		`* LIST (\HasNoChildren) "/" "INBOX"`,
+		`* LIST (\Noselect \HasChildren) "/" "Folders"`,
+		`* LIST (\HasNoChildren) "/" "Folders/sub"`,
+		`* LIST (\Noselect \HasChildren) "/" "Saved Searches"`,
+		`* LIST (\HasNoChildren) "/" "Saved Searches/Reports"`,
+	}, lines)
+
+	lines = c.ok(`LIST "" "%%"`)
+	assert.Len(t, lines, 3, "%% stops at the delimiter")
+
+	lines, status := c.run(`SELECT inbox`)
+	assert.Contains(t, lines, "* 3 EXISTS")
+	assert.Equal(t, "OK [READ-ONLY] SELECT completed", status)
+
+	lines = c.ok(`EXAMINE "Folders/sub"`)
+	assert.Contains(t, lines, "* 1 EXISTS")
+
+	lines = c.ok(`STATUS "Saved Searches/Reports" (MESSAGES UNSEEN)`)
+	assert.Equal(t, []string{`* STATUS "Saved Searches/Reports" (MESSAGES 1 UNSEEN 0)`}, lines)
+
+	_, status = c.run(`SELECT Folders`)
+	assert.True(t, strings.HasPrefix(status, "NO"), "a \\Noselect parent cannot be selected")
+	_, status = c.run(`SELECT Missing`)
+	assert.True(t, strings.HasPrefix(status, "NO [NONEXISTENT]"), status)
+}
+
+// TestFetch tests fetching envelopes, structure and sections from the files
+func TestFetch(t *testing.T) {
+	database, dir := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "default", DB: database}}, false, ""))
+	c.ok(`LOGIN user pass`)
+	c.ok(`SELECT INBOX`)
+
+	report := findEmail(t, database, "report.eml")
+	lines := c.ok(`UID FETCH %d (FLAGS ENVELOPE RFC822.SIZE)`, report.ID)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], fmt.Sprintf("UID %d", report.ID))
+	assert.Contains(t, lines[0], `FLAGS (\Seen)`)
+	assert.Contains(t, lines[0], `"Report" (("Dana" NIL "dana" "test.com"))`)
+	assert.Contains(t, lines[0], `(("Dana" NIL "dana" "test.com")) ((NIL NIL "erin" "test.com")) ((NIL NIL "frank" "test.com")) NIL`)
+	assert.Contains(t, lines[0], fmt.Sprintf("RFC822.SIZE %d", len(reportEML)))
+
+	lines = c.ok(`UID FETCH %d (BODYSTRUCTURE)`, report.ID)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `("TEXT" "PLAIN" ("CHARSET" "utf-8") NIL NIL "7BIT" 12 1`)
+	assert.Contains(t, lines[0], `("ATTACHMENT" ("FILENAME" "notes.txt"))`)
+	assert.Contains(t, lines[0], `"MIXED" ("BOUNDARY" "b1")`)
+
+	lines = c.ok(`UID FETCH %d (BODY.PEEK[2] BODY.PEEK[HEADER.FIELDS (Subject)] BODY.PEEK[1.MIME] BODY[]<0.4>)`, report.ID)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "BODY[2] {15}attachment text")
+	assert.Contains(t, lines[0], "BODY[HEADER.FIELDS (Subject)] {19}Subject: Report\r\n\r\n")
+	assert.Contains(t, lines[0], "BODY[1.MIME] {43}Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	assert.Contains(t, lines[0], "BODY[]<0> {4}From")
+
+	// Bare LF line endings are served as CRLF
+	budget := findEmail(t, database, "sub/b.eml")
+	lines = c.ok(`UID FETCH %d (BODY.PEEK[TEXT])`, budget.ID)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "BODY[TEXT] {24}Second quarter numbers\r\n")
+
+	// The whole message matches the file
+	lines = c.ok(`UID FETCH %d (RFC822)`, report.ID)
+	raw, err := os.ReadFile(filepath.Join(dir, "report.eml"))
+	require.NoError(t, err)
+	assert.Contains(t, lines[0], string(raw))
+
+	lines = c.ok(`FETCH 1:* (UID)`)
+	assert.Len(t, lines, 3)
+}
+
+// TestSearch tests search keys on metadata, the search index and headers
+func TestSearch(t *testing.T) {
+	database, _ := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "default", DB: database}}, false, ""))
+	c.ok(`LOGIN user pass`)
+	c.ok(`SELECT INBOX`)
+
+	lunch := findEmail(t, database, "a.eml")
+	budget := findEmail(t, database, "sub/b.eml")
+	report := findEmail(t, database, "report.eml")
+	uids := func(ids ...int64) []string {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		line := "* SEARCH"
+		for _, id := range ids {
+			line += fmt.Sprintf(" %d", id)
+		}
+		return []string{line}
+	}
+
+	assert.Equal(t, uids(budget.ID), c.ok(`UID SEARCH TEXT quarter`))
+	assert.Equal(t, uids(lunch.ID), c.ok(`UID SEARCH FROM alice`))
+	assert.Equal(t, uids(budget.ID, report.ID), c.ok(`UID SEARCH NOT FROM alice`))
+	assert.Equal(t, uids(lunch.ID, budget.ID), c.ok(`UID SEARCH OR SUBJECT lunch SUBJECT budget`))
+	assert.Equal(t, uids(report.ID), c.ok(`UID SEARCH CHARSET UTF-8 TO erin`))
+	assert.Equal(t, uids(report.ID), c.ok(`UID SEARCH CC frank`))
+	assert.Equal(t, uids(report.ID), c.ok(`UID SEARCH HEADER Content-Type multipart`))
+	assert.Equal(t, uids(budget.ID, report.ID), c.ok(`UID SEARCH SINCE 2-Jun-2024`))
+	assert.Equal(t, uids(budget.ID), c.ok(`UID SEARCH (ON 2-Jun-2024 SEEN)`))
+	assert.Equal(t, uids(), c.ok(`UID SEARCH UNSEEN`))
+	assert.Equal(t, uids(lunch.ID, budget.ID, report.ID), c.ok(`UID SEARCH UID 1:*`))
+
+	// Plain SEARCH returns sequence numbers, which follow UID order
+	seq := 1
+	for _, e := range []*db.Email{lunch, report} {
+		if e.ID < budget.ID {
+			seq++
+		}
+	}
+	assert.Equal(t, []string{fmt.Sprintf("* SEARCH %d", seq)}, c.ok(`SEARCH TEXT quarter`))
+
+	_, status := c.run(`SEARCH CHARSET KOI8-R TEXT x`)
+	assert.True(t, strings.HasPrefix(status, "NO [BADCHARSET"), status)
+	_, status = c.run(`SEARCH BOGUS`)
+	assert.True(t, strings.HasPrefix(status, "BAD"), status)
+}
+
+// TestReadOnly tests that changes to the archive are refused
+func TestReadOnly(t *testing.T) {
+	database, _ := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "default", DB: database}}, false, ""))
+	c.ok(`LOGIN user pass`)
+	c.ok(`SELECT INBOX`)
+
+	for _, cmd := range []string{
+		`STORE 1 +FLAGS (\Deleted)`,
+		`UID COPY 1 Trash`,
+		`EXPUNGE`,
+		`CREATE Trash`,
+		`DELETE INBOX`,
+	} {
+		_, status := c.run(cmd)
+		assert.True(t, strings.HasPrefix(status, "NO"), "%s: %s", cmd, status)
+	}
+
+	lines, status := c.run(`APPEND INBOX {5+}` + "\r\nhello")
+	assert.Empty(t, lines)
+	assert.True(t, strings.HasPrefix(status, "NO"), status)
+
+	c.ok(`CLOSE`)
+	_, status = c.run(`FETCH 1 UID`)
+	assert.True(t, strings.HasPrefix(status, "BAD"), "no mailbox is selected after CLOSE")
+}
+
+// TestNoopReportsNewEmails tests that NOOP announces emails indexed since
+// the mailbox was selected
+func TestNoopReportsNewEmails(t *testing.T) {
+	database, dir := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "default", DB: database}}, false, ""))
+	c.ok(`LOGIN user pass`)
+	c.ok(`SELECT INBOX`)
+
+	writeEmails(t, dir, map[string]string{"c.eml": "From: carol@test.com\r\nSubject: New\r\n\r\nHello\r\n"})
+	_, err := indexer.NewIndexer(database, dir, false).IndexAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"* 4 EXISTS"}, c.ok(`NOOP`))
+	assert.Empty(t, c.ok(`NOOP`))
+}
+
+// TestCollectionMailboxes tests that each collection gets its own mailboxes
+func TestCollectionMailboxes(t *testing.T) {
+	first, _ := setupCollection(t)
+	second, _ := setupCollection(t)
+	c := dial(t, startServer(t, []Source{{Name: "acme", DB: first}, {Name: "globex", DB: second}}, false, ""))
+	c.ok(`LOGIN user pass`)
+
+	lines := c.ok(`LIST "" "globex/*"`)
+	assert.Equal(t, []string{
+		`* LIST (\Noselect \HasChildren) "/" "globex/Folders"`,
+		`* LIST (\HasNoChildren) "/" "globex/Folders/sub"`,
+		`* LIST (\Noselect \HasChildren) "/" "globex/Saved Searches"`,
+		`* LIST (\HasNoChildren) "/" "globex/Saved Searches/Reports"`,
+	}, lines)
+
+	assert.Contains(t, c.ok(`SELECT acme`), "* 3 EXISTS")
+	assert.Contains(t, c.ok(`SELECT "globex/Folders/sub"`), "* 1 EXISTS")
+}
+
+// findEmail returns the indexed email with the given path
+func findEmail(t *testing.T, database *db.DB, path string) *db.Email {
+	t.Helper()
+	emails, err := database.ListAllEmails()
+	require.NoError(t, err)
+	for _, e := range emails {
+		if e.FilePath == path {
+			return e
+		}
+	}
+	t.Fatalf("email %s not indexed", path)
+	return nil
+}
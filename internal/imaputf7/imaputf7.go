@@ -0,0 +1,82 @@
+// Package imaputf7 converts mailbox names to and from the modified UTF-7 of
+// RFC 3501, which IMAP uses for names outside ASCII.
+package imaputf7
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// utf7Encoding is the base64 variant of modified UTF-7, with , for /
+var utf7Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// Encode encodes a UTF-8 mailbox name in IMAP's modified UTF-7
+func Encode(name string) string {
+	var sb strings.Builder
+	var pending []rune
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		raw := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			raw = append(raw, byte(u>>8), byte(u))
+		}
+		sb.WriteByte('&')
+		sb.WriteString(utf7Encoding.EncodeToString(raw))
+		sb.WriteByte('-')
+		pending = pending[:0]
+	}
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				sb.WriteString("&-")
+			} else {
+				sb.WriteRune(r)
+			}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	flush()
+	return sb.String()
+}
+
+// Decode decodes a modified UTF-7 mailbox name
+func Decode(name string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '&' {
+			sb.WriteByte(name[i])
+			continue
+		}
+		end := strings.IndexByte(name[i:], '-')
+		if end < 0 {
+			return "", errors.New("unterminated modified UTF-7 sequence")
+		}
+		encoded := name[i+1 : i+end]
+		i += end
+		if encoded == "" {
+			sb.WriteByte('&')
+			continue
+		}
+		raw, err := utf7Encoding.DecodeString(encoded)
+		if err != nil || len(raw)%2 != 0 {
+			return "", errors.New("invalid modified UTF-7 sequence")
+		}
+		units := make([]uint16, len(raw)/2)
+		for j := range units {
+			units[j] = uint16(raw[2*j])<<8 | uint16(raw[2*j+1])
+		}
+		sb.WriteString(string(utf16.Decode(units)))
+	}
+	if !utf8.ValidString(sb.String()) {
+		return "", errors.New("invalid mailbox name")
+	}
+	return sb.String(), nil
+}
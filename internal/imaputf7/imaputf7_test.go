@@ -0,0 +1,28 @@
+package imaputf7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoundTrip tests modified UTF-7 mailbox names
+func TestRoundTrip(t *testing.T) {
+	tests := map[string]string{
+		"Inbox":    "Inbox",
+		"Entwürfe": "Entw&APw-rfe",
+		"R&D":      "R&-D",
+		"台北":       "&U,BTFw-",
+		"a/日本語/b":  "a/&ZeVnLIqe-/b",
+	}
+	for name, encoded := range tests {
+		assert.Equal(t, encoded, Encode(name))
+		decoded, err := Decode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, name, decoded)
+	}
+
+	_, err := Decode("&Jjo")
+	assert.Error(t, err)
+}
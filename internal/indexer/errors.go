@@ -0,0 +1,45 @@
+package indexer
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-message"
+)
+
+// Categories of indexing failure
+const (
+	FailUnreadable = "unreadable"     // The file could not be opened or read
+	FailMalformed  = "malformed MIME" // The file is not a parseable email
+	FailCharset    = "charset"        // A part uses a charset that cannot be decoded
+	FailDBWrite    = "db write"       // The email could not be stored
+)
+
+// FailCategories lists the failure categories in display order
+var FailCategories = []string{FailUnreadable, FailMalformed, FailCharset, FailDBWrite}
+
+// FileError is why a file could not be indexed
+type FileError struct {
+	Category string
+	Err      error
+}
+
+func (e *FileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// parseError categorizes an error from parsing an email
+func parseError(err error) *FileError {
+	if message.IsUnknownCharset(err) {
+		return &FileError{Category: FailCharset, Err: err}
+	}
+	return &FileError{Category: FailMalformed, Err: err}
+}
+
+// readError categorizes an error from opening or reading a file
+func readError(err error) *FileError {
+	return &FileError{Category: FailUnreadable, Err: fmt.Errorf("failed to open file: %w", err)}
+}
@@ -1,6 +1,10 @@
 package indexer
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
@@ -13,8 +17,14 @@ import (
 	"github.com/felo/eml-viewer/internal/db"
 	"github.com/felo/eml-viewer/internal/parser"
 	"github.com/felo/eml-viewer/internal/scanner"
+	"github.com/felo/eml-viewer/internal/similarity"
 )
 
+// ParserVersion is stamped on every email the indexer writes. Bump it when a
+// change to parsing alters what is stored for an email; emails stamped with
+// an older version are then parsed again in the background.
+const ParserVersion = 1
+
 // Indexer handles email indexing operations
 type Indexer struct {
 	db          *db.DB
@@ -23,6 +33,9 @@ type Indexer struct {
 	concurrency int           // Number of concurrent workers
 	batchSize   int           // Number of emails to batch before writing
 	flushTime   time.Duration // Maximum time to wait before flushing batch
+	scanPII     bool          // Whether to scan new emails for sensitive data
+	dkimKeys    parser.DKIMKeyStore
+	reparseWait time.Duration // Pause after each re-parsed email
 }
 
 // parsedEmail holds a parsed email with its attachments ready for batching
@@ -30,13 +43,15 @@ type parsedEmail struct {
 	email       *db.Email
 	attachments []parser.ParsedAttachment
 	filePath    string
+	findings    []*db.PIIFinding // Sensitive data, if the PII scan is enabled
+	links       []*db.Link
 }
 
 // batchWriteResult holds the result of processing a batch write
 type batchWriteResult struct {
 	indexed     int
-	failed      int
 	failedFiles []string
+	err         *FileError // Why failedFiles could not be written
 }
 
 // NewIndexer creates a new indexer
@@ -60,6 +75,25 @@ func (idx *Indexer) WithConcurrency(workers int) *Indexer {
 	return idx
 }
 
+// WithPIIScan enables scanning new emails for sensitive data while indexing
+func (idx *Indexer) WithPIIScan(enabled bool) *Indexer {
+	idx.scanPII = enabled
+	return idx
+}
+
+// WithDKIMKeys sets the public keys used to verify DKIM signatures offline
+func (idx *Indexer) WithDKIMKeys(keys parser.DKIMKeyStore) *Indexer {
+	idx.dkimKeys = keys
+	return idx
+}
+
+// WithReparseWait sets the pause after each email Reparse updates, leaving
+// the database free for other work in between
+func (idx *Indexer) WithReparseWait(wait time.Duration) *Indexer {
+	idx.reparseWait = wait
+	return idx
+}
+
 // IndexResult contains statistics about an indexing operation
 type IndexResult struct {
 	TotalFound  int
@@ -67,17 +101,47 @@ type IndexResult struct {
 	Skipped     int
 	Failed      int
 	FailedFiles []string
+	Errors      map[string]*FileError // Why each failed file failed, by path
+}
+
+// fail records a file that could not be indexed
+func (r *IndexResult) fail(filePath string, err *FileError) {
+	r.Failed++
+	r.FailedFiles = append(r.FailedFiles, filePath)
+	if r.Errors == nil {
+		r.Errors = make(map[string]*FileError)
+	}
+	r.Errors[filePath] = err
 }
 
 // IndexAll scans and indexes all .eml files using concurrent workers
 func (idx *Indexer) IndexAll() (*IndexResult, error) {
-	return idx.indexAllConcurrent()
+	return idx.IndexAllContext(context.Background())
+}
+
+// IndexAllContext is IndexAll, stopping early when ctx is cancelled. Emails
+// already parsed are still written in whole batches, and the partial result
+// is returned with ctx's error.
+func (idx *Indexer) IndexAllContext(ctx context.Context) (*IndexResult, error) {
+	return idx.indexConcurrent(ctx, nil)
+}
+
+// IndexWithProgress indexes all files and reports progress via a callback
+func (idx *Indexer) IndexWithProgress(progress func(current, total int, filePath string)) (*IndexResult, error) {
+	return idx.IndexWithProgressContext(context.Background(), progress)
+}
+
+// IndexWithProgressContext is IndexWithProgress, stopping early when ctx is
+// cancelled as IndexAllContext does
+func (idx *Indexer) IndexWithProgressContext(ctx context.Context, progress func(current, total int, filePath string)) (*IndexResult, error) {
+	return idx.indexConcurrent(ctx, progress)
 }
 
-// indexAllConcurrent indexes files using a worker pool with batch writes
-func (idx *Indexer) indexAllConcurrent() (*IndexResult, error) {
+// indexConcurrent indexes files using a worker pool with batch writes,
+// reporting progress if the callback is set
+func (idx *Indexer) indexConcurrent(ctx context.Context, progress func(current, total int, filePath string)) (*IndexResult, error) {
 	// Get all .eml files
-	files, err := idx.scanner.Scan()
+	files, err := idx.scanner.ScanContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan for files: %w", err)
 	}
@@ -91,6 +155,26 @@ func (idx *Indexer) indexAllConcurrent() (*IndexResult, error) {
 		log.Printf("Found %d .eml files to process with %d workers\n", result.TotalFound, idx.concurrency)
 	}
 
+	// Failures recorded for files no longer in the folder can't be retried
+	if err := idx.db.PruneIndexErrors(files); err != nil {
+		log.Printf("Error pruning index errors: %v\n", err)
+	}
+
+	return idx.indexFiles(ctx, files, result, progress)
+}
+
+// IndexFilesContext indexes the given files, relative to the emails folder,
+// skipping any already indexed. It is used to retry files that failed.
+func (idx *Indexer) IndexFilesContext(ctx context.Context, files []string, progress func(current, total int, filePath string)) (*IndexResult, error) {
+	result := &IndexResult{
+		TotalFound:  len(files),
+		FailedFiles: make([]string, 0),
+	}
+	return idx.indexFiles(ctx, files, result, progress)
+}
+
+// indexFiles indexes those of files not yet in the database, adding to result
+func (idx *Indexer) indexFiles(ctx context.Context, files []string, result *IndexResult, progress func(current, total int, filePath string)) (*IndexResult, error) {
 	// Check which files already exist in the database (batch check)
 	existingFiles, err := idx.db.EmailsExistBatch(files)
 	if err != nil {
@@ -127,7 +211,7 @@ func (idx *Indexer) indexAllConcurrent() (*IndexResult, error) {
 	var parseWg sync.WaitGroup
 	for i := 0; i < idx.concurrency; i++ {
 		parseWg.Add(1)
-		go idx.parseWorker(&parseWg, fileChan, parsedChan, batchChan)
+		go idx.parseWorker(ctx, &parseWg, fileChan, parsedChan, batchChan)
 	}
 
 	// Start batch writer
@@ -136,49 +220,77 @@ func (idx *Indexer) indexAllConcurrent() (*IndexResult, error) {
 	batchResultChan := make(chan batchWriteResult, 10)
 	go idx.batchWriter(&batchWg, batchChan, batchResultChan)
 
-	// Send files to workers
+	// Queue files for the workers, which stop taking them once ctx is cancelled
 	for _, file := range filesToProcess {
 		fileChan <- file
 	}
 	close(fileChan)
 
-	// Wait for all parsers to finish, then close batch channel
+	// Wait for all parsers to finish, then close channels
 	go func() {
 		parseWg.Wait()
 		close(batchChan)
+		close(parsedChan)
 	}()
 
-	// Wait for batch writer to finish
+	// Wait for batch writer to finish, then close result channel
 	go func() {
 		batchWg.Wait()
 		close(batchResultChan)
-		close(parsedChan)
 	}()
 
-	// Collect parse results (for skipped/failed tracking)
-	processedCount := 0
+	// Collect parse results with progress reporting. They are kept apart from
+	// result until collection ends, as batch results arrive concurrently.
+	var parseSkipped int
+	var parseFailed []indexResult
+	parseDone := make(chan struct{})
 	go func() {
+		processedCount := 0
 		for res := range parsedChan {
 			processedCount++
+			if progress != nil {
+				progress(processedCount, len(filesToProcess), res.filePath)
+			}
 			if idx.verbose && processedCount%10 == 0 {
 				log.Printf("Processing file %d/%d...\n", processedCount, len(filesToProcess))
 			}
 
 			switch res.status {
 			case statusSkipped:
-				result.Skipped++
+				parseSkipped++
 			case statusFailed:
-				result.Failed++
-				result.FailedFiles = append(result.FailedFiles, res.filePath)
+				parseFailed = append(parseFailed, res)
 			}
 		}
+		close(parseDone)
 	}()
 
 	// Collect batch write results
 	for batchRes := range batchResultChan {
 		result.NewIndexed += batchRes.indexed
-		result.Failed += batchRes.failed
-		result.FailedFiles = append(result.FailedFiles, batchRes.failedFiles...)
+		for _, file := range batchRes.failedFiles {
+			result.fail(file, batchRes.err)
+		}
+	}
+
+	// Wait for parse result collection to finish
+	<-parseDone
+	result.Skipped += parseSkipped
+	for _, res := range parseFailed {
+		result.fail(res.filePath, res.err)
+	}
+
+	// Keep the reasons for the problems page
+	if err := idx.db.RecordIndexErrors(indexErrors(result.Errors)); err != nil {
+		log.Printf("Error recording index errors: %v\n", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		if idx.verbose {
+			log.Printf("Indexing cancelled: %d new, %d skipped, %d failed\n",
+				result.NewIndexed, result.Skipped, result.Failed)
+		}
+		return result, err
 	}
 
 	if idx.verbose {
@@ -200,66 +312,30 @@ const (
 type indexResult struct {
 	filePath string
 	status   indexStatus
+	err      *FileError // Set for statusFailed
 }
 
 // parseWorker reads and parses EML files, sending parsed data to batch writer
-func (idx *Indexer) parseWorker(wg *sync.WaitGroup, fileChan <-chan string, resultChan chan<- indexResult, batchChan chan<- *parsedEmail) {
+func (idx *Indexer) parseWorker(ctx context.Context, wg *sync.WaitGroup, fileChan <-chan string, resultChan chan<- indexResult, batchChan chan<- *parsedEmail) {
 	defer wg.Done()
 
 	for filePath := range fileChan {
-		// Resolve relative path to absolute path (scanner returns relative paths)
-		absolutePath := filepath.Join(idx.scanner.GetRootPath(), filePath)
-
-		// Parse the email
-		parsed, err := parser.ParseEMLFile(absolutePath)
-		if err != nil {
-			log.Printf("Error parsing %s: %v\n", absolutePath, err)
-			resultChan <- indexResult{
-				filePath: filePath,
-				status:   statusFailed,
-			}
-			continue
+		if ctx.Err() != nil {
+			return
 		}
 
-		// Get file size
-		fileInfo, err := os.Stat(absolutePath)
-		if err != nil {
-			log.Printf("Error getting file info for %s: %v\n", absolutePath, err)
+		p, fileErr := idx.parseFile(filePath)
+		if fileErr != nil {
 			resultChan <- indexResult{
 				filePath: filePath,
 				status:   statusFailed,
+				err:      fileErr,
 			}
 			continue
 		}
 
-		// Create email record (metadata only, truncate body text to 10KB for FTS5)
-		bodyTextPreview := parsed.BodyText
-		if len(bodyTextPreview) > 10240 {
-			bodyTextPreview = bodyTextPreview[:10240]
-		}
-
-		email := &db.Email{
-			FilePath:         filePath,
-			MessageID:        parsed.MessageID,
-			InReplyTo:        parsed.InReplyTo,
-			ThreadReferences: strings.Join(parsed.References, ", "),
-			Subject:          parsed.Subject,
-			Sender:           parsed.Sender,
-			SenderName:       parsed.SenderName,
-			Recipients:       strings.Join(parsed.Recipients, ", "),
-			Date:             db.NullTime{Time: parsed.Date, Valid: !parsed.Date.IsZero()},
-			BodyTextPreview:  bodyTextPreview,
-			HasAttachments:   len(parsed.Attachments) > 0,
-			AttachmentCount:  len(parsed.Attachments),
-			FileSize:         fileInfo.Size(),
-		}
-
 		// Send to batch writer
-		batchChan <- &parsedEmail{
-			email:       email,
-			attachments: parsed.Attachments,
-			filePath:    filePath,
-		}
+		batchChan <- p
 
 		// Signal successful parse (for progress tracking)
 		resultChan <- indexResult{
@@ -269,6 +345,141 @@ func (idx *Indexer) parseWorker(wg *sync.WaitGroup, fileChan <-chan string, resu
 	}
 }
 
+// parseFile reads and parses an .eml file, relative to the emails folder,
+// into the records the indexer stores for it
+func (idx *Indexer) parseFile(filePath string) (*parsedEmail, *FileError) {
+	// Resolve relative path to absolute path (scanner returns relative paths)
+	absolutePath := filepath.Join(idx.scanner.GetRootPath(), filePath)
+
+	// Parse the email, hashing the exact bytes that were read
+	parsed, fileHash, authVerdict, fileErr := idx.readEML(absolutePath)
+	if fileErr != nil {
+		log.Printf("Error parsing %s: %v\n", absolutePath, fileErr)
+		return nil, fileErr
+	}
+
+	// Get file size
+	fileInfo, err := os.Stat(absolutePath)
+	if err != nil {
+		log.Printf("Error getting file info for %s: %v\n", absolutePath, err)
+		return nil, readError(err)
+	}
+
+	// Date undated emails by the file, now that it has been stat'ed
+	parsed.WithFileTime(fileInfo.ModTime())
+
+	// Create email record (metadata only, truncate body text to 10KB for FTS5)
+	bodyTextPreview := parsed.BodyText
+	if len(bodyTextPreview) > 10240 {
+		bodyTextPreview = bodyTextPreview[:10240]
+	}
+
+	email := &db.Email{
+		FilePath:         filePath,
+		MessageID:        parsed.MessageID,
+		InReplyTo:        parsed.InReplyTo,
+		ThreadReferences: strings.Join(parsed.References, ", "),
+		Subject:          parsed.Subject,
+		Sender:           parsed.Sender,
+		SenderName:       parsed.SenderName,
+		Recipients:       strings.Join(parsed.Recipients, ", "),
+		Date:             db.NullTime{Time: parsed.Date, Valid: !parsed.Date.IsZero()},
+		DateSource:       parsed.DateSource,
+		BodyTextPreview:  bodyTextPreview,
+		HasAttachments:   len(parsed.Attachments) > 0,
+		AttachmentCount:  len(parsed.Attachments),
+		FileSize:         fileInfo.Size(),
+		SHA256:           fileHash,
+		ContentHash:      parser.ContentHash(parsed),
+		BodyHash:         bodyHash(parsed),
+		MinHash:          bodySignature(parsed),
+		AuthVerdict:      authVerdict,
+		ParserVersion:    ParserVersion,
+	}
+
+	var findings []*db.PIIFinding
+	if idx.scanPII {
+		findings = sensitiveFindings(parsed)
+	}
+
+	return &parsedEmail{
+		email:       email,
+		attachments: parsed.Attachments,
+		filePath:    filePath,
+		findings:    findings,
+		links:       emailLinks(parsed),
+	}, nil
+}
+
+// readEML reads and parses an .eml file and returns the SHA-256 of its bytes
+// and its authentication verdict
+func (idx *Indexer) readEML(path string) (*parser.ParsedEmail, string, string, *FileError) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", "", readError(err)
+	}
+
+	parsed, err := parser.ParseEML(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", "", parseError(err)
+	}
+	return parsed, hashBytes(raw), parser.AnalyzeAuth(raw, idx.dkimKeys).Verdict, nil
+}
+
+// bodySignature returns the encoded MinHash signature of an email's body, or
+// nil if the body has no words
+func bodySignature(parsed *parser.ParsedEmail) []byte {
+	body := parsed.BodyText
+	if strings.TrimSpace(body) == "" {
+		body = parsed.BodyHTML
+	}
+	sig, ok := similarity.Compute(body)
+	if !ok {
+		return nil
+	}
+	return sig.Encode()
+}
+
+// emailLinks converts the links found by the parser for storage
+func emailLinks(parsed *parser.ParsedEmail) []*db.Link {
+	links := make([]*db.Link, len(parsed.Links))
+	for i, l := range parsed.Links {
+		links[i] = &db.Link{
+			URL:         l.URL,
+			Domain:      l.Domain,
+			DisplayText: l.Text,
+			Source:      l.Source,
+			Mismatch:    l.Mismatch,
+		}
+	}
+	return links
+}
+
+// indexErrors converts a result's failures for storage
+func indexErrors(failures map[string]*FileError) []*db.IndexError {
+	errs := make([]*db.IndexError, 0, len(failures))
+	for path, failure := range failures {
+		errs = append(errs, &db.IndexError{
+			FilePath: path,
+			Category: failure.Category,
+			Message:  failure.Error(),
+		})
+	}
+	return errs
+}
+
+// hashBytes returns the hex SHA-256 of data
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// bodyHash hashes the exact bodies that redaction offsets point into, so a
+// re-parse can tell whether they moved
+func bodyHash(parsed *parser.ParsedEmail) string {
+	return hashBytes([]byte(parsed.BodyText + "\x00" + parsed.BodyHTML))
+}
+
 // batchWriter collects parsed emails and writes them in batches
 func (idx *Indexer) batchWriter(wg *sync.WaitGroup, batchChan <-chan *parsedEmail, resultChan chan<- batchWriteResult) {
 	defer wg.Done()
@@ -333,7 +544,7 @@ func (idx *Indexer) writeBatch(batch []*parsedEmail) batchWriteResult {
 	if err != nil {
 		log.Printf("Error batch inserting emails: %v\n", err)
 		// Mark all as failed
-		result.failed = len(batch)
+		result.err = &FileError{Category: FailDBWrite, Err: err}
 		for _, p := range batch {
 			result.failedFiles = append(result.failedFiles, p.filePath)
 		}
@@ -342,6 +553,15 @@ func (idx *Indexer) writeBatch(batch []*parsedEmail) batchWriteResult {
 
 	result.indexed = len(emailIDs)
 
+	// Files that failed before are fixed now
+	written := make([]string, len(batch))
+	for i, p := range batch {
+		written[i] = p.filePath
+	}
+	if err := idx.db.ClearIndexErrors(written); err != nil {
+		log.Printf("Error clearing index errors: %v\n", err)
+	}
+
 	// Collect all attachments for batch insert (metadata only, no BLOB data)
 	var allAttachments []*db.Attachment
 	for i, p := range batch {
@@ -353,6 +573,7 @@ func (idx *Indexer) writeBatch(batch []*parsedEmail) batchWriteResult {
 					Filename:    att.Filename,
 					ContentType: att.ContentType,
 					Size:        att.Size,
+					SHA256:      hashBytes(att.Data),
 				})
 			}
 		}
@@ -366,6 +587,25 @@ func (idx *Indexer) writeBatch(batch []*parsedEmail) batchWriteResult {
 		}
 	}
 
+	// Store links
+	for i, p := range batch {
+		if len(p.links) == 0 {
+			continue
+		}
+		if err := idx.db.SaveLinks(emailIDs[i], p.links); err != nil {
+			log.Printf("Error saving links for %s: %v\n", p.filePath, err)
+		}
+	}
+
+	// Store sensitive data findings; a failed email is left for a later PII scan
+	if idx.scanPII {
+		for i, p := range batch {
+			if err := idx.db.SavePIIFindings(emailIDs[i], p.findings); err != nil {
+				log.Printf("Error saving PII findings for %s: %v\n", p.filePath, err)
+			}
+		}
+	}
+
 	if idx.verbose {
 		log.Printf("Batch wrote %d emails with %d attachments\n", len(batch), len(allAttachments))
 	}
@@ -399,8 +639,7 @@ func (idx *Indexer) indexAllSequential() (*IndexResult, error) {
 		exists, err := idx.db.EmailExists(filePath)
 		if err != nil {
 			log.Printf("Error checking if email exists: %v\n", err)
-			result.Failed++
-			result.FailedFiles = append(result.FailedFiles, filePath)
+			result.fail(filePath, &FileError{Category: FailDBWrite, Err: err})
 			continue
 		}
 
@@ -409,65 +648,28 @@ func (idx *Indexer) indexAllSequential() (*IndexResult, error) {
 			continue
 		}
 
-		// Resolve relative path to absolute path (scanner returns relative paths)
-		absolutePath := filepath.Join(idx.scanner.GetRootPath(), filePath)
-
-		// Parse the email
-		parsed, err := parser.ParseEMLFile(absolutePath)
-		if err != nil {
-			log.Printf("Error parsing %s: %v\n", absolutePath, err)
-			result.Failed++
-			result.FailedFiles = append(result.FailedFiles, filePath)
+		p, fileErr := idx.parseFile(filePath)
+		if fileErr != nil {
+			result.fail(filePath, fileErr)
 			continue
 		}
 
-		// Get file size
-		fileInfo, err := os.Stat(absolutePath)
-		if err != nil {
-			log.Printf("Error getting file info for %s: %v\n", absolutePath, err)
-			result.Failed++
-			result.FailedFiles = append(result.FailedFiles, filePath)
-			continue
-		}
-
-		// Create email record (metadata only, truncate body text to 10KB for FTS5)
-		bodyTextPreview := parsed.BodyText
-		if len(bodyTextPreview) > 10240 {
-			bodyTextPreview = bodyTextPreview[:10240]
-		}
-
-		email := &db.Email{
-			FilePath:         filePath,
-			MessageID:        parsed.MessageID,
-			InReplyTo:        parsed.InReplyTo,
-			ThreadReferences: strings.Join(parsed.References, ", "),
-			Subject:          parsed.Subject,
-			Sender:           parsed.Sender,
-			SenderName:       parsed.SenderName,
-			Recipients:       strings.Join(parsed.Recipients, ", "),
-			Date:             db.NullTime{Time: parsed.Date, Valid: !parsed.Date.IsZero()},
-			BodyTextPreview:  bodyTextPreview,
-			HasAttachments:   len(parsed.Attachments) > 0,
-			AttachmentCount:  len(parsed.Attachments),
-			FileSize:         fileInfo.Size(),
-		}
-
 		// Insert email
-		emailID, err := idx.db.InsertEmail(email)
+		emailID, err := idx.db.InsertEmail(p.email)
 		if err != nil {
 			log.Printf("Error inserting email %s: %v\n", filePath, err)
-			result.Failed++
-			result.FailedFiles = append(result.FailedFiles, filePath)
+			result.fail(filePath, &FileError{Category: FailDBWrite, Err: err})
 			continue
 		}
 
 		// Insert attachments (metadata only, no BLOB data)
-		for _, att := range parsed.Attachments {
+		for _, att := range p.attachments {
 			attachment := &db.Attachment{
 				EmailID:     emailID,
 				Filename:    att.Filename,
 				ContentType: att.ContentType,
 				Size:        att.Size,
+				SHA256:      hashBytes(att.Data),
 			}
 
 			_, err := idx.db.InsertAttachment(attachment)
@@ -477,117 +679,25 @@ func (idx *Indexer) indexAllSequential() (*IndexResult, error) {
 			}
 		}
 
-		result.NewIndexed++
-	}
-
-	if idx.verbose {
-		log.Printf("Indexing complete: %d new, %d skipped, %d failed\n",
-			result.NewIndexed, result.Skipped, result.Failed)
-	}
-
-	return result, nil
-}
-
-// IndexWithProgress indexes all files and reports progress via a callback
-func (idx *Indexer) IndexWithProgress(progress func(current, total int, filePath string)) (*IndexResult, error) {
-	// Get all .eml files
-	files, err := idx.scanner.Scan()
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan for files: %w", err)
-	}
-
-	result := &IndexResult{
-		TotalFound:  len(files),
-		FailedFiles: make([]string, 0),
-	}
-
-	// Check which files already exist in the database (batch check)
-	existingFiles, err := idx.db.EmailsExistBatch(files)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check existing emails: %w", err)
-	}
-
-	// Filter out existing files
-	filesToProcess := make([]string, 0, len(files))
-	for _, file := range files {
-		if existingFiles[file] {
-			result.Skipped++
-		} else {
-			filesToProcess = append(filesToProcess, file)
-		}
-	}
-
-	if len(filesToProcess) == 0 {
-		return result, nil
-	}
-
-	// Create channels for work distribution
-	fileChan := make(chan string, len(filesToProcess))
-	parsedChan := make(chan indexResult, idx.concurrency)
-	batchChan := make(chan *parsedEmail, idx.concurrency*2)
-
-	// Start worker pool for parsing
-	var parseWg sync.WaitGroup
-	for i := 0; i < idx.concurrency; i++ {
-		parseWg.Add(1)
-		go idx.parseWorker(&parseWg, fileChan, parsedChan, batchChan)
-	}
-
-	// Start batch writer
-	var batchWg sync.WaitGroup
-	batchWg.Add(1)
-	batchResultChan := make(chan batchWriteResult, 10)
-	go idx.batchWriter(&batchWg, batchChan, batchResultChan)
-
-	// Send files to workers
-	for _, file := range filesToProcess {
-		fileChan <- file
-	}
-	close(fileChan)
-
-	// Wait for all parsers to finish, then close channels
-	go func() {
-		parseWg.Wait()
-		close(batchChan)
-		close(parsedChan) // Close parsedChan after all workers are done
-	}()
-
-	// Wait for batch writer to finish, then close result channel
-	go func() {
-		batchWg.Wait()
-		close(batchResultChan)
-	}()
-
-	// Collect parse results with progress reporting (in separate goroutine)
-	processedCount := 0
-	parseDone := make(chan struct{})
-	go func() {
-		for res := range parsedChan {
-			processedCount++
-			if progress != nil {
-				progress(processedCount, len(filesToProcess), res.filePath)
+		if len(p.links) > 0 {
+			if err := idx.db.SaveLinks(emailID, p.links); err != nil {
+				log.Printf("Error saving links for %s: %v\n", filePath, err)
 			}
+		}
 
-			switch res.status {
-			case statusSkipped:
-				result.Skipped++
-			case statusFailed:
-				result.Failed++
-				result.FailedFiles = append(result.FailedFiles, res.filePath)
+		if idx.scanPII {
+			if err := idx.db.SavePIIFindings(emailID, p.findings); err != nil {
+				log.Printf("Error saving PII findings for %s: %v\n", filePath, err)
 			}
 		}
-		close(parseDone)
-	}()
 
-	// Collect batch write results
-	for batchRes := range batchResultChan {
-		result.NewIndexed += batchRes.indexed
-		result.Failed += batchRes.failed
-		result.FailedFiles = append(result.FailedFiles, batchRes.failedFiles...)
+		result.NewIndexed++
 	}
 
-	// Wait for parse result collection to finish
-	<-parseDone
+	if idx.verbose {
+		log.Printf("Indexing complete: %d new, %d skipped, %d failed\n",
+			result.NewIndexed, result.Skipped, result.Failed)
+	}
 
 	return result, nil
 }
@@ -0,0 +1,106 @@
+package indexer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/pii"
+)
+
+// PIIScanResult contains statistics about a sensitive data scan
+type PIIScanResult struct {
+	Scanned  int
+	Flagged  int
+	Findings int
+	Failed   int
+}
+
+// sensitiveFindings scans an email's body and text attachments for PII. The
+// HTML body is only scanned when there is no plain text body, so the same
+// value is not reported twice.
+func sensitiveFindings(parsed *parser.ParsedEmail) []*db.PIIFinding {
+	var findings []*db.PIIFinding
+	add := func(text, source, filename string) {
+		for _, f := range pii.Scan(text) {
+			findings = append(findings, &db.PIIFinding{
+				Type:               string(f.Type),
+				Source:             source,
+				AttachmentFilename: filename,
+				Start:              f.Start,
+				End:                f.End,
+				Masked:             f.Masked(),
+			})
+		}
+	}
+
+	if strings.TrimSpace(parsed.BodyText) != "" {
+		add(parsed.BodyText, db.PIISourceBody, "")
+	} else {
+		add(parsed.BodyHTML, db.PIISourceHTML, "")
+	}
+	for _, att := range parsed.Attachments {
+		if text, ok := pii.AttachmentText(att.ContentType, att.Filename, att.Data); ok {
+			add(text, db.PIISourceAttachment, att.Filename)
+		}
+	}
+	return findings
+}
+
+// ScanSensitiveData runs the PII scan on indexed emails that have not been
+// scanned yet, or on every email if rescan is set. progress, if not nil, is
+// called after each email.
+func (idx *Indexer) ScanSensitiveData(rescan bool, progress func(done, total int)) (*PIIScanResult, error) {
+	if rescan {
+		if err := idx.db.ResetPIIScan(); err != nil {
+			return nil, err
+		}
+	}
+
+	emails, err := idx.db.EmailsNeedingPIIScan()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails to scan: %w", err)
+	}
+
+	result := &PIIScanResult{}
+	for i, email := range emails {
+		if progress != nil {
+			progress(i, len(emails))
+		}
+
+		path, err := idx.db.ResolveEmailPath(email.FilePath)
+		if err != nil {
+			log.Printf("Skipping %s: %v\n", email.FilePath, err)
+			result.Failed++
+			continue
+		}
+		parsed, err := parser.ParseEMLFile(path)
+		if err != nil {
+			log.Printf("Error parsing %s: %v\n", path, err)
+			result.Failed++
+			continue
+		}
+
+		findings := sensitiveFindings(parsed)
+		if err := idx.db.SavePIIFindings(email.ID, findings); err != nil {
+			return result, err
+		}
+		result.Scanned++
+		result.Findings += len(findings)
+		if len(findings) > 0 {
+			result.Flagged++
+		}
+	}
+	if progress != nil {
+		progress(len(emails), len(emails))
+	}
+
+	if idx.verbose {
+		log.Printf("PII scan complete: %d scanned, %d flagged, %d failed\n",
+			result.Scanned, result.Flagged, result.Failed)
+	}
+
+	return result, nil
+}
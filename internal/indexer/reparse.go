@@ -0,0 +1,108 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// reparsePage is how many stale emails ReparseContext loads at a time
+const reparsePage = 200
+
+// ReparseContext parses again the emails stamped with a ParserVersion older
+// than the current one and updates them in place, one at a time with the
+// WithReparseWait pause in between. Stale emails are loaded a page at a
+// time in ID order. In the result, TotalFound counts the emails due and
+// NewIndexed those updated. If ctx is cancelled it stops after the current
+// email and returns the partial result with ctx.Err(); the rest are still
+// due next time.
+func (idx *Indexer) ReparseContext(ctx context.Context, progress func(current, total int, filePath string)) (*IndexResult, error) {
+	total, err := idx.db.CountEmailsBelowParserVersion(ParserVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emails to re-parse: %w", err)
+	}
+
+	result := &IndexResult{
+		TotalFound:  total,
+		FailedFiles: make([]string, 0),
+	}
+	current := 0
+	var afterID int64
+	for {
+		// Failed emails keep their old version, so paging by ID moves past them
+		emails, err := idx.db.EmailsBelowParserVersion(ParserVersion, afterID, reparsePage)
+		if err != nil {
+			return result, fmt.Errorf("failed to list emails to re-parse: %w", err)
+		}
+		if len(emails) == 0 {
+			break
+		}
+
+		for _, email := range emails {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			afterID = email.ID
+
+			if fileErr := idx.reparseEmail(email); fileErr != nil {
+				result.fail(email.FilePath, fileErr)
+			} else {
+				result.NewIndexed++
+			}
+			current++
+			if progress != nil {
+				progress(current, max(total, current), email.FilePath)
+			}
+
+			if idx.reparseWait > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(idx.reparseWait):
+				}
+			}
+		}
+	}
+
+	if idx.verbose {
+		log.Printf("Re-parse complete: %d updated, %d failed\n", result.NewIndexed, result.Failed)
+	}
+	return result, nil
+}
+
+// reparseEmail parses an indexed email's file again and updates its records
+func (idx *Indexer) reparseEmail(email *db.Email) *FileError {
+	if _, err := idx.db.ResolveEmailPath(email.FilePath); err != nil {
+		return readError(err)
+	}
+	p, fileErr := idx.parseFile(email.FilePath)
+	if fileErr != nil {
+		return fileErr
+	}
+	p.email.ID = email.ID
+
+	attachments := make([]*db.Attachment, len(p.attachments))
+	for i, att := range p.attachments {
+		attachments[i] = &db.Attachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			Size:        att.Size,
+			SHA256:      hashBytes(att.Data),
+		}
+	}
+	if err := idx.db.UpdateParsedEmail(p.email, attachments); err != nil {
+		return &FileError{Category: FailDBWrite, Err: err}
+	}
+
+	if err := idx.db.SaveLinks(email.ID, p.links); err != nil {
+		log.Printf("Error saving links for %s: %v\n", email.FilePath, err)
+	}
+	if idx.scanPII {
+		if err := idx.db.SavePIIFindings(email.ID, p.findings); err != nil {
+			log.Printf("Error saving PII findings for %s: %v\n", email.FilePath, err)
+		}
+	}
+	return nil
+}
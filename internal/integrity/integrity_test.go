@@ -0,0 +1,192 @@
+package integrity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const attachmentEML = "From: dana@test.com\r\n" +
+	"Subject: Report\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"See attached\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+	"\r\n" +
+	"attachment text\r\n" +
+	"--b1--\r\n"
+
+// setupIndexedCollection writes three .eml files and indexes them
+func setupIndexedCollection(t *testing.T) (*db.DB, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	database := db.SetupTestDB(t)
+	database.SetEmailsPath(dir)
+	t.Cleanup(func() { db.CleanupTestDB(t, database) })
+
+	files := map[string]string{
+		"a.eml":        "From: alice@test.com\r\nSubject: A\r\n\r\nFirst\r\n",
+		"sub/b.eml":    "From: bob@test.com\r\nSubject: B\r\n\r\nSecond\r\n",
+		"report.eml":   attachmentEML,
+		"notes/ignore": "not an email",
+	}
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	result, err := indexer.NewIndexer(database, dir, false).IndexAll()
+	require.NoError(t, err)
+	require.Equal(t, 3, result.NewIndexed)
+
+	return database, dir
+}
+
+// TestHashesRecordedAtIntake tests that the indexer stores file and attachment hashes
+func TestHashesRecordedAtIntake(t *testing.T) {
+	database, dir := setupIndexedCollection(t)
+
+	records, err := database.ListFileHashes()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	expected, _, err := HashFile(filepath.Join(dir, "a.eml"))
+	require.NoError(t, err)
+	assert.Equal(t, "a.eml", records[0].FilePath)
+	assert.Equal(t, expected, records[0].SHA256)
+
+	attachments, err := database.ListAttachmentHashes()
+	require.NoError(t, err)
+	var report *db.FileHash
+	for _, r := range records {
+		if r.FilePath == "report.eml" {
+			report = r
+		}
+	}
+	require.NotNil(t, report)
+	require.Len(t, attachments[report.EmailID], 1)
+	sum := sha256.Sum256([]byte("attachment text"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), attachments[report.EmailID][0].SHA256)
+}
+
+// TestVerify tests detection of altered, missing and new files
+func TestVerify(t *testing.T) {
+	database, dir := setupIndexedCollection(t)
+	verifier := NewVerifier(database, dir)
+
+	report, err := verifier.Verify()
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 3, report.Verified)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.eml"), []byte("From: alice@test.com\r\nSubject: A\r\n\r\nTampered\r\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "b.eml")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.eml"), []byte("From: carol@test.com\r\n\r\nNew\r\n"), 0644))
+
+	report, err = verifier.Verify()
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 1, report.Verified)
+	require.Len(t, report.Altered, 1)
+	assert.Equal(t, "a.eml", report.Altered[0].Path)
+	assert.NotEqual(t, report.Altered[0].ExpectedHash, report.Altered[0].ActualHash)
+	assert.Equal(t, []string{"sub/b.eml"}, report.Missing)
+	assert.Equal(t, []string{"c.eml"}, report.New)
+}
+
+// TestVerifyUnreadable tests that a file that cannot be read is reported
+// and the other files are still checked
+func TestVerifyUnreadable(t *testing.T) {
+	database, dir := setupIndexedCollection(t)
+
+	// A directory can be opened but not read
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.eml")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "a.eml")))
+
+	report, err := NewVerifier(database, dir).Verify()
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	require.Len(t, report.Unreadable, 1)
+	assert.Equal(t, "a.eml", report.Unreadable[0].Path)
+	assert.NotEmpty(t, report.Unreadable[0].Error)
+	assert.Empty(t, report.Missing)
+	assert.Equal(t, 2, report.Verified)
+}
+
+// TestVerifyUnhashed tests that emails indexed before hashing are reported separately
+func TestVerifyUnhashed(t *testing.T) {
+	database, dir := setupIndexedCollection(t)
+	_, err := database.Exec("UPDATE emails SET sha256 = NULL WHERE file_path = 'a.eml'")
+	require.NoError(t, err)
+
+	report, err := NewVerifier(database, dir).Verify()
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, []string{"a.eml"}, report.Unhashed)
+	assert.Equal(t, 2, report.Verified)
+}
+
+// TestSignedManifest tests signing, re-formatting tolerance and tamper detection
+func TestSignedManifest(t *testing.T) {
+	database, _ := setupIndexedCollection(t)
+
+	var buf bytes.Buffer
+	m, fingerprint, err := WriteSignedManifest(database, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, m.EmailCount)
+	assert.Len(t, fingerprint, 16)
+
+	checked, pub, err := CheckSignature(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, Fingerprint(pub))
+	require.Len(t, checked.Files, 3)
+	assert.Equal(t, m.Files[0].SHA256, checked.Files[0].SHA256)
+
+	// Re-indenting the file does not invalidate the signature
+	var compact bytes.Buffer
+	require.NoError(t, json.Compact(&compact, buf.Bytes()))
+	_, _, err = CheckSignature(compact.Bytes())
+	assert.NoError(t, err)
+
+	// Nor does a tool writing <, > and & unescaped
+	key, err := SigningKey(database)
+	require.NoError(t, err)
+	signed, err := Sign(&Manifest{Files: []ManifestEntry{{Path: "a&b.eml", MessageID: "<a@test.com>"}}}, key)
+	require.NoError(t, err)
+	data, err := json.Marshal(signed)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `\u003c`)
+	unescaped := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(data))
+	checked, _, err = CheckSignature([]byte(unescaped))
+	require.NoError(t, err)
+	assert.Equal(t, "<a@test.com>", checked.Files[0].MessageID)
+
+	// Changing any recorded hash does
+	tampered := strings.Replace(buf.String(), m.Files[0].SHA256, strings.Repeat("0", 64), 1)
+	_, _, err = CheckSignature([]byte(tampered))
+	assert.ErrorIs(t, err, ErrBadSignature)
+
+	// The same key is reused for later manifests
+	var second bytes.Buffer
+	_, fingerprint2, err := WriteSignedManifest(database, &second)
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, fingerprint2)
+}
@@ -0,0 +1,217 @@
+package integrity
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// signingKeySetting is the settings key holding the hex ed25519 seed
+const signingKeySetting = "manifest_signing_key"
+
+// SignatureAlgorithm identifies how manifests are signed
+const SignatureAlgorithm = "ed25519"
+
+// ErrBadSignature is returned when a manifest does not match its signature
+var ErrBadSignature = errors.New("manifest signature is invalid")
+
+// Manifest describes the state of the collection at a point in time
+type Manifest struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	EmailCount  int             `json:"email_count"`
+	TotalBytes  int64           `json:"total_bytes"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is the intake record of one .eml file
+type ManifestEntry struct {
+	Path        string               `json:"path"`
+	Size        int64                `json:"size"`
+	SHA256      string               `json:"sha256"`
+	MessageID   string               `json:"message_id,omitempty"`
+	IndexedAt   *time.Time           `json:"indexed_at,omitempty"`
+	Attachments []ManifestAttachment `json:"attachments,omitempty"`
+}
+
+// ManifestAttachment is the intake record of one attachment
+type ManifestAttachment struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// Signature holds a detached signature over the manifest
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"` // base64
+	Value     string `json:"value"`      // base64
+}
+
+// SignedManifest is the exported document. The signature covers the manifest
+// as encoding/json marshals it. CheckSignature decodes the manifest and
+// marshals it again before verifying, so the file may be re-indented or
+// rewritten by other JSON tools, which may unescape characters such as < and
+// &, as long as the values themselves are kept.
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature Signature       `json:"signature"`
+}
+
+// BuildManifest collects the recorded hashes of every indexed email and attachment
+func BuildManifest(database *db.DB) (*Manifest, error) {
+	records, err := database.ListFileHashes()
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := database.ListAttachmentHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		GeneratedAt: time.Now().UTC(),
+		EmailCount:  len(records),
+		Files:       make([]ManifestEntry, 0, len(records)),
+	}
+	for _, rec := range records {
+		entry := ManifestEntry{
+			Path:      rec.FilePath,
+			Size:      rec.FileSize,
+			SHA256:    rec.SHA256,
+			MessageID: rec.MessageID,
+		}
+		if rec.IndexedAt.Valid {
+			t := rec.IndexedAt.Time.UTC()
+			entry.IndexedAt = &t
+		}
+		for _, att := range attachments[rec.EmailID] {
+			entry.Attachments = append(entry.Attachments, ManifestAttachment{
+				Filename: att.Filename,
+				Size:     att.Size,
+				SHA256:   att.SHA256,
+			})
+		}
+		m.TotalBytes += rec.FileSize
+		m.Files = append(m.Files, entry)
+	}
+
+	return m, nil
+}
+
+// SigningKey loads the manifest signing key, creating it on first use
+func SigningKey(database *db.DB) (ed25519.PrivateKey, error) {
+	stored, err := database.GetSetting(signingKeySetting)
+	if err != nil {
+		return nil, err
+	}
+	if stored != "" {
+		seed, err := hex.DecodeString(stored)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("stored manifest signing key is corrupt")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	if err := database.SetSetting(signingKeySetting, hex.EncodeToString(key.Seed())); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Fingerprint returns a short SHA-256 fingerprint of a public key, for
+// recording alongside exported manifests
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign encodes and signs a manifest
+func Sign(m *Manifest, key ed25519.PrivateKey) (*SignedManifest, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return &SignedManifest{
+		Manifest: body,
+		Signature: Signature{
+			Algorithm: SignatureAlgorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, body)),
+		},
+	}, nil
+}
+
+// WriteSignedManifest builds, signs and writes the current manifest as indented
+// JSON, returning the manifest and the signing key fingerprint
+func WriteSignedManifest(database *db.DB, w io.Writer) (*Manifest, string, error) {
+	m, err := BuildManifest(database)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := SigningKey(database)
+	if err != nil {
+		return nil, "", err
+	}
+	signed, err := Sign(m, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(signed); err != nil {
+		return nil, "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return m, Fingerprint(key.Public().(ed25519.PublicKey)), nil
+}
+
+// CheckSignature verifies an exported manifest against its embedded public key
+// and returns the decoded manifest. Callers should also compare the key's
+// fingerprint with one recorded independently.
+func CheckSignature(data []byte) (*Manifest, ed25519.PublicKey, error) {
+	var signed SignedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode signed manifest: %w", err)
+	}
+	if signed.Signature.Algorithm != SignatureAlgorithm {
+		return nil, nil, fmt.Errorf("unsupported signature algorithm %q", signed.Signature.Algorithm)
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(signed.Signature.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, nil, errors.New("invalid manifest public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature.Value)
+	if err != nil {
+		return nil, nil, ErrBadSignature
+	}
+
+	// Verify the canonical encoding of what was decoded, so the signature
+	// covers exactly the manifest returned whatever its formatting
+	var m Manifest
+	if err := json.Unmarshal(signed.Manifest, &m); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	body, err := json.Marshal(&m)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if !ed25519.Verify(pub, body, sig) {
+		return nil, nil, ErrBadSignature
+	}
+	return &m, pub, nil
+}
@@ -0,0 +1,152 @@
+package integrity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/scanner"
+)
+
+// AlteredFile describes a file whose contents no longer match the intake hash
+type AlteredFile struct {
+	Path         string `json:"path"`
+	ExpectedHash string `json:"expected_sha256"`
+	ActualHash   string `json:"actual_sha256"`
+	ExpectedSize int64  `json:"expected_size"`
+	ActualSize   int64  `json:"actual_size"`
+}
+
+// UnreadableFile describes an indexed file that exists but could not be hashed
+type UnreadableFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Report is the outcome of re-hashing the collection
+type Report struct {
+	CheckedAt  time.Time        `json:"checked_at"`
+	Indexed    int              `json:"indexed"`
+	Verified   int              `json:"verified"`
+	Missing    []string         `json:"missing"`
+	Unreadable []UnreadableFile `json:"unreadable"`
+	Altered    []AlteredFile    `json:"altered"`
+	New        []string         `json:"new"`
+	Unhashed   []string         `json:"unhashed"` // Indexed before hashing was introduced
+}
+
+// OK reports whether every indexed file is present and unchanged
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unreadable) == 0 && len(r.Altered) == 0 && len(r.New) == 0
+}
+
+// Verifier re-hashes the files in the emails folder and compares them
+// with the hashes recorded at intake
+type Verifier struct {
+	db         *db.DB
+	emailsPath string
+}
+
+// NewVerifier creates a new verifier
+func NewVerifier(database *db.DB, emailsPath string) *Verifier {
+	return &Verifier{db: database, emailsPath: emailsPath}
+}
+
+// Verify reports missing, unreadable, altered and new files. A file that
+// cannot be read is reported and the check goes on with the rest.
+func (v *Verifier) Verify() (*Report, error) {
+	records, err := v.db.ListFileHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := scanner.NewScanner(v.emailsPath).Scan()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for files: %w", err)
+	}
+	onDisk := make(map[string]bool, len(files))
+	for _, f := range files {
+		onDisk[f] = true
+	}
+
+	report := &Report{
+		CheckedAt:  time.Now().UTC(),
+		Indexed:    len(records),
+		Missing:    []string{},
+		Unreadable: []UnreadableFile{},
+		Altered:    []AlteredFile{},
+		New:        []string{},
+		Unhashed:   []string{},
+	}
+
+	indexed := make(map[string]bool, len(records))
+	for _, rec := range records {
+		indexed[rec.FilePath] = true
+
+		if !onDisk[rec.FilePath] {
+			report.Missing = append(report.Missing, rec.FilePath)
+			continue
+		}
+		if rec.SHA256 == "" {
+			report.Unhashed = append(report.Unhashed, rec.FilePath)
+			continue
+		}
+
+		absPath, err := v.db.ResolveEmailPath(rec.FilePath)
+		if err != nil {
+			report.Unreadable = append(report.Unreadable, UnreadableFile{Path: rec.FilePath, Error: err.Error()})
+			continue
+		}
+		hash, size, err := HashFile(absPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since the scan
+			report.Missing = append(report.Missing, rec.FilePath)
+			continue
+		}
+		if err != nil {
+			report.Unreadable = append(report.Unreadable, UnreadableFile{Path: rec.FilePath, Error: err.Error()})
+			continue
+		}
+		if hash != rec.SHA256 {
+			report.Altered = append(report.Altered, AlteredFile{
+				Path:         rec.FilePath,
+				ExpectedHash: rec.SHA256,
+				ActualHash:   hash,
+				ExpectedSize: rec.FileSize,
+				ActualSize:   size,
+			})
+			continue
+		}
+		report.Verified++
+	}
+
+	for _, f := range files {
+		if !indexed[f] {
+			report.New = append(report.New, f)
+		}
+	}
+
+	return report, nil
+}
+
+// HashFile returns the hex SHA-256 and size of a file
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
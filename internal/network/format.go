@@ -0,0 +1,263 @@
+package network
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format identifies a graph output format
+type Format string
+
+const (
+	FormatGraphML Format = "graphml" // GraphML, read by yEd, Gephi, NetworkX
+	FormatGEXF    Format = "gexf"    // GEXF 1.3, Gephi's native format
+	FormatJSON    Format = "json"    // Node and edge lists
+)
+
+// ErrUnknownFormat is returned for unsupported graph formats
+var ErrUnknownFormat = errors.New("unknown graph format")
+
+// ParseFormat validates a format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatGraphML, FormatGEXF, FormatJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatGraphML:
+		return "application/graphml+xml"
+	case FormatGEXF:
+		return "application/gexf+xml"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "application/octet-stream"
+}
+
+// Extension returns the file extension for the format
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Write writes the graph in the given format
+func Write(w io.Writer, g *Graph, format Format) error {
+	switch format {
+	case FormatGraphML:
+		return writeXML(w, graphML(g))
+	case FormatGEXF:
+		return writeXML(w, gexf(g))
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// writeXML writes an XML document with a declaration
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write graph: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// nodeIDs numbers nodes, since addresses are not valid XML IDs
+func nodeIDs(g *Graph) map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[n.ID] = "n" + strconv.Itoa(i)
+	}
+	return ids
+}
+
+// GraphML document structure
+
+type graphMLDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphML converts a graph to a GraphML document
+func graphML(g *Graph) *graphMLDoc {
+	doc := &graphMLDoc{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "address", For: "node", Name: "address", Type: "string"},
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "sent", For: "node", Name: "sent", Type: "int"},
+			{ID: "received", For: "node", Name: "received", Type: "int"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "int"},
+		},
+		Graph: graphMLGraph{ID: "correspondence", EdgeDefault: "directed"},
+	}
+
+	ids := nodeIDs(g)
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: ids[n.ID],
+			Data: []graphMLData{
+				{Key: "address", Value: n.ID},
+				{Key: "label", Value: n.Label()},
+				{Key: "sent", Value: strconv.Itoa(n.Sent)},
+				{Key: "received", Value: strconv.Itoa(n.Received)},
+			},
+		})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: ids[e.Source],
+			Target: ids[e.Target],
+			Data:   []graphMLData{{Key: "weight", Value: strconv.Itoa(e.Weight)}},
+		})
+	}
+	return doc
+}
+
+// GEXF document structure
+
+type gexfDoc struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Meta    gexfMeta  `xml:"meta"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	Creator     string `xml:"creator"`
+	Description string `xml:"description"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string         `xml:"defaultedgetype,attr"`
+	Mode            string         `xml:"mode,attr"`
+	Attributes      gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode     `xml:"nodes>node"`
+	Edges           []gexfEdge     `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type gexfEdge struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+	Weight int    `xml:"weight,attr"`
+}
+
+// gexf converts a graph to a GEXF document
+func gexf(g *Graph) *gexfDoc {
+	doc := &gexfDoc{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Meta: gexfMeta{
+			Creator:     "EML Viewer",
+			Description: "Email correspondence network",
+		},
+		Graph: gexfGraph{
+			DefaultEdgeType: "directed",
+			Mode:            "static",
+			Attributes: gexfAttributes{
+				Class: "node",
+				Attributes: []gexfAttribute{
+					{ID: "address", Title: "address", Type: "string"},
+					{ID: "sent", Title: "sent", Type: "integer"},
+					{ID: "received", Title: "received", Type: "integer"},
+				},
+			},
+		},
+	}
+
+	ids := nodeIDs(g)
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gexfNode{
+			ID:    ids[n.ID],
+			Label: n.Label(),
+			AttValues: []gexfAttValue{
+				{For: "address", Value: n.ID},
+				{For: "sent", Value: strconv.Itoa(n.Sent)},
+				{For: "received", Value: strconv.Itoa(n.Received)},
+			},
+		})
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: ids[e.Source],
+			Target: ids[e.Target],
+			Weight: e.Weight,
+		})
+	}
+	return doc
+}
@@ -0,0 +1,137 @@
+// Package network builds the correspondence graph of who emails whom and
+// writes it in formats read by graph tools such as Gephi and yEd.
+package network
+
+import (
+	"sort"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// Node is an email address in the graph
+type Node struct {
+	ID       string `json:"id"` // Lowercased address
+	Name     string `json:"name,omitempty"`
+	Sent     int    `json:"sent"`
+	Received int    `json:"received"`
+}
+
+// Label returns the display name of the node, falling back to its address
+func (n *Node) Label() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.ID
+}
+
+// Edge counts emails sent from one address to another
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Weight int    `json:"weight"`
+}
+
+// Graph is a directed, weighted sender-to-recipient graph
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Build aggregates correspondence counts into a graph. Nodes are ordered by
+// total traffic and edges by weight, busiest first.
+func Build(rows []*db.Correspondence) *Graph {
+	nodes := make(map[string]*Node)
+	node := func(id string) *Node {
+		n, ok := nodes[id]
+		if !ok {
+			n = &Node{ID: id}
+			nodes[id] = n
+		}
+		return n
+	}
+
+	edges := make(map[[2]string]*Edge)
+	for _, row := range rows {
+		sender := node(row.Sender)
+		if sender.Name == "" {
+			sender.Name = row.SenderName
+		}
+		for _, r := range row.Recipients {
+			if r == row.Sender {
+				continue // Notes to self
+			}
+			sender.Sent += row.Count
+			node(r).Received += row.Count
+
+			key := [2]string{row.Sender, r}
+			e, ok := edges[key]
+			if !ok {
+				e = &Edge{Source: row.Sender, Target: r}
+				edges[key] = e
+			}
+			e.Weight += row.Count
+		}
+	}
+
+	g := &Graph{}
+	for _, n := range nodes {
+		if n.Sent+n.Received > 0 {
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+	for _, e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	g.sort()
+	return g
+}
+
+// sort orders nodes by total traffic and edges by weight, ties by address
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		a, b := g.Nodes[i], g.Nodes[j]
+		if a.Sent+a.Received != b.Sent+b.Received {
+			return a.Sent+a.Received > b.Sent+b.Received
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+}
+
+// Prune returns the subgraph of the maxNodes busiest addresses (0 for no
+// limit), keeping only edges of at least minWeight emails between them.
+// Addresses left without edges are dropped.
+func (g *Graph) Prune(maxNodes, minWeight int) *Graph {
+	keep := make(map[string]bool)
+	for i, n := range g.Nodes {
+		if maxNodes > 0 && i >= maxNodes {
+			break
+		}
+		keep[n.ID] = true
+	}
+
+	pruned := &Graph{}
+	connected := make(map[string]bool)
+	for _, e := range g.Edges {
+		if e.Weight >= minWeight && keep[e.Source] && keep[e.Target] {
+			pruned.Edges = append(pruned.Edges, e)
+			connected[e.Source] = true
+			connected[e.Target] = true
+		}
+	}
+	for _, n := range g.Nodes {
+		if connected[n.ID] {
+			pruned.Nodes = append(pruned.Nodes, n)
+		}
+	}
+	return pruned
+}
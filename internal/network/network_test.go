@@ -0,0 +1,85 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleCorrespondence is alice writing to bob and carol, bob replying, and a note to self
+var sampleCorrespondence = []*db.Correspondence{
+	{Sender: "alice@acme.com", SenderName: "Alice", Recipients: []string{"bob@acme.com", "carol@other.org"}, Count: 3},
+	{Sender: "alice@acme.com", Recipients: []string{"bob@acme.com"}, Count: 2},
+	{Sender: "bob@acme.com", Recipients: []string{"alice@acme.com"}, Count: 1},
+	{Sender: "dave@acme.com", Recipients: []string{"dave@acme.com"}, Count: 4},
+}
+
+// TestBuild tests aggregating correspondence into weighted edges
+func TestBuild(t *testing.T) {
+	g := Build(sampleCorrespondence)
+
+	require.Len(t, g.Nodes, 3, "Notes to self are not links")
+	assert.Equal(t, "alice@acme.com", g.Nodes[0].ID, "Busiest address first")
+	assert.Equal(t, "Alice", g.Nodes[0].Label())
+	assert.Equal(t, 8, g.Nodes[0].Sent)
+	assert.Equal(t, 1, g.Nodes[0].Received)
+
+	require.Len(t, g.Edges, 3)
+	assert.Equal(t, &Edge{Source: "alice@acme.com", Target: "bob@acme.com", Weight: 5}, g.Edges[0])
+	assert.Equal(t, &Edge{Source: "alice@acme.com", Target: "carol@other.org", Weight: 3}, g.Edges[1])
+}
+
+// TestPrune tests limiting the graph to busy addresses and heavy links
+func TestPrune(t *testing.T) {
+	g := Build(sampleCorrespondence)
+
+	pruned := g.Prune(0, 2)
+	assert.Len(t, pruned.Edges, 2)
+	assert.Len(t, pruned.Nodes, 3)
+
+	pruned = g.Prune(2, 1)
+	require.Len(t, pruned.Nodes, 2)
+	assert.Len(t, pruned.Edges, 2, "Both directions between alice and bob")
+
+	pruned = g.Prune(0, 10)
+	assert.Empty(t, pruned.Nodes, "Addresses without links are dropped")
+}
+
+// TestWriteFormats tests that every format produces a well-formed document
+func TestWriteFormats(t *testing.T) {
+	g := Build(sampleCorrespondence)
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, g, FormatGraphML))
+	var graphml graphMLDoc
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &graphml))
+	assert.Len(t, graphml.Graph.Nodes, 3)
+	assert.Len(t, graphml.Graph.Edges, 3)
+	assert.Equal(t, "directed", graphml.Graph.EdgeDefault)
+	assert.Contains(t, buf.String(), `<data key="address">carol@other.org</data>`)
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, g, FormatGEXF))
+	var doc gexfDoc
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc))
+	assert.Len(t, doc.Graph.Nodes, 3)
+	require.Len(t, doc.Graph.Edges, 3)
+	assert.Equal(t, 5, doc.Graph.Edges[0].Weight)
+
+	buf.Reset()
+	require.NoError(t, Write(&buf, g, FormatJSON))
+	var decoded Graph
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, g.Edges, decoded.Edges)
+
+	_, err := ParseFormat("dot")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	f, err := ParseFormat("GEXF")
+	require.NoError(t, err)
+	assert.Equal(t, FormatGEXF, f)
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-message/mail"
+)
+
+// ErrAttachmentNotFound is returned when an email has no attachment with the
+// requested key
+var ErrAttachmentNotFound = errors.New("attachment not found in email")
+
+// FindAttachment walks an email's MIME parts and returns a reader over the
+// decoded content of the first attachment with the given key, matching the
+// attachments ParseEML reports. Parts with the key's filename and content
+// type are decoded once to count their size, as several may share a name;
+// the email is then read again up to the matching part. Other parts are
+// skipped without being decoded and nothing after the attachment is read,
+// so the email is never held in memory.
+func FindAttachment(r io.ReadSeeker, key AttachmentKey) (io.Reader, error) {
+	found := -1
+	err := walkAttachments(r, func(i int, filename, contentType string, body io.Reader) (bool, error) {
+		if filename != key.Filename || contentType != key.ContentType {
+			return false, nil
+		}
+		size, err := io.Copy(io.Discard, body)
+		if err != nil {
+			return false, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		if size != key.Size {
+			return false, nil
+		}
+		found = i
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found < 0 {
+		return nil, ErrAttachmentNotFound
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind email: %w", err)
+	}
+	var attachment io.Reader
+	err = walkAttachments(r, func(i int, _, _ string, body io.Reader) (bool, error) {
+		if i != found {
+			return false, nil
+		}
+		attachment = body
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+// walkAttachments calls fn with the filename, content type and body of each
+// attachment in turn, numbering them from 0, until fn returns true
+func walkAttachments(r io.Reader, fn func(i int, filename, contentType string, body io.Reader) (bool, error)) error {
+	mr, err := mail.CreateReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to create mail reader: %w", err)
+	}
+
+	for i := 0; ; {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read part: %w", err)
+		}
+
+		if h, ok := part.Header.(*mail.AttachmentHeader); ok {
+			filename, _ := h.Filename()
+			contentType, _, _ := h.ContentType()
+			stop, err := fn(i, filename, contentType, part.Body)
+			if err != nil || stop {
+				return err
+			}
+			i++
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFindAttachment tests that the streamed attachment matches the parsed one
+func TestFindAttachment(t *testing.T) {
+	parsed, err := ParseEMLFile("testdata/with-attachment.eml")
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 1)
+
+	f, err := os.Open("testdata/with-attachment.eml")
+	require.NoError(t, err)
+	defer f.Close()
+
+	body, err := FindAttachment(f, parsed.Attachments[0].Key())
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, parsed.Attachments[0].Data, data)
+}
+
+// TestFindAttachmentNotFound tests missing attachments and plain emails
+func TestFindAttachmentNotFound(t *testing.T) {
+	f, err := os.Open("testdata/with-attachment.eml")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = FindAttachment(f, AttachmentKey{Filename: "other.pdf", ContentType: "application/pdf"})
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+
+	parsed, err := ParseEMLFile("testdata/with-attachment.eml")
+	require.NoError(t, err)
+	key := parsed.Attachments[0].Key()
+	key.Size++
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	_, err = FindAttachment(f, key)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound, "The size must match too")
+
+	_, err = FindAttachment(strings.NewReader("Subject: Plain\r\n\r\nNo attachments\r\n"), key)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+}
+
+// TestFindAttachmentSharedFilename tests that parts sharing a filename are
+// told apart by content type and size
+func TestFindAttachmentSharedFilename(t *testing.T) {
+	eml := "From: a@test.com\r\n" +
+		"Subject: Images\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Two images\r\n" +
+		"--b1\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"image001.png\"\r\n" +
+		"\r\n" +
+		"first\r\n" +
+		"--b1\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=\"image001.png\"\r\n" +
+		"\r\n" +
+		"the second one\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=\"image001.png\"\r\n" +
+		"\r\n" +
+		"not an image\r\n" +
+		"--b1--\r\n"
+
+	parsed, err := ParseEML(strings.NewReader(eml))
+	require.NoError(t, err)
+	require.Len(t, parsed.Attachments, 3)
+
+	for _, att := range parsed.Attachments {
+		body, err := FindAttachment(strings.NewReader(eml), att.Key())
+		require.NoError(t, err)
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		assert.Equal(t, att.Data, data)
+	}
+}
@@ -0,0 +1,246 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Overall authentication verdicts
+const (
+	AuthPass = "pass"
+	AuthFail = "fail"
+	AuthNone = "none" // No authentication information, or only neutral results
+)
+
+// AuthVerdicts lists the verdicts in display order
+var AuthVerdicts = []string{AuthPass, AuthFail, AuthNone}
+
+// AuthResult is one method's result from an Authentication-Results header,
+// such as "dkim=pass header.d=example.com"
+type AuthResult struct {
+	Method     string            // spf, dkim, dmarc, arc, ...
+	Result     string            // pass, fail, softfail, neutral, none, temperror, permerror, ...
+	Properties map[string]string // e.g. "header.d" or "smtp.mailfrom"
+}
+
+// AuthSummary is what an email's headers say about its authenticity, plus
+// offline DKIM verification
+type AuthSummary struct {
+	// AuthServID names the server that added the topmost Authentication-Results
+	AuthServID string
+	Results    []AuthResult
+
+	// Results reported by the receiving server; empty when not reported
+	SPF   string
+	DKIM  string
+	DMARC string
+
+	// ARC is the chain validation result of the newest ARC set, and
+	// ARCInstances the number of sets
+	ARC          string
+	ARCInstances int
+
+	// OriginalResults are the results recorded by the first ARC hop, before
+	// any forwarding
+	OriginalResults []AuthResult
+
+	Signatures []DKIMSignature
+
+	// Verdict is AuthPass, AuthFail or AuthNone
+	Verdict string
+}
+
+// AnalyzeAuth reads the authentication headers of a raw message and verifies
+// its DKIM signatures offline against keys, which may be empty
+func AnalyzeAuth(raw []byte, keys DKIMKeyStore) *AuthSummary {
+	fields, body := splitMessage(raw)
+	summary := &AuthSummary{}
+
+	// The topmost Authentication-Results was added by the last receiving
+	// server; ones further down may have been forged by the sender
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, "Authentication-Results") {
+			summary.AuthServID, summary.Results = ParseAuthenticationResults(f.Value())
+			break
+		}
+	}
+	for _, r := range summary.Results {
+		switch r.Method {
+		case "spf":
+			summary.SPF = firstResult(summary.SPF, r.Result)
+		case "dkim":
+			// Any passing signature is enough
+			if summary.DKIM != AuthPass {
+				summary.DKIM = r.Result
+			}
+		case "dmarc":
+			summary.DMARC = firstResult(summary.DMARC, r.Result)
+		case "arc":
+			summary.ARC = firstResult(summary.ARC, r.Result)
+		}
+	}
+	if summary.SPF == "" {
+		for _, f := range fields {
+			if strings.EqualFold(f.Name, "Received-SPF") {
+				if result := strings.Fields(f.Value()); len(result) > 0 {
+					summary.SPF = strings.ToLower(result[0])
+				}
+				break
+			}
+		}
+	}
+
+	summary.analyzeARC(fields)
+	summary.Signatures = verifyDKIM(fields, body, keys)
+	summary.Verdict = summary.verdict()
+	return summary
+}
+
+// firstResult keeps an existing result over a later one
+func firstResult(current, next string) string {
+	if current != "" {
+		return current
+	}
+	return next
+}
+
+// analyzeARC reads the chain validation claimed by the newest ARC-Seal and
+// the results recorded by the oldest ARC set
+func (s *AuthSummary) analyzeARC(fields []headerField) {
+	newest, oldest := 0, 0
+	var newestCV, oldestResults string
+	for _, f := range fields {
+		switch {
+		case strings.EqualFold(f.Name, "ARC-Seal"):
+			tags := parseTags(f.Value())
+			i, err := strconv.Atoi(tags["i"])
+			if err != nil {
+				continue
+			}
+			s.ARCInstances++
+			if i > newest {
+				newest, newestCV = i, strings.ToLower(tags["cv"])
+			}
+		case strings.EqualFold(f.Name, "ARC-Authentication-Results"):
+			instance, rest, _ := strings.Cut(f.Value(), ";")
+			name, value, _ := strings.Cut(instance, "=")
+			i, err := strconv.Atoi(strings.TrimSpace(value))
+			if strings.TrimSpace(name) != "i" || err != nil {
+				continue
+			}
+			if oldest == 0 || i < oldest {
+				oldest, oldestResults = i, rest
+			}
+		}
+	}
+	// A result reported by the receiving server wins over the seal's own claim
+	if s.ARC == "" {
+		s.ARC = newestCV
+	}
+	if oldestResults != "" {
+		_, s.OriginalResults = ParseAuthenticationResults(oldestResults)
+	}
+}
+
+// verdict combines the reported results and offline verification. A
+// signature that fails offline means the message changed after it was
+// signed, which outweighs what the receiving server reported.
+func (s *AuthSummary) verdict() string {
+	offlinePass, offlineFail := false, false
+	for _, sig := range s.Signatures {
+		switch sig.Result() {
+		case DKIMPass:
+			offlinePass = true
+		case DKIMFail:
+			offlineFail = true
+		}
+	}
+
+	switch {
+	case offlineFail && !offlinePass:
+		return AuthFail
+	case s.DMARC == AuthPass:
+		return AuthPass
+	case s.DMARC == AuthFail:
+		return AuthFail
+	case offlinePass || s.DKIM == AuthPass || s.SPF == AuthPass:
+		return AuthPass
+	case s.DKIM == AuthFail || s.SPF == AuthFail:
+		return AuthFail
+	}
+	return AuthNone
+}
+
+// ParseAuthenticationResults parses an Authentication-Results header value
+// (RFC 8601) into the authserv-id and the results it lists
+func ParseAuthenticationResults(value string) (string, []AuthResult) {
+	parts := strings.Split(stripComments(value), ";")
+	servID := ""
+	if fields := strings.Fields(parts[0]); len(fields) > 0 {
+		servID = fields[0]
+	}
+
+	var results []AuthResult
+	for _, part := range parts[1:] {
+		tokens := strings.Fields(part)
+		if len(tokens) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(tokens[0], "=")
+		if !ok {
+			continue // "none" when no methods were checked
+		}
+		method, _, _ = strings.Cut(method, "/") // drop a method version
+		r := AuthResult{
+			Method:     strings.ToLower(method),
+			Result:     strings.ToLower(result),
+			Properties: map[string]string{},
+		}
+		for _, token := range tokens[1:] {
+			if name, value, ok := strings.Cut(token, "="); ok {
+				r.Properties[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+		results = append(results, r)
+	}
+	return servID, results
+}
+
+// stripComments removes parenthesized comments, which may nest
+func stripComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' && depth == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+			continue
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			continue
+		}
+		if depth == 0 {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// PropertyList formats a result's properties for display, sorted by name
+func (r AuthResult) PropertyList() string {
+	names := make([]string, 0, len(r.Properties))
+	for name := range r.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + r.Properties[name]
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseAuthenticationResults tests comments, versions and properties
+func TestParseAuthenticationResults(t *testing.T) {
+	servID, results := ParseAuthenticationResults(`mx.google.com (spam filter);
+       dkim=pass (good) header.i=@example.com header.s="sel";
+       spf/1=SoftFail (domain of transitioning a@b.c) smtp.mailfrom=b.c; dmarc=none`)
+	assert.Equal(t, "mx.google.com", servID)
+	require.Len(t, results, 3)
+	assert.Equal(t, AuthResult{Method: "dkim", Result: "pass", Properties: map[string]string{"header.i": "@example.com", "header.s": "sel"}}, results[0])
+	assert.Equal(t, "spf", results[1].Method)
+	assert.Equal(t, "softfail", results[1].Result)
+	assert.Equal(t, "header.i=@example.com header.s=sel", results[0].PropertyList())
+
+	_, results = ParseAuthenticationResults("mx.example.com; none")
+	assert.Empty(t, results)
+}
+
+// TestAnalyzeAuth tests the verdict and the fallbacks to Received-SPF and ARC
+func TestAnalyzeAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		verdict string
+	}{
+		{"dmarc pass", "Authentication-Results: mx; spf=fail; dmarc=pass\r\n", AuthPass},
+		{"dmarc fail", "Authentication-Results: mx; dkim=pass; dmarc=fail\r\n", AuthFail},
+		{"spf only", "Received-SPF: Pass (mx: domain of a@b.c) client-ip=1.2.3.4\r\n", AuthPass},
+		{"spf softfail", "Authentication-Results: mx; spf=softfail\r\n", AuthNone},
+		{"nothing", "", AuthNone},
+		{"forged lower header", "Authentication-Results: mx; spf=fail\r\nAuthentication-Results: mx; dmarc=pass\r\n", AuthFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.headers + "From: a@b.c\r\nSubject: Hi\r\n\r\nBody\r\n"
+			assert.Equal(t, tt.verdict, AnalyzeAuth([]byte(raw), nil).Verdict)
+		})
+	}
+
+	raw := "ARC-Seal: i=2; a=rsa-sha256; cv=pass; d=list.org; s=arc; b=xyz\r\n" +
+		"ARC-Authentication-Results: i=2; list.org; dkim=fail\r\n" +
+		"ARC-Seal: i=1; a=rsa-sha256; cv=none; d=mx.org; s=arc; b=xyz\r\n" +
+		"ARC-Authentication-Results: i=1; mx.org; dkim=pass header.d=example.com; dmarc=pass\r\n" +
+		"From: a@example.com\r\n\r\nBody\r\n"
+	summary := AnalyzeAuth([]byte(raw), nil)
+	assert.Equal(t, 2, summary.ARCInstances)
+	assert.Equal(t, "pass", summary.ARC)
+	require.Len(t, summary.OriginalResults, 2)
+	assert.Equal(t, "example.com", summary.OriginalResults[0].Properties["header.d"])
+	assert.Equal(t, AuthNone, summary.Verdict, "ARC results are shown but do not decide the verdict")
+}
@@ -0,0 +1,118 @@
+package parser
+
+import (
+	netmail "net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+)
+
+// Where an email's date came from, in fallback order
+const (
+	DateSourceHeader   = "header"      // The Date header
+	DateSourceReceived = "received"    // The latest Received timestamp
+	DateSourceResent   = "resent-date" // The Resent-Date header
+	DateSourceFile     = "file"        // The .eml file's modification time
+	DateSourceNone     = "none"        // No date could be found
+)
+
+// DateUncertain reports whether a date from source may not be when the
+// email was sent
+func DateUncertain(source string) bool {
+	return source != "" && source != DateSourceHeader
+}
+
+// lenientLayouts are date formats seen in malformed Date headers, tried after
+// net/mail's RFC 5322 parsing fails. Weekdays and comments are removed first.
+var lenientLayouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05 MST",
+	"2-Jan-2006 15:04:05 -0700",
+	"Jan 2 15:04:05 2006",
+	"Jan 2 15:04:05 MST 2006",
+	"Jan 2 15:04:05 -0700 2006",
+	"Jan 2, 2006 15:04:05 -0700",
+	"Jan 2, 2006 3:04:05 PM",
+	"Jan 2, 2006 3:04 PM",
+	"January 2, 2006 3:04 PM",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var (
+	leadingWeekday = regexp.MustCompile(`^(?i)(mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?,?\s+`)
+	// A numeric zone written as "GMT+0100" or "UTC-05:00"
+	prefixedZone = regexp.MustCompile(`(?i)\b(?:GMT|UTC)\s*([+-])(\d{2}):?(\d{2})$`)
+)
+
+// ParseDateLenient parses an email date, accepting common malformations:
+// missing or wrong weekdays, two-digit years, missing seconds or zones,
+// "GMT+0100" zones, ctime and ISO 8601 formats. Dates before 1971 or after
+// 2100 are rejected as implausible.
+func ParseDateLenient(s string) (time.Time, bool) {
+	s = strings.Join(strings.Fields(stripComments(s)), " ")
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := netmail.ParseDate(s); err == nil {
+		return t, plausibleDate(t)
+	}
+
+	s = leadingWeekday.ReplaceAllString(s, "")
+	s = prefixedZone.ReplaceAllString(s, "$1$2$3")
+	s = strings.TrimSuffix(s, " GMT")
+	for _, layout := range lenientLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, plausibleDate(t)
+		}
+	}
+	return time.Time{}, false
+}
+
+// plausibleDate rejects placeholder dates such as the Unix epoch
+func plausibleDate(t time.Time) bool {
+	return t.Year() >= 1971 && t.Year() < 2100
+}
+
+// messageDate picks an email's date and its source from the Date header,
+// falling back to the latest Received timestamp and then Resent-Date
+func messageDate(header mail.Header) (time.Time, string) {
+	if t, ok := ParseDateLenient(header.Get("Date")); ok {
+		return t, DateSourceHeader
+	}
+
+	var latest time.Time
+	for _, value := range header.Values("Received") {
+		hop := ParseReceived(strings.Join(strings.Fields(value), " "))
+		if plausibleDate(hop.Time) && hop.Time.After(latest) {
+			latest = hop.Time
+		}
+	}
+	if !latest.IsZero() {
+		return latest, DateSourceReceived
+	}
+
+	if t, ok := ParseDateLenient(header.Get("Resent-Date")); ok {
+		return t, DateSourceResent
+	}
+	return time.Time{}, DateSourceNone
+}
+
+// WithFileTime dates an email by its file's modification time when no header
+// gave a date
+func (p *ParsedEmail) WithFileTime(modTime time.Time) {
+	if p.DateSource == DateSourceNone && !modTime.IsZero() {
+		p.Date = modTime
+		p.DateSource = DateSourceFile
+	}
+}
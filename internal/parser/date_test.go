@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDateLenient tests malformed dates seen in real mail
+func TestParseDateLenient(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	tests := []string{
+		"Tue, 5 Mar 2024 14:30:00 +0000",
+		"Tue, 5 Mar 2024 14:30:00 +0000 (UTC)",
+		"Fri, 5 Mar 2024 14:30:00 +0000",     // Wrong weekday
+		"Tuesday, 5 Mar 2024 14:30:00 +0000", // Full weekday
+		"5 MAR 2024 14:30:00 +0000",
+		"Tue, 05 Mar 24 14:30:00 +0000",
+		"Tue, 5 Mar 2024 15:30:00 GMT+0100",
+		"Tue,  5 Mar 2024\r\n 14:30 +0000",
+		"Tue Mar  5 14:30:00 2024",
+		"2024-03-05T14:30:00Z",
+		"2024-03-05 14:30:00",
+		"March 5, 2024 2:30 PM",
+	}
+	for _, s := range tests {
+		got, ok := ParseDateLenient(s)
+		if assert.True(t, ok, s) {
+			assert.True(t, want.Equal(got), "%s parsed as %s", s, got)
+		}
+	}
+
+	for _, s := range []string{"", "yesterday", "Thu, 1 Jan 1970 00:00:00 +0000", "0000-00-00"} {
+		_, ok := ParseDateLenient(s)
+		assert.False(t, ok, s)
+	}
+}
+
+// TestParseEML_DateFallback tests the fallback chain for missing or invalid Date headers
+func TestParseEML_DateFallback(t *testing.T) {
+	received := "Received: from a.example by b.example; Tue, 5 Mar 2024 10:00:00 +0000\r\n" +
+		"Received: from c.example by a.example; Tue, 5 Mar 2024 09:59:00 +0000\r\n"
+	tests := []struct {
+		name    string
+		headers string
+		want    time.Time
+		source  string
+	}{
+		{"valid header", "Date: Mon, 4 Mar 2024 08:00:00 +0000\r\n" + received, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), DateSourceHeader},
+		{"invalid header", "Date: someday\r\n" + received, time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC), DateSourceReceived},
+		{"resent", "Resent-Date: Wed, 6 Mar 2024 12:00:00 +0000\r\n", time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC), DateSourceResent},
+		{"nothing", "", time.Time{}, DateSourceNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tt.headers + "From: a@example.com\r\nSubject: Hi\r\n\r\nBody\r\n"
+			parsed, err := ParseEML(bytes.NewReader([]byte(raw)))
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(parsed.Date), "got %s", parsed.Date)
+			assert.Equal(t, tt.source, parsed.DateSource)
+		})
+	}
+
+	// Files fall back to their modification time
+	path := filepath.Join(t.TempDir(), "undated.eml")
+	require.NoError(t, os.WriteFile(path, []byte("From: a@example.com\r\n\r\nBody\r\n"), 0644))
+	mtime := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	parsed, err := ParseEMLFile(path)
+	require.NoError(t, err)
+	assert.True(t, mtime.Equal(parsed.Date))
+	assert.Equal(t, DateSourceFile, parsed.DateSource)
+	assert.True(t, DateUncertain(parsed.DateSource))
+	assert.False(t, DateUncertain(DateSourceHeader))
+}
@@ -0,0 +1,426 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Outcomes of checking one part of a DKIM signature offline
+const (
+	DKIMPass        = "pass"
+	DKIMFail        = "fail"
+	DKIMNoKey       = "nokey"       // No key for the selector in the local key store
+	DKIMUnsupported = "unsupported" // Unknown algorithm or canonicalization
+	DKIMInvalid     = "invalid"     // Signature header is missing required tags
+)
+
+var crlf = []byte("\r\n")
+
+// DKIMSignature is a DKIM-Signature header with the result of verifying it
+// offline. BodyHash is checked against the message itself; Signature needs
+// the signer's public key from the local key store.
+type DKIMSignature struct {
+	Domain    string
+	Selector  string
+	Algorithm string
+	Headers   []string // Signed header names, in signing order
+	BodyHash  string   // DKIMPass, DKIMFail, DKIMUnsupported or DKIMInvalid
+	Signature string   // DKIMPass, DKIMFail, DKIMNoKey, DKIMUnsupported or DKIMInvalid
+	Error     string   // Why verification failed, if it did
+}
+
+// Result summarizes the signature: pass when both checks pass, fail when
+// either fails, and the body hash result when the key is not available
+func (s DKIMSignature) Result() string {
+	switch {
+	case s.BodyHash == DKIMFail || s.Signature == DKIMFail:
+		return DKIMFail
+	case s.BodyHash == DKIMPass && s.Signature == DKIMPass:
+		return DKIMPass
+	case s.BodyHash != DKIMPass:
+		return s.BodyHash
+	}
+	return s.Signature
+}
+
+// DKIMKeyStore holds DKIM public key records by DNS name
+// ("selector._domainkey.example.com"), so signatures can be checked without DNS
+type DKIMKeyStore map[string]string
+
+// LoadDKIMKeys reads a key store file. Each line holds a DNS name and its TXT
+// record, as in a zone file:
+//
+//	brisbane._domainkey.example.com  v=DKIM1; k=ed25519; p=11qYAYK...
+//
+// Blank lines and lines starting with # are skipped; a missing file is an
+// empty store.
+func LoadDKIMKeys(path string) (DKIMKeyStore, error) {
+	keys := DKIMKeyStore{}
+	if path == "" {
+		return keys, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dkim key store: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, record, ok := strings.Cut(text, " ")
+		if !ok {
+			name, record, ok = strings.Cut(text, "\t")
+		}
+		if !ok {
+			return nil, fmt.Errorf("dkim key store line %d: expected a name and a record", line)
+		}
+		// Zone files often quote and split long TXT records
+		record = strings.TrimSpace(record)
+		record = strings.NewReplacer(`" "`, "", `"`, "").Replace(record)
+		keys[strings.ToLower(strings.TrimSuffix(name, "."))] = record
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dkim key store: %w", err)
+	}
+	return keys, nil
+}
+
+// lookup returns the key record for a selector and domain
+func (k DKIMKeyStore) lookup(selector, domain string) (string, bool) {
+	record, ok := k[strings.ToLower(selector+"._domainkey."+domain)]
+	return record, ok
+}
+
+// headerField is one header field exactly as it appears in the message,
+// including folding and the trailing CRLF
+type headerField struct {
+	Name string
+	Raw  string
+}
+
+// Value returns the field's value with folding removed
+func (h headerField) Value() string {
+	_, v, _ := strings.Cut(h.Raw, ":")
+	v = strings.NewReplacer("\r\n", "", "\n", "").Replace(v)
+	return strings.TrimSpace(v)
+}
+
+// splitMessage splits a message into header fields and body. Line endings are
+// converted to CRLF, as they were when the message was signed.
+func splitMessage(raw []byte) ([]headerField, []byte) {
+	raw = bytes.ReplaceAll(raw, crlf, []byte("\n"))
+	raw = bytes.ReplaceAll(raw, []byte("\n"), crlf)
+
+	var fields []headerField
+	rest := raw
+	for len(rest) > 0 {
+		end := bytes.Index(rest, crlf)
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += 2
+		}
+		line := rest[:end]
+		if bytes.Equal(line, crlf) {
+			return fields, rest[end:]
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].Raw += string(line)
+		} else {
+			name, _, _ := strings.Cut(string(line), ":")
+			fields = append(fields, headerField{Name: strings.TrimSpace(name), Raw: string(line)})
+		}
+		rest = rest[end:]
+	}
+	return fields, nil
+}
+
+// parseTags parses a tag=value list such as a DKIM-Signature or key record
+func parseTags(s string) map[string]string {
+	tags := map[string]string{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+// stripWhitespace removes all whitespace, as allowed inside base64 tag values
+func stripWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// collapseWSP replaces runs of spaces and tabs with a single space
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// canonicalBody canonicalizes a CRLF body with the "simple" or "relaxed" algorithm
+func canonicalBody(body []byte, relaxed bool) []byte {
+	if relaxed {
+		lines := strings.Split(string(body), "\r\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(collapseWSP(line), " ")
+		}
+		body = []byte(strings.Join(lines, "\r\n"))
+	}
+	for bytes.HasSuffix(body, crlf) {
+		body = body[:len(body)-2]
+	}
+	if len(body) > 0 || !relaxed {
+		body = append(body, crlf...)
+	}
+	return body
+}
+
+// canonicalHeader canonicalizes a header field with the "simple" or "relaxed" algorithm
+func canonicalHeader(h headerField, relaxed bool) string {
+	if !relaxed {
+		return h.Raw
+	}
+	_, value, _ := strings.Cut(h.Raw, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.TrimSpace(collapseWSP(value))
+	return strings.ToLower(h.Name) + ":" + value + "\r\n"
+}
+
+// withoutSignature empties the b= tag of a DKIM-Signature field, as it was
+// when the signature was computed. A trailing CRLF may be lost, which does not
+// matter as the signature field is hashed without one.
+func withoutSignature(raw string) string {
+	colon := strings.Index(raw, ":") + 1
+	parts := strings.Split(raw[colon:], ";")
+	for i, part := range parts {
+		name, _, ok := strings.Cut(part, "=")
+		if ok && strings.TrimSpace(name) == "b" {
+			parts[i] = part[:strings.Index(part, "=")+1]
+		}
+	}
+	return raw[:colon] + strings.Join(parts, ";")
+}
+
+// verifyDKIM checks every DKIM-Signature in a message
+func verifyDKIM(fields []headerField, body []byte, keys DKIMKeyStore) []DKIMSignature {
+	var sigs []DKIMSignature
+	for i, f := range fields {
+		if strings.EqualFold(f.Name, "DKIM-Signature") {
+			sigs = append(sigs, verifySignature(fields, i, body, keys))
+		}
+	}
+	return sigs
+}
+
+// verifySignature checks the DKIM-Signature at fields[index]
+func verifySignature(fields []headerField, index int, body []byte, keys DKIMKeyStore) DKIMSignature {
+	tags := parseTags(fields[index].Value())
+	sig := DKIMSignature{
+		Domain:    strings.ToLower(tags["d"]),
+		Selector:  tags["s"],
+		Algorithm: strings.ToLower(tags["a"]),
+		BodyHash:  DKIMInvalid,
+		Signature: DKIMInvalid,
+	}
+	for _, name := range strings.Split(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			sig.Headers = append(sig.Headers, name)
+		}
+	}
+	if sig.Domain == "" || sig.Selector == "" || tags["b"] == "" || tags["bh"] == "" || len(sig.Headers) == 0 {
+		sig.Error = "missing required tags"
+		return sig
+	}
+
+	newHash, ok := dkimHashes[strings.TrimPrefix(strings.TrimPrefix(sig.Algorithm, "rsa-"), "ed25519-")]
+	headerCanon, bodyCanon, _ := strings.Cut(strings.ToLower(tags["c"]), "/")
+	if headerCanon == "" {
+		headerCanon = "simple"
+	}
+	if bodyCanon == "" {
+		bodyCanon = "simple"
+	}
+	if !ok || !validCanon(headerCanon) || !validCanon(bodyCanon) {
+		sig.BodyHash, sig.Signature = DKIMUnsupported, DKIMUnsupported
+		sig.Error = "unsupported algorithm or canonicalization"
+		return sig
+	}
+
+	// Body hash
+	canonBody := canonicalBody(body, bodyCanon == "relaxed")
+	if l, ok := tags["l"]; ok {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > len(canonBody) {
+			sig.BodyHash, sig.Signature = DKIMInvalid, DKIMInvalid
+			sig.Error = "invalid body length"
+			return sig
+		}
+		canonBody = canonBody[:n]
+	}
+	h := newHash()
+	h.Write(canonBody)
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) == stripWhitespace(tags["bh"]) {
+		sig.BodyHash = DKIMPass
+	} else {
+		sig.BodyHash = DKIMFail
+		sig.Error = "body hash does not match; the body changed after signing"
+	}
+
+	// Header signature
+	record, ok := keys.lookup(sig.Selector, sig.Domain)
+	if !ok {
+		sig.Signature = DKIMNoKey
+		return sig
+	}
+	signature, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["b"]))
+	if err != nil {
+		sig.Signature = DKIMInvalid
+		sig.Error = "signature is not valid base64"
+		return sig
+	}
+
+	h = newHash()
+	h.Write(signedHeaders(fields, index, sig.Headers, headerCanon == "relaxed"))
+	if err := verifyWithKey(record, sig.Algorithm, h.Sum(nil), signature); err != nil {
+		if errors.Is(err, errUnsupportedKey) {
+			sig.Signature = DKIMUnsupported
+		} else {
+			sig.Signature = DKIMFail
+		}
+		if sig.Error == "" {
+			sig.Error = err.Error()
+		}
+		return sig
+	}
+	sig.Signature = DKIMPass
+	return sig
+}
+
+// dkimHashes maps the hash part of a DKIM algorithm name to its hash
+var dkimHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+}
+
+// validCanon reports whether c is a known canonicalization algorithm
+func validCanon(c string) bool {
+	return c == "simple" || c == "relaxed"
+}
+
+// signedHeaders builds the header data a signature covers: the listed fields,
+// each taking the last unused instance of its name, then the signature field
+// itself with b= empty and no trailing CRLF
+func signedHeaders(fields []headerField, sigIndex int, names []string, relaxed bool) []byte {
+	used := map[int]bool{}
+	var b strings.Builder
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].Name, name) {
+				used[i] = true
+				b.WriteString(canonicalHeader(fields[i], relaxed))
+				break
+			}
+		}
+	}
+	self := fields[sigIndex]
+	self.Raw = withoutSignature(self.Raw)
+	b.WriteString(strings.TrimSuffix(canonicalHeader(self, relaxed), "\r\n"))
+	return []byte(b.String())
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+// verifyWithKey checks a signature over digest with the public key in a DKIM key record
+func verifyWithKey(record, algorithm string, digest, signature []byte) error {
+	tags := parseTags(record)
+	keyData, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["p"]))
+	if err != nil || len(keyData) == 0 {
+		return errors.New("key record has no valid public key (revoked?)")
+	}
+
+	keyType := strings.ToLower(tags["k"])
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	if !strings.HasPrefix(algorithm, keyType+"-") {
+		return fmt.Errorf("key type %s does not match algorithm %s", keyType, algorithm)
+	}
+
+	switch keyType {
+	case "rsa":
+		pub, err := parseRSAKey(keyData)
+		if err != nil {
+			return err
+		}
+		h := crypto.SHA256
+		if strings.HasSuffix(algorithm, "sha1") {
+			h = crypto.SHA1
+		}
+		if err := rsa.VerifyPKCS1v15(pub, h, digest, signature); err != nil {
+			return errors.New("signature does not match; signed headers changed or wrong key")
+		}
+		return nil
+	case "ed25519":
+		if len(keyData) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 public key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(keyData), digest, signature) {
+			return errors.New("signature does not match; signed headers changed or wrong key")
+		}
+		return nil
+	}
+	return errUnsupportedKey
+}
+
+// parseRSAKey parses an RSA public key in SubjectPublicKeyInfo or PKCS #1 form
+func parseRSAKey(data []byte) (*rsa.PublicKey, error) {
+	if pub, err := x509.ParsePKIXPublicKey(data); err == nil {
+		if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("key record is not an RSA key")
+	}
+	pub, err := x509.ParsePKCS1PublicKey(data)
+	if err != nil {
+		return nil, errors.New("invalid RSA public key")
+	}
+	return pub, nil
+}
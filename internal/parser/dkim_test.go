@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCanonicalization tests the examples from RFC 6376 section 3.4.6
+func TestCanonicalization(t *testing.T) {
+	fields, body := splitMessage([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n\r\n C \r\nD \t E\r\n\r\n\r\n"))
+	require.Len(t, fields, 2)
+
+	assert.Equal(t, "a:X\r\n", canonicalHeader(fields[0], true))
+	assert.Equal(t, "b:Y Z\r\n", canonicalHeader(fields[1], true))
+	assert.Equal(t, " C\r\nD E\r\n", string(canonicalBody(body, true)))
+
+	assert.Equal(t, "B : Y\t\r\n\tZ  \r\n", canonicalHeader(fields[1], false))
+	assert.Equal(t, " C \r\nD \t E\r\n", string(canonicalBody(body, false)))
+
+	assert.Equal(t, "", string(canonicalBody(nil, true)), "Empty relaxed body")
+	assert.Equal(t, "\r\n", string(canonicalBody(nil, false)), "Empty simple body")
+}
+
+// signedMessage is a relaxed/relaxed ed25519 test message; BH and B are
+// replaced by the body hash and signature
+const signedMessage = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=sel;\n" +
+	" h=From : Subject; bh=BH; b=B\n" +
+	"From: Alice  <alice@example.com>\n" +
+	"Subject:  Hello\n   world\n" +
+	"To: bob@example.com\n" +
+	"\n" +
+	"Hi Bob,  \nsee you   soon.\n\n\n"
+
+// signEd25519 signs signedMessage, computing the canonical forms by hand
+func signEd25519(t *testing.T, priv ed25519.PrivateKey) string {
+	t.Helper()
+	bodyHash := sha256.Sum256([]byte("Hi Bob,\r\nsee you soon.\r\n"))
+	bh := base64.StdEncoding.EncodeToString(bodyHash[:])
+
+	headers := "from:Alice <alice@example.com>\r\n" +
+		"subject:Hello world\r\n" +
+		"dkim-signature:v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=sel; h=From : Subject; bh=" + bh + "; b="
+	digest := sha256.Sum256([]byte(headers))
+	b := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:]))
+
+	return strings.NewReplacer("bh=BH", "bh="+bh, "b=B\n", "b="+b+"\n").Replace(signedMessage)
+}
+
+// TestVerifyDKIM_Ed25519 tests offline verification and tamper detection
+func TestVerifyDKIM_Ed25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := DKIMKeyStore{"sel._domainkey.example.com": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}
+	msg := signEd25519(t, priv)
+
+	summary := AnalyzeAuth([]byte(msg), keys)
+	require.Len(t, summary.Signatures, 1)
+	sig := summary.Signatures[0]
+	assert.Equal(t, "example.com", sig.Domain)
+	assert.Equal(t, []string{"From", "Subject"}, sig.Headers)
+	assert.Equal(t, DKIMPass, sig.BodyHash)
+	assert.Equal(t, DKIMPass, sig.Signature, sig.Error)
+	assert.Equal(t, AuthPass, summary.Verdict)
+
+	// Without the key only the body hash can be checked
+	sig = AnalyzeAuth([]byte(msg), nil).Signatures[0]
+	assert.Equal(t, DKIMPass, sig.BodyHash)
+	assert.Equal(t, DKIMNoKey, sig.Signature)
+	assert.Equal(t, DKIMNoKey, sig.Result())
+
+	// Unsigned headers may change; signed ones and the body may not
+	sig = AnalyzeAuth([]byte(strings.Replace(msg, "bob@example.com", "eve@example.com", 1)), keys).Signatures[0]
+	assert.Equal(t, DKIMPass, sig.Result())
+
+	sig = AnalyzeAuth([]byte(strings.Replace(msg, "world", "there", 1)), keys).Signatures[0]
+	assert.Equal(t, DKIMPass, sig.BodyHash)
+	assert.Equal(t, DKIMFail, sig.Signature)
+
+	tampered := AnalyzeAuth([]byte(strings.Replace(msg, "soon", "later", 1)), keys)
+	assert.Equal(t, DKIMFail, tampered.Signatures[0].BodyHash)
+	assert.Equal(t, AuthFail, tampered.Verdict)
+}
+
+// TestVerifyDKIM_RSA tests an rsa-sha256 simple/simple signature with a key
+// store file in zone file format
+func TestVerifyDKIM_RSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	p := base64.StdEncoding.EncodeToString(der)
+
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	store := "# test keys\n\nmail._domainkey.example.org. \"v=DKIM1; k=rsa; \" \"p=" + p[:100] + "\" \"" + p[100:] + "\"\n"
+	require.NoError(t, os.WriteFile(path, []byte(store), 0644))
+	keys, err := LoadDKIMKeys(path)
+	require.NoError(t, err)
+	require.Contains(t, keys, "mail._domainkey.example.org")
+
+	body := "Quarterly numbers attached.\r\n"
+	bodyHash := sha256.Sum256([]byte(body))
+	sigHeader := "DKIM-Signature: v=1; a=rsa-sha256; d=example.org; s=mail; h=from:subject;\r\n" +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+	headers := "From: ceo@example.org\r\nSubject: Numbers\r\n"
+	digest := sha256.Sum256([]byte(headers + sigHeader))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	msg := sigHeader + base64.StdEncoding.EncodeToString(signature) + "\r\n" + headers + "\r\n" + body
+	sig := AnalyzeAuth([]byte(msg), keys).Signatures[0]
+	assert.Equal(t, DKIMPass, sig.BodyHash)
+	assert.Equal(t, DKIMPass, sig.Signature, sig.Error)
+
+	missing, err := LoadDKIMKeys(filepath.Join(t.TempDir(), "none.txt"))
+	require.NoError(t, err)
+	assert.Empty(t, missing, "A missing key store is empty")
+}
@@ -7,7 +7,6 @@ import (
 	"mime"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/emersion/go-message/charset"
 	"github.com/emersion/go-message/mail"
@@ -31,7 +30,14 @@ func ParseEMLFile(filePath string) (*ParsedEmail, error) {
 	defer f.Close()
 
 	// Parse the email
-	return ParseEML(f)
+	parsed, err := ParseEML(f)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil {
+		parsed.WithFileTime(info.ModTime())
+	}
+	return parsed, nil
 }
 
 // ParseEML parses an email from a reader
@@ -102,13 +108,8 @@ func ParseEML(r io.Reader) (*ParsedEmail, error) {
 		}
 	}
 
-	// Date
-	if date, err := header.Date(); err == nil {
-		parsed.Date = date
-	} else {
-		// Use current time as fallback
-		parsed.Date = time.Now()
-	}
+	// Date, falling back to other headers when it is missing or malformed
+	parsed.Date, parsed.DateSource = messageDate(header)
 
 	// Parse body and attachments
 	for {
@@ -158,6 +159,8 @@ func ParseEML(r io.Reader) (*ParsedEmail, error) {
 		}
 	}
 
+	parsed.Links = ExtractLinks(parsed.BodyText, parsed.BodyHTML)
+
 	return parsed, nil
 }
 
@@ -103,9 +103,9 @@ func TestParseEML_MissingHeaders(t *testing.T) {
 	// Message-ID is missing, should be empty
 	assert.Empty(t, parsed.MessageID)
 
-	// Date is missing - parser may set current time or zero time depending on library behavior
-	// Either is acceptable, just verify no crash
-	_ = parsed.Date
+	// Date is missing, so the file's modification time is used
+	assert.False(t, parsed.Date.IsZero())
+	assert.Equal(t, DateSourceFile, parsed.DateSource)
 
 	// Should still parse the body
 	assert.Contains(t, parsed.BodyText, "missing some headers")
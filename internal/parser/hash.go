@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContentHash returns a hash of the parts of a message that survive being
+// exported by different mail clients: sender, recipients, date, subject and
+// body text. Transport headers (Received, X-*) and whitespace differences are
+// ignored, so copies of the same message from several custodians match.
+func ContentHash(p *ParsedEmail) string {
+	body := p.BodyText
+	if strings.TrimSpace(body) == "" {
+		body = p.BodyHTML
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(strings.TrimSpace(p.Sender)))
+	b.WriteByte('\n')
+	b.WriteString(normalizeAddressList(p.Recipients))
+	b.WriteByte('\n')
+	b.WriteString(normalizeAddressList(p.CC))
+	b.WriteByte('\n')
+	if !p.Date.IsZero() {
+		b.WriteString(p.Date.UTC().Format(time.RFC3339))
+	}
+	b.WriteByte('\n')
+	b.WriteString(collapseWhitespace(p.Subject))
+	b.WriteByte('\n')
+	b.WriteString(collapseWhitespace(body))
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeAddressList lowercases and sorts addresses so order does not matter
+func normalizeAddressList(addrs []string) string {
+	normalized := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "" {
+			normalized = append(normalized, a)
+		}
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ",")
+}
+
+// collapseWhitespace replaces every run of whitespace with a single space
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestContentHash_IgnoresTransportHeaders tests that copies of a message
+// exported by different clients hash the same
+func TestContentHash_IgnoresTransportHeaders(t *testing.T) {
+	original := "Message-ID: <a@example.com>\r\n" +
+		"From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com, carol@example.com\r\n" +
+		"Date: Mon, 1 Jan 2024 10:00:00 +0000\r\n" +
+		"Subject: Quarterly report\r\n" +
+		"\r\n" +
+		"Numbers are attached.\r\nThanks\r\n"
+
+	// Another custodian's copy: extra transport headers, reordered recipients,
+	// a different time zone and re-wrapped body
+	copied := "Received: from mx.example.com by mail.example.org\r\n" +
+		"X-Custodian: legal\r\n" +
+		"Message-ID: <different@example.org>\r\n" +
+		"From: alice@example.com\r\n" +
+		"To: Carol <CAROL@example.com>, bob@example.com\r\n" +
+		"Date: Mon, 1 Jan 2024 11:00:00 +0100\r\n" +
+		"Subject: Quarterly   report\r\n" +
+		"\r\n" +
+		"Numbers are attached. Thanks\r\n"
+
+	a, err := ParseEML(strings.NewReader(original))
+	require.NoError(t, err)
+	b, err := ParseEML(strings.NewReader(copied))
+	require.NoError(t, err)
+
+	assert.Equal(t, ContentHash(a), ContentHash(b))
+
+	b.BodyText = "Numbers are attached. Thanks!"
+	assert.NotEqual(t, ContentHash(a), ContentHash(b), "Body changes must change the hash")
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Sources of extracted links
+const (
+	LinkSourceText = "text"
+	LinkSourceHTML = "html"
+)
+
+// maxURLLength is the longest URL kept; longer matches are almost always
+// tracking blobs or broken markup
+const maxURLLength = 2048
+
+// Link is a URL found in an email body
+type Link struct {
+	URL    string
+	Domain string // Lowercase host without a leading "www."
+	Text   string // Visible text of an HTML anchor; empty for bare URLs
+	Source string // LinkSourceText or LinkSourceHTML
+
+	// Mismatch is set when the anchor text looks like a URL or domain that
+	// differs from where the link actually goes
+	Mismatch bool
+}
+
+var (
+	anchorPattern = regexp.MustCompile(`(?is)<a\b[^>]*?\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))[^>]*>(.*?)</a\s*>`)
+	urlPattern    = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+|\bwww\.[a-z0-9-]+(?:\.[a-z0-9-]+)+[^\s<>"'` + "`" + `]*`)
+	domainPattern = regexp.MustCompile(`(?i)^(?:https?://)?(?:[a-z0-9-]+\.)+[a-z]{2,}(?:[/:?#]\S*)?$`)
+	tagPattern    = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	hiddenPattern = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+)
+
+// ExtractLinks returns the http(s) links in an email's bodies: HTML anchors
+// with their visible text, then bare URLs in the HTML and plain text. Each URL
+// appears once per distinct anchor text.
+func ExtractLinks(text, htmlBody string) []Link {
+	var links []Link
+	seen := map[string]bool{}
+	seenURL := map[string]bool{}
+
+	add := func(raw, anchorText, source string) {
+		link, ok := newLink(raw, anchorText, source)
+		if !ok {
+			return
+		}
+		key := link.URL + "\x00" + link.Text
+		if seen[key] || (link.Text == "" && seenURL[link.URL]) {
+			return
+		}
+		seen[key] = true
+		seenURL[link.URL] = true
+		links = append(links, link)
+	}
+
+	if htmlBody != "" {
+		body := hiddenPattern.ReplaceAllString(htmlBody, "")
+		for _, m := range anchorPattern.FindAllStringSubmatch(body, -1) {
+			href := m[1] + m[2] + m[3]
+			add(html.UnescapeString(href), visibleText(m[4]), LinkSourceHTML)
+		}
+		// Anchor text is left out: a URL shown as link text is not where the link goes
+		visible := anchorPattern.ReplaceAllString(body, " ")
+		visible = html.UnescapeString(tagPattern.ReplaceAllString(visible, " "))
+		for _, raw := range urlPattern.FindAllString(visible, -1) {
+			add(raw, "", LinkSourceHTML)
+		}
+	}
+	for _, raw := range urlPattern.FindAllString(text, -1) {
+		add(raw, "", LinkSourceText)
+	}
+
+	return links
+}
+
+// visibleText reduces an anchor's inner HTML to its text
+func visibleText(inner string) string {
+	text := html.UnescapeString(tagPattern.ReplaceAllString(inner, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// newLink cleans up a raw URL and builds a link, or returns false if it is
+// not an http(s) URL with a host
+func newLink(raw, anchorText, source string) (Link, bool) {
+	raw = trimURL(strings.TrimSpace(raw))
+	if len(raw) > maxURLLength {
+		return Link{}, false
+	}
+	if strings.HasPrefix(strings.ToLower(raw), "www.") {
+		raw = "http://" + raw
+	}
+
+	domain, ok := linkDomain(raw)
+	if !ok {
+		return Link{}, false
+	}
+
+	link := Link{URL: raw, Domain: domain, Text: anchorText, Source: source}
+	if anchorText != "" && anchorText != raw {
+		if shown, ok := displayedDomain(anchorText); ok && !sameSite(shown, domain) {
+			link.Mismatch = true
+		}
+	}
+	return link, true
+}
+
+// trimURL drops punctuation that ends a sentence rather than the URL, keeping
+// a closing parenthesis that balances one inside the URL
+func trimURL(s string) string {
+	for s != "" {
+		last := s[len(s)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"]}>", last) >= 0:
+			s = s[:len(s)-1]
+		case last == ')' && strings.Count(s, "(") < strings.Count(s, ")"):
+			s = s[:len(s)-1]
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// linkDomain returns the normalized host of an http(s) URL
+func linkDomain(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	host := NormalizeDomain(u.Hostname())
+	if host == "" || !strings.Contains(host, ".") {
+		return "", false
+	}
+	return host, true
+}
+
+// NormalizeDomain lowercases a host name and strips a leading "www."
+func NormalizeDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// displayedDomain returns the domain anchor text appears to point to, or
+// false if the text does not look like a URL or domain name
+func displayedDomain(text string) (string, bool) {
+	if strings.Contains(text, " ") || !domainPattern.MatchString(text) {
+		return "", false
+	}
+	if !strings.Contains(strings.ToLower(text), "://") {
+		text = "http://" + text
+	}
+	return linkDomain(text)
+}
+
+// sameSite reports whether two domains are equal or one is a subdomain of the other
+func sameSite(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
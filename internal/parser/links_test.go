@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtractLinks tests finding URLs in text and HTML bodies
+func TestExtractLinks(t *testing.T) {
+	text := "See https://Docs.Example.com/a?b=1. Also (www.example.org/page) and http://intranet/ and ftp://files.example.com"
+	html := `<p>Log in at <a href="https://evil.example.net/login">https://www.mybank.com</a>,
+<a href='https://track.mybank.com/x?u=1&amp;v=2'>mybank.com</a>
+<a href=https://shop.example.com>Click <b>here</b></a>
+or <a href="mailto:bob@example.com">mail</a>. Plain https://shop.example.com too.</p>
+<style>.x { background: url(https://cdn.example.com/bg.png) }</style>`
+
+	links := ExtractLinks(text, html)
+	require.Len(t, links, 5)
+
+	assert.Equal(t, Link{URL: "https://evil.example.net/login", Domain: "evil.example.net", Text: "https://www.mybank.com", Source: LinkSourceHTML, Mismatch: true}, links[0])
+	assert.Equal(t, "https://track.mybank.com/x?u=1&v=2", links[1].URL, "Entities in href are decoded")
+	assert.False(t, links[1].Mismatch, "Subdomain of the displayed domain")
+	assert.Equal(t, "Click here", links[2].Text)
+	assert.False(t, links[2].Mismatch, "Text that is not a domain is never a mismatch")
+
+	assert.Equal(t, "https://Docs.Example.com/a?b=1", links[3].URL, "Trailing period is dropped")
+	assert.Equal(t, "docs.example.com", links[3].Domain)
+	assert.Equal(t, LinkSourceText, links[3].Source)
+	assert.Equal(t, "http://www.example.org/page", links[4].URL)
+	assert.Equal(t, "example.org", links[4].Domain)
+}
+
+// TestTrimURL tests stripping trailing punctuation
+func TestTrimURL(t *testing.T) {
+	assert.Equal(t, "https://en.wikipedia.org/wiki/Go_(language)", trimURL("https://en.wikipedia.org/wiki/Go_(language)"))
+	assert.Equal(t, "https://example.com/x", trimURL("https://example.com/x),"))
+	assert.Equal(t, "https://example.com", trimURL(`https://example.com".`))
+}
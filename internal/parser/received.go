@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Thresholds for flagging a hop as suspicious
+const (
+	SlowHopDelay       = 10 * time.Minute // A hop that held the message longer than this
+	ClockSkewTolerance = time.Minute      // How far a hop may claim to precede the previous one
+)
+
+// Hop flags
+const (
+	HopSlow      = "slow"       // Delay above SlowHopDelay
+	HopPrivateIP = "private IP" // Sending IP is private, loopback or link-local
+	HopClockSkew = "clock skew" // Timestamp earlier than the previous hop's
+)
+
+// Hop is one server-to-server step of a delivery, parsed from a Received header
+type Hop struct {
+	From string // Host name the sending server gave (HELO/EHLO)
+	By   string // Host that received the message
+	IP   string // Sending server's IP, as recorded by the receiving host
+	With string // Protocol, e.g. ESMTPS
+	ID   string // Queue ID on the receiving host
+	For  string // Envelope recipient
+
+	Time time.Time // Zero if the timestamp could not be parsed
+
+	// Delay is the time since the previous hop; HasDelay is false for the
+	// first hop and when either timestamp is missing
+	Delay    time.Duration
+	HasDelay bool
+
+	Flags []string
+	Raw   string // Unfolded header value
+}
+
+var bracketedIP = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// TraceReceived parses the Received headers of a raw message into the
+// delivery path, in delivery order (the bottom Received header first)
+func TraceReceived(raw []byte) []Hop {
+	fields, _ := splitMessage(raw)
+	var hops []Hop
+	for i := len(fields) - 1; i >= 0; i-- {
+		if strings.EqualFold(fields[i].Name, "Received") {
+			hops = append(hops, ParseReceived(fields[i].Value()))
+		}
+	}
+
+	for i := range hops {
+		hop := &hops[i]
+		if ip := net.ParseIP(hop.IP); ip != nil && (ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+			hop.Flags = append(hop.Flags, HopPrivateIP)
+		}
+		if i == 0 || hop.Time.IsZero() || hops[i-1].Time.IsZero() {
+			continue
+		}
+		hop.Delay, hop.HasDelay = hop.Time.Sub(hops[i-1].Time), true
+		switch {
+		case hop.Delay > SlowHopDelay:
+			hop.Flags = append(hop.Flags, HopSlow)
+		case hop.Delay < -ClockSkewTolerance:
+			hop.Flags = append(hop.Flags, HopClockSkew)
+		}
+	}
+	return hops
+}
+
+// ParseReceived parses one Received header value (RFC 5321 section 4.4), such
+// as "from a.example (a.example [192.0.2.1]) by b.example with ESMTP id 123;
+// Tue, 5 Mar 2024 10:00:00 +0000". Servers vary the format, so unknown
+// clauses are ignored.
+func ParseReceived(value string) Hop {
+	hop := Hop{Raw: value}
+
+	clauses := value
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		clauses = value[:i]
+		if t, err := mail.ParseDate(strings.TrimSpace(stripComments(value[i+1:]))); err == nil {
+			hop.Time = t
+		}
+	}
+
+	words := receivedWords(clauses)
+	for i := 0; i+1 < len(words); i++ {
+		next := words[i+1]
+		if strings.HasPrefix(next, "(") {
+			continue
+		}
+		switch strings.ToLower(words[i]) {
+		case "from":
+			hop.From = next
+			// The receiving host records the sending IP in a comment
+			for j := i + 2; j < len(words) && strings.HasPrefix(words[j], "(") && hop.IP == ""; j++ {
+				hop.IP = findIP(words[j])
+			}
+			if hop.IP == "" {
+				hop.IP = findIP(next)
+			}
+		case "by":
+			hop.By = next
+		case "with":
+			hop.With = next
+		case "id":
+			hop.ID = next
+		case "for":
+			hop.For = strings.Trim(next, "<>")
+		default:
+			continue
+		}
+		i++
+	}
+	return hop
+}
+
+// receivedWords splits a Received header into words, keeping each
+// parenthesized comment together as one word
+func receivedWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	depth := 0
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for _, c := range s {
+		switch {
+		case c == '(':
+			if depth == 0 {
+				flush()
+			}
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				word.WriteRune(c)
+				flush()
+				continue
+			}
+		case (c == ' ' || c == '\t') && depth == 0:
+			flush()
+			continue
+		}
+		word.WriteRune(c)
+	}
+	flush()
+	return words
+}
+
+// findIP returns the first IP address in a Received word, bracketed or bare
+func findIP(s string) string {
+	if m := bracketedIP.FindStringSubmatch(s); m != nil && net.ParseIP(m[1]) != nil {
+		return m[1]
+	}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return strings.ContainsRune(" ()[]=,", r) }) {
+		if net.ParseIP(f) != nil && strings.ContainsAny(f, ".:") {
+			return f
+		}
+	}
+	return ""
+}
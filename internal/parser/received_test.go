@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseReceived tests the common Received header formats
+func TestParseReceived(t *testing.T) {
+	hop := ParseReceived("from mail.example.com (mail.example.com [203.0.113.5]) by mx.google.com with ESMTPS id abc123 for <bob@gmail.com> (version=TLS1_3); Tue, 5 Mar 2024 10:00:00 -0800 (PST)")
+	assert.Equal(t, "mail.example.com", hop.From)
+	assert.Equal(t, "203.0.113.5", hop.IP)
+	assert.Equal(t, "mx.google.com", hop.By)
+	assert.Equal(t, "ESMTPS", hop.With)
+	assert.Equal(t, "abc123", hop.ID)
+	assert.Equal(t, "bob@gmail.com", hop.For)
+	assert.Equal(t, time.Date(2024, 3, 5, 18, 0, 0, 0, time.UTC), hop.Time.UTC())
+
+	hop = ParseReceived("from [IPv6:2001:db8::1] (helo=laptop) by smtp.example.org (Postfix) with ESMTPSA; 5 Mar 2024 10:00:00 +0000")
+	assert.Equal(t, "2001:db8::1", hop.IP)
+	assert.Equal(t, "smtp.example.org", hop.By)
+
+	hop = ParseReceived("by 2002:a05:6a10:1::1 with SMTP id x; garbage")
+	assert.Equal(t, "", hop.From)
+	assert.True(t, hop.Time.IsZero(), "Unparseable dates are left zero")
+}
+
+// TestTraceReceived tests hop ordering, delays and flags
+func TestTraceReceived(t *testing.T) {
+	raw := "Received: from relay.example.net (relay.example.net [198.51.100.7]) by mx.example.com; Tue, 5 Mar 2024 11:30:00 +0000\r\n" +
+		"Received: from laptop (unknown [192.168.1.20])\r\n" +
+		"\tby relay.example.net with ESMTPSA; Tue, 5 Mar 2024 11:00:05 +0000\r\n" +
+		"Received: by laptop with local; Tue, 5 Mar 2024 11:05:00 +0000\r\n" +
+		"From: a@example.net\r\n\r\nBody\r\n"
+
+	hops := TraceReceived([]byte(raw))
+	require.Len(t, hops, 3)
+	assert.Equal(t, "laptop", hops[0].By, "Oldest hop comes first")
+	assert.False(t, hops[0].HasDelay)
+
+	assert.Equal(t, "192.168.1.20", hops[1].IP)
+	assert.Equal(t, -(4*time.Minute + 55*time.Second), hops[1].Delay)
+	assert.Equal(t, []string{HopPrivateIP, HopClockSkew}, hops[1].Flags)
+
+	assert.Equal(t, "mx.example.com", hops[2].By)
+	assert.Equal(t, 29*time.Minute+55*time.Second, hops[2].Delay)
+	assert.Equal(t, []string{HopSlow}, hops[2].Flags)
+
+	assert.Empty(t, TraceReceived([]byte("From: a@b.c\r\n\r\nBody\r\n")))
+}
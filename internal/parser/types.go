@@ -14,9 +14,11 @@ type ParsedEmail struct {
 	CC          []string
 	BCC         []string
 	Date        time.Time
+	DateSource  string // DateSourceHeader, or the fallback the date came from
 	BodyText    string
 	BodyHTML    string
 	Attachments []ParsedAttachment
+	Links       []Link // URLs in the text and HTML bodies
 	RawHeaders  string
 }
 
@@ -27,3 +29,16 @@ type ParsedAttachment struct {
 	Size        int64
 	Data        []byte
 }
+
+// AttachmentKey identifies an attachment within its email. Two parts may
+// share a filename, but not usually a filename, content type and size.
+type AttachmentKey struct {
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+// Key returns the attachment's key
+func (a ParsedAttachment) Key() AttachmentKey {
+	return AttachmentKey{Filename: a.Filename, ContentType: a.ContentType, Size: a.Size}
+}
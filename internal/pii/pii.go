@@ -0,0 +1,311 @@
+// Package pii finds sensitive data in email text: payment card numbers,
+// IBANs, national ID numbers, phone numbers, API keys and passwords. Matches
+// are validated where the format allows (Luhn for cards, mod-97 for IBANs)
+// to keep false positives down.
+package pii
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Type is a kind of sensitive data
+type Type string
+
+const (
+	CreditCard Type = "credit_card"
+	IBAN       Type = "iban"
+	NationalID Type = "national_id"
+	Phone      Type = "phone"
+	APIKey     Type = "api_key"
+	Password   Type = "password"
+)
+
+// Types lists every kind of sensitive data in report order
+var Types = []Type{CreditCard, IBAN, NationalID, Phone, APIKey, Password}
+
+// maxTextSize is the largest attachment scanned, in bytes
+const maxTextSize = 5 << 20
+
+// Label returns a human-readable name for the type
+func (t Type) Label() string {
+	switch t {
+	case CreditCard:
+		return "Credit card"
+	case IBAN:
+		return "IBAN"
+	case NationalID:
+		return "National ID"
+	case Phone:
+		return "Phone number"
+	case APIKey:
+		return "API key"
+	case Password:
+		return "Password"
+	}
+	return string(t)
+}
+
+// Valid reports whether t is a known type
+func (t Type) Valid() bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Finding is one piece of sensitive data. Start and End are byte offsets of
+// the sensitive value in the scanned text.
+type Finding struct {
+	Type  Type
+	Start int
+	End   int
+	Value string
+}
+
+// Masked returns the finding's value with most characters hidden, safe to
+// store and display
+func (f Finding) Masked() string {
+	return Mask(f.Type, f.Value)
+}
+
+// detector finds candidate matches of one type. group selects the submatch
+// holding the sensitive value (0 for the whole match) and check validates
+// the value, returning the length of its valid prefix or 0 to reject it.
+type detector struct {
+	typ   Type
+	re    *regexp.Regexp
+	group int
+	check func(value string) int
+}
+
+// detectors run in priority order; a later match overlapping an earlier one is dropped
+var detectors = []detector{
+	{CreditCard, regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), 0, validCardPrefix},
+	{IBAN, regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), 0, validIBANPrefix},
+	{NationalID, regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), 0, validSSN},
+	{NationalID, regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`), 0, nil},
+	{APIKey, regexp.MustCompile(`\b(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|sk_(?:live|test)_[A-Za-z0-9]{16,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|sk-[A-Za-z0-9_-]{20,})`), 0, nil},
+	{APIKey, regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)["']?\s*[:=]\s*["']?([A-Za-z0-9_\-./+]{16,})`), 1, nil},
+	{Password, regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|passcode)["']?\s*[:=]\s*["']?([^\s"']{4,})`), 1, nil},
+	{Password, regexp.MustCompile(`(?i)\b(?:password|passcode) is\s+["']?([^\s"']{4,})`), 1, hasNonLetter},
+	{Phone, regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,5}`), 0, phoneDigits},
+	{Phone, regexp.MustCompile(`(?:\(\d{3}\) ?|\b\d{3}[.-])\d{3}[.-]\d{4}\b`), 0, nil},
+}
+
+// Scan returns the sensitive data found in text, ordered by offset
+func Scan(text string) []Finding {
+	var findings []Finding
+	for _, d := range detectors {
+		for _, m := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*d.group], m[2*d.group+1]
+			if start < 0 {
+				continue
+			}
+			value := strings.TrimRight(text[start:end], ".,;")
+			if d.check != nil {
+				n := d.check(value)
+				if n == 0 {
+					continue
+				}
+				value = value[:n]
+			}
+			end = start + len(value)
+			if overlaps(findings, start, end) {
+				continue
+			}
+			findings = append(findings, Finding{Type: d.typ, Start: start, End: end, Value: value})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings
+}
+
+// overlaps reports whether [start, end) overlaps any finding
+func overlaps(findings []Finding, start, end int) bool {
+	for _, f := range findings {
+		if start < f.End && f.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// groupEnds returns the lengths of value's prefixes that end a group of
+// characters (before a space or dash, or at the end), longest first
+func groupEnds(value string) []int {
+	ends := []int{len(value)}
+	for i := len(value) - 1; i > 0; i-- {
+		if value[i] == ' ' || value[i] == '-' {
+			ends = append(ends, i)
+		}
+	}
+	return ends
+}
+
+// stripSeparators removes spaces and dashes
+func stripSeparators(s string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(s)
+}
+
+// validCardPrefix returns the length of the longest prefix of value that is a
+// Luhn-valid card number. Grouped numbers followed by more digits (e.g. "4111
+// 1111 1111 1111 12") are matched up to the valid group.
+func validCardPrefix(value string) int {
+	for _, n := range groupEnds(value) {
+		digits := stripSeparators(value[:n])
+		if len(digits) >= 13 && len(digits) <= 19 && Luhn(digits) {
+			return n
+		}
+	}
+	return 0
+}
+
+// Luhn reports whether a string of digits passes the Luhn checksum
+func Luhn(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBANPrefix returns the length of the longest prefix of value that is a valid IBAN
+func validIBANPrefix(value string) int {
+	for _, n := range groupEnds(value) {
+		if ValidIBAN(value[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// ValidIBAN reports whether s (spaces allowed) passes the IBAN mod-97 check
+func ValidIBAN(s string) bool {
+	s = strings.ToUpper(stripSeparators(s))
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+	// Move the country code and check digits to the end, map letters to
+	// 10-35 and take the remainder digit by digit
+	mod := 0
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			mod = (mod*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			mod = (mod*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return mod == 1
+}
+
+// validSSN rejects US Social Security numbers that are never issued
+func validSSN(value string) int {
+	area, group, serial := value[0:3], value[4:6], value[7:11]
+	if area == "000" || area == "666" || area[0] == '9' || group == "00" || serial == "0000" {
+		return 0
+	}
+	return len(value)
+}
+
+// phoneDigits accepts international numbers with 8 to 15 digits
+func phoneDigits(value string) int {
+	value = strings.TrimRight(value, " .-(")
+	digits := 0
+	for _, r := range value {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if digits < 8 || digits > 15 {
+		return 0
+	}
+	return len(value)
+}
+
+// hasNonLetter accepts values containing a digit or symbol, so prose like
+// "the password is required" is not flagged
+func hasNonLetter(value string) int {
+	for _, r := range value {
+		if !unicode.IsLetter(r) {
+			return len(value)
+		}
+	}
+	return 0
+}
+
+// Mask hides a sensitive value. Numbers keep their last four digits and
+// separators; API keys keep a four-character prefix; passwords are hidden
+// entirely.
+func Mask(t Type, value string) string {
+	switch t {
+	case Password:
+		return "********"
+	case APIKey:
+		if len(value) <= 8 {
+			return "********"
+		}
+		return value[:4] + strings.Repeat("*", 8)
+	}
+
+	keep := 4
+	out := []rune(value)
+	for i := len(out) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(out[i]) && !unicode.IsDigit(out[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		out[i] = '*'
+	}
+	return string(out)
+}
+
+// textExtensions are attachment file extensions scanned as text
+var textExtensions = map[string]bool{
+	".txt": true, ".csv": true, ".tsv": true, ".json": true, ".xml": true,
+	".log": true, ".md": true, ".ics": true, ".vcf": true, ".env": true,
+	".ini": true, ".conf": true, ".yaml": true, ".yml": true, ".html": true, ".htm": true,
+}
+
+// AttachmentText returns the text of a text-based attachment, or false if the
+// attachment is binary or too large to scan
+func AttachmentText(contentType, filename string, data []byte) (string, bool) {
+	if len(data) == 0 || len(data) > maxTextSize || !utf8.Valid(data) {
+		return "", false
+	}
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		textExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return string(data), true
+	}
+	return "", false
+}
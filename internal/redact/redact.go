@@ -0,0 +1,243 @@
+// Package redact renders emails with marked spans of text hidden, as plain
+// text or as a self-contained printable HTML page. Spans are byte offsets into
+// the body; the original .eml file is never modified.
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Placeholder replaces each redacted span in text output
+const Placeholder = "[REDACTED]"
+
+// Span is a byte range [Start, End) of text to hide
+type Span struct {
+	Start int
+	End   int
+}
+
+// Segment is a run of text that is either shown or redacted
+type Segment struct {
+	Text     string
+	Redacted bool
+}
+
+// Valid reports whether a span lies within text and on character boundaries
+func (s Span) Valid(text string) bool {
+	if s.Start < 0 || s.End > len(text) || s.Start >= s.End {
+		return false
+	}
+	return utf8.RuneStart(text[s.Start]) && (s.End == len(text) || utf8.RuneStart(text[s.End]))
+}
+
+// ErrInvalidSpan is returned when a span cannot be applied to its text, so
+// redacted output would show what it should hide
+var ErrInvalidSpan = errors.New("redaction does not fit the text")
+
+// Check returns ErrInvalidSpan if any span is not Valid for text
+func Check(text string, spans []Span) error {
+	for _, s := range spans {
+		if !s.Valid(text) {
+			return fmt.Errorf("%w: bytes %d-%d of %d", ErrInvalidSpan, s.Start, s.End, len(text))
+		}
+	}
+	return nil
+}
+
+// Merge drops spans outside text, then sorts and joins overlapping or adjacent spans
+func Merge(text string, spans []Span) []Span {
+	var valid []Span
+	for _, s := range spans {
+		if s.Valid(text) {
+			valid = append(valid, s)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Start < valid[j].Start })
+
+	var merged []Span
+	for _, s := range valid {
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			if s.End > merged[n-1].End {
+				merged[n-1].End = s.End
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// Segments splits text into shown and redacted runs
+func Segments(text string, spans []Span) []Segment {
+	var segments []Segment
+	pos := 0
+	for _, s := range Merge(text, spans) {
+		if s.Start > pos {
+			segments = append(segments, Segment{Text: text[pos:s.Start]})
+		}
+		segments = append(segments, Segment{Text: text[s.Start:s.End], Redacted: true})
+		pos = s.End
+	}
+	if pos < len(text) {
+		segments = append(segments, Segment{Text: text[pos:]})
+	}
+	return segments
+}
+
+// Apply returns text with every span replaced by Placeholder
+func Apply(text string, spans []Span) string {
+	var b strings.Builder
+	for _, seg := range Segments(text, spans) {
+		if seg.Redacted {
+			b.WriteString(Placeholder)
+		} else {
+			b.WriteString(seg.Text)
+		}
+	}
+	return b.String()
+}
+
+var (
+	hiddenElements = regexp.MustCompile(`(?is)<(script|style|head|title)\b.*?</(script|style|head|title)\s*>`)
+	lineBreaks     = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6]|blockquote)\s*>`)
+	tags           = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+\n`)
+)
+
+// HTMLText converts an HTML body to plain text. Markup, attributes, scripts
+// and styles are dropped, so nothing hidden in the HTML survives into a
+// redacted rendering.
+func HTMLText(body string) string {
+	body = hiddenElements.ReplaceAllString(body, "")
+	body = lineBreaks.ReplaceAllString(body, "\n")
+	body = tags.ReplaceAllString(body, "")
+	body = html.UnescapeString(body)
+	body = blankLines.ReplaceAllString(body, "\n\n")
+	return strings.TrimSpace(body)
+}
+
+// Document is an email prepared for redacted output. Body is plain text and
+// Spans are the parts of it to hide.
+type Document struct {
+	Subject     string
+	From        string
+	To          string
+	CC          string
+	Date        string
+	Body        string
+	Spans       []Span
+	Attachments []string
+}
+
+// WriteText writes the document as plain text. It writes nothing and fails
+// if any span does not fit the body.
+func WriteText(w io.Writer, d *Document) error {
+	if err := Check(d.Body, d.Spans); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, h := range d.headers() {
+		b.WriteString(h.Name + ": " + h.Value + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(Apply(d.Body, d.Spans))
+	b.WriteString("\n")
+	if len(d.Attachments) > 0 {
+		b.WriteString("\nAttachments (not included):\n")
+		for _, a := range d.Attachments {
+			b.WriteString("  " + a + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// header is one header line of a rendered document
+type header struct {
+	Name  string
+	Value string
+}
+
+// headers lists the document's non-empty headers
+func (d *Document) headers() []header {
+	var out []header
+	for _, h := range []header{
+		{"Subject", d.Subject}, {"From", d.From}, {"To", d.To}, {"Cc", d.CC}, {"Date", d.Date},
+	} {
+		if h.Value != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+var htmlTemplate = template.Must(template.New("redacted").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}} (redacted)</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #111; }
+table { border-collapse: collapse; margin-bottom: 1.5rem; }
+th { text-align: left; padding: 0.15rem 1rem 0.15rem 0; color: #555; font-weight: 600; vertical-align: top; }
+pre { white-space: pre-wrap; word-wrap: break-word; font-family: inherit; line-height: 1.5; }
+.redacted { background: #000; color: #000; padding: 0 0.25rem; border-radius: 2px; }
+.note { margin-top: 2rem; font-size: 0.8rem; color: #555; border-top: 1px solid #ddd; padding-top: 0.5rem; }
+@media print { body { margin: 0; max-width: none; } }
+</style>
+</head>
+<body>
+<table>
+{{range .Headers}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+<pre>{{range .Segments}}{{if .Redacted}}<span class="redacted">REDACTED</span>{{else}}{{.Text}}{{end}}{{end}}</pre>
+{{if .Attachments}}<p class="note">Attachments (not included): {{range $i, $a := .Attachments}}{{if $i}}, {{end}}{{$a}}{{end}}</p>
+{{end}}<p class="note">Redacted copy. Redacted text has been removed from this document, not just hidden.</p>
+</body>
+</html>
+`))
+
+// WriteHTML writes the document as a standalone HTML page suitable for
+// printing or saving as PDF. Redacted text is left out of the page entirely.
+// It writes nothing and fails if any span does not fit the body.
+func WriteHTML(w io.Writer, d *Document) error {
+	if err := Check(d.Body, d.Spans); err != nil {
+		return err
+	}
+	segments := Segments(d.Body, d.Spans)
+	for i := range segments {
+		if segments[i].Redacted {
+			segments[i].Text = ""
+		}
+	}
+	return htmlTemplate.Execute(w, map[string]interface{}{
+		"Subject":     d.Subject,
+		"Headers":     d.headers(),
+		"Segments":    segments,
+		"Attachments": d.Attachments,
+	})
+}
+
+// FromDisplay converts an offset into text as a browser displays it, where
+// CRLF and lone CR line endings become LF, into a byte offset into text
+func FromDisplay(text string, offset int) int {
+	d := 0
+	for i := 0; i < len(text); i++ {
+		if d >= offset {
+			return i
+		}
+		if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+			continue
+		}
+		d++
+	}
+	return len(text)
+}
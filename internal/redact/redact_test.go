@@ -0,0 +1,107 @@
+package redact
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSpanValid tests span bounds and character boundaries
+func TestSpanValid(t *testing.T) {
+	text := "café 1234"
+	assert.True(t, Span{0, 5}.Valid(text))
+	assert.True(t, Span{6, 10}.Valid(text))
+	assert.False(t, Span{0, 4}.Valid(text), "Ends inside é")
+	assert.False(t, Span{3, 3}.Valid(text), "Empty")
+	assert.False(t, Span{6, 11}.Valid(text), "Past the end")
+	assert.False(t, Span{-1, 2}.Valid(text))
+}
+
+// TestMerge tests sorting and joining spans
+func TestMerge(t *testing.T) {
+	text := "0123456789abcdef"
+	merged := Merge(text, []Span{{10, 12}, {0, 3}, {2, 5}, {5, 6}, {14, 99}})
+	assert.Equal(t, []Span{{0, 6}, {10, 12}}, merged)
+}
+
+// TestApply tests replacing spans with the placeholder
+func TestApply(t *testing.T) {
+	text := "Card 4111 1111 1111 1111, pin 1234."
+	out := Apply(text, []Span{{30, 34}, {5, 24}})
+	assert.Equal(t, "Card [REDACTED], pin [REDACTED].", out)
+	assert.Equal(t, text, Apply(text, nil))
+}
+
+// TestHTMLText tests converting HTML bodies to text
+func TestHTMLText(t *testing.T) {
+	body := `<html><head><title>T</title><style>p{}</style></head><body>` +
+		`<p>Hello &amp; welcome</p><div style="display:none">secret</div>` +
+		`<a href="mailto:x@example.com">mail</a><br>bye<script>alert(1)</script></body></html>`
+	out := HTMLText(body)
+	assert.Equal(t, "Hello & welcome\nsecret\nmail\nbye", out)
+	assert.NotContains(t, out, "mailto")
+	assert.NotContains(t, out, "alert")
+}
+
+// TestWriteText tests the plain text rendering
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, &Document{
+		Subject:     "Invoice",
+		From:        "alice@example.com",
+		Body:        "IBAN DE89 3704 0044 0532 0130 00",
+		Spans:       []Span{{5, 32}},
+		Attachments: []string{"invoice.pdf"},
+	}))
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "Subject: Invoice\nFrom: alice@example.com\n\n"))
+	assert.Contains(t, out, "IBAN [REDACTED]")
+	assert.NotContains(t, out, "3704")
+	assert.Contains(t, out, "invoice.pdf")
+}
+
+// TestWriteHTML tests that redacted text is left out of the HTML page
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTML(&buf, &Document{
+		Subject: "<b>Hi</b>",
+		Body:    "password: hunter2! <script>",
+		Spans:   []Span{{10, 18}},
+	}))
+	out := buf.String()
+	assert.Contains(t, out, `<span class="redacted">REDACTED</span>`)
+	assert.NotContains(t, out, "hunter2")
+	assert.Contains(t, out, "&lt;script&gt;")
+	assert.Contains(t, out, "&lt;b&gt;Hi&lt;/b&gt;")
+}
+
+// TestWriteFailsClosed tests that a span that does not fit the body stops
+// the rendering instead of leaving its text in clear
+func TestWriteFailsClosed(t *testing.T) {
+	body := "é 4111 1111 1111 1111"
+	for _, spans := range [][]Span{
+		{{3, 99}},         // Past the end, as after a re-parse
+		{{-1, 3}},         // Before the start
+		{{0, 2}, {1, 22}}, // One valid span, one inside "é"
+	} {
+		doc := &Document{Subject: "Card", Body: body, Spans: spans}
+		var buf bytes.Buffer
+		assert.ErrorIs(t, WriteText(&buf, doc), ErrInvalidSpan)
+		assert.ErrorIs(t, WriteHTML(&buf, doc), ErrInvalidSpan)
+		assert.Zero(t, buf.Len(), "nothing is written")
+	}
+}
+
+// TestFromDisplay tests mapping browser offsets back to byte offsets
+func TestFromDisplay(t *testing.T) {
+	text := "ab\r\ncd\ré"
+	assert.Equal(t, 0, FromDisplay(text, 0))
+	assert.Equal(t, 2, FromDisplay(text, 2), "Start of the line break")
+	assert.Equal(t, 4, FromDisplay(text, 3), "After CRLF")
+	assert.Equal(t, 7, FromDisplay(text, 6), "Lone CR counts as one")
+	assert.Equal(t, len(text), FromDisplay(text, 8))
+	assert.Equal(t, len(text), FromDisplay(text, 99))
+}
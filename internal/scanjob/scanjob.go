@@ -0,0 +1,374 @@
+// Package scanjob runs scans of the emails folder as jobs, one at a time.
+// Each job is recorded in the database and streams its progress to any
+// number of subscribers.
+package scanjob
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+)
+
+// ErrRunning is returned when a scan is started while another is running
+var ErrRunning = errors.New("scan already in progress")
+
+// pausedForScan is recorded on a re-parse that a scan stopped
+const pausedForScan = "Paused for a scan; the re-parse resumes when it finishes"
+
+// Event types sent to subscribers
+const (
+	EventProgress  = "progress"
+	EventComplete  = "complete"
+	EventCancelled = "cancelled"
+	EventError     = "error"
+)
+
+// keepJobs is how many finished jobs stay in memory for late subscribers;
+// older ones are only in the database
+const keepJobs = 16
+
+// subscriberBuffer is how many events a slow subscriber may fall behind by
+// before its oldest events are dropped
+const subscriberBuffer = 16
+
+// Progress is a snapshot of a job's state
+type Progress struct {
+	JobID   int64
+	Kind    string // A db.ScanJob kind
+	Status  string // A db.ScanJob status
+	Current int    // Files processed so far
+	Total   int    // Files to process
+	File    string // Last file processed
+	Found   int
+	New     int
+	Skipped int
+	Failed  int
+	Error   string // Why a failed scan stopped
+}
+
+// Event is a progress update sent to a job's subscribers
+type Event struct {
+	Type     string
+	Progress Progress
+}
+
+// Job is one scan run
+type Job struct {
+	ID   int64
+	kind string
+
+	preempted bool // Stopped for a scan; guarded by the manager's mu
+
+	mu          sync.Mutex
+	progress    Progress
+	final       *Event // Set once the job has finished
+	subscribers map[chan Event]struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Snapshot returns the job's current state
+func (j *Job) Snapshot() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Running reports whether the job has not finished yet
+func (j *Job) Running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.final == nil
+}
+
+// Cancel stops the job. Emails indexed so far are kept.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done is closed once the job has stopped and been recorded
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Subscribe returns a channel of the job's events, starting with its current
+// state, and a function that stops them. A finished job sends only its final
+// event. Sending never blocks the scan: a subscriber that falls behind loses
+// its oldest events.
+func (j *Job) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.final != nil {
+		ch <- *j.final
+		return ch, func() {}
+	}
+	ch <- Event{Type: EventProgress, Progress: j.progress}
+	j.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		j.mu.Lock()
+		delete(j.subscribers, ch)
+		j.mu.Unlock()
+	}
+}
+
+// publish sends an event to all subscribers; j.mu must be held
+func (j *Job) publish(event Event) {
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Full: drop the oldest event to make room. Only publish sends,
+			// so the retry cannot block.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- event
+		}
+	}
+}
+
+// update records indexing progress
+func (j *Job) update(current, total int, filePath string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Current = current
+	j.progress.Total = total
+	j.progress.File = filePath
+	j.publish(Event{Type: EventProgress, Progress: j.progress})
+}
+
+// finish records the job's outcome and sends its final event
+func (j *Job) finish(record *db.ScanJob, eventType string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Status = record.Status
+	j.progress.Found = record.TotalFound
+	j.progress.New = record.NewIndexed
+	j.progress.Skipped = record.Skipped
+	j.progress.Failed = record.Failed
+	j.progress.Error = record.Error
+	j.final = &Event{Type: eventType, Progress: j.progress}
+	j.publish(*j.final)
+	j.subscribers = nil
+}
+
+// Manager starts scan jobs and keeps track of them
+type Manager struct {
+	db         *db.DB
+	newIndexer func() *indexer.Indexer
+
+	mu            sync.Mutex
+	running       *Job
+	jobs          map[int64]*Job // Recent jobs, by ID
+	resumeReparse bool           // Restart the re-parse once the running job ends
+	stopped       bool
+}
+
+// NewManager creates a manager whose jobs index with indexers from newIndexer
+func NewManager(database *db.DB, newIndexer func() *indexer.Indexer) *Manager {
+	return &Manager{
+		db:         database,
+		newIndexer: newIndexer,
+		jobs:       make(map[int64]*Job),
+	}
+}
+
+// runFunc does a job's work with the given indexer, reporting progress
+type runFunc func(idx *indexer.Indexer, ctx context.Context, progress func(current, total int, filePath string)) (*indexer.IndexResult, error)
+
+// Start records a new job scanning the emails folder and runs it in the
+// background. It returns ErrRunning if a job is already running.
+func (m *Manager) Start() (*Job, error) {
+	return m.start(db.ScanJobKindScan, (*indexer.Indexer).IndexWithProgressContext)
+}
+
+// Retry starts a job that indexes only the given files, relative to the
+// emails folder, as Start does
+func (m *Manager) Retry(files []string) (*Job, error) {
+	return m.start(db.ScanJobKindRetry, func(idx *indexer.Indexer, ctx context.Context, progress func(current, total int, filePath string)) (*indexer.IndexResult, error) {
+		return idx.IndexFilesContext(ctx, files, progress)
+	})
+}
+
+// Reparse starts a job that parses again the emails indexed by an older
+// parser version, as Start does
+func (m *Manager) Reparse() (*Job, error) {
+	return m.start(db.ScanJobKindReparse, (*indexer.Indexer).ReparseContext)
+}
+
+// start records and starts a job of the given kind. A re-parse only
+// refreshes emails that are already indexed, so any other job stops it and
+// takes its place; the re-parse starts again once that job ends.
+func (m *Manager) start(kind string, work runFunc) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if running := m.running; running != nil {
+		if kind == db.ScanJobKindReparse || running.kind != db.ScanJobKindReparse {
+			return nil, ErrRunning
+		}
+		running.preempted = true
+		m.resumeReparse = true
+		running.cancel()
+
+		m.mu.Unlock()
+		<-running.done
+		m.mu.Lock()
+		if m.running != nil || m.stopped {
+			return nil, ErrRunning
+		}
+	}
+
+	id, err := m.db.CreateScanJob(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:          id,
+		kind:        kind,
+		progress:    Progress{JobID: id, Kind: kind, Status: db.ScanJobRunning},
+		subscribers: make(map[chan Event]struct{}),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	m.running = job
+	m.jobs[id] = job
+	m.prune()
+
+	go m.run(ctx, job, work)
+	return job, nil
+}
+
+// run does a job's work and records the outcome
+func (m *Manager) run(ctx context.Context, job *Job, work runFunc) {
+	defer close(job.done)
+	defer job.cancel()
+
+	result, err := work(m.newIndexer(), ctx, job.update)
+
+	m.mu.Lock()
+	preempted := job.preempted
+	m.mu.Unlock()
+
+	record := &db.ScanJob{ID: job.ID, Kind: job.kind, Status: db.ScanJobComplete}
+	eventType := EventComplete
+	switch {
+	case errors.Is(err, context.Canceled):
+		record.Status, eventType = db.ScanJobCancelled, EventCancelled
+		if preempted {
+			record.Error = pausedForScan
+		}
+	case err != nil:
+		record.Status, eventType = db.ScanJobFailed, EventError
+		record.Error = err.Error()
+	}
+
+	var failures map[string]string
+	if result != nil {
+		record.TotalFound = result.TotalFound
+		record.NewIndexed = result.NewIndexed
+		record.Skipped = result.Skipped
+		record.Failed = result.Failed
+		failures = make(map[string]string, len(result.Errors))
+		for path, failure := range result.Errors {
+			failures[path] = failure.Error()
+		}
+	}
+	if err := m.db.FinishScanJob(record, failures); err != nil {
+		log.Printf("Failed to record scan job %d: %v", job.ID, err)
+	}
+
+	// Free the manager before announcing the end, so a client that sees the
+	// final event can start another scan straight away
+	m.mu.Lock()
+	m.running = nil
+	resume := m.resumeReparse && job.kind != db.ScanJobKindReparse && !m.stopped
+	if resume {
+		m.resumeReparse = false
+	}
+	m.mu.Unlock()
+
+	job.finish(record, eventType)
+
+	if resume {
+		if _, err := m.Reparse(); err != nil && !errors.Is(err, ErrRunning) {
+			log.Printf("Failed to resume the re-parse: %v", err)
+		}
+	}
+}
+
+// prune forgets the oldest finished jobs beyond keepJobs; m.mu must be held
+func (m *Manager) prune() {
+	for len(m.jobs) > keepJobs {
+		var oldest int64
+		for id := range m.jobs {
+			if m.jobs[id] != m.running && (oldest == 0 || id < oldest) {
+				oldest = id
+			}
+		}
+		if oldest == 0 {
+			return
+		}
+		delete(m.jobs, oldest)
+	}
+}
+
+// Job returns a recent job by ID, or nil if it is not in memory
+func (m *Manager) Job(id int64) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.jobs[id]
+}
+
+// Running returns the running job, or nil if none is running
+func (m *Manager) Running() *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// Latest returns the running job, or else the most recent one, or nil
+func (m *Manager) Latest() *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running != nil {
+		return m.running
+	}
+	var latest *Job
+	for _, job := range m.jobs {
+		if latest == nil || job.ID > latest.ID {
+			latest = job
+		}
+	}
+	return latest
+}
+
+// Stop cancels the running job and waits for it to be recorded, or for ctx
+// to expire, so the database is not closed under a batch write
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopped = true
+	job := m.running
+	m.mu.Unlock()
+	if job == nil {
+		return nil
+	}
+	job.Cancel()
+
+	select {
+	case <-job.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,149 @@
+package scanjob
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSubscribeDropsOldestWhenFull tests that a subscriber that never reads
+// cannot block progress updates and still sees the latest state
+func TestSubscribeDropsOldestWhenFull(t *testing.T) {
+	job := &Job{ID: 1, subscribers: make(map[chan Event]struct{})}
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	for i := 1; i <= subscriberBuffer*3; i++ {
+		job.update(i, subscriberBuffer*3, "file.eml")
+	}
+	job.finish(&db.ScanJob{ID: 1, Status: db.ScanJobComplete, NewIndexed: 5}, EventComplete)
+
+	var last Event
+	count := 0
+	for len(events) > 0 {
+		last = <-events
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count)
+	assert.Equal(t, EventComplete, last.Type)
+	assert.Equal(t, 5, last.Progress.New)
+
+	// Late subscribers get only the final event
+	late, _ := job.Subscribe()
+	require.Len(t, late, 1)
+	assert.Equal(t, EventComplete, (<-late).Type)
+}
+
+// TestManagerRunsOneJobAtATime tests job recording and the running guard
+func TestManagerRunsOneJobAtATime(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 1; i <= 3; i++ {
+		content := fmt.Sprintf("From: a@test.com\r\nSubject: Job %d\r\nDate: Mon, 1 Jan 2024 10:00:00 +0000\r\n\r\nBody\r\n", i)
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, fmt.Sprintf("job%d.eml", i)), []byte(content), 0644))
+	}
+
+	database := db.SetupTestDB(t)
+	defer db.CleanupTestDB(t, database)
+
+	// Hold the indexer back until the running guard has been checked
+	release := make(chan struct{})
+	m := NewManager(database, func() *indexer.Indexer {
+		<-release
+		return indexer.NewIndexer(database, tempDir, false)
+	})
+
+	job, err := m.Start()
+	require.NoError(t, err)
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	_, err = m.Start()
+	assert.ErrorIs(t, err, ErrRunning)
+	assert.Same(t, job, m.Running())
+	close(release)
+
+	var final Event
+	timeout := time.After(5 * time.Second)
+	for final.Type == "" || final.Type == EventProgress {
+		select {
+		case final = <-events:
+		case <-timeout:
+			t.Fatal("Job did not finish")
+		}
+	}
+	<-job.Done()
+
+	assert.Equal(t, EventComplete, final.Type)
+	assert.Equal(t, 3, final.Progress.New)
+	assert.Nil(t, m.Running())
+	assert.Same(t, job, m.Latest())
+
+	record, err := database.GetScanJob(job.ID)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, db.ScanJobComplete, record.Status)
+	assert.Equal(t, db.ScanJobKindScan, record.Kind)
+	assert.Equal(t, 3, record.NewIndexed)
+}
+
+// TestScanPreemptsReparse tests that a scan stops a running re-parse and that
+// the re-parse starts again once the scan has finished
+func TestScanPreemptsReparse(t *testing.T) {
+	tempDir := t.TempDir()
+	content := "From: a@test.com\r\nSubject: Scan\r\nDate: Mon, 1 Jan 2024 10:00:00 +0000\r\n\r\nBody\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "scan.eml"), []byte(content), 0644))
+
+	database := db.SetupTestDB(t)
+	defer db.CleanupTestDB(t, database)
+
+	m := NewManager(database, func() *indexer.Indexer {
+		return indexer.NewIndexer(database, tempDir, false)
+	})
+
+	// A re-parse that runs until it is cancelled
+	reparse, err := m.start(db.ScanJobKindReparse, func(_ *indexer.Indexer, ctx context.Context, _ func(int, int, string)) (*indexer.IndexResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.NoError(t, err)
+
+	_, err = m.Reparse()
+	assert.ErrorIs(t, err, ErrRunning, "a re-parse does not preempt another")
+
+	scan, err := m.Start()
+	require.NoError(t, err)
+	assert.False(t, reparse.Running())
+	assert.Equal(t, db.ScanJobCancelled, reparse.Snapshot().Status)
+	assert.Equal(t, pausedForScan, reparse.Snapshot().Error)
+
+	select {
+	case <-scan.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scan did not finish")
+	}
+	assert.Equal(t, db.ScanJobComplete, scan.Snapshot().Status)
+	assert.Equal(t, 1, scan.Snapshot().New)
+
+	// The re-parse is started again once the scan is over
+	var resumed *Job
+	require.Eventually(t, func() bool {
+		resumed = m.Latest()
+		return resumed != nil && resumed.ID > scan.ID
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.ScanJobKindReparse, resumed.Snapshot().Kind)
+	<-resumed.Done()
+
+	record, err := database.GetScanJob(reparse.ID)
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, db.ScanJobCancelled, record.Status)
+	assert.Equal(t, pausedForScan, record.Error)
+}
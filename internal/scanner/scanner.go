@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -36,6 +37,11 @@ func (s *Scanner) GetRootPath() string {
 // Scan recursively scans for .eml files and returns paths relative to rootPath
 // This ensures portability across different systems and drive mappings
 func (s *Scanner) Scan() ([]string, error) {
+	return s.ScanContext(context.Background())
+}
+
+// ScanContext is Scan, stopping the walk when ctx is cancelled
+func (s *Scanner) ScanContext(ctx context.Context) ([]string, error) {
 	var emlFiles []string
 
 	// Get absolute path of root for reliable relative path calculation
@@ -48,6 +54,9 @@ func (s *Scanner) Scan() ([]string, error) {
 		if err != nil {
 			return fmt.Errorf("error accessing path %s: %w", path, err)
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		// Skip directories
 		if info.IsDir() {
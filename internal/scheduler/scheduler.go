@@ -0,0 +1,196 @@
+// Package scheduler runs background maintenance tasks on fixed intervals.
+// Each task's last run is kept in the settings table, so a task that ran
+// shortly before a restart is not run again straight away.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/db"
+)
+
+// settingPrefix namespaces the settings keys holding each task's last run
+const settingPrefix = "maintenance:"
+
+// Task is a job run every Interval
+type Task struct {
+	Name     string
+	Interval time.Duration                             // Zero disables the task
+	Run      func(ctx context.Context) (string, error) // Returns a one-line summary
+}
+
+// Status is a task's schedule and the outcome of its last run
+type Status struct {
+	Name         string
+	Interval     time.Duration
+	Running      bool
+	LastRun      time.Time // Zero if the task has never run
+	LastDuration time.Duration
+	LastResult   string
+	LastError    string
+	NextRun      time.Time // Zero if the task is disabled
+}
+
+// Enabled reports whether the task runs at all
+func (s Status) Enabled() bool {
+	return s.Interval > 0
+}
+
+// lastRun is the part of a Status stored between restarts
+type lastRun struct {
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+	Result   string        `json:"result"`
+	Error    string        `json:"error"`
+}
+
+// Scheduler runs tasks when they are due, one at a time
+type Scheduler struct {
+	db    *db.DB
+	tasks []Task
+
+	mu     sync.Mutex
+	status map[string]*Status
+}
+
+// New creates a scheduler for tasks, loading when each last ran
+func New(database *db.DB, tasks ...Task) *Scheduler {
+	s := &Scheduler{
+		db:     database,
+		tasks:  tasks,
+		status: make(map[string]*Status, len(tasks)),
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		st := &Status{Name: task.Name, Interval: task.Interval}
+		if value, err := database.GetSetting(settingPrefix + task.Name); err != nil {
+			log.Printf("Failed to load last run of %s: %v", task.Name, err)
+		} else if value != "" {
+			var last lastRun
+			if err := json.Unmarshal([]byte(value), &last); err == nil {
+				st.LastRun, st.LastDuration = last.At, last.Duration
+				st.LastResult, st.LastError = last.Result, last.Error
+			}
+		}
+		if st.Enabled() {
+			// Tasks that never ran wait one interval, as startup has just indexed
+			st.NextRun = now.Add(task.Interval)
+			if !st.LastRun.IsZero() {
+				st.NextRun = st.LastRun.Add(task.Interval)
+			}
+		}
+		s.status[task.Name] = st
+	}
+	return s
+}
+
+// Run runs tasks as they fall due until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		for _, task := range s.tasks {
+			if ctx.Err() != nil {
+				return
+			}
+			if s.due(task.Name, time.Now()) {
+				s.runTask(ctx, task)
+			}
+		}
+
+		next, ok := s.nextRun()
+		if !ok {
+			<-ctx.Done()
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// due reports whether a task should run at now
+func (s *Scheduler) due(name string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.status[name]
+	return st.Enabled() && !now.Before(st.NextRun)
+}
+
+// nextRun returns when the next task falls due, or false if none is enabled
+func (s *Scheduler) nextRun() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, st := range s.status {
+		if st.Enabled() && (next.IsZero() || st.NextRun.Before(next)) {
+			next = st.NextRun
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// runTask runs a task and records the outcome
+func (s *Scheduler) runTask(ctx context.Context, task Task) {
+	s.mu.Lock()
+	s.status[task.Name].Running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	result, err := task.Run(ctx)
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by shutdown: keep the previous outcome so the task
+		// runs again after the restart
+		s.mu.Lock()
+		s.status[task.Name].Running = false
+		s.mu.Unlock()
+		return
+	}
+	last := lastRun{At: start, Duration: time.Since(start), Result: result}
+	if err != nil {
+		last.Error = err.Error()
+		log.Printf("Maintenance task %s failed: %v", task.Name, err)
+	}
+
+	s.mu.Lock()
+	st := s.status[task.Name]
+	st.Running = false
+	st.LastRun, st.LastDuration = last.At, last.Duration
+	st.LastResult, st.LastError = last.Result, last.Error
+	st.NextRun = start.Add(task.Interval)
+	s.mu.Unlock()
+
+	if data, err := json.Marshal(last); err == nil {
+		if err := s.db.SetSetting(settingPrefix+task.Name, string(data)); err != nil {
+			log.Printf("Failed to save last run of %s: %v", task.Name, err)
+		}
+	}
+}
+
+// Status returns each task's status, in the order the tasks were given
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, len(s.tasks))
+	for i, task := range s.tasks {
+		statuses[i] = *s.status[task.Name]
+	}
+	return statuses
+}
+
+// Healthy reports whether every task's last run succeeded
+func (s *Scheduler) Healthy() bool {
+	for _, st := range s.Status() {
+		if st.LastError != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/felo/eml-viewer/internal/config"
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSchedulerRunsDueTasks tests that enabled tasks run on their interval,
+// disabled ones never do, and outcomes are kept across restarts
+func TestSchedulerRunsDueTasks(t *testing.T) {
+	database := db.SetupTestDB(t)
+	defer db.CleanupTestDB(t, database)
+
+	var quick, disabled atomic.Int32
+	tasks := []Task{
+		{Name: "quick", Interval: 10 * time.Millisecond, Run: func(context.Context) (string, error) {
+			quick.Add(1)
+			return "done", nil
+		}},
+		{Name: "broken", Interval: 10 * time.Millisecond, Run: func(context.Context) (string, error) {
+			return "", errors.New("disk on fire")
+		}},
+		{Name: "disabled", Run: func(context.Context) (string, error) {
+			disabled.Add(1)
+			return "", nil
+		}},
+	}
+
+	s := New(database, tasks...)
+	assert.True(t, s.Healthy(), "Nothing has run yet")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool { return quick.Load() >= 3 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	<-stopped
+
+	assert.Zero(t, disabled.Load())
+	assert.False(t, s.Healthy())
+
+	statuses := s.Status()
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "quick", statuses[0].Name)
+	assert.Equal(t, "done", statuses[0].LastResult)
+	assert.False(t, statuses[0].LastRun.IsZero())
+	assert.Equal(t, "disk on fire", statuses[1].LastError)
+	assert.False(t, statuses[2].Enabled())
+	assert.True(t, statuses[2].LastRun.IsZero())
+	assert.True(t, statuses[2].NextRun.IsZero())
+
+	// A restarted scheduler picks up the last runs
+	restarted := New(database, tasks...)
+	again := restarted.Status()
+	assert.Equal(t, "done", again[0].LastResult)
+	assert.WithinDuration(t, statuses[0].LastRun, again[0].LastRun, time.Millisecond)
+	assert.Equal(t, "disk on fire", again[1].LastError)
+	assert.False(t, restarted.Healthy())
+}
+
+// TestMaintenanceTasks tests the built-in database tasks against a real database
+func TestMaintenanceTasks(t *testing.T) {
+	database := db.SetupTestDB(t)
+	defer db.CleanupTestDB(t, database)
+
+	tasks := MaintenanceTasks(config.Default(), database, nil)
+	require.Len(t, tasks, 5)
+	for _, task := range tasks {
+		assert.Positive(t, task.Interval, task.Name)
+		if task.Name == TaskScan {
+			continue
+		}
+		result, err := task.Run(context.Background())
+		require.NoError(t, err, task.Name)
+		assert.NotEmpty(t, result, task.Name)
+	}
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/felo/eml-viewer/internal/config"
+	"github.com/felo/eml-viewer/internal/db"
+	"github.com/felo/eml-viewer/internal/scanjob"
+)
+
+// Built-in task names
+const (
+	TaskScan       = "scan"
+	TaskAnalyze    = "analyze"
+	TaskOptimize   = "optimize"
+	TaskIntegrity  = "integrity"
+	TaskCheckpoint = "checkpoint"
+)
+
+// MaintenanceTasks returns the built-in tasks with intervals from cfg
+func MaintenanceTasks(cfg *config.Config, database *db.DB, scans *scanjob.Manager) []Task {
+	return []Task{
+		{Name: TaskScan, Interval: cfg.ScanInterval, Run: scanTask(scans)},
+		{Name: TaskAnalyze, Interval: cfg.AnalyzeInterval, Run: func(context.Context) (string, error) {
+			if err := database.Analyze(); err != nil {
+				return "", err
+			}
+			return "Statistics updated", nil
+		}},
+		{Name: TaskOptimize, Interval: cfg.OptimizeInterval, Run: func(context.Context) (string, error) {
+			if err := database.OptimizeFTS(); err != nil {
+				return "", err
+			}
+			return "Search index optimized", nil
+		}},
+		{Name: TaskIntegrity, Interval: cfg.IntegrityInterval, Run: func(context.Context) (string, error) {
+			problems, err := database.IntegrityCheck()
+			if err != nil {
+				return "", err
+			}
+			if len(problems) > 0 {
+				return "", fmt.Errorf("integrity check found %d problems, first: %s", len(problems), problems[0])
+			}
+			return "No problems found", nil
+		}},
+		{Name: TaskCheckpoint, Interval: cfg.CheckpointInterval, Run: func(context.Context) (string, error) {
+			pages, err := database.CheckpointWAL()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d pages checkpointed", pages), nil
+		}},
+	}
+}
+
+// scanTask starts an incremental scan job and waits for it. A scan someone
+// else started is left alone and the run skipped.
+func scanTask(scans *scanjob.Manager) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		job, err := scans.Start()
+		if errors.Is(err, scanjob.ErrRunning) {
+			return "Skipped, a scan was already running", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		select {
+		case <-job.Done():
+		case <-ctx.Done():
+			// Shutdown stops the job itself
+			return "", ctx.Err()
+		}
+
+		p := job.Snapshot()
+		switch p.Status {
+		case db.ScanJobFailed:
+			return "", fmt.Errorf("scan #%d failed: %s", job.ID, p.Error)
+		case db.ScanJobCancelled:
+			return fmt.Sprintf("Scan #%d cancelled after %d new emails", job.ID, p.New), nil
+		}
+		return fmt.Sprintf("Scan #%d: %d new, %d failed", job.ID, p.New, p.Failed), nil
+	}
+}
@@ -0,0 +1,154 @@
+// Package similarity estimates how similar two email bodies are using MinHash
+// signatures over word shingles, with locality-sensitive hashing (LSH) bands
+// for finding candidate pairs without comparing every email to every other.
+package similarity
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// NumHashes is the number of MinHash functions in a signature
+	NumHashes = 64
+	// NumBands is the number of LSH bands a signature is split into
+	NumBands = 16
+	// rowsPerBand is the number of signature values in each band
+	rowsPerBand = NumHashes / NumBands
+	// shingleSize is the number of words in each shingle
+	shingleSize = 3
+	// SignatureSize is the encoded size of a signature in bytes
+	SignatureSize = NumHashes * 4
+)
+
+// Signature is a MinHash signature
+type Signature [NumHashes]uint32
+
+// seeds holds one seed per hash function, derived deterministically so that
+// signatures stay comparable across runs
+var seeds = func() [NumHashes]uint64 {
+	var s [NumHashes]uint64
+	x := uint64(0x5eed)
+	for i := range s {
+		x = splitmix64(x)
+		s[i] = x
+	}
+	return s
+}()
+
+// splitmix64 is a fast, well-mixed 64-bit hash step
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Shingles returns the hashed word shingles of a text. Case, punctuation and
+// whitespace are ignored; lines quoted with ">" are skipped so replies are
+// compared on what was actually written.
+func Shingles(text string) []uint64 {
+	var words []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		words = append(words, strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})...)
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	n := shingleSize
+	if len(words) < n {
+		n = len(words)
+	}
+
+	seen := make(map[uint64]bool)
+	var shingles []uint64
+	for i := 0; i+n <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		sum := h.Sum64()
+		if !seen[sum] {
+			seen[sum] = true
+			shingles = append(shingles, sum)
+		}
+	}
+	return shingles
+}
+
+// Compute returns the MinHash signature of a text, or false if the text has
+// no words to compare
+func Compute(text string) (Signature, bool) {
+	var sig Signature
+	shingles := Shingles(text)
+	if len(shingles) == 0 {
+		return sig, false
+	}
+
+	for i := range sig {
+		sig[i] = ^uint32(0)
+	}
+	for _, s := range shingles {
+		for i, seed := range seeds {
+			if v := uint32(splitmix64(s ^ seed)); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig, true
+}
+
+// Similarity estimates the Jaccard similarity of the texts behind two signatures
+func Similarity(a, b Signature) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / NumHashes
+}
+
+// Bands returns one hash per LSH band. Two signatures sharing any band hash
+// are candidates for comparison; pairs above roughly 0.6 similarity almost
+// always share at least one band.
+func Bands(sig Signature) [NumBands]int64 {
+	var bands [NumBands]int64
+	buf := make([]byte, rowsPerBand*4)
+	for b := range bands {
+		for r := 0; r < rowsPerBand; r++ {
+			binary.LittleEndian.PutUint32(buf[r*4:], sig[b*rowsPerBand+r])
+		}
+		h := fnv.New64a()
+		h.Write(buf)
+		bands[b] = int64(h.Sum64())
+	}
+	return bands
+}
+
+// Encode serializes a signature for storage
+func (s Signature) Encode() []byte {
+	buf := make([]byte, SignatureSize)
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(buf[i*4:], v)
+	}
+	return buf
+}
+
+// Decode parses a stored signature, or returns false if it is malformed
+func Decode(data []byte) (Signature, bool) {
+	var sig Signature
+	if len(data) != SignatureSize {
+		return sig, false
+	}
+	for i := range sig {
+		sig[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return sig, true
+}
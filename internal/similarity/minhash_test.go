@@ -0,0 +1,76 @@
+package similarity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const memo = `Please find attached the quarterly revenue forecast for the northern region.
+The numbers assume the new pricing takes effect in March and that the two
+pending contracts close before the end of the quarter. Let me know if you
+have any questions before Friday's board meeting.`
+
+// TestShingles tests tokenization, case folding and quoted-line skipping
+func TestShingles(t *testing.T) {
+	assert.Empty(t, Shingles(""))
+	assert.Empty(t, Shingles("  --- !!! "))
+	assert.Len(t, Shingles("one two"), 1, "Short texts become a single shingle")
+	assert.Len(t, Shingles("one two three four"), 2)
+
+	assert.Equal(t, Shingles("Hello, World again"), Shingles("hello world   AGAIN!"))
+	assert.Equal(t, Shingles("new text here"), Shingles("new text here\n> quoted reply text"))
+}
+
+// TestSimilarity tests that edits lower the estimate roughly in proportion
+func TestSimilarity(t *testing.T) {
+	a, ok := Compute(memo)
+	require.True(t, ok)
+
+	same, _ := Compute(strings.ToUpper(memo))
+	assert.Equal(t, 1.0, Similarity(a, same))
+
+	edited, _ := Compute(strings.Replace(memo, "Friday's board meeting", "Thursday's review", 1))
+	assert.Greater(t, Similarity(a, edited), 0.6)
+	assert.Less(t, Similarity(a, edited), 1.0)
+
+	other, _ := Compute("Lunch is moved to the cafeteria on the second floor starting next week.")
+	assert.Less(t, Similarity(a, other), 0.2)
+
+	_, ok = Compute("")
+	assert.False(t, ok)
+}
+
+// TestBands tests that near-identical signatures share a band
+func TestBands(t *testing.T) {
+	a, _ := Compute(memo)
+	edited, _ := Compute(memo + " Thanks.")
+
+	shared := 0
+	ba, be := Bands(a), Bands(edited)
+	for i := range ba {
+		if ba[i] == be[i] {
+			shared++
+		}
+	}
+	assert.Greater(t, shared, 0)
+	assert.Equal(t, ba, Bands(a), "Bands are deterministic")
+}
+
+// TestEncodeDecode tests signature serialization
+func TestEncodeDecode(t *testing.T) {
+	sig, _ := Compute(memo)
+	data := sig.Encode()
+	assert.Len(t, data, SignatureSize)
+
+	decoded, ok := Decode(data)
+	require.True(t, ok)
+	assert.Equal(t, sig, decoded)
+
+	_, ok = Decode(data[:10])
+	assert.False(t, ok)
+	_, ok = Decode(nil)
+	assert.False(t, ok)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -16,7 +18,10 @@ import (
 	"github.com/felo/eml-viewer/internal/config"
 	"github.com/felo/eml-viewer/internal/db"
 	"github.com/felo/eml-viewer/internal/handlers"
+	"github.com/felo/eml-viewer/internal/imapserver"
 	"github.com/felo/eml-viewer/internal/indexer"
+	"github.com/felo/eml-viewer/internal/parser"
+	"github.com/felo/eml-viewer/internal/scheduler"
 	"github.com/felo/eml-viewer/web"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -25,62 +30,75 @@ import (
 func main() {
 	// Load configuration
 	cfg := config.Default()
+	if err := cfg.LoadEnv(); err != nil {
+		log.Fatalf("Configuration failed: %v", err)
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Configuration validation failed: %v", err)
 	}
 
-	// Ensure database directory exists
-	dbDir := filepath.Dir(cfg.DBPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		log.Fatalf("Failed to create database directory: %v", err)
-	}
-
-	// Open database
-	database, err := db.Open(cfg.DBPath)
+	collections, err := cfg.LoadCollections()
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatalf("Failed to load collections: %v", err)
 	}
-	defer database.Close()
 
-	// Set emails path for resolving relative .eml file paths
-	database.SetEmailsPath(cfg.EmailsPath)
-
-	log.Printf("Database opened at: %s", cfg.DBPath)
-	log.Printf("Emails path configured: %s", cfg.EmailsPath)
-
-	// Check if emails directory exists
-	if _, err := os.Stat(cfg.EmailsPath); os.IsNotExist(err) {
-		log.Printf("Emails directory not found: %s", cfg.EmailsPath)
-		log.Printf("Creating directory...")
-		if err := os.MkdirAll(cfg.EmailsPath, 0755); err != nil {
-			log.Fatalf("Failed to create emails directory: %v", err)
+	// Run a CLI subcommand instead of the web server if one was given,
+	// against the collection named by -collection or the first one
+	args := os.Args[1:]
+	if len(args) > 1 && args[0] == "-collection" {
+		col := config.FindCollection(collections, args[1])
+		if col == nil {
+			log.Fatalf("Unknown collection %q", args[1])
 		}
-		log.Printf("Created emails directory at: %s", cfg.EmailsPath)
-		log.Printf("Please place your .eml files in this directory and restart the application")
+		cfg = cfg.ForCollection(*col)
+		args = args[2:]
 	} else {
-		// Index emails on startup
-		log.Printf("Indexing emails from: %s", cfg.EmailsPath)
-		idx := indexer.NewIndexer(database, cfg.EmailsPath, true)
-		result, err := idx.IndexAll()
-		if err != nil {
-			log.Printf("Warning: Indexing failed: %v", err)
-		} else {
-			log.Printf("Indexing complete: %d new, %d skipped, %d failed",
-				result.NewIndexed, result.Skipped, result.Failed)
+		cfg = cfg.ForCollection(collections[0])
+	}
+	if len(args) > 0 {
+		name := args[0]
+		if name == "help" || name == "-h" || name == "--help" {
+			printUsage(os.Stdout)
+			return
+		}
+		cmd := findCommand(name)
+		if cmd == nil {
+			printUsage(os.Stderr)
+			os.Exit(2)
+		}
+		if err := cmd.run(cfg, args[1:]); err != nil {
+			log.Fatalf("%s: %v", cmd.name, err)
+		}
+		return
+	}
+
+	// Open and index every collection before serving any
+	var opened []*db.DB
+	for _, col := range collections {
+		if len(collections) > 1 {
+			log.Printf("Opening collection %q", col.Name)
+		}
+		database, cancelled := openCollection(cfg.ForCollection(col))
+		defer database.Close()
+		if cancelled {
+			return
 		}
+		opened = append(opened, database)
 	}
 
 	// Create shutdown signal channel
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Initialize handlers with embedded templates
-	h := handlers.New(database, cfg)
-	h.SetShutdownChannel(sigChan)
-	if err := h.LoadTemplates(web.Assets); err != nil {
-		log.Fatalf("Failed to load templates: %v", err)
+	// Each collection has its own handlers, scan jobs and maintenance
+	set := handlers.NewCollections()
+	var servers []*collectionServer
+	for i, col := range collections {
+		cs := startCollection(cfg.ForCollection(col), opened[i], sigChan)
+		set.Add(col.Name, cs.handlers, collectionRoutes(cs.handlers))
+		servers = append(servers, cs)
 	}
 
 	// Set up router
@@ -91,27 +109,9 @@ func main() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
 	r.Use(securityHeadersMiddleware)
-	r.Use(h.AuthMiddleware)
-
-	// Routes
-	r.Get("/", h.Index)
-	r.Get("/email/{id}", h.ViewEmail)
-	r.Get("/email/{id}/html", h.ViewEmailHTML)
-	r.Get("/search", h.Search)
-	r.Get("/attachments/{id}/download", h.DownloadAttachment)
-	r.Post("/scan", h.Scan)
-	r.Get("/scan", h.ScanPage)
-	r.Get("/scan/progress", h.ScanProgressSSE)
-	r.Post("/shutdown", h.Shutdown)
-
-	// Autocomplete API endpoints for lazy-loading filter dropdowns
-	r.Get("/api/autocomplete/senders", h.AutocompleteSenders)
-	r.Get("/api/autocomplete/recipients", h.AutocompleteRecipients)
+	r.Use(servers[0].handlers.AuthMiddleware)
 
-	// Conversation/threading routes
-	r.Get("/threaded", h.ListThreaded)
-	r.Get("/conversation/{id}", h.ViewFullConversation)
-	r.Get("/conversation/{id}/thread", h.ViewConversationThread)
+	r.Post("/collections/switch", set.Switch)
 
 	// Static files from embedded assets
 	staticFS, err := fs.Sub(web.Assets, "static")
@@ -120,6 +120,9 @@ func main() {
 	}
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 
+	// Everything else is served by the chosen collection
+	r.Mount("/", set)
+
 	// Create server
 	srv := &http.Server{
 		Addr:         cfg.Address(),
@@ -137,6 +140,26 @@ func main() {
 		}
 	}()
 
+	// Optionally serve the collections read-only over IMAP too
+	var imapServer *imapserver.Server
+	if cfg.IMAPPort != "" {
+		sources := make([]imapserver.Source, len(collections))
+		for i, col := range collections {
+			sources[i] = imapserver.Source{Name: col.Name, DB: opened[i]}
+		}
+		imapServer = imapserver.New(sources, cfg.RequireAuth, cfg.AuthToken)
+		listener, err := net.Listen("tcp", cfg.IMAPAddress())
+		if err != nil {
+			log.Fatalf("Failed to start IMAP server: %v", err)
+		}
+		go func() {
+			log.Printf("Starting IMAP server on %s", cfg.IMAPAddress())
+			if err := imapServer.Serve(listener); err != nil {
+				log.Printf("IMAP server failed: %v", err)
+			}
+		}()
+	}
+
 	// Auto-open browser
 	time.Sleep(500 * time.Millisecond) // Give server time to start
 	if err := openBrowser(cfg.URL()); err != nil {
@@ -154,6 +177,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if imapServer != nil {
+		imapServer.Close()
+	}
+
+	// Let running scans and maintenance tasks finish before the databases close
+	for _, cs := range servers {
+		cs.stop(ctx)
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
@@ -161,6 +193,201 @@ func main() {
 	log.Println("Server stopped")
 }
 
+// openCollection opens a collection's database and indexes new emails in its
+// folder. It reports whether Ctrl-C cancelled the indexing.
+func openCollection(cfg *config.Config) (*db.DB, bool) {
+	// Ensure database directory exists
+	dbDir := filepath.Dir(cfg.DBPath)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		log.Fatalf("Failed to create database directory: %v", err)
+	}
+
+	// Open database
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+
+	// Set emails path for resolving relative .eml file paths
+	database.SetEmailsPath(cfg.EmailsPath)
+
+	// Scans still marked running were cut off by the last exit
+	if err := database.InterruptScanJobs(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	log.Printf("Database opened at: %s", cfg.DBPath)
+	log.Printf("Emails path configured: %s", cfg.EmailsPath)
+
+	// Check if emails directory exists
+	if _, err := os.Stat(cfg.EmailsPath); os.IsNotExist(err) {
+		log.Printf("Emails directory not found: %s", cfg.EmailsPath)
+		log.Printf("Creating directory...")
+		if err := os.MkdirAll(cfg.EmailsPath, 0755); err != nil {
+			log.Fatalf("Failed to create emails directory: %v", err)
+		}
+		log.Printf("Created emails directory at: %s", cfg.EmailsPath)
+		log.Printf("Please place your .eml files in this directory and restart the application")
+	} else {
+		// Index emails on startup
+		log.Printf("Indexing emails from: %s", cfg.EmailsPath)
+		keys, err := parser.LoadDKIMKeys(cfg.DKIMKeysPath)
+		if err != nil {
+			log.Printf("Warning: Failed to load DKIM keys: %v", err)
+		}
+		idx := indexer.NewIndexer(database, cfg.EmailsPath, true).
+			WithPIIScan(cfg.ScanPII).
+			WithDKIMKeys(keys)
+		// Ctrl-C during startup indexing stops it, keeping what was indexed
+		indexCtx, stopIndexing := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		result, err := idx.IndexAllContext(indexCtx)
+		stopIndexing()
+		if errors.Is(err, context.Canceled) {
+			if result != nil {
+				log.Printf("Indexing cancelled: %d new, %d skipped, %d failed",
+					result.NewIndexed, result.Skipped, result.Failed)
+			} else {
+				log.Printf("Indexing cancelled")
+			}
+			return database, true
+		} else if err != nil {
+			log.Printf("Warning: Indexing failed: %v", err)
+		} else {
+			log.Printf("Indexing complete: %d new, %d skipped, %d failed",
+				result.NewIndexed, result.Skipped, result.Failed)
+		}
+	}
+	return database, false
+}
+
+// collectionServer is a collection's handlers and background maintenance
+type collectionServer struct {
+	handlers      *handlers.Handlers
+	stopScheduler context.CancelFunc
+	schedDone     chan struct{}
+}
+
+// startCollection creates a collection's handlers and starts its scheduled
+// maintenance, and a re-parse of emails indexed by an older version
+func startCollection(cfg *config.Config, database *db.DB, sigChan chan os.Signal) *collectionServer {
+	// Initialize handlers with embedded templates
+	h := handlers.New(database, cfg)
+	h.SetShutdownChannel(sigChan)
+	if err := h.LoadTemplates(web.Assets); err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
+	}
+
+	// Run periodic scans and database maintenance in the background
+	sched := scheduler.New(database, scheduler.MaintenanceTasks(cfg, database, h.ScanJobs())...)
+	h.SetScheduler(sched)
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	schedDone := make(chan struct{})
+	go func() {
+		sched.Run(schedCtx)
+		close(schedDone)
+	}()
+
+	// Emails indexed by an older release are parsed again in the background
+	if stale, err := database.CountEmailsBelowParserVersion(indexer.ParserVersion); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if stale > 0 {
+		if job, err := h.ScanJobs().Reparse(); err != nil {
+			log.Printf("Warning: Failed to start re-parse: %v", err)
+		} else {
+			log.Printf("Re-parsing %d emails indexed by an older version (scan #%d)", stale, job.ID)
+		}
+	}
+
+	return &collectionServer{handlers: h, stopScheduler: stopScheduler, schedDone: schedDone}
+}
+
+// stop cancels the collection's scan and maintenance and waits for them to
+// stop or for ctx to expire, so the database is not closed under a write
+func (cs *collectionServer) stop(ctx context.Context) {
+	cs.stopScheduler()
+	if err := cs.handlers.StopScan(ctx); err != nil {
+		log.Printf("Scan did not stop in time: %v", err)
+	}
+	select {
+	case <-cs.schedDone:
+	case <-ctx.Done():
+		log.Printf("Maintenance task did not stop in time")
+	}
+}
+
+// collectionRoutes returns the routes serving one collection
+func collectionRoutes(h *handlers.Handlers) chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/", h.Index)
+	r.Get("/email/{id}", h.ViewEmail)
+	r.Get("/email/{id}/html", h.ViewEmailHTML)
+	r.Get("/email/{id}/similar", h.SimilarEmails)
+	r.Get("/email/{id}/redact", h.RedactPage)
+	r.Post("/email/{id}/redactions", h.AddRedaction)
+	r.Post("/email/{id}/redactions/accept", h.AcceptFindings)
+	r.Post("/email/{id}/redactions/{rid}/delete", h.DeleteRedaction)
+	r.Get("/email/{id}/redacted", h.DownloadRedacted)
+	r.Get("/search", h.Search)
+	r.Get("/export", h.Export)
+	r.Get("/duplicates", h.DuplicatesPage)
+	r.Get("/similar", h.SimilarPage)
+	r.Get("/analytics", h.AnalyticsPage)
+	r.Get("/network", h.NetworkPage)
+	r.Get("/network/export", h.ExportNetwork)
+	r.Get("/api/network", h.APINetwork)
+	r.Get("/contact/{address}", h.ContactPage)
+	r.Get("/api/contacts/{address}", h.APIContact)
+	r.Get("/api/response-times", h.APIResponseTimes)
+	r.Get("/api/threads/{id}/response-times", h.APIThreadResponseTimes)
+	r.Get("/sensitive", h.SensitiveDataPage)
+	r.Get("/api/sensitive", h.APISensitiveData)
+	r.Get("/api/emails/{id}/sensitive", h.APIEmailSensitiveData)
+	r.Get("/domains", h.DomainsPage)
+	r.Get("/api/domains", h.APIDomains)
+	r.Get("/api/emails/{id}/links", h.APIEmailLinks)
+	r.Get("/api/emails/{id}/auth", h.APIEmailAuth)
+	r.Get("/api/emails/{id}/hops", h.APIEmailHops)
+	r.Get("/productions", h.ProductionsPage)
+	r.Post("/productions", h.CreateProduction)
+	r.Get("/verify", h.VerifyPage)
+	r.Post("/verify", h.Verify)
+	r.Get("/verify/manifest", h.DownloadManifest)
+	r.Get("/api/verify", h.APIVerify)
+	r.Get("/attachments/{id}/download", h.DownloadAttachment)
+	r.Post("/scan", h.Scan)
+	r.Get("/scan", h.ScanPage)
+	r.Get("/scan/progress", h.ScanProgressSSE)
+	r.Post("/scan/cancel", h.CancelScan)
+	r.Post("/scan/reparse", h.ReparseScan)
+	r.Get("/scan/history", h.ScanHistory)
+	r.Get("/scan/{job}/progress", h.ScanJobProgressSSE)
+	r.Post("/scan/{job}/cancel", h.CancelScanJob)
+	r.Get("/problems", h.ProblemsPage)
+	r.Post("/problems/retry", h.RetryProblems)
+	r.Get("/health", h.Health)
+	r.Post("/shutdown", h.Shutdown)
+
+	// Autocomplete API endpoints for lazy-loading filter dropdowns
+	r.Get("/api/autocomplete/senders", h.AutocompleteSenders)
+	r.Get("/api/autocomplete/recipients", h.AutocompleteRecipients)
+
+	// Saved searches (smart folders)
+	r.Get("/saved-searches", h.ListSavedSearches)
+	r.Post("/saved-searches", h.CreateSavedSearch)
+	r.Post("/saved-searches/{id}/delete", h.DeleteSavedSearch)
+	r.Get("/saved/{id}", h.ViewSavedSearch)
+	r.Get("/api/saved-searches", h.APIListSavedSearches)
+	r.Get("/api/saved-searches/{id}", h.APIGetSavedSearch)
+
+	// Conversation/threading routes
+	r.Get("/threaded", h.ListThreaded)
+	r.Get("/conversation/{id}", h.ViewFullConversation)
+	r.Get("/conversation/{id}/thread", h.ViewConversationThread)
+
+	return r
+}
+
 // securityHeadersMiddleware adds security headers to all responses
 func securityHeadersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
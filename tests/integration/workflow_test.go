@@ -1,11 +1,13 @@
 package integration
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/felo/eml-viewer/internal/db"
 	"github.com/felo/eml-viewer/internal/indexer"
@@ -453,3 +455,302 @@ func copyFile(src, dst string) error {
 	_, err = io.Copy(destFile, sourceFile)
 	return err
 }
+
+// TestWorkflow_PIIScan tests the sensitive data scan during indexing and as a later pass
+func TestWorkflow_PIIScan(t *testing.T) {
+	tempDir := t.TempDir()
+
+	withCard := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Payment\r\n" +
+		"Message-ID: <card@example.com>\r\nDate: Mon, 6 May 2024 09:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nPlease charge 4111 1111 1111 1111 today.\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=\"creds.txt\"\r\n\r\n" +
+		"password: hunter2!\r\n--b--\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "card.eml"), []byte(withCard), 0644))
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+	testDB.SetEmailsPath(tempDir)
+
+	// Indexing with the scan enabled stores findings right away
+	_, err = indexer.NewIndexer(testDB, tempDir, false).WithPIIScan(true).IndexAll()
+	require.NoError(t, err)
+
+	emails, err := testDB.ListEmails(10, 0)
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+
+	findings, err := testDB.GetPIIFindings(emails[0].ID)
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	assert.Equal(t, "password", findings[0].Type)
+	assert.Equal(t, "creds.txt", findings[0].AttachmentFilename)
+	assert.Equal(t, "credit_card", findings[1].Type)
+	assert.Equal(t, "**** **** **** 1111", findings[1].Masked)
+
+	content, err := testDB.GetEmailWithFullContent(emails[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "4111 1111 1111 1111", content.BodyText[findings[1].Start:findings[1].End],
+		"Offsets point into the body shown on the email page")
+
+	// Emails indexed without the scan are picked up by a later pass
+	clean := "From: carol@example.com\r\nTo: bob@example.com\r\nSubject: Lunch\r\n" +
+		"Date: Tue, 7 May 2024 12:00:00 +0000\r\n\r\nCall me on +44 20 7946 0958.\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "phone.eml"), []byte(clean), 0644))
+	idx := indexer.NewIndexer(testDB, tempDir, false)
+	_, err = idx.IndexAll()
+	require.NoError(t, err)
+
+	result, err := idx.ScanSensitiveData(false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Scanned)
+	assert.Equal(t, 1, result.Flagged)
+
+	result, err = idx.ScanSensitiveData(true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Scanned)
+	assert.Equal(t, 3, result.Findings)
+}
+
+// TestWorkflow_Links tests that indexing stores the links in email bodies
+func TestWorkflow_Links(t *testing.T) {
+	tempDir := t.TempDir()
+
+	phish := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Account notice\r\n" +
+		"Date: Mon, 6 May 2024 09:00:00 +0000\r\nMIME-Version: 1.0\r\nContent-Type: text/html\r\n\r\n" +
+		"<p>Sign in at <a href=\"https://evil.example.net/login\">https://mybank.com</a></p>\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "phish.eml"), []byte(phish), 0644))
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+	testDB.SetEmailsPath(tempDir)
+
+	_, err = indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+
+	domains, err := testDB.GetLinkedDomains(db.SearchFilters{})
+	require.NoError(t, err)
+	require.Len(t, domains, 1)
+	assert.Equal(t, "evil.example.net", domains[0].Domain)
+	assert.Equal(t, 1, domains[0].Mismatched)
+
+	count, err := testDB.CountFiltered(db.SearchFilters{Domain: "example.net"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestWorkflow_AuthVerdict tests that indexing records the authentication
+// verdict for the auth filter
+func TestWorkflow_AuthVerdict(t *testing.T) {
+	tempDir := t.TempDir()
+
+	write := func(name, results string) {
+		content := "Authentication-Results: mx.example.com; " + results + "\r\n" +
+			"From: alice@example.com\r\nTo: bob@example.com\r\nSubject: " + name + "\r\n" +
+			"Date: Mon, 6 May 2024 09:00:00 +0000\r\n\r\nHello\r\n"
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name+".eml"), []byte(content), 0644))
+	}
+	write("genuine", "spf=pass smtp.mailfrom=example.com; dmarc=pass header.from=example.com")
+	write("spoofed", "spf=fail smtp.mailfrom=example.com; dmarc=fail header.from=example.com")
+	write("unknown", "none")
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+	testDB.SetEmailsPath(tempDir)
+
+	_, err = indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+
+	for verdict, subject := range map[string]string{"pass": "genuine", "fail": "spoofed", "none": "unknown"} {
+		results, err := testDB.SearchFiltered(db.SearchFilters{Auth: verdict}, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, results, 1, verdict)
+		assert.Equal(t, subject, results[0].Subject)
+	}
+}
+
+// TestWorkflow_DateFallback tests that undated emails are dated by their file
+// and marked uncertain instead of taking the indexing time
+func TestWorkflow_DateFallback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	path := filepath.Join(tempDir, "undated.eml")
+	require.NoError(t, os.WriteFile(path, []byte("From: alice@example.com\r\nSubject: Undated\r\n\r\nHello\r\n"), 0644))
+	mtime := time.Date(2021, 6, 15, 8, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+	testDB.SetEmailsPath(tempDir)
+
+	_, err = indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+
+	results, err := testDB.SearchFiltered(db.SearchFilters{DateUncertain: true}, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, parser.DateSourceFile, results[0].DateSource)
+	assert.True(t, mtime.Equal(results[0].GetDate()))
+}
+
+// TestWorkflow_CancelIndexing tests that a cancelled run keeps the emails it
+// wrote and that the next run indexes the rest
+func TestWorkflow_CancelIndexing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	numEmails := 20
+	for i := 1; i <= numEmails; i++ {
+		content := fmt.Sprintf("From: sender%d@test.com\r\nSubject: Cancel Test %d\r\nDate: Mon, 1 Jan 2024 10:00:00 +0000\r\n\r\nBody %d\r\n", i, i, i)
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, fmt.Sprintf("cancel%d.eml", i)), []byte(content), 0644))
+	}
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	idx := indexer.NewIndexer(testDB, tempDir, false).WithConcurrency(1)
+	result, err := idx.IndexWithProgressContext(ctx, func(current, total int, filePath string) {
+		if current == 3 {
+			cancel()
+		}
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	assert.GreaterOrEqual(t, result.NewIndexed, 3)
+	assert.Less(t, result.NewIndexed, numEmails)
+
+	count, err := testDB.CountEmails()
+	require.NoError(t, err)
+	assert.Equal(t, result.NewIndexed, count, "Whole batches should be written")
+
+	result2, err := indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+	assert.Equal(t, numEmails-count, result2.NewIndexed)
+	assert.Equal(t, count, result2.Skipped)
+
+	// A context cancelled before starting stops during the directory walk
+	_, err = indexer.NewIndexer(testDB, tempDir, false).IndexAllContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestWorkflow_IndexErrors tests that failures are recorded by category and
+// cleared once the file indexes or leaves the folder
+func TestWorkflow_IndexErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	charsetPath := filepath.Join(tempDir, "charset.eml")
+	require.NoError(t, os.WriteFile(charsetPath, []byte("From: a@test.com\r\nSubject: Charset\r\nContent-Type: text/plain; charset=x-bogus\r\n\r\nHi\r\n"), 0644))
+	garbagePath := filepath.Join(tempDir, "garbage.eml")
+	require.NoError(t, os.WriteFile(garbagePath, []byte("not an email at all"), 0644))
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+
+	result, err := indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, indexer.FailCharset, result.Errors["charset.eml"].Category)
+	assert.Equal(t, indexer.FailMalformed, result.Errors["garbage.eml"].Category)
+
+	errs, err := testDB.ListIndexErrors()
+	require.NoError(t, err)
+	require.Len(t, errs, 2)
+
+	// Fixing one file and removing the other clears both on the next scan
+	require.NoError(t, os.WriteFile(charsetPath, []byte("From: a@test.com\r\nSubject: Charset\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nHi\r\n"), 0644))
+	require.NoError(t, os.Remove(garbagePath))
+	result, err = indexer.NewIndexer(testDB, tempDir, false).IndexAll()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.NewIndexed)
+
+	count, err := testDB.CountIndexErrors()
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// TestWorkflow_Reparse tests that emails indexed by an older parser version
+// are parsed again in place, keeping their IDs and file hash
+func TestWorkflow_Reparse(t *testing.T) {
+	tempDir := t.TempDir()
+	content := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Invoice\r\n" +
+		"Date: Mon, 6 May 2024 09:00:00 +0000\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"b\"\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n" +
+		"--b\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=\"invoice.txt\"\r\n\r\n" +
+		"Total: 10\r\n--b--\r\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "invoice.eml"), []byte(content), 0644))
+
+	testDB, err := db.Open(":memory:")
+	require.NoError(t, err)
+	defer testDB.Close()
+	testDB.SetEmailsPath(tempDir)
+
+	idx := indexer.NewIndexer(testDB, tempDir, false)
+	_, err = idx.IndexAll()
+	require.NoError(t, err)
+
+	emails, err := testDB.ListEmails(10, 0)
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+	original, err := testDB.GetEmailByID(emails[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, indexer.ParserVersion, original.ParserVersion)
+	attachments, err := testDB.GetAttachmentsByEmailID(original.ID)
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+
+	require.NoError(t, testDB.AddRedaction(&db.Redaction{EmailID: original.ID, Source: db.PIISourceBody, Start: 4, End: 12}))
+
+	// Simulate rows written by an older release, which recorded no body hash
+	_, err = testDB.Exec("UPDATE emails SET parser_version = 0, subject = 'Inv?ice', attachment_count = 0, body_hash = NULL")
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE attachments SET sha256 = 'old'")
+	require.NoError(t, err)
+	stale, err := testDB.CountEmailsBelowParserVersion(indexer.ParserVersion)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stale)
+
+	var calls int
+	result, err := idx.ReparseContext(context.Background(), func(current, total int, filePath string) {
+		calls++
+		assert.Equal(t, 1, total)
+		assert.Equal(t, "invoice.eml", filePath)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.NewIndexed)
+	assert.Equal(t, 1, calls)
+
+	email, err := testDB.GetEmailByID(original.ID)
+	require.NoError(t, err)
+	require.NotNil(t, email)
+	assert.Equal(t, "Invoice", email.Subject)
+	assert.Equal(t, 1, email.AttachmentCount)
+	assert.Equal(t, indexer.ParserVersion, email.ParserVersion)
+	assert.Equal(t, original.SHA256, email.SHA256, "File hash recorded at intake is kept")
+
+	var matches int
+	require.NoError(t, testDB.QueryRow("SELECT COUNT(*) FROM emails_fts WHERE emails_fts MATCH 'invoice'").Scan(&matches))
+	assert.Equal(t, 1, matches, "Search index follows the corrected subject")
+
+	reparsed, err := testDB.GetAttachmentsByEmailID(original.ID)
+	require.NoError(t, err)
+	require.Len(t, reparsed, 1)
+	assert.Equal(t, attachments[0].ID, reparsed[0].ID, "Attachment keeps its ID")
+	assert.Equal(t, "invoice.txt", reparsed[0].Filename)
+	assert.Equal(t, attachments[0].SHA256, reparsed[0].SHA256, "Attachment hash is taken from the new parse")
+
+	redactions, err := testDB.GetRedactions(original.ID)
+	require.NoError(t, err)
+	require.Len(t, redactions, 1)
+	assert.True(t, redactions[0].Stale, "Without a recorded body hash, redactions need checking")
+
+	// Nothing is left to re-parse
+	result, err = idx.ReparseContext(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.TotalFound)
+}